@@ -3,8 +3,16 @@ module hashtags_search
 go 1.23.0
 
 require (
-	github.com/KaranJagtiani/go-logstash v1.0.2 
-	github.com/gorilla/websocket v1.5.3 
-	github.com/joho/godotenv v1.5.1 
-	github.com/lib/pq v1.10.9 
-)
\ No newline at end of file
+	github.com/KaranJagtiani/go-logstash v1.0.2
+	github.com/gorilla/websocket v1.5.3
+	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
+	shared v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/vmihailenco/msgpack/v5 v5.4.1 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+)
+
+replace shared => ../shared
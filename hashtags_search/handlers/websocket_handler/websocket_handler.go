@@ -7,6 +7,10 @@ import (
 
 	"github.com/gorilla/websocket"
 	"hashtags_search/controllers/hashtag_controller"
+	"shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
+	"shared/ratelimit"
 )
 
 // Message represents the structure of incoming WebSocket messages.
@@ -16,37 +20,71 @@ type Message struct {
 
 // WebSocketHandler manages WebSocket connections and message handling.
 type WebSocketHandler struct {
-	upgrader websocket.Upgrader
-	dbCtrl   hashtagcontroller.HashtagProvider
+	upgrader      websocket.Upgrader
+	dbCtrl        hashtagcontroller.HashtagProvider
+	Authenticator *auth.Authenticator // Verifies the handshake token; nil accepts unauthenticated clients.
+	Lifecycle     lifecycle.Config    // Heartbeat, deadline and frame size settings applied to every connection.
+	RateLimiter   *ratelimit.Limiter  // Limits queries per user (or remote IP); nil disables limiting.
 }
 
 // NewWebSocketHandler initializes a new WebSocket handler with the given database controller.
 func NewWebSocketHandler(dbCtrl hashtagcontroller.HashtagProvider) *WebSocketHandler {
 	return &WebSocketHandler{
-		upgrader: websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
-		dbCtrl:   dbCtrl,
+		upgrader:    websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }},
+		dbCtrl:      dbCtrl,
+		Lifecycle:   lifecycle.DefaultConfig(),
+		RateLimiter: ratelimit.NewLimiter(ratelimit.DefaultQueryLimits()),
 	}
 }
 
-
 // ServeHTTP upgrades an HTTP connection to a WebSocket and processes messages.
+// When an Authenticator is configured, handshakes without a valid token are rejected.
 func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	conn, err := wsh.upgrader.Upgrade(w, r, nil)
+	var callerID int
+	if wsh.Authenticator != nil {
+		var err error
+		if callerID, err = wsh.Authenticator.Authenticate(r); err != nil {
+			log.Printf("Rejected unauthenticated connection: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	ws, err := wsh.upgrader.Upgrade(w, r, codec.Negotiate(r))
 	if err != nil {
 		log.Printf("WebSocket upgrade error: %v", err)
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+
+	// Ping the client and stop reading once it no longer answers.
+	heartbeat := lifecycle.Start(ws, wsh.Lifecycle)
+	defer heartbeat.Stop()
+
+	// Replies are encoded in the format negotiated through Sec-WebSocket-Protocol (JSON by default).
+	conn := codec.Wrap(ws)
+	conn.WriteTimeout = wsh.Lifecycle.WriteTimeout
+
+	// Queries are rate limited per authenticated user, or per remote IP for anonymous connections.
+	key := ratelimit.Key(callerID, r)
 
 	for {
-		msgType, msgData, err := conn.ReadMessage()
+		_, msgData, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Error reading WebSocket message: %v", err)
 			break
 		}
 
+		// Reject queries over the rate limit, and disconnect callers that keep exceeding it.
+		if decision := ratelimit.LimitQuery(wsh.RateLimiter, conn, heartbeat, key); !decision.Allowed {
+			if decision.Disconnect {
+				break
+			}
+			continue
+		}
+
 		var msg Message
-		if err := json.Unmarshal(msgData, &msg); err != nil {
+		if err := conn.Codec.Unmarshal(msgData, &msg); err != nil {
 			log.Printf("Error parsing JSON message: %v", err)
 			continue
 		}
@@ -59,7 +97,7 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 		log.Printf("Received query: %s; Responding with: %s", msg.Query, string(jsonData))
 
-		if err := conn.WriteMessage(msgType, jsonData); err != nil {
+		if err := conn.WriteJSON(json.RawMessage(jsonData)); err != nil {
 			log.Printf("Error sending WebSocket message: %v", err)
 			break
 		}
@@ -6,9 +6,12 @@ import (
 
 	"hashtags_search/controllers/base_controller"
 	"hashtags_search/controllers/hashtag_controller"
+	"hashtags_search/handlers/websocket_handler"
 	"hashtags_search/modules/database/database_pool"
 	"hashtags_search/server"
-	"hashtags_search/handlers/websocket_handler"
+	"shared/auth"
+	"shared/lifecycle"
+	"shared/ratelimit"
 )
 
 // main initializes the database, sets up controllers, registers routes, and starts the HTTP server.
@@ -22,8 +25,17 @@ func main() {
 	baseCtrl := basecontroller.BaseController{Database: dbPool.GetDb()}
 	getDbCtrl := hashtagcontroller.HashtagController{BaseController: baseCtrl}
 
+	// Load the token verification settings for the WebSocket handshake.
+	authConfig, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading auth config: %v", err)
+	}
+
 	// Create WebSocket handler for real-time communication.
 	wsHandler := websockethandler.NewWebSocketHandler(&getDbCtrl)
+	wsHandler.Authenticator = auth.NewAuthenticator(authConfig)
+	wsHandler.Lifecycle = lifecycle.LoadConfig()
+	wsHandler.RateLimiter = ratelimit.NewLimiter(ratelimit.LoadConfig(ratelimit.DefaultQueryLimits()))
 
 	// Register HTTP routes.
 	http.Handle("/", wsHandler)
@@ -50,7 +50,7 @@ func TestServerShutdown(t *testing.T) {
 	// Start server in a separate goroutine.
 	go func() {
 		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			t.Fatalf("Server error: %v", err)
+			t.Errorf("Server error: %v", err)
 		}
 	}()
 
@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"hashtags_search/handlers/websocket_handler"
+	"shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
+	"shared/ratelimit"
 )
 
 // MockHashtagController is a mock implementation of the HashtagController interface for testing purposes.
@@ -74,3 +79,134 @@ func TestWebSocketHandler(t *testing.T) {
 		t.Errorf("Unexpected response: %s", string(response))
 	}
 }
+
+// TestWebSocketHandler_RequiresToken verifies that, with an Authenticator configured,
+// the handshake is rejected without a token and accepted with a correctly signed one.
+func TestWebSocketHandler_RequiresToken(t *testing.T) {
+	config := &auth.Config{Secret: []byte("test-secret")}
+	wsh := websockethandler.NewWebSocketHandler(&MockHashtagController{})
+	wsh.Authenticator = auth.NewAuthenticator(config)
+
+	ts := httptest.NewServer(http.HandlerFunc(wsh.ServeHTTP))
+	defer ts.Close()
+	wsURL := "ws" + ts.URL[4:]
+
+	if _, resp, err := websocket.DefaultDialer.Dial(wsURL, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 for handshake without token, got %v", err)
+	}
+
+	token, _ := auth.SignToken(auth.Claims{UserId: 1, ExpiresAt: time.Now().Add(time.Hour).Unix()}, config.Secret)
+	wsConn, _, err := websocket.DefaultDialer.Dial(wsURL+"?token="+token, nil)
+	if err != nil {
+		t.Fatalf("Expected authenticated handshake to succeed: %v", err)
+	}
+	wsConn.Close()
+}
+
+// TestWebSocketHandler_Msgpack verifies that a client negotiating msgpack.v1 can send its query
+// as a binary MessagePack frame and receives the response in the same format.
+func TestWebSocketHandler_Msgpack(t *testing.T) {
+	wsh := websockethandler.NewWebSocketHandler(&MockHashtagController{})
+	ts := httptest.NewServer(http.HandlerFunc(wsh.ServeHTTP))
+	defer ts.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{codec.MsgpackSubprotocol}}
+	wsConn, _, err := dialer.Dial("ws"+ts.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("WebSocket connection error: %v", err)
+	}
+	defer wsConn.Close()
+	if wsConn.Subprotocol() != codec.MsgpackSubprotocol {
+		t.Fatalf("Expected %q to be negotiated, got %q", codec.MsgpackSubprotocol, wsConn.Subprotocol())
+	}
+
+	messageBytes, _ := codec.Msgpack.Marshal(websockethandler.Message{Query: "example"})
+	if err := wsConn.WriteMessage(websocket.BinaryMessage, messageBytes); err != nil {
+		t.Fatalf("Error sending WebSocket message: %v", err)
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	messageType, response, err := wsConn.ReadMessage()
+	if err != nil {
+		t.Fatalf("Error reading WebSocket response: %v", err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Errorf("Expected a binary frame, got type %d", messageType)
+	}
+
+	var parsedResponse []map[string]interface{}
+	if err := codec.Msgpack.Unmarshal(response, &parsedResponse); err != nil {
+		t.Fatalf("Error decoding msgpack response: %v", err)
+	}
+	if len(parsedResponse) == 0 || parsedResponse[0]["name"] != "example" {
+		t.Errorf("Unexpected response: %v", parsedResponse)
+	}
+}
+
+// TestWebSocketHandler_MaxMessageSize verifies that frames above the configured size limit
+// make the server close the connection.
+func TestWebSocketHandler_MaxMessageSize(t *testing.T) {
+	wsh := websockethandler.NewWebSocketHandler(&MockHashtagController{})
+	wsh.Lifecycle = lifecycle.Config{MaxMessageSize: 64}
+	ts := httptest.NewServer(http.HandlerFunc(wsh.ServeHTTP))
+	defer ts.Close()
+
+	wsConn, _, err := websocket.DefaultDialer.Dial("ws"+ts.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("WebSocket connection error: %v", err)
+	}
+	defer wsConn.Close()
+
+	messageBytes, _ := json.Marshal(websockethandler.Message{Query: strings.Repeat("x", 128)})
+	if err := wsConn.WriteMessage(websocket.TextMessage, messageBytes); err != nil {
+		t.Fatalf("Error sending WebSocket message: %v", err)
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := wsConn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Expected the connection to be closed with %d, got %v", websocket.CloseMessageTooBig, err)
+	}
+}
+
+// TestWebSocketHandler_RateLimited verifies that queries over the limit are answered with a
+// rate_limited error frame carrying a retry-after value, and that repeat offenders are disconnected.
+func TestWebSocketHandler_RateLimited(t *testing.T) {
+	wsh := websockethandler.NewWebSocketHandler(&MockHashtagController{})
+	wsh.RateLimiter = ratelimit.NewLimiter(ratelimit.Config{
+		Rules:           map[string]ratelimit.Rule{ratelimit.QueryFrameType: {Rate: 0.001, Burst: 1}},
+		MaxViolations:   2,
+		ViolationWindow: time.Minute,
+	})
+	ts := httptest.NewServer(http.HandlerFunc(wsh.ServeHTTP))
+	defer ts.Close()
+
+	wsConn, _, err := websocket.DefaultDialer.Dial("ws"+ts.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("WebSocket connection error: %v", err)
+	}
+	defer wsConn.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := wsConn.WriteJSON(websockethandler.Message{Query: "example"}); err != nil {
+			t.Fatalf("Error sending WebSocket message: %v", err)
+		}
+		wsConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, response, err := wsConn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Error reading WebSocket response %d: %v", i+1, err)
+		}
+		if i == 0 {
+			continue // The first query fits in the burst and is answered normally.
+		}
+
+		var frame ratelimit.ErrorFrame
+		if err := json.Unmarshal(response, &frame); err != nil || frame.Error.Code != "rate_limited" || frame.Error.RetryAfterMs <= 0 {
+			t.Errorf("Expected a rate_limited error frame for query %d, got %s", i+1, response)
+		}
+	}
+
+	wsConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := wsConn.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("Expected the repeat offender to be disconnected with %d, got %v", websocket.ClosePolicyViolation, err)
+	}
+}
@@ -0,0 +1,112 @@
+package mediacontroller
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings of the media service.
+type Config struct {
+	Secret        []byte        // HMAC key the presigned URLs are signed with.
+	ServiceToken  string        // Token the other services send with their lookups.
+	PublicURL     string        // Base URL clients reach the service at; presigned URLs start with it.
+	StorageDir    string        // Directory the blobs are stored in.
+	DownloadTTL   time.Duration // How long a presigned download URL works.
+	UploadTTL     time.Duration // How long a presigned upload URL works.
+	MaxUploadSize int64         // Largest accepted upload, in bytes.
+	ListenAddrs   []string      // Addresses the service listens on.
+}
+
+// DefaultConfig returns the built-in settings, without a signing key. The service listens on
+// both addresses the other services look media up at: avatars on 8165 and place photos on 8170.
+//
+// Returns:
+//   - The default Config.
+func DefaultConfig() Config {
+	return Config{
+		PublicURL:     "http://127.0.0.1:8165",
+		StorageDir:    "media",
+		DownloadTTL:   15 * time.Minute,
+		UploadTTL:     10 * time.Minute,
+		MaxUploadSize: 10 << 20,
+		ListenAddrs:   []string{"127.0.0.1:8165", "127.0.0.1:8170"},
+	}
+}
+
+// LoadConfig reads the media service settings from environment variables:
+//   - MEDIA_SIGNING_SECRET: the HMAC key of the presigned URLs (required).
+//   - MEDIA_SERVICE_TOKEN: the token the other services send with their lookups (required).
+//   - MEDIA_PUBLIC_URL: the base URL of the presigned URLs.
+//   - MEDIA_STORAGE_DIR: the directory the blobs are stored in.
+//   - MEDIA_DOWNLOAD_TTL_SECONDS, MEDIA_UPLOAD_TTL_SECONDS: how long the URLs work.
+//   - MEDIA_MAX_UPLOAD_BYTES: the largest accepted upload.
+//   - MEDIA_LISTEN_ADDRS: comma-separated addresses to listen on.
+//
+// Returns:
+//   - The loaded Config.
+//   - An error if MEDIA_SIGNING_SECRET or MEDIA_SERVICE_TOKEN is missing or a setting is malformed.
+func LoadConfig() (Config, error) {
+	config := DefaultConfig()
+
+	secret := os.Getenv("MEDIA_SIGNING_SECRET")
+	if secret == "" {
+		return Config{}, fmt.Errorf("MEDIA_SIGNING_SECRET is not set")
+	}
+	config.Secret = []byte(secret)
+
+	config.ServiceToken = os.Getenv("MEDIA_SERVICE_TOKEN")
+	if config.ServiceToken == "" {
+		return Config{}, fmt.Errorf("MEDIA_SERVICE_TOKEN is not set")
+	}
+
+	if raw := os.Getenv("MEDIA_PUBLIC_URL"); raw != "" {
+		config.PublicURL = strings.TrimRight(raw, "/")
+	}
+	if raw := os.Getenv("MEDIA_STORAGE_DIR"); raw != "" {
+		config.StorageDir = raw
+	}
+	if raw := os.Getenv("MEDIA_LISTEN_ADDRS"); raw != "" {
+		config.ListenAddrs = nil
+		for _, addr := range strings.Split(raw, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				config.ListenAddrs = append(config.ListenAddrs, addr)
+			}
+		}
+		if len(config.ListenAddrs) == 0 {
+			return Config{}, fmt.Errorf("invalid MEDIA_LISTEN_ADDRS: %q", raw)
+		}
+	}
+
+	var err error
+	if config.DownloadTTL, err = durationFromEnv("MEDIA_DOWNLOAD_TTL_SECONDS", config.DownloadTTL); err != nil {
+		return Config{}, err
+	}
+	if config.UploadTTL, err = durationFromEnv("MEDIA_UPLOAD_TTL_SECONDS", config.UploadTTL); err != nil {
+		return Config{}, err
+	}
+	if raw := os.Getenv("MEDIA_MAX_UPLOAD_BYTES"); raw != "" {
+		size, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || size <= 0 {
+			return Config{}, fmt.Errorf("invalid MEDIA_MAX_UPLOAD_BYTES: %q", raw)
+		}
+		config.MaxUploadSize = size
+	}
+	return config, nil
+}
+
+// durationFromEnv reads a positive number of seconds from an environment variable,
+// falling back to the given default when it is unset.
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	seconds, err := strconv.Atoi(raw)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, raw)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
@@ -0,0 +1,239 @@
+package mediacontroller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	Response "media_service/models/presigned_url"
+	"media_service/modules/signer"
+	"media_service/modules/storage"
+)
+
+// MediaPath is the path below which the blobs are downloaded and uploaded.
+const MediaPath = "/media/"
+
+// attachmentsPrefix starts the keys of message attachments.
+const attachmentsPrefix = "attachments/"
+
+// MediaController issues presigned URLs for the avatars of users, the photos of places and
+// the attachments of chat messages, and reads and writes their blobs.
+//
+// Avatars are stored under "avatars/<user_id>", one per user. Place photos are stored under
+// "places/<place_id>/<random name>", any number per place. Attachments are stored under
+// "attachments/<user_id>/<random name>", keyed by the user who uploaded them.
+type MediaController struct {
+	Storage storage.Storage // Keeps the blobs
+	Signer  *signer.Signer  // Signs and verifies the presigned URLs
+	Config  Config          // URL lifetimes, upload limit and public URL
+	now     func() time.Time
+}
+
+// NewMediaController creates a MediaController.
+//
+// Parameters:
+//   - store: The storage of the blobs.
+//   - config: The service settings; Config.Secret signs the URLs.
+//
+// Returns:
+//   - A pointer to the MediaController.
+func NewMediaController(store storage.Storage, config Config) *MediaController {
+	return &MediaController{
+		Storage: store,
+		Signer:  signer.New(config.Secret),
+		Config:  config,
+		now:     time.Now,
+	}
+}
+
+// AvatarURL returns a presigned download URL of a user's avatar.
+//
+// Parameters:
+//   - ctx: Bounds the storage lookup.
+//   - userId: ID of the user.
+//
+// Returns:
+//   - The presigned URL; empty if the user has no avatar.
+//   - An error if the storage cannot be read.
+func (mc *MediaController) AvatarURL(ctx context.Context, userId int) (string, error) {
+	return mc.objectURL(ctx, AvatarKey(userId))
+}
+
+// AttachmentURL returns a presigned download URL of a message attachment.
+//
+// Parameters:
+//   - ctx: Bounds the storage lookup.
+//   - mediaId: The key the attachment was uploaded under.
+//
+// Returns:
+//   - The presigned URL; empty if no such attachment exists.
+//   - An error if the storage cannot be read.
+func (mc *MediaController) AttachmentURL(ctx context.Context, mediaId string) (string, error) {
+	if !strings.HasPrefix(mediaId, attachmentsPrefix) {
+		return "", nil
+	}
+	return mc.objectURL(ctx, mediaId)
+}
+
+// PlaceMediaURLs returns presigned download URLs of a place's photos, ordered by key.
+//
+// Parameters:
+//   - ctx: Bounds the storage lookup.
+//   - placeId: ID of the place.
+//
+// Returns:
+//   - The presigned URLs; empty if the place has no photos.
+//   - An error if the storage cannot be read.
+func (mc *MediaController) PlaceMediaURLs(ctx context.Context, placeId int) ([]string, error) {
+	objects, err := mc.Storage.List(ctx, fmt.Sprintf("places/%d/", placeId))
+	if err != nil {
+		return nil, fmt.Errorf("error listing place media: %w", err)
+	}
+	urls := make([]string, 0, len(objects))
+	for _, object := range objects {
+		urls = append(urls, mc.DownloadURL(object.Key))
+	}
+	return urls, nil
+}
+
+// AvatarUploadURL issues a presigned URL to upload a user's avatar, replacing the current one.
+//
+// Parameters:
+//   - userId: ID of the user.
+//
+// Returns:
+//   - The upload URL, the key of the avatar and when the URL expires.
+func (mc *MediaController) AvatarUploadURL(userId int) Response.UploadUrlResponse {
+	return mc.uploadURL(AvatarKey(userId))
+}
+
+// PlaceUploadURL issues a presigned URL to upload a new photo of a place.
+//
+// Parameters:
+//   - placeId: ID of the place.
+//
+// Returns:
+//   - The upload URL, the key of the new photo and when the URL expires.
+//   - An error if no name can be generated for the photo.
+func (mc *MediaController) PlaceUploadURL(placeId int) (Response.UploadUrlResponse, error) {
+	name, err := randomName()
+	if err != nil {
+		return Response.UploadUrlResponse{}, err
+	}
+	return mc.uploadURL(fmt.Sprintf("places/%d/%s", placeId, name)), nil
+}
+
+// AttachmentUploadURL issues a presigned URL to upload a new attachment. The key of the
+// upload is the media ID messages reference the attachment by.
+//
+// Parameters:
+//   - userId: ID of the uploading user.
+//
+// Returns:
+//   - The upload URL, the key of the new attachment and when the URL expires.
+//   - An error if no name can be generated for the attachment.
+func (mc *MediaController) AttachmentUploadURL(userId int) (Response.UploadUrlResponse, error) {
+	name, err := randomName()
+	if err != nil {
+		return Response.UploadUrlResponse{}, err
+	}
+	return mc.uploadURL(fmt.Sprintf("%s%d/%s", attachmentsPrefix, userId, name)), nil
+}
+
+// DownloadURL returns a presigned URL to download the object stored under the key,
+// valid for Config.DownloadTTL.
+//
+// Parameters:
+//   - key: The key of the object.
+//
+// Returns:
+//   - The presigned URL.
+func (mc *MediaController) DownloadURL(key string) string {
+	return mc.presign(http.MethodGet, key, mc.now().Add(mc.Config.DownloadTTL))
+}
+
+// Open verifies a download request and opens the requested object.
+//
+// Parameters:
+//   - r: The download request; its query carries the signature.
+//   - key: The key of the object, taken from the request's path.
+//
+// Returns:
+//   - The content and description of the object.
+//   - signer.ErrInvalidSignature or signer.ErrExpired if the request is not allowed,
+//     storage.ErrNotFound if no such object exists, or a storage error.
+func (mc *MediaController) Open(r *http.Request, key string) (storage.Blob, storage.Object, error) {
+	if err := mc.Signer.Verify(r.Method, key, r.URL.Query()); err != nil {
+		return nil, storage.Object{}, err
+	}
+	return mc.Storage.Open(r.Context(), key)
+}
+
+// Put verifies an upload request and stores its body, up to Config.MaxUploadSize bytes.
+//
+// Parameters:
+//   - w: The response writer, used to limit the body.
+//   - r: The upload request; its query carries the signature.
+//   - key: The key of the object, taken from the request's path.
+//
+// Returns:
+//   - The description of the stored object.
+//   - signer.ErrInvalidSignature or signer.ErrExpired if the request is not allowed,
+//     an *http.MaxBytesError if the body is too large, or a storage error.
+func (mc *MediaController) Put(w http.ResponseWriter, r *http.Request, key string) (storage.Object, error) {
+	if err := mc.Signer.Verify(r.Method, key, r.URL.Query()); err != nil {
+		return storage.Object{}, err
+	}
+	body := http.MaxBytesReader(w, r.Body, mc.Config.MaxUploadSize)
+	return mc.Storage.Put(r.Context(), key, body)
+}
+
+// objectURL returns a presigned download URL of the object stored under the key,
+// or an empty URL if there is none.
+func (mc *MediaController) objectURL(ctx context.Context, key string) (string, error) {
+	blob, object, err := mc.Storage.Open(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error looking up %s: %w", key, err)
+	}
+	blob.Close()
+	return mc.DownloadURL(object.Key), nil
+}
+
+// AvatarKey returns the key a user's avatar is stored under.
+func AvatarKey(userId int) string {
+	return fmt.Sprintf("avatars/%d", userId)
+}
+
+// uploadURL issues a presigned upload URL of the key, valid for Config.UploadTTL.
+func (mc *MediaController) uploadURL(key string) Response.UploadUrlResponse {
+	expires := mc.now().Add(mc.Config.UploadTTL)
+	return Response.UploadUrlResponse{
+		Status:    Response.StatusSuccess,
+		UploadURL: mc.presign(http.MethodPut, key, expires),
+		Key:       key,
+		ExpiresAt: expires.UTC().Truncate(time.Second),
+	}
+}
+
+// presign builds the URL of the key signed for the method until the expiry.
+func (mc *MediaController) presign(method, key string, expires time.Time) string {
+	return mc.Config.PublicURL + MediaPath + key + "?" + mc.Signer.Sign(method, key, expires).Encode()
+}
+
+// randomName returns a random name for a new object.
+func randomName() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return "", fmt.Errorf("error generating object name: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,213 @@
+package mediahandler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"media_service/controllers/media_controller"
+	Response "media_service/models/presigned_url"
+	"media_service/modules/signer"
+	"media_service/modules/storage"
+	Auth "shared/auth"
+)
+
+// Upload targets accepted by POST /uploads.
+const (
+	TargetAvatar     = "avatar"
+	TargetPlace      = "place"
+	TargetAttachment = "attachment"
+)
+
+// MediaHandler serves the HTTP API of the media service. The lookups need the service token:
+//   - GET /?user_id=N answers with a PresignedUrlResponse holding the user's avatar URL.
+//   - GET /?place_id=N answers with a PlaceResponse holding the place's photo URLs.
+//   - GET /?media_id=K answers with a PresignedUrlResponse holding a message attachment's URL.
+//   - POST /uploads?target=avatar|place|attachment[&place_id=N] issues a presigned upload URL.
+//   - GET /media/<key> downloads and PUT /media/<key> uploads a blob through a presigned URL.
+type MediaHandler struct {
+	media         *mediacontroller.MediaController // Issues the URLs and reads and writes the blobs
+	Authenticator *Auth.Authenticator              // Verifies the token of upload URL requests; nil rejects them all
+	ServiceToken  string                           // Token the other services send with their lookups; empty rejects them all
+}
+
+// NewMediaHandler initializes a new MediaHandler serving the given controller's media.
+func NewMediaHandler(media *mediacontroller.MediaController) *MediaHandler {
+	return &MediaHandler{media: media}
+}
+
+// Routes returns a mux routing the media service's endpoints to the handler.
+//
+// Returns:
+//   - The configured *http.ServeMux.
+func (h *MediaHandler) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", h.Lookup)
+	mux.HandleFunc("POST /uploads", h.IssueUpload)
+	mux.HandleFunc("GET "+mediacontroller.MediaPath+"{key...}", h.Download)
+	mux.HandleFunc("PUT "+mediacontroller.MediaPath+"{key...}", h.Upload)
+	return mux
+}
+
+// Lookup answers the presigned URL lookups of the other services. They authenticate with
+// the service token as an `Authorization: Bearer <token>` header.
+func (h *MediaHandler) Lookup(w http.ResponseWriter, r *http.Request) {
+	if !h.isService(r) {
+		log.Printf("Rejected lookup without the service token from %s", r.RemoteAddr)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	switch {
+	case query.Has("user_id"):
+		userId, err := strconv.Atoi(query.Get("user_id"))
+		if err != nil {
+			http.Error(w, "user_id must be a number", http.StatusBadRequest)
+			return
+		}
+		url, err := h.media.AvatarURL(r.Context(), userId)
+		if err != nil {
+			log.Printf("Error looking up avatar of user %d: %v", userId, err)
+			writeJSON(w, http.StatusInternalServerError, Response.PresignedUrlResponse{Status: Response.StatusError})
+			return
+		}
+		writeJSON(w, http.StatusOK, Response.PresignedUrlResponse{Status: Response.StatusSuccess, PresignedURL: url})
+
+	case query.Has("place_id"):
+		placeId, err := strconv.Atoi(query.Get("place_id"))
+		if err != nil {
+			http.Error(w, "place_id must be a number", http.StatusBadRequest)
+			return
+		}
+		urls, err := h.media.PlaceMediaURLs(r.Context(), placeId)
+		if err != nil {
+			log.Printf("Error looking up media of place %d: %v", placeId, err)
+			writeJSON(w, http.StatusInternalServerError, Response.PlaceResponse{Status: Response.StatusError, PresignedURL: []string{}})
+			return
+		}
+		writeJSON(w, http.StatusOK, Response.PlaceResponse{Status: Response.StatusSuccess, PresignedURL: urls})
+
+	case query.Has("media_id"):
+		mediaId := query.Get("media_id")
+		url, err := h.media.AttachmentURL(r.Context(), mediaId)
+		if err != nil {
+			log.Printf("Error looking up attachment %q: %v", mediaId, err)
+			writeJSON(w, http.StatusInternalServerError, Response.PresignedUrlResponse{Status: Response.StatusError})
+			return
+		}
+		writeJSON(w, http.StatusOK, Response.PresignedUrlResponse{Status: Response.StatusSuccess, PresignedURL: url})
+
+	default:
+		http.Error(w, "user_id, place_id or media_id is required", http.StatusBadRequest)
+	}
+}
+
+// isService reports whether the request carries the service token.
+func (h *MediaHandler) isService(r *http.Request) bool {
+	if h.ServiceToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(h.ServiceToken)) == 1
+}
+
+// IssueUpload issues a presigned upload URL to an authenticated user. Users may upload
+// their own avatar, photos of any place, and attachments to send in chats.
+func (h *MediaHandler) IssueUpload(w http.ResponseWriter, r *http.Request) {
+	if h.Authenticator == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	userId, err := h.Authenticator.Authenticate(r)
+	if err != nil {
+		log.Printf("Rejected unauthenticated upload request: %v", err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	switch query.Get("target") {
+	case TargetAvatar:
+		writeJSON(w, http.StatusOK, h.media.AvatarUploadURL(userId))
+
+	case TargetPlace:
+		placeId, err := strconv.Atoi(query.Get("place_id"))
+		if err != nil || placeId <= 0 {
+			http.Error(w, "place_id must be a positive number", http.StatusBadRequest)
+			return
+		}
+		upload, err := h.media.PlaceUploadURL(placeId)
+		if err != nil {
+			log.Printf("Error issuing upload URL for place %d: %v", placeId, err)
+			http.Error(w, "error issuing upload URL", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, upload)
+
+	case TargetAttachment:
+		upload, err := h.media.AttachmentUploadURL(userId)
+		if err != nil {
+			log.Printf("Error issuing attachment upload URL for user %d: %v", userId, err)
+			http.Error(w, "error issuing upload URL", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, upload)
+
+	default:
+		http.Error(w, "target must be avatar, place or attachment", http.StatusBadRequest)
+	}
+}
+
+// Download serves a blob to a request carrying a valid presigned download URL.
+func (h *MediaHandler) Download(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	blob, object, err := h.media.Open(r, key)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Cache-Control", "private, max-age=60")
+	http.ServeContent(w, r, object.Key, object.ModTime, blob)
+}
+
+// Upload stores the body of a request carrying a valid presigned upload URL.
+func (h *MediaHandler) Upload(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if _, err := h.media.Put(w, r, key); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// writeError answers a failed download or upload with the matching status code.
+func writeError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, signer.ErrInvalidSignature), errors.Is(err, signer.ErrExpired):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, storage.ErrInvalidKey), errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.As(err, &tooLarge):
+		http.Error(w, "upload too large", http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("Error serving media: %v", err)
+		http.Error(w, "storage error", http.StatusInternalServerError)
+	}
+}
+
+// writeJSON sends the body as JSON with the given status code.
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Error sending response: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"media_service/controllers/media_controller"
+	"media_service/handlers/media_handler"
+	"media_service/modules/storage"
+	"media_service/utls/env"
+	"shared/auth"
+)
+
+// main is the entry point of the media service. It loads the settings, opens the blob
+// storage and serves the media API on every configured address.
+func main() {
+	// Load environment variables from .env file
+	goenv.LoadEnv()
+
+	config, err := mediacontroller.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading media config: %v", err)
+	}
+
+	store, err := storage.NewFileSystem(config.StorageDir)
+	if err != nil {
+		log.Fatalf("Error opening media storage: %v", err)
+	}
+
+	// Load the token verification settings of the upload URL requests
+	authConfig, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading auth config: %v", err)
+	}
+
+	mediaCtrl := mediacontroller.NewMediaController(store, config)
+	mediaHandler := mediahandler.NewMediaHandler(mediaCtrl)
+	mediaHandler.Authenticator = auth.NewAuthenticator(authConfig)
+	mediaHandler.ServiceToken = config.ServiceToken
+
+	startServers(config.ListenAddrs, mediaHandler.Routes())
+}
+
+// startServers starts one HTTP server per address, all serving the same handler,
+// and shuts them down gracefully on a termination signal.
+//
+// Parameters:
+//   - addrs: The addresses to listen on.
+//   - handler: The HTTP handler serving the requests.
+func startServers(addrs []string, handler http.Handler) {
+	servers := make([]*http.Server, 0, len(addrs))
+	for _, addr := range addrs {
+		server := &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		servers = append(servers, server)
+
+		go func() {
+			log.Printf("Server started on http://%s", server.Addr)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Server error: %v", err)
+			}
+		}()
+	}
+
+	waitForShutdown(servers)
+}
+
+// waitForShutdown listens for termination signals and gracefully shuts down the HTTP servers.
+//
+// Parameters:
+//   - servers: The HTTP servers to be gracefully shut down.
+func waitForShutdown(servers []*http.Server) {
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	<-quit
+	log.Println("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown failed: %v", err)
+		}
+	}
+
+	log.Println("Server successfully shut down.")
+}
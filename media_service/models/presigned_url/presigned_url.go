@@ -0,0 +1,44 @@
+package presignedurl
+
+import "time"
+
+// PresignedUrlResponse is the response to an avatar lookup, as expected by the services
+// that show avatars.
+//
+// Fields:
+//   - Status: The status of the request ("success" or "error").
+//   - PresignedURL: The presigned download URL of the avatar; empty if the user has none.
+type PresignedUrlResponse struct {
+	Status       string `json:"STATUS"`
+	PresignedURL string `json:"PRESIGNED_URL"`
+}
+
+// PlaceResponse is the response to a place media lookup, as expected by places_search.
+//
+// Fields:
+//   - Status: The status of the request ("success" or "error").
+//   - PresignedURL: The presigned download URLs of the place's photos, oldest first.
+type PlaceResponse struct {
+	Status       string   `json:"STATUS"`
+	PresignedURL []string `json:"PRESIGNED_URL"`
+}
+
+// UploadUrlResponse is the response to a request for an upload URL.
+//
+// Fields:
+//   - Status: The status of the request ("success" or "error").
+//   - UploadURL: The presigned URL to PUT the blob to.
+//   - Key: The key the blob will be stored under.
+//   - ExpiresAt: When the upload URL stops working.
+type UploadUrlResponse struct {
+	Status    string    `json:"STATUS"`
+	UploadURL string    `json:"UPLOAD_URL"`
+	Key       string    `json:"KEY"`
+	ExpiresAt time.Time `json:"EXPIRES_AT"`
+}
+
+// Statuses reported in the STATUS field.
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+)
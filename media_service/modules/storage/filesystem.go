@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileSystem stores every object as a file below a root directory, at the path its key names.
+type FileSystem struct {
+	root string
+}
+
+// NewFileSystem creates a FileSystem storing its objects below root, creating the directory
+// if it does not exist.
+//
+// Parameters:
+//   - root: The directory to store the objects in.
+//
+// Returns:
+//   - A pointer to the FileSystem.
+//   - An error if the directory cannot be created.
+func NewFileSystem(root string) (*FileSystem, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating storage directory: %w", err)
+	}
+	return &FileSystem{root: root}, nil
+}
+
+// Put writes the body to a temporary file next to the object and renames it into place,
+// so readers never see a partially written object.
+func (f *FileSystem) Put(ctx context.Context, key string, body io.Reader) (Object, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return Object{}, fmt.Errorf("error creating object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return Object{}, fmt.Errorf("error creating object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return Object{}, fmt.Errorf("error writing object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return Object{}, fmt.Errorf("error writing object: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return Object{}, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return Object{}, fmt.Errorf("error storing object: %w", err)
+	}
+	return f.stat(key, path)
+}
+
+// Open opens the file of the object.
+func (f *FileSystem) Open(ctx context.Context, key string) (Blob, Object, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	object, err := f.stat(key, path)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, Object{}, ErrNotFound
+		}
+		return nil, Object{}, fmt.Errorf("error opening object: %w", err)
+	}
+	return file, object, nil
+}
+
+// List walks the directory the prefix falls in and returns the objects below it.
+func (f *FileSystem) List(ctx context.Context, prefix string) ([]Object, error) {
+	dir := f.root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		if err := ValidateKey(prefix[:i]); err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(f.root, filepath.FromSlash(prefix[:i]))
+	}
+
+	var objects []Object
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{Key: key, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
+	}
+
+	sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+	return objects, nil
+}
+
+// Delete removes the file of the object.
+func (f *FileSystem) Delete(ctx context.Context, key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("error deleting object: %w", err)
+	}
+	return nil
+}
+
+// path returns the file path of a key after validating it.
+func (f *FileSystem) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.root, filepath.FromSlash(key)), nil
+}
+
+// stat describes the file of an object; directories do not count as objects.
+func (f *FileSystem) stat(key, path string) (Object, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Object{}, ErrNotFound
+		}
+		return Object{}, fmt.Errorf("error reading object: %w", err)
+	}
+	if info.IsDir() {
+		return Object{}, ErrNotFound
+	}
+	return Object{Key: key, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
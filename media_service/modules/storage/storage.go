@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// MaxKeyLength is the longest accepted object key, in bytes.
+const MaxKeyLength = 512
+
+var (
+	// ErrNotFound is returned when no object is stored under a key.
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey is returned for keys that are empty, too long, or not made of safe path segments.
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// Object describes a stored blob.
+//
+// Fields:
+//   - Key: The slash-separated key the blob is stored under, e.g. "avatars/42".
+//   - Size: The size of the blob in bytes.
+//   - ModTime: When the blob was last written.
+type Object struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Blob is the content of a stored object, opened for reading.
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// Storage keeps the blobs of the media service. Implementations must be safe for
+// concurrent use; FileSystem stores the blobs on the local filesystem.
+type Storage interface {
+	// Put stores the body under the key, replacing any object stored there.
+	Put(ctx context.Context, key string, body io.Reader) (Object, error)
+	// Open opens the object stored under the key for reading.
+	Open(ctx context.Context, key string) (Blob, Object, error)
+	// List returns the objects whose keys start with the prefix, ordered by key.
+	List(ctx context.Context, prefix string) ([]Object, error)
+	// Delete removes the object stored under the key.
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidateKey checks that a key is a relative path of safe segments. Every segment may only
+// contain letters, digits, '.', '-' and '_', and may not be "." or "..", so a key can never
+// point outside the storage.
+//
+// Parameters:
+//   - key: The key to check.
+//
+// Returns:
+//   - ErrInvalidKey if the key is not acceptable, nil otherwise.
+func ValidateKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength {
+		return ErrInvalidKey
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return ErrInvalidKey
+		}
+		for _, c := range segment {
+			if !isKeyChar(c) {
+				return ErrInvalidKey
+			}
+		}
+	}
+	return nil
+}
+
+// isKeyChar reports whether c may appear in a key segment.
+func isKeyChar(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '.' || c == '-' || c == '_'
+}
@@ -0,0 +1,274 @@
+package tests
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"media_service/controllers/media_controller"
+	"media_service/handlers/media_handler"
+	Response "media_service/models/presigned_url"
+	"media_service/modules/storage"
+	"shared/auth"
+)
+
+// testSecret signs the access tokens of the tests.
+var testSecret = []byte("test-secret")
+
+// testServiceToken is the token the lookups of the tests are sent with.
+const testServiceToken = "service-token"
+
+// newTestMediaServer starts the media API on a test server storing its blobs in a temporary directory.
+func newTestMediaServer(t *testing.T, configure func(*mediacontroller.Config)) (*httptest.Server, *mediacontroller.MediaController) {
+	store, err := storage.NewFileSystem(t.TempDir())
+	require.NoError(t, err)
+
+	config := mediacontroller.DefaultConfig()
+	config.Secret = []byte("media-secret")
+	if configure != nil {
+		configure(&config)
+	}
+
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	config.PublicURL = server.URL
+	mediaCtrl := mediacontroller.NewMediaController(store, config)
+	mediaHandler := mediahandler.NewMediaHandler(mediaCtrl)
+	mediaHandler.Authenticator = auth.NewAuthenticator(&auth.Config{Secret: testSecret})
+	mediaHandler.ServiceToken = testServiceToken
+	handler = mediaHandler.Routes()
+	return server, mediaCtrl
+}
+
+// issueUpload requests an upload URL as the given user.
+func issueUpload(t *testing.T, server *httptest.Server, userID int, query string) Response.UploadUrlResponse {
+	token, err := auth.SignToken(auth.Claims{Subject: strconv.Itoa(userID), ExpiresAt: time.Now().Add(time.Hour).Unix()}, testSecret)
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/uploads?"+query, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var upload Response.UploadUrlResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&upload))
+	return upload
+}
+
+// put uploads the body to a presigned upload URL and returns the status code.
+func put(t *testing.T, uploadURL, body string) int {
+	req, err := http.NewRequest(http.MethodPut, uploadURL, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// get downloads a URL and returns the status code and body.
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+// lookup sends a lookup with the given query and service token and returns the status code and body.
+func lookup(t *testing.T, server *httptest.Server, query, token string) (int, string) {
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/?"+query, nil)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+// TestMediaHandler_AvatarRoundTrip tests uploading an avatar through an upload URL and
+// downloading it through the URL the avatar lookup answers with.
+func TestMediaHandler_AvatarRoundTrip(t *testing.T) {
+	server, _ := newTestMediaServer(t, nil)
+
+	var found Response.PresignedUrlResponse
+	_, body := lookup(t, server, "user_id=42", testServiceToken)
+	require.NoError(t, json.Unmarshal([]byte(body), &found))
+	assert.Equal(t, Response.StatusSuccess, found.Status)
+	assert.Empty(t, found.PresignedURL)
+
+	upload := issueUpload(t, server, 42, "target=avatar")
+	assert.Equal(t, "avatars/42", upload.Key)
+	assert.Equal(t, http.StatusCreated, put(t, upload.UploadURL, "avatar bytes"))
+
+	_, body = lookup(t, server, "user_id=42", testServiceToken)
+	require.NoError(t, json.Unmarshal([]byte(body), &found))
+	require.NotEmpty(t, found.PresignedURL)
+
+	parsed, err := url.Parse(found.PresignedURL)
+	require.NoError(t, err)
+	expires, err := strconv.ParseInt(parsed.Query().Get("expires"), 10, 64)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(15*time.Minute), time.Unix(expires, 0), 5*time.Second)
+
+	status, content := get(t, found.PresignedURL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "avatar bytes", content)
+}
+
+// TestMediaHandler_PlaceMedia tests that a place lookup lists every uploaded photo.
+func TestMediaHandler_PlaceMedia(t *testing.T) {
+	server, _ := newTestMediaServer(t, nil)
+
+	for _, photo := range []string{"first", "second"} {
+		upload := issueUpload(t, server, 1, "target=place&place_id=7")
+		assert.True(t, strings.HasPrefix(upload.Key, "places/7/"))
+		require.Equal(t, http.StatusCreated, put(t, upload.UploadURL, photo))
+	}
+
+	var found Response.PlaceResponse
+	_, body := lookup(t, server, "place_id=7", testServiceToken)
+	require.NoError(t, json.Unmarshal([]byte(body), &found))
+	assert.Equal(t, Response.StatusSuccess, found.Status)
+	require.Len(t, found.PresignedURL, 2)
+
+	var photos []string
+	for _, presigned := range found.PresignedURL {
+		status, content := get(t, presigned)
+		require.Equal(t, http.StatusOK, status)
+		photos = append(photos, content)
+	}
+	assert.ElementsMatch(t, []string{"first", "second"}, photos)
+
+	_, body = lookup(t, server, "place_id=8", testServiceToken)
+	require.NoError(t, json.Unmarshal([]byte(body), &found))
+	assert.Empty(t, found.PresignedURL)
+}
+
+// TestMediaHandler_RejectsTamperedURLs tests that downloads and uploads need a matching,
+// unexpired signature.
+func TestMediaHandler_RejectsTamperedURLs(t *testing.T) {
+	server, mediaCtrl := newTestMediaServer(t, nil)
+
+	upload := issueUpload(t, server, 42, "target=avatar")
+	require.Equal(t, http.StatusCreated, put(t, upload.UploadURL, "avatar bytes"))
+
+	// An upload URL does not allow downloads, and a download URL does not allow uploads.
+	status, _ := get(t, upload.UploadURL)
+	assert.Equal(t, http.StatusForbidden, status)
+	download := mediaCtrl.DownloadURL("avatars/42")
+	assert.Equal(t, http.StatusForbidden, put(t, download, "overwritten"))
+
+	// The signature is bound to the key.
+	status, _ = get(t, strings.Replace(download, "avatars/42", "avatars/43", 1))
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Moving the expiry invalidates the signature.
+	parsed, err := url.Parse(download)
+	require.NoError(t, err)
+	query := parsed.Query()
+	query.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	parsed.RawQuery = query.Encode()
+	status, _ = get(t, parsed.String())
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// Unsigned URLs are rejected.
+	status, _ = get(t, server.URL+"/media/avatars/42")
+	assert.Equal(t, http.StatusForbidden, status)
+
+	status, content := get(t, download)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "avatar bytes", content)
+}
+
+// TestMediaHandler_ExpiredURL tests that URLs stop working once they expire.
+func TestMediaHandler_ExpiredURL(t *testing.T) {
+	server, mediaCtrl := newTestMediaServer(t, func(config *mediacontroller.Config) {
+		config.DownloadTTL = -time.Second
+	})
+
+	upload := issueUpload(t, server, 42, "target=avatar")
+	require.Equal(t, http.StatusCreated, put(t, upload.UploadURL, "avatar bytes"))
+
+	status, body := get(t, mediaCtrl.DownloadURL("avatars/42"))
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Contains(t, body, "expired")
+}
+
+// TestMediaHandler_UploadLimits tests that upload URLs need a token and that large uploads are refused.
+func TestMediaHandler_UploadLimits(t *testing.T) {
+	server, _ := newTestMediaServer(t, func(config *mediacontroller.Config) {
+		config.MaxUploadSize = 4
+	})
+
+	resp, err := http.Post(server.URL+"/uploads?target=avatar", "", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	upload := issueUpload(t, server, 42, "target=avatar")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, put(t, upload.UploadURL, "too large"))
+	status, _ := lookup(t, server, "user_id=42", testServiceToken)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+// TestMediaHandler_Attachments tests uploading a message attachment and looking it up by its media ID.
+func TestMediaHandler_Attachments(t *testing.T) {
+	server, _ := newTestMediaServer(t, nil)
+
+	upload := issueUpload(t, server, 42, "target=attachment")
+	assert.True(t, strings.HasPrefix(upload.Key, "attachments/42/"))
+	require.Equal(t, http.StatusCreated, put(t, upload.UploadURL, "voice note"))
+
+	var found Response.PresignedUrlResponse
+	_, body := lookup(t, server, "media_id="+url.QueryEscape(upload.Key), testServiceToken)
+	require.NoError(t, json.Unmarshal([]byte(body), &found))
+	require.NotEmpty(t, found.PresignedURL)
+	status, content := get(t, found.PresignedURL)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "voice note", content)
+
+	// Only attachments can be looked up by media ID.
+	avatar := issueUpload(t, server, 42, "target=avatar")
+	require.Equal(t, http.StatusCreated, put(t, avatar.UploadURL, "avatar bytes"))
+	_, body = lookup(t, server, "media_id="+url.QueryEscape(avatar.Key), testServiceToken)
+	require.NoError(t, json.Unmarshal([]byte(body), &found))
+	assert.Empty(t, found.PresignedURL)
+}
+
+// TestMediaHandler_LookupNeedsServiceToken tests that lookups without the service token are rejected.
+func TestMediaHandler_LookupNeedsServiceToken(t *testing.T) {
+	server, _ := newTestMediaServer(t, nil)
+
+	upload := issueUpload(t, server, 42, "target=attachment")
+	require.Equal(t, http.StatusCreated, put(t, upload.UploadURL, "voice note"))
+
+	for _, token := range []string{"", "wrong-token"} {
+		status, body := lookup(t, server, "media_id="+url.QueryEscape(upload.Key), token)
+		assert.Equal(t, http.StatusUnauthorized, status)
+		assert.NotContains(t, body, "PRESIGNED_URL")
+	}
+
+	status, _ := lookup(t, server, "user_id=42", testServiceToken)
+	assert.Equal(t, http.StatusOK, status)
+}
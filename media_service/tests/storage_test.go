@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"media_service/modules/storage"
+)
+
+// TestFileSystem_PutOpenList tests that stored objects can be read back and listed by prefix.
+func TestFileSystem_PutOpenList(t *testing.T) {
+	store, err := storage.NewFileSystem(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	for _, key := range []string{"places/7/b", "places/7/a", "places/70/c", "avatars/7"} {
+		_, err := store.Put(ctx, key, strings.NewReader("content of "+key))
+		require.NoError(t, err)
+	}
+
+	blob, object, err := store.Open(ctx, "places/7/a")
+	require.NoError(t, err)
+	defer blob.Close()
+	content, err := io.ReadAll(blob)
+	require.NoError(t, err)
+	assert.Equal(t, "content of places/7/a", string(content))
+	assert.Equal(t, int64(len(content)), object.Size)
+
+	objects, err := store.List(ctx, "places/7/")
+	require.NoError(t, err)
+	var keys []string
+	for _, object := range objects {
+		keys = append(keys, object.Key)
+	}
+	assert.Equal(t, []string{"places/7/a", "places/7/b"}, keys)
+
+	objects, err = store.List(ctx, "places/8/")
+	require.NoError(t, err)
+	assert.Empty(t, objects)
+
+	require.NoError(t, store.Delete(ctx, "avatars/7"))
+	_, _, err = store.Open(ctx, "avatars/7")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+// TestFileSystem_RejectsUnsafeKeys tests that keys cannot point outside the storage directory.
+func TestFileSystem_RejectsUnsafeKeys(t *testing.T) {
+	store, err := storage.NewFileSystem(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"", "../secret", "avatars/../../secret", "/etc/passwd", "avatars//7", "avatars/7 8"} {
+		_, err := store.Put(context.Background(), key, strings.NewReader("x"))
+		assert.ErrorIs(t, err, storage.ErrInvalidKey, key)
+	}
+}
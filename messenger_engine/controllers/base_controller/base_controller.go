@@ -6,6 +6,9 @@ import (
 	"messenger_engine/modules/database/database"
 )
 
+// MediaServiceURL is the media service endpoint returning presigned URLs of avatars and attachments.
+const MediaServiceURL = "http://127.0.0.1:8165"
+
 // BaseController provides a common structure for controllers that require database access.
 type BaseController struct {
 	Database *database.Database // Database instance used by the controller.
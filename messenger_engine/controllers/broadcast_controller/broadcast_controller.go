@@ -6,91 +6,375 @@ import (
 
 	"github.com/gorilla/websocket"
 
-	"messenger_engine/models/message"
 	"messenger_engine/controllers/message_controller"
+	"messenger_engine/models/event"
+	"messenger_engine/models/message"
+	"messenger_engine/modules/backplane"
 )
 
-// Broadcast manages WebSocket clients and handles message broadcasting.
+// EventBufferSize is the number of published events buffered ahead of the dispatcher.
+const EventBufferSize = 1024
+
+// Broadcast manages WebSocket clients, their chat subscriptions and event broadcasting.
+// Fan-out only enqueues payloads on the clients' outbound queues and never blocks on network I/O.
+// Published events are also relayed through the backplane, so subscribers connected to other
+// instances receive them too.
 type Broadcast struct {
-	Clients         map[*websocket.Conn]bool // A map of connected WebSocket clients.
-	mu              sync.Mutex               // Mutex to ensure concurrent safety.
-	Broadcast       chan message.FinalMessage       // Channel for broadcasting messages.
-	RepliesBroadcast chan message.FinalMessageReply // Channel for broadcasting reply messages.
+	Clients     map[*Client]bool         // A map of connected WebSocket clients.
+	rooms       map[int]map[*Client]bool // Subscribers of every chat, keyed by chat ID.
+	memberships map[*Client]map[int]bool // Chats every client is subscribed to.
+	users       map[int]map[*Client]bool // Connections of every identified user, keyed by user ID.
+	identities  map[*Client]int          // User every identified client belongs to.
+	presence    map[int]bool             // Users announced online by presence events, including other instances'.
+	listener    PresenceListener         // Notified when users come online or go offline; may be nil.
+	changes     chan presenceChange      // Presence changes waiting for the listener.
+	observer    EventObserver            // Shown every delivered event; may be nil.
+	observed    chan event.Event         // Delivered events waiting for the observer.
+	config      Config                   // Per-connection delivery settings.
+	mu          sync.Mutex               // Mutex to ensure concurrent safety.
+	Events      chan event.Event         // Stream of every event delivered to chat subscribers.
+	backplane   backplane.Backplane      // Relays events between instances.
 }
 
-// NewBroadcaster initializes and returns a new Broadcast instance.
+// NewBroadcaster initializes and returns a new Broadcast instance with the default delivery settings.
 //
 // Returns:
 //   - A pointer to a newly created Broadcast instance.
 func NewBroadcaster() *Broadcast {
+	return NewBroadcasterWithConfig(DefaultConfig())
+}
+
+// NewBroadcasterWithConfig initializes and returns a new single-node Broadcast instance.
+//
+// Parameters:
+//   - config: The per-connection queue size, write timeout and slow consumer policy.
+//
+// Returns:
+//   - A pointer to a newly created Broadcast instance.
+func NewBroadcasterWithConfig(config Config) *Broadcast {
+	return NewBroadcasterWithBackplane(config, backplane.NewMemoryBackplane())
+}
+
+// NewBroadcasterWithBackplane initializes and returns a new Broadcast instance
+// that shares its events with the other instances attached to the backplane.
+//
+// Parameters:
+//   - config: The per-connection queue size, write timeout and slow consumer policy.
+//   - bp: The backplane relaying events between instances.
+//
+// Returns:
+//   - A pointer to a newly created Broadcast instance.
+func NewBroadcasterWithBackplane(config Config, bp backplane.Backplane) *Broadcast {
+	if config.QueueSize <= 0 {
+		config.QueueSize = DefaultConfig().QueueSize
+	}
 	return &Broadcast{
-		Clients:         make(map[*websocket.Conn]bool),
-		Broadcast:       make(chan message.FinalMessage),
-		RepliesBroadcast: make(chan message.FinalMessageReply),
+		Clients:     make(map[*Client]bool),
+		rooms:       make(map[int]map[*Client]bool),
+		memberships: make(map[*Client]map[int]bool),
+		users:       make(map[int]map[*Client]bool),
+		identities:  make(map[*Client]int),
+		presence:    make(map[int]bool),
+		changes:     make(chan presenceChange, EventBufferSize),
+		observed:    make(chan event.Event, EventBufferSize),
+		config:      config,
+		Events:      make(chan event.Event, EventBufferSize),
+		backplane:   bp,
 	}
 }
 
-// RegisterClient adds a new WebSocket client to the broadcaster.
+// RegisterClient adds a new WebSocket connection to the broadcaster and starts its writer goroutine.
+// From then on, every write to the connection must go through the returned Client.
 //
 // Parameters:
-//   - client: The WebSocket connection to be registered.
-func (b *Broadcast) RegisterClient(client *websocket.Conn) {
+//   - conn: The WebSocket connection to be registered.
+//
+// Returns:
+//   - The Client wrapping the connection.
+func (b *Broadcast) RegisterClient(conn *websocket.Conn) *Client {
+	client := newClient(conn, b.config, b.RemoveClient)
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.Clients[client] = true
+	return client
 }
 
-// RemoveClient removes a WebSocket client from the broadcaster and closes its connection.
+// RemoveClient removes a client from the broadcaster, drops all of its
+// chat subscriptions, stops its writer goroutine and closes its connection.
 //
 // Parameters:
-//   - client: The WebSocket connection to be removed.
-func (b *Broadcast) RemoveClient(client *websocket.Conn) {
+//   - client: The client to be removed.
+func (b *Broadcast) RemoveClient(client *Client) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	if _, exists := b.Clients[client]; exists {
-		client.Close()
-		delete(b.Clients, client)
+	b.removeClientLocked(client)
+}
+
+// removeClientLocked removes the client and its subscriptions. The caller must hold b.mu.
+func (b *Broadcast) removeClientLocked(client *Client) {
+	for chatId := range b.memberships[client] {
+		b.unsubscribeLocked(client, chatId)
 	}
+	delete(b.memberships, client)
+	if userId, ok := b.identities[client]; ok {
+		delete(b.users[userId], client)
+		if len(b.users[userId]) == 0 {
+			// The user's last connection to this instance closed
+			delete(b.users, userId)
+			b.queuePresenceLocked(userId, false)
+		}
+		delete(b.identities, client)
+	}
+	delete(b.Clients, client)
+	client.close()
 }
 
-// HandleMessages listens for incoming messages on the Broadcast channel
-// and sends them to all registered WebSocket clients.
+// Identify binds the client to the user it is authenticated as, so events addressed
+// to that user reach the client whether or not it is subscribed to their chat.
+// The user's first connection to this instance notifies the presence listener.
+//
+// Parameters:
+//   - client: The client to identify.
+//   - userId: The ID of the authenticated user.
+func (b *Broadcast) Identify(client *Client, userId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Removed clients must not come back through a late identification.
+	if !b.Clients[client] {
+		return
+	}
+
+	if b.identities[client] == userId {
+		return
+	}
+	if b.users[userId] == nil {
+		b.users[userId] = make(map[*Client]bool)
+		b.queuePresenceLocked(userId, true)
+	}
+	b.users[userId][client] = true
+	b.identities[client] = userId
+}
+
+// Subscribe adds the client to the subscribers of the given chat.
+// A client may be subscribed to any number of chats at the same time.
+//
+// Parameters:
+//   - client: The client to subscribe.
+//   - chatId: The ID of the chat to subscribe to.
+func (b *Broadcast) Subscribe(client *Client, chatId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Removed clients must not come back through a late subscription.
+	if !b.Clients[client] {
+		return
+	}
+
+	if b.rooms[chatId] == nil {
+		b.rooms[chatId] = make(map[*Client]bool)
+	}
+	b.rooms[chatId][client] = true
+
+	if b.memberships[client] == nil {
+		b.memberships[client] = make(map[int]bool)
+	}
+	b.memberships[client][chatId] = true
+}
+
+// Unsubscribe removes the client from the subscribers of the given chat.
+// The client stays registered and keeps its other subscriptions.
+//
+// Parameters:
+//   - client: The client to unsubscribe.
+//   - chatId: The ID of the chat to unsubscribe from.
+func (b *Broadcast) Unsubscribe(client *Client, chatId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.unsubscribeLocked(client, chatId)
+}
+
+// unsubscribeLocked removes a single subscription. The caller must hold b.mu.
+func (b *Broadcast) unsubscribeLocked(client *Client, chatId int) {
+	if room, ok := b.rooms[chatId]; ok {
+		delete(room, client)
+		if len(room) == 0 {
+			delete(b.rooms, chatId)
+		}
+	}
+	if chats, ok := b.memberships[client]; ok {
+		delete(chats, chatId)
+	}
+}
+
+// UnsubscribeUser removes every connection of the user from the subscribers of the given chat,
+// e.g. once the user left the chat or was removed from it.
+//
+// Parameters:
+//   - userId: The ID of the user to unsubscribe.
+//   - chatId: The ID of the chat to unsubscribe from.
+func (b *Broadcast) UnsubscribeUser(userId int, chatId int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for client := range b.users[userId] {
+		b.unsubscribeLocked(client, chatId)
+	}
+}
+
+// ClientCount returns the number of registered clients.
+func (b *Broadcast) ClientCount() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.Clients)
+}
+
+// IsSubscribed reports whether the client is subscribed to the given chat.
+func (b *Broadcast) IsSubscribed(client *Client, chatId int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rooms[chatId][client]
+}
+
+// Subscribers returns a snapshot of the clients subscribed to the given chat.
+func (b *Broadcast) Subscribers(chatId int) []*Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscribers := make([]*Client, 0, len(b.rooms[chatId]))
+	for client := range b.rooms[chatId] {
+		subscribers = append(subscribers, client)
+	}
+	return subscribers
+}
+
+// recipients returns a snapshot of the clients an event is delivered to: the subscribers
+// of its chat (unless the event is for its recipients only) and every connection of its
+// recipients, each client listed once. Connections of the event's excluded user are skipped.
+func (b *Broadcast) recipients(ev event.Event) []*Client {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var clients []*Client
+	seen := make(map[*Client]bool)
+	if ev.ExcludeUserId != 0 {
+		for client := range b.users[ev.ExcludeUserId] {
+			seen[client] = true
+		}
+	}
+	if !ev.RecipientsOnly {
+		for client := range b.rooms[ev.ChatId] {
+			if !seen[client] {
+				seen[client] = true
+				clients = append(clients, client)
+			}
+		}
+	}
+	for _, userId := range ev.Recipients {
+		for client := range b.users[userId] {
+			if !seen[client] {
+				seen[client] = true
+				clients = append(clients, client)
+			}
+		}
+	}
+	return clients
+}
+
+// Subscriptions returns the IDs of all chats the client is subscribed to.
+func (b *Broadcast) Subscriptions(client *Client) []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	chats := make([]int, 0, len(b.memberships[client]))
+	for chatId := range b.memberships[client] {
+		chats = append(chats, chatId)
+	}
+	return chats
+}
+
+// HandleMessages is the single dispatcher of the event stream. It reads every
+// event published locally or relayed from other instances and sends it to the
+// clients subscribed to the event's chat and to the connections of its recipients.
 //
 // Parameters:
 //   - mmc: A pointer to the MessageController that handles messages.
 func (b *Broadcast) HandleMessages(mmc *messagecontroller.MessageController) {
-	for msg := range b.Broadcast {
-		b.mu.Lock()
-		for client := range b.Clients {
-			if err := client.WriteJSON(msg); err != nil {
-				log.Printf("Error sending message to client: %v", err)
-				b.RemoveClient(client)
-			}
+	go b.relay()
+	go b.notifyPresence()
+	go b.notifyObserver()
+
+	for ev := range b.Events {
+		b.deliver(ev)
+	}
+}
+
+// relay feeds the events of other instances into the local event stream
+// until the backplane is closed.
+func (b *Broadcast) relay() {
+	for ev := range b.backplane.Events() {
+		b.Events <- ev
+	}
+}
+
+// Publish appends an event to the local event stream and shares it with the other
+// instances. The dispatcher never blocks on clients, so publishing only waits while
+// the stream buffer is full. A backplane failure is logged and local delivery still happens.
+//
+// Parameters:
+//   - ev: The event to deliver to the subscribers of its chat and to its recipients.
+func (b *Broadcast) Publish(ev event.Event) {
+	b.Events <- ev
+
+	if err := b.backplane.Publish(ev); err != nil {
+		log.Printf("Error relaying event to other instances: %v", err)
+	}
+}
+
+// deliver enqueues the event's payload on the queue of every subscriber of its chat and of
+// every connection of its recipients. Clients whose queue is full are handled according to
+// the slow consumer policy. The event is then shown to the observer, if one is registered.
+func (b *Broadcast) deliver(ev event.Event) {
+	switch ev.Type {
+	case event.PresenceChanged:
+		b.trackPresence(ev)
+	case event.ChatUpdated:
+		b.trackMembership(ev)
+	}
+
+	var slow []*Client
+	for _, client := range b.recipients(ev) {
+		switch err := client.WriteJSON(ev.Payload); err {
+		case nil, ErrClientClosed:
+		case ErrQueueFull:
+			slow = append(slow, client)
+		}
+	}
+
+	for _, client := range slow {
+		if b.config.Policy == DropForSlowConsumer {
+			log.Println("Client send queue full, dropping message")
+			continue
 		}
-		b.mu.Unlock()
+		log.Println("Client send queue full, evicting slow consumer")
+		b.RemoveClient(client)
 	}
+
+	b.queueObserved(ev)
 }
 
-// BroadcastMessage sends a message to all registered WebSocket clients.
+// BroadcastMessage sends a message to the subscribers of its chat.
 //
 // Parameters:
 //   - msg: The FinalMessage struct containing the message to broadcast.
 func (b *Broadcast) BroadcastMessage(msg message.FinalMessage) {
-	select {
-	case b.Broadcast <- msg:
-	default:
-		log.Println("Broadcast channel full, dropping message")
-	}
+	b.Publish(event.FromMessage(msg))
 }
 
-// BroadcastReplyMessage sends a reply message to all registered WebSocket clients.
+// BroadcastReplyMessage sends a reply message to the subscribers of its chat.
 //
 // Parameters:
 //   - msg: The FinalMessageReply struct containing the reply message to broadcast.
 func (b *Broadcast) BroadcastReplyMessage(msg message.FinalMessageReply) {
-	select {
-	case b.RepliesBroadcast <- msg:
-	default:
-		log.Println("Reply broadcast channel full, dropping message")
-	}
+	b.Publish(event.FromReply(msg))
 }
@@ -0,0 +1,161 @@
+package broadcastcontroller
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"shared/codec"
+)
+
+var (
+	// ErrClientClosed is returned when a payload is sent to a removed client.
+	ErrClientClosed = errors.New("client connection closed")
+	// ErrQueueFull is returned when the client's outbound queue has no room left.
+	ErrQueueFull = errors.New("client send queue full")
+)
+
+// closeWriteTimeout bounds writing a close frame when no write timeout is configured.
+const closeWriteTimeout = time.Second
+
+// Client is a WebSocket connection registered with the broadcaster.
+// Every client owns a bounded outbound queue drained by a dedicated writer goroutine,
+// which is the only goroutine that ever writes to the underlying connection.
+type Client struct {
+	Conn  *websocket.Conn // The underlying WebSocket connection.
+	Codec codec.Codec     // Wire format negotiated during the handshake.
+
+	send      chan interface{} // Outbound queue drained by writePump.
+	done      chan struct{}    // Closed when the client is removed.
+	closeOnce sync.Once        // Guards closing done and the connection.
+	config    Config           // Queue and write settings of the broadcaster.
+	remove    func(*Client)    // Removes the client from the broadcaster.
+}
+
+// closeFrame is queued by Disconnect, so the close frame is written after the payloads queued before it.
+type closeFrame struct {
+	code int
+	text string
+}
+
+// newClient wraps the connection and starts its writer goroutine.
+// The remove callback is invoked once the writer stops because a write failed or the client was disconnected.
+func newClient(conn *websocket.Conn, config Config, remove func(*Client)) *Client {
+	c := &Client{
+		Conn:   conn,
+		Codec:  codec.ForConn(conn),
+		send:   make(chan interface{}, config.QueueSize),
+		done:   make(chan struct{}),
+		config: config,
+		remove: remove,
+	}
+	go c.writePump()
+	return c
+}
+
+// WriteJSON enqueues the payload for delivery to the client.
+// It never blocks on network I/O, so it can be used wherever a reply has to be
+// sent from the connection's read loop. It satisfies the error handler's WebSocketWriter.
+//
+// Parameters:
+//   - v: The payload to encode with the client's codec and send.
+//
+// Returns:
+//   - ErrClientClosed if the client was removed, ErrQueueFull if its queue is full.
+func (c *Client) WriteJSON(v interface{}) error {
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	default:
+	}
+
+	select {
+	case c.send <- v:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Disconnect queues a close frame with the given status code and reason behind the pending payloads.
+// Once the writer has sent it, the client is removed and its connection closed.
+// When the queue is full, the close frame is written right away instead and the client
+// is removed without waiting for the pending payloads.
+//
+// Parameters:
+//   - code: The WebSocket close code, e.g. websocket.ClosePolicyViolation.
+//   - text: The close reason sent to the client.
+//
+// Returns:
+//   - ErrClientClosed if the client was already removed.
+func (c *Client) Disconnect(code int, text string) error {
+	frame := closeFrame{code: code, text: text}
+	err := c.WriteJSON(frame)
+	if err != ErrQueueFull {
+		return err
+	}
+
+	// Close control frames may be written next to the writer goroutine
+	c.writeClose(frame)
+	c.remove(c)
+	return nil
+}
+
+// Done returns a channel that is closed once the client has been removed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// close stops the writer goroutine and closes the connection. It is safe to call repeatedly.
+func (c *Client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+// writePump writes queued payloads to the connection until the client is closed,
+// a write fails or a close frame is sent. Payloads are encoded with the negotiated codec,
+// and each write is bounded by the configured write timeout.
+func (c *Client) writePump() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case payload := <-c.send:
+			if frame, ok := payload.(closeFrame); ok {
+				c.writeClose(frame)
+				c.remove(c)
+				return
+			}
+			data, err := c.Codec.Marshal(payload)
+			if err != nil {
+				log.Printf("Error encoding message for client: %v", err)
+				continue
+			}
+			if c.config.WriteTimeout > 0 {
+				c.Conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+			}
+			if err := c.Conn.WriteMessage(c.Codec.MessageType(), data); err != nil {
+				log.Printf("Error sending message to client: %v", err)
+				c.remove(c)
+				return
+			}
+		}
+	}
+}
+
+// writeClose sends a close frame, bounded by the configured write timeout.
+func (c *Client) writeClose(frame closeFrame) {
+	timeout := c.config.WriteTimeout
+	if timeout <= 0 {
+		timeout = closeWriteTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	message := websocket.FormatCloseMessage(frame.code, frame.text)
+	if err := c.Conn.WriteControl(websocket.CloseMessage, message, deadline); err != nil {
+		log.Printf("Error sending close frame to client: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package broadcastcontroller
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SlowConsumerPolicy decides what happens when a client's outbound queue is full.
+type SlowConsumerPolicy string
+
+const (
+	// EvictSlowConsumer disconnects clients that cannot keep up.
+	EvictSlowConsumer SlowConsumerPolicy = "evict"
+	// DropForSlowConsumer keeps the client connected and drops the payloads that do not fit.
+	DropForSlowConsumer SlowConsumerPolicy = "drop"
+)
+
+// Config holds the per-connection delivery settings of the broadcaster.
+type Config struct {
+	QueueSize    int                // Number of payloads buffered per client.
+	WriteTimeout time.Duration      // Deadline for a single write to a client.
+	Policy       SlowConsumerPolicy // What to do when a client's queue is full.
+}
+
+// DefaultConfig returns the delivery settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		QueueSize:    256,
+		WriteTimeout: 10 * time.Second,
+		Policy:       EvictSlowConsumer,
+	}
+}
+
+// LoadConfig reads the delivery settings from environment variables, falling back to
+// DefaultConfig for unset or malformed values:
+//   - BROADCAST_QUEUE_SIZE: payloads buffered per client.
+//   - BROADCAST_WRITE_TIMEOUT_MS: deadline for a single write, in milliseconds.
+//   - BROADCAST_SLOW_CONSUMER_POLICY: "evict" or "drop".
+func LoadConfig() Config {
+	config := DefaultConfig()
+
+	if raw := os.Getenv("BROADCAST_QUEUE_SIZE"); raw != "" {
+		if size, err := strconv.Atoi(raw); err == nil && size > 0 {
+			config.QueueSize = size
+		} else {
+			log.Printf("Ignoring invalid BROADCAST_QUEUE_SIZE %q", raw)
+		}
+	}
+
+	if raw := os.Getenv("BROADCAST_WRITE_TIMEOUT_MS"); raw != "" {
+		if ms, err := strconv.Atoi(raw); err == nil && ms > 0 {
+			config.WriteTimeout = time.Duration(ms) * time.Millisecond
+		} else {
+			log.Printf("Ignoring invalid BROADCAST_WRITE_TIMEOUT_MS %q", raw)
+		}
+	}
+
+	switch policy := SlowConsumerPolicy(os.Getenv("BROADCAST_SLOW_CONSUMER_POLICY")); policy {
+	case "":
+	case EvictSlowConsumer, DropForSlowConsumer:
+		config.Policy = policy
+	default:
+		log.Printf("Ignoring invalid BROADCAST_SLOW_CONSUMER_POLICY %q", policy)
+	}
+
+	return config
+}
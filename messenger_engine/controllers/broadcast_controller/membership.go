@@ -0,0 +1,33 @@
+package broadcastcontroller
+
+import (
+	"encoding/json"
+	"log"
+
+	Chats "messenger_engine/models/chat"
+	"messenger_engine/models/event"
+)
+
+// trackMembership drops the subscriptions of a user who was removed from a chat or left it.
+// Every instance does this when it delivers the chat update, so the user stops receiving
+// the chat on connections to other instances too.
+func (b *Broadcast) trackMembership(ev event.Event) {
+	var update Chats.ChatUpdate
+	switch payload := ev.Payload.(type) {
+	case Chats.ChatUpdate:
+		update = payload
+	case json.RawMessage:
+		// Events relayed from other instances carry their payload as raw JSON
+		if err := json.Unmarshal(payload, &update); err != nil {
+			log.Printf("Error decoding chat update event: %v", err)
+			return
+		}
+	default:
+		return
+	}
+
+	if update.Action != Chats.ActionMemberRemoved && update.Action != Chats.ActionMemberLeft {
+		return
+	}
+	b.UnsubscribeUser(update.UserId, ev.ChatId)
+}
@@ -0,0 +1,53 @@
+package broadcastcontroller
+
+import (
+	"log"
+
+	"messenger_engine/models/event"
+)
+
+// EventObserver is shown every event the dispatcher delivers, whether it was published
+// locally or relayed from another instance. It is implemented by *chathandler.ChatsHandler,
+// which turns the events into inbox updates.
+type EventObserver interface {
+	Observe(ev event.Event)
+}
+
+// OnEvent registers the observer shown every delivered event. Events are handed over in order
+// by a single goroutine started by HandleMessages, so the observer may block on the database
+// without stalling the dispatcher.
+//
+// Parameters:
+//   - observer: The observer to notify; nil stops notifications.
+func (b *Broadcast) OnEvent(observer EventObserver) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.observer = observer
+}
+
+// queueObserved schedules the event for the observer. Like presence, observation is best
+// effort: when the queue is full the event is dropped instead of blocking the dispatcher.
+func (b *Broadcast) queueObserved(ev event.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.observer == nil {
+		return
+	}
+	select {
+	case b.observed <- ev:
+	default:
+		log.Printf("Observer queue full, dropping %s event of chat %d", ev.Type, ev.ChatId)
+	}
+}
+
+// notifyObserver hands queued events to the observer, one at a time.
+func (b *Broadcast) notifyObserver() {
+	for ev := range b.observed {
+		b.mu.Lock()
+		observer := b.observer
+		b.mu.Unlock()
+		if observer != nil {
+			observer.Observe(ev)
+		}
+	}
+}
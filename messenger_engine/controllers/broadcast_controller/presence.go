@@ -0,0 +1,106 @@
+package broadcastcontroller
+
+import (
+	"encoding/json"
+	"log"
+
+	"messenger_engine/models/event"
+	"messenger_engine/models/presence"
+)
+
+// PresenceListener is told when a user's first connection to this instance opens
+// and when their last one closes. It is implemented by *PresenceController.PresenceController.
+type PresenceListener interface {
+	UserConnected(userId int)
+	UserDisconnected(userId int)
+}
+
+// presenceChange is a pending notification of the PresenceListener.
+type presenceChange struct {
+	userId int
+	online bool
+}
+
+// OnPresence registers the listener notified about users coming online and going offline.
+// Notifications are delivered in order by a single goroutine started by HandleMessages,
+// so the listener may block on the database without stalling the dispatcher.
+//
+// Parameters:
+//   - listener: The listener to notify; nil stops notifications.
+func (b *Broadcast) OnPresence(listener PresenceListener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.listener = listener
+}
+
+// IsOnline reports whether the user has a live connection to this instance,
+// or was last announced online by another instance.
+//
+// Parameters:
+//   - userId: The ID of the user.
+func (b *Broadcast) IsOnline(userId int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.users[userId]) > 0 || b.presence[userId]
+}
+
+// queuePresenceLocked schedules a notification of the listener. Presence is best effort:
+// when the queue is full the change is dropped instead of blocking. The caller must hold b.mu.
+func (b *Broadcast) queuePresenceLocked(userId int, online bool) {
+	if b.listener == nil {
+		return
+	}
+	select {
+	case b.changes <- presenceChange{userId: userId, online: online}:
+	default:
+		log.Printf("Presence queue full, dropping presence change of user %d", userId)
+	}
+}
+
+// notifyPresence hands queued presence changes to the listener, one at a time.
+func (b *Broadcast) notifyPresence() {
+	for change := range b.changes {
+		b.mu.Lock()
+		listener := b.listener
+		b.mu.Unlock()
+		if listener == nil {
+			continue
+		}
+
+		if change.online {
+			listener.UserConnected(change.userId)
+		} else {
+			listener.UserDisconnected(change.userId)
+		}
+	}
+}
+
+// trackPresence remembers the state announced by a presence event, so users connected to
+// other instances are reported online too. When another instance announces a user offline
+// who is still connected here, the user is announced online again.
+func (b *Broadcast) trackPresence(ev event.Event) {
+	var state presence.Presence
+	switch payload := ev.Payload.(type) {
+	case presence.Presence:
+		state = payload
+	case json.RawMessage:
+		// Events relayed from other instances carry their payload as raw JSON
+		if err := json.Unmarshal(payload, &state); err != nil {
+			log.Printf("Error decoding presence event: %v", err)
+			return
+		}
+	default:
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state.Online {
+		b.presence[state.UserId] = true
+		return
+	}
+	delete(b.presence, state.UserId)
+	if len(b.users[state.UserId]) > 0 {
+		b.queuePresenceLocked(state.UserId, true)
+	}
+}
@@ -1,129 +1,252 @@
 package chatcontroller
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
-	"strconv"
 
 	BaseController "messenger_engine/controllers/base_controller"
-	UlrResponse "messenger_engine/models/presigned_url"
-	UrlController "messenger_engine/controllers/url_controller"
+	Chats "messenger_engine/models/chat"
 )
 
 // ChatController manages chat-related operations, including fetching user chats.
 type ChatController struct {
 	*BaseController.BaseController      // Embeds the base controller for shared functionality
-	UrlFetcher UrlController.HttpPresignedUrlFetcher // Fetcher for retrieving presigned URLs for avatars
+	Avatars UrlResolver // Resolves the presigned URLs of avatars; nil leaves avatars out of chat lists
+	Presence OnlineChecker // Tells whether chat partners are online; nil leaves presence out of chat lists
 }
 
-// GetUserChats retrieves a user's chats from the database by their user ID.
-// It fetches the most recent chat message for each chat, including the content, timestamp, receiver info, and avatar URL.
-func (gmc *ChatController) GetUserChats(UserID int) ([]byte, error) {
-	// Get the database connection
+// UrlResolver fetches the presigned URLs of a whole result set at once.
+// It is implemented by *urlresolver.Resolver.
+type UrlResolver interface {
+	Resolve(ctx context.Context, urls []string) map[string][]string
+}
+
+// OnlineChecker reports whether a user has a live connection.
+// It is implemented by *Broadcast.Broadcast.
+type OnlineChecker interface {
+	IsOnline(userId int) bool
+}
+
+const (
+	// DefaultInboxLimit is the page size used when an inbox request does not specify one.
+	DefaultInboxLimit = 20
+	// MaxInboxLimit caps the page size of a single inbox request.
+	MaxInboxLimit = 100
+)
+
+// inboxQuery selects the inbox entries of user $1; callers append the conditions and the
+// order on the entries, aliased i. A user takes part in the chats they are a member of,
+// the same membership IsParticipant checks before a chat is read.
+// Messages the user deleted for themselves are skipped when picking the latest message.
+const inboxQuery = `
+	WITH user_chats AS (
+		SELECT chat_id FROM base_chat_member WHERE user_id = $1
+	), inbox AS (
+		SELECT uc.chat_id, c.is_group, c.title, c.avatar_url,
+			last.id AS message_id, last.content, last.author_id, last.timestamp, last.is_deleted,
+			COALESCE(last.timestamp, c.created_at) AS last_activity_at
+		FROM user_chats AS uc
+		JOIN base_chat AS c ON c.id = uc.chat_id
+		LEFT JOIN LATERAL (
+			SELECT m.id, m.content, m.author_id, m.timestamp, m.is_deleted
+			FROM base_chatmessage AS m
+			WHERE m.chat_id = uc.chat_id
+				AND NOT EXISTS (SELECT 1 FROM base_chatmessage_hidden AS h WHERE h.message_id = m.id AND h.user_id = $1)
+			ORDER BY m.id DESC
+			LIMIT 1
+		) AS last ON true
+	)
+	SELECT i.chat_id, i.is_group, i.title, i.avatar_url,
+		i.message_id, CASE WHEN i.is_deleted THEN '' ELSE i.content END, i.author_id, i.timestamp,
+		COALESCE(i.is_deleted, false), i.last_activity_at,
+		(SELECT count(*) FROM base_chatmessage AS m
+			WHERE m.chat_id = i.chat_id AND m.author_id <> $1 AND NOT m.is_deleted
+				AND m.seq > COALESCE((SELECT r.last_read_seq FROM base_chat_read AS r
+					WHERE r.chat_id = i.chat_id AND r.user_id = $1), 0)),
+		(SELECT COALESCE(json_agg(json_build_object('user_id', p.user_id, 'username', COALESCE(u.username, ''))
+				ORDER BY p.user_id), '[]')
+			FROM base_chat_member AS p
+			LEFT JOIN base_user AS u ON u.id = p.user_id
+			WHERE p.chat_id = i.chat_id AND p.user_id <> $1)
+	FROM inbox AS i
+	WHERE i.last_activity_at IS NOT NULL`
+
+// GetUserChats lists a page of a user's inbox: one entry per chat the user takes part in,
+// with its latest message from either side, the other participants and the number of
+// messages the user has not read yet. Chats are ordered by their last activity, newest first.
+// Participants of 1:1 chats carry their avatar URL, and when a Presence checker is configured,
+// every participant also tells whether they are online.
+//
+// Parameters:
+//   - query: The InboxQuery describing the user, the cursor and the page size.
+//
+// Returns:
+//   - An InboxPage with the chats and whether chats that were active earlier exist.
+//   - An error if the query fails.
+func (gmc *ChatController) GetUserChats(query Chats.InboxQuery) (Chats.InboxPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultInboxLimit
+	}
+	if limit > MaxInboxLimit {
+		limit = MaxInboxLimit
+	}
+
+	var before Chats.InboxCursor
+	if query.Before != nil {
+		before = *query.Before
+	}
+
 	db := gmc.Database.GetConnection()
 
-	// SQL query to fetch the most recent chat message for each chat
-	query := `
-		SELECT 
-			bcm.content, 
-			bcm.timestamp, 
-			bcm.chat_id, 
-			bcm.receiver_id, 
-			base_user.username AS receiver_username 
-
-		FROM base_chatmessage AS bcm
-		
-		LEFT JOIN (
-			SELECT id, username
-			FROM base_user
-		) base_user ON bcm.receiver_id = base_user.id
-		
-		WHERE bcm.author_id = $1
-
-		GROUP BY bcm.content, bcm.timestamp, bcm.chat_id, bcm.receiver_id, username
-		ORDER BY timestamp DESC
-
-		LIMIT 1
-	`
-
-	// Execute the query
-	rows, err := db.Query(query, UserID)
+	// Fetch the chats last active before the cursor, plus one extra row to find out whether another page exists
+	rows, err := db.Query(inboxQuery+`
+		AND ($3 = 0 OR (i.last_activity_at, i.chat_id) < ($2::timestamptz, $3))
+		ORDER BY i.last_activity_at DESC, i.chat_id DESC
+		LIMIT $4`, query.UserId, before.LastActivityAt, max(before.ChatId, 0), limit+1)
 	if err != nil {
-		// Log the error and return it
-		fmt.Printf("Error executing query: %v", err)
-		return nil, err
+		return Chats.InboxPage{}, fmt.Errorf("error loading chats: %w", err)
 	}
 	defer rows.Close() // Ensure the rows are closed after processing
 
-	var results []map[string]interface{} // Holds the results to be returned
-
-	// Iterate through the query results
+	entries := []Chats.InboxEntry{}
 	for rows.Next() {
-		var (
-			content          string
-			timestamp        string
-			chatID           int
-			receiverID       int
-			receiverUsername string
-		)
-
-		// Scan the row into the variables
-		err := rows.Scan(&content, &timestamp, &chatID, &receiverID, &receiverUsername)
+		entry, err := scanInboxEntry(rows)
 		if err != nil {
-			// Log scanning error and return it
-			fmt.Printf("Error scanning row: %v", err)
-			return nil, err
+			return Chats.InboxPage{}, fmt.Errorf("error scanning row: %w", err)
 		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return Chats.InboxPage{}, fmt.Errorf("error iterating rows: %w", err)
+	}
 
-		// Create a map to store the chat data
-		chatsDict := map[string]interface{}{
-			"messge_content":            content,
-			"message_timestamp":         timestamp,
-			"chat_id":                   chatID,
-			"message_receiver_id":       receiverID,
-			"message_receiver_username": receiverUsername,
-		}
+	page := Chats.InboxPage{HasMore: len(entries) > limit}
+	if page.HasMore {
+		entries = entries[:limit]
+	}
+	if len(entries) > 0 {
+		last := entries[len(entries)-1]
+		page.NextCursor = &Chats.InboxCursor{LastActivityAt: last.LastActivityAt, ChatId: last.ChatId}
+	}
 
-		// Convert the user ID to string for the URL
-		StrUserId := strconv.Itoa(UserID)
+	gmc.describeParticipants(entries)
+	page.Chats = entries
+	return page, nil
+}
 
-		// Prepare the URL for fetching the avatar
-		urlString := fmt.Sprintf("http://127.0.0.1:8165?user_id=%s", StrUserId)
+// GetInboxEntry loads a single chat as it appears in a user's inbox, e.g. to push the change
+// of a chat to the user's open inbox.
+//
+// Parameters:
+//   - userId: ID of the user whose inbox is shown.
+//   - chatId: ID of the chat.
+//
+// Returns:
+//   - The chat's InboxEntry.
+//   - Whether the chat is in the user's inbox; false once the user no longer takes part in it.
+//   - An error if the query fails.
+func (gmc *ChatController) GetInboxEntry(userId, chatId int) (Chats.InboxEntry, bool, error) {
+	db := gmc.Database.GetConnection()
 
-		// Channels for receiving the presigned URL or error response
-		responseCh := make(chan *UlrResponse.PresignedUrlResponse)
-		errorCh := make(chan string)
+	rows, err := db.Query(inboxQuery+` AND i.chat_id = $2`, userId, chatId)
+	if err != nil {
+		return Chats.InboxEntry{}, false, fmt.Errorf("error loading chat: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return Chats.InboxEntry{}, false, fmt.Errorf("error loading chat: %w", err)
+		}
+		return Chats.InboxEntry{}, false, nil
+	}
+	entry, err := scanInboxEntry(rows)
+	if err != nil {
+		return Chats.InboxEntry{}, false, fmt.Errorf("error scanning row: %w", err)
+	}
+
+	entries := []Chats.InboxEntry{entry}
+	gmc.describeParticipants(entries)
+	return entries[0], true, nil
+}
 
-		// Asynchronously fetch the presigned URL for the user's avatar
-		go gmc.UrlFetcher.Fetch(urlString)
+// scanInboxEntry reads a row of inboxQuery.
+func scanInboxEntry(rows *sql.Rows) (Chats.InboxEntry, error) {
+	var (
+		entry        Chats.InboxEntry
+		messageId    sql.NullInt64
+		content      sql.NullString
+		authorId     sql.NullInt64
+		timestamp    sql.NullTime
+		isDeleted    bool
+		participants []byte
+	)
+	err := rows.Scan(&entry.ChatId, &entry.IsGroup, &entry.Title, &entry.AvatarUrl,
+		&messageId, &content, &authorId, &timestamp, &isDeleted, &entry.LastActivityAt,
+		&entry.UnreadCount, &participants)
+	if err != nil {
+		return entry, err
+	}
 
-		// Handle the response or error from the URL fetch
-		select {
-		case response := <-responseCh:
-			// Add the fetched avatar URL to the chat data
-			chatsDict["user_avatar_url"] = response.PresignedURL
-		case err := <-errorCh:
-			// Log any error that occurs while fetching the avatar URL
-			fmt.Printf("Received error: %s\n", err)
+	if messageId.Valid {
+		entry.LastMessage = &Chats.InboxMessage{
+			MessageId: int(messageId.Int64),
+			Content:   content.String,
+			AuthorId:  int(authorId.Int64),
+			Timestamp: timestamp.Time,
+			IsDeleted: isDeleted,
 		}
+	}
 
-		// Append the chat data to the results list
-		results = append(results, chatsDict)
+	entry.Participants = []Chats.Participant{}
+	if len(participants) > 0 {
+		if err := json.Unmarshal(participants, &entry.Participants); err != nil {
+			return entry, fmt.Errorf("error decoding participants: %w", err)
+		}
 	}
+	return entry, nil
+}
 
-	// Check for errors during row iteration
-	if err := rows.Err(); err != nil {
-		// Log any error and return it
-		fmt.Printf("Error iterating rows: %v", err)
-		return nil, err
+// describeParticipants adds avatar URLs to the participants of 1:1 chats when an avatar
+// resolver is configured and, when a Presence checker is configured, whether each participant
+// is online. The avatars of all entries are resolved at once; those that cannot be resolved
+// are left out.
+func (gmc *ChatController) describeParticipants(entries []Chats.InboxEntry) {
+	var avatarURLs []string
+	for i := range entries {
+		for j := range entries[i].Participants {
+			participant := &entries[i].Participants[j]
+			if gmc.Presence != nil {
+				online := gmc.Presence.IsOnline(participant.UserId)
+				participant.Online = &online
+			}
+			if !entries[i].IsGroup {
+				avatarURLs = append(avatarURLs, avatarURL(participant.UserId))
+			}
+		}
+	}
+	if gmc.Avatars == nil || len(avatarURLs) == 0 {
+		return
 	}
 
-	// Marshal the results into JSON format for the response
-	jsonData, err := json.Marshal(results)
-	if err != nil {
-		// Handle any error during JSON marshaling
-		return nil, err
+	avatars := gmc.Avatars.Resolve(context.Background(), avatarURLs)
+	for i := range entries {
+		if entries[i].IsGroup {
+			continue
+		}
+		for j := range entries[i].Participants {
+			participant := &entries[i].Participants[j]
+			if urls := avatars[avatarURL(participant.UserId)]; len(urls) > 0 {
+				participant.AvatarUrl = urls[0]
+			}
+		}
 	}
+}
 
-	return jsonData, nil
+// avatarURL returns the media service URL answering with the presigned URL of a user's avatar.
+func avatarURL(userId int) string {
+	return fmt.Sprintf("%s?user_id=%d", BaseController.MediaServiceURL, userId)
 }
@@ -0,0 +1,74 @@
+package chatcontroller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	Chats "messenger_engine/models/chat"
+)
+
+// OpenDirectChat returns the 1:1 chat of two users, creating it the first time one of them
+// writes to the other. Every pair of users has at most one 1:1 chat, and its ID is taken from
+// the same sequence as the IDs of group chats, so clients never choose chat IDs themselves.
+//
+// Parameters:
+//   - authorId: ID of the user posting the message, who becomes the owner of a new chat.
+//   - receiverId: ID of the other participant; the author's own ID opens a chat with themselves.
+//
+// Returns:
+//   - The chat with its members.
+//   - ErrNotChatMember if the author no longer takes part in the pair's chat,
+//     or another error if the chat could not be opened.
+func (gmc *ChatController) OpenDirectChat(authorId, receiverId int) (Chats.Chat, error) {
+	db := gmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	// A concurrent first message of the other user waits on the unique pair and then
+	// finds the chat it created
+	var chatId int
+	err = tx.QueryRow(`
+		INSERT INTO base_chat (creator_id, is_group, direct_user_low, direct_user_high)
+		VALUES ($1, false, LEAST($1::integer, $2::integer), GREATEST($1::integer, $2::integer))
+		ON CONFLICT (direct_user_low, direct_user_high) WHERE NOT is_group DO NOTHING
+		RETURNING id`, authorId, receiverId).Scan(&chatId)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		err = tx.QueryRow(`
+			SELECT id FROM base_chat
+			WHERE NOT is_group AND direct_user_low = LEAST($1::integer, $2::integer) AND direct_user_high = GREATEST($1::integer, $2::integer)`,
+			authorId, receiverId).Scan(&chatId)
+		if err != nil {
+			return Chats.Chat{}, fmt.Errorf("error loading chat: %w", err)
+		}
+	case err != nil:
+		return Chats.Chat{}, fmt.Errorf("error creating chat: %w", err)
+	default:
+		if _, err := insertMember(tx, chatId, authorId, Chats.RoleOwner); err != nil {
+			return Chats.Chat{}, err
+		}
+		if receiverId != authorId {
+			if _, err := insertMember(tx, chatId, receiverId, Chats.RoleMember); err != nil {
+				return Chats.Chat{}, err
+			}
+		}
+	}
+
+	chat, err := loadChat(tx, chatId, false)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	if _, ok := chat.Member(authorId); !ok {
+		return Chats.Chat{}, ErrNotChatMember
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return chat, nil
+}
@@ -0,0 +1,390 @@
+package chatcontroller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	Chats "messenger_engine/models/chat"
+)
+
+var (
+	// ErrChatNotFound is returned when the referenced chat does not exist.
+	ErrChatNotFound = errors.New("chat not found")
+	// ErrNotChatMember is returned when a user acts on a chat they do not belong to.
+	ErrNotChatMember = errors.New("user is not a member of this chat")
+	// ErrInsufficientRole is returned when a member's role does not allow the operation.
+	ErrInsufficientRole = errors.New("insufficient role for this operation")
+	// ErrAlreadyMember is returned when adding a user who already belongs to the chat.
+	ErrAlreadyMember = errors.New("user is already a member of this chat")
+	// ErrNotGroupChat is returned when managing the membership of a 1:1 chat.
+	ErrNotGroupChat = errors.New("membership of 1:1 chats cannot be changed")
+)
+
+// queryer is implemented by both *sql.DB and *sql.Tx.
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// loadChat loads a chat with its members, in the order they joined.
+// When lock is set, the chat row stays locked until the transaction ends,
+// so membership changes of the same chat are applied one after another.
+func loadChat(q queryer, chatId int, lock bool) (Chats.Chat, error) {
+	query := `SELECT id, title, avatar_url, COALESCE(creator_id, 0), is_group, created_at FROM base_chat WHERE id = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+
+	var chat Chats.Chat
+	err := q.QueryRow(query, chatId).
+		Scan(&chat.ChatId, &chat.Title, &chat.AvatarUrl, &chat.CreatorId, &chat.IsGroup, &chat.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chats.Chat{}, ErrChatNotFound
+	}
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error loading chat: %w", err)
+	}
+
+	rows, err := q.Query(`
+		SELECT user_id, role, joined_at FROM base_chat_member
+		WHERE chat_id = $1
+		ORDER BY joined_at, user_id`, chatId)
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error loading chat members: %w", err)
+	}
+	defer rows.Close()
+
+	chat.Members = []Chats.Member{}
+	for rows.Next() {
+		var member Chats.Member
+		if err := rows.Scan(&member.UserId, &member.Role, &member.JoinedAt); err != nil {
+			return Chats.Chat{}, fmt.Errorf("error scanning chat member: %w", err)
+		}
+		chat.Members = append(chat.Members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error iterating chat members: %w", err)
+	}
+	return chat, nil
+}
+
+// insertMember adds a user to the chat inside the transaction.
+//
+// Returns:
+//   - The new membership with the time the user joined.
+//   - An error if the membership could not be saved.
+func insertMember(tx *sql.Tx, chatId, userId int, role Chats.Role) (Chats.Member, error) {
+	member := Chats.Member{UserId: userId, Role: role}
+	err := tx.QueryRow(`
+		INSERT INTO base_chat_member (chat_id, user_id, role) VALUES ($1, $2, $3)
+		RETURNING joined_at`, chatId, userId, role).Scan(&member.JoinedAt)
+	if err != nil {
+		return Chats.Member{}, fmt.Errorf("error adding chat member: %w", err)
+	}
+	return member, nil
+}
+
+// GetChat retrieves a chat with its metadata and members.
+//
+// Parameters:
+//   - chatId: ID of the chat to load.
+//
+// Returns:
+//   - The chat with its members, in the order they joined.
+//   - ErrChatNotFound if the chat does not exist, or another error if it could not be loaded.
+func (gmc *ChatController) GetChat(chatId int) (Chats.Chat, error) {
+	return loadChat(gmc.Database.GetConnection(), chatId, false)
+}
+
+// CreateChat creates a group chat owned by its creator.
+// The other members join as plain members; duplicates and the creator are skipped.
+//
+// Parameters:
+//   - creatorId: ID of the user creating the chat, who becomes its owner.
+//   - title: Display name of the chat.
+//   - avatarUrl: URL of the chat's avatar; may be empty.
+//   - memberIds: IDs of the users to add besides the creator.
+//
+// Returns:
+//   - The created chat with its members.
+//   - An error if the chat could not be created.
+func (gmc *ChatController) CreateChat(creatorId int, title, avatarUrl string, memberIds []int) (Chats.Chat, error) {
+	db := gmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	chat := Chats.Chat{Title: strings.TrimSpace(title), AvatarUrl: avatarUrl, CreatorId: creatorId, IsGroup: true}
+	err = tx.QueryRow(`
+		INSERT INTO base_chat (title, avatar_url, creator_id, is_group) VALUES ($1, $2, $3, true)
+		RETURNING id, created_at`, chat.Title, chat.AvatarUrl, chat.CreatorId).Scan(&chat.ChatId, &chat.CreatedAt)
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error creating chat: %w", err)
+	}
+
+	owner, err := insertMember(tx, chat.ChatId, creatorId, Chats.RoleOwner)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	chat.Members = []Chats.Member{owner}
+
+	for _, userId := range memberIds {
+		if _, ok := chat.Member(userId); ok {
+			continue
+		}
+		member, err := insertMember(tx, chat.ChatId, userId, Chats.RoleMember)
+		if err != nil {
+			return Chats.Chat{}, err
+		}
+		chat.Members = append(chat.Members, member)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return chat, nil
+}
+
+// AddMember adds a user to a group chat. Admins and the owner may add members;
+// only the owner may add someone directly as an admin.
+//
+// Parameters:
+//   - actorId: ID of the member adding the user.
+//   - chatId: ID of the chat.
+//   - userId: ID of the user to add.
+//   - role: Role of the new member; empty means member.
+//
+// Returns:
+//   - The chat after the change.
+//   - ErrChatNotFound, ErrNotGroupChat, ErrNotChatMember, ErrInsufficientRole or
+//     ErrAlreadyMember if the change is not allowed, or another error if it could not be saved.
+func (gmc *ChatController) AddMember(actorId, chatId, userId int, role Chats.Role) (Chats.Chat, error) {
+	if role == "" {
+		role = Chats.RoleMember
+	}
+
+	db := gmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	chat, err := loadChat(tx, chatId, true)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	if !chat.IsGroup {
+		return Chats.Chat{}, ErrNotGroupChat
+	}
+	actor, ok := chat.Member(actorId)
+	if !ok {
+		return Chats.Chat{}, ErrNotChatMember
+	}
+	if !actor.Role.Outranks(role) {
+		return Chats.Chat{}, ErrInsufficientRole
+	}
+	if _, ok := chat.Member(userId); ok {
+		return Chats.Chat{}, ErrAlreadyMember
+	}
+
+	member, err := insertMember(tx, chatId, userId, role)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	chat.Members = append(chat.Members, member)
+
+	if err := tx.Commit(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return chat, nil
+}
+
+// RemoveMember removes a user from a group chat. The actor must outrank the member:
+// admins remove plain members, the owner removes anyone else.
+// Removing oneself is the same as leaving the chat.
+//
+// Parameters:
+//   - actorId: ID of the member removing the user.
+//   - chatId: ID of the chat.
+//   - userId: ID of the member to remove.
+//
+// Returns:
+//   - The chat after the change.
+//   - ErrChatNotFound, ErrNotGroupChat, ErrNotChatMember or ErrInsufficientRole if the
+//     change is not allowed, or another error if it could not be saved.
+func (gmc *ChatController) RemoveMember(actorId, chatId, userId int) (Chats.Chat, error) {
+	if actorId == userId {
+		return gmc.LeaveChat(userId, chatId)
+	}
+
+	db := gmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	chat, err := loadChat(tx, chatId, true)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	if !chat.IsGroup {
+		return Chats.Chat{}, ErrNotGroupChat
+	}
+	actor, ok := chat.Member(actorId)
+	if !ok {
+		return Chats.Chat{}, ErrNotChatMember
+	}
+	target, ok := chat.Member(userId)
+	if !ok {
+		return Chats.Chat{}, ErrNotChatMember
+	}
+	if !actor.Role.Outranks(target.Role) {
+		return Chats.Chat{}, ErrInsufficientRole
+	}
+
+	if _, err := tx.Exec(`DELETE FROM base_chat_member WHERE chat_id = $1 AND user_id = $2`, chatId, userId); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error removing chat member: %w", err)
+	}
+	chat.Members = withoutMember(chat.Members, userId)
+
+	if err := tx.Commit(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return chat, nil
+}
+
+// LeaveChat removes a user from a group chat at their own request.
+// When the owner leaves, ownership passes to the longest-standing admin,
+// or to the longest-standing member if there is no admin.
+//
+// Parameters:
+//   - userId: ID of the member leaving.
+//   - chatId: ID of the chat.
+//
+// Returns:
+//   - The chat after the change.
+//   - ErrChatNotFound, ErrNotGroupChat or ErrNotChatMember if the change is not allowed,
+//     or another error if it could not be saved.
+func (gmc *ChatController) LeaveChat(userId, chatId int) (Chats.Chat, error) {
+	db := gmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	chat, err := loadChat(tx, chatId, true)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	if !chat.IsGroup {
+		return Chats.Chat{}, ErrNotGroupChat
+	}
+	leaving, ok := chat.Member(userId)
+	if !ok {
+		return Chats.Chat{}, ErrNotChatMember
+	}
+
+	if _, err := tx.Exec(`DELETE FROM base_chat_member WHERE chat_id = $1 AND user_id = $2`, chatId, userId); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error removing chat member: %w", err)
+	}
+	chat.Members = withoutMember(chat.Members, userId)
+
+	if leaving.Role == Chats.RoleOwner && len(chat.Members) > 0 {
+		successor := successorIndex(chat.Members)
+		if _, err := tx.Exec(`UPDATE base_chat_member SET role = $3 WHERE chat_id = $1 AND user_id = $2`,
+			chatId, chat.Members[successor].UserId, Chats.RoleOwner); err != nil {
+			return Chats.Chat{}, fmt.Errorf("error transferring chat ownership: %w", err)
+		}
+		chat.Members[successor].Role = Chats.RoleOwner
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return chat, nil
+}
+
+// RenameChat changes the title of a group chat and, when avatarUrl is not nil, its avatar.
+// Admins and the owner may rename the chat.
+//
+// Parameters:
+//   - actorId: ID of the member renaming the chat.
+//   - chatId: ID of the chat.
+//   - title: The new title.
+//   - avatarUrl: The new avatar URL, or nil to keep the current one.
+//
+// Returns:
+//   - The chat after the change.
+//   - ErrChatNotFound, ErrNotGroupChat, ErrNotChatMember or ErrInsufficientRole if the
+//     change is not allowed, or another error if it could not be saved.
+func (gmc *ChatController) RenameChat(actorId, chatId int, title string, avatarUrl *string) (Chats.Chat, error) {
+	db := gmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Chats.Chat{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	chat, err := loadChat(tx, chatId, true)
+	if err != nil {
+		return Chats.Chat{}, err
+	}
+	if !chat.IsGroup {
+		return Chats.Chat{}, ErrNotGroupChat
+	}
+	actor, ok := chat.Member(actorId)
+	if !ok {
+		return Chats.Chat{}, ErrNotChatMember
+	}
+	if !actor.Role.CanManageChat() {
+		return Chats.Chat{}, ErrInsufficientRole
+	}
+
+	chat.Title = strings.TrimSpace(title)
+	if avatarUrl != nil {
+		chat.AvatarUrl = *avatarUrl
+	}
+	if _, err := tx.Exec(`UPDATE base_chat SET title = $2, avatar_url = $3 WHERE id = $1`,
+		chatId, chat.Title, chat.AvatarUrl); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error renaming chat: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Chats.Chat{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return chat, nil
+}
+
+// withoutMember returns the members without the given user.
+func withoutMember(members []Chats.Member, userId int) []Chats.Member {
+	remaining := make([]Chats.Member, 0, len(members))
+	for _, member := range members {
+		if member.UserId != userId {
+			remaining = append(remaining, member)
+		}
+	}
+	return remaining
+}
+
+// successorIndex picks the member who inherits ownership: the admin who joined first,
+// or the member who joined first if there is no admin. Members must be ordered by join time.
+func successorIndex(members []Chats.Member) int {
+	for i, member := range members {
+		if member.Role == Chats.RoleAdmin {
+			return i
+		}
+	}
+	return 0
+}
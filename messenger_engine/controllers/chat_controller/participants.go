@@ -0,0 +1,47 @@
+package chatcontroller
+
+import (
+	"fmt"
+)
+
+// IsParticipant reports whether the user takes part in the chat.
+// The members of a chat row are its participants; every chat with messages has one.
+//
+// Parameters:
+//   - userId: ID of the user.
+//   - chatId: ID of the chat.
+//
+// Returns:
+//   - Whether the user may read and subscribe to the chat.
+//   - An error if the membership could not be checked.
+func (gmc *ChatController) IsParticipant(userId, chatId int) (bool, error) {
+	return gmc.checkParticipant(userId, chatId)
+}
+
+// CanPost reports whether the user may post to the chat. Only the participants of an existing
+// chat may post to it; 1:1 chats are opened with OpenDirectChat before their first message.
+//
+// Parameters:
+//   - userId: ID of the author.
+//   - chatId: ID of the chat.
+//
+// Returns:
+//   - Whether the user may post to the chat.
+//   - An error if the membership could not be checked.
+func (gmc *ChatController) CanPost(userId, chatId int) (bool, error) {
+	return gmc.checkParticipant(userId, chatId)
+}
+
+// checkParticipant reports whether the user is a member of the chat.
+func (gmc *ChatController) checkParticipant(userId, chatId int) (bool, error) {
+	db := gmc.Database.GetConnection()
+
+	var participant bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM base_chat_member WHERE chat_id = $1 AND user_id = $2)`,
+		chatId, userId).Scan(&participant)
+	if err != nil {
+		return false, fmt.Errorf("error checking chat membership: %w", err)
+	}
+	return participant, nil
+}
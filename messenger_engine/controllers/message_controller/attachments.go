@@ -0,0 +1,108 @@
+package messagecontroller
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	BaseController "messenger_engine/controllers/base_controller"
+	Messages "messenger_engine/models/message"
+)
+
+// ErrForeignAttachment is returned when a message references media uploaded by another user.
+var ErrForeignAttachment = errors.New("attachments must be uploaded by the message author")
+
+// UrlResolver fetches the presigned URLs of a whole page of messages at once.
+// It is implemented by *urlresolver.Resolver.
+type UrlResolver interface {
+	Resolve(ctx context.Context, urls []string) map[string][]string
+}
+
+// messageAttachments collects the attachments of every base_chatmessage row (aliased m) as a
+// JSON array in the order they were sent.
+const messageAttachments = `
+	LEFT JOIN LATERAL (
+		SELECT json_agg(json_build_object(
+			'media_id', a.media_id, 'mime_type', a.mime_type, 'size', a.size,
+			'width', COALESCE(a.width, 0), 'height', COALESCE(a.height, 0),
+			'duration_ms', COALESCE(a.duration_ms, 0))
+			ORDER BY a.position) AS attachments
+		FROM base_chatmessage_attachment AS a
+		WHERE a.message_id = m.id
+	) AS at ON true`
+
+// checkAttachments verifies that every attachment was uploaded by the author. The media service
+// stores the uploads of a user under "attachments/<user_id>/", so nobody can attach the files
+// of somebody else by guessing their media IDs.
+func checkAttachments(authorId int, attachments []Messages.Attachment) error {
+	prefix := fmt.Sprintf("attachments/%d/", authorId)
+	for _, attachment := range attachments {
+		if !strings.HasPrefix(attachment.MediaId, prefix) {
+			return ErrForeignAttachment
+		}
+	}
+	return nil
+}
+
+// saveAttachments stores the attachments of a new message inside its transaction.
+func saveAttachments(tx *sql.Tx, messageId int, attachments []Messages.Attachment) error {
+	for position, attachment := range attachments {
+		_, err := tx.Exec(`
+			INSERT INTO base_chatmessage_attachment (message_id, position, media_id, mime_type, size, width, height, duration_ms)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), NULLIF($8, 0))`,
+			messageId, position, attachment.MediaId, attachment.MimeType, attachment.Size,
+			attachment.Width, attachment.Height, attachment.DurationMs)
+		if err != nil {
+			return fmt.Errorf("error saving attachment: %w", err)
+		}
+	}
+	return nil
+}
+
+// signAttachments sets the Url of every attachment to a presigned download URL. The URLs of
+// all attachments are resolved at once; those that cannot be resolved stay empty.
+//
+// Parameters:
+//   - attachments: The attachments to sign, typically of a whole page of messages.
+func (mmc *MessageController) signAttachments(attachments []*Messages.Attachment) {
+	if mmc.Media == nil || len(attachments) == 0 {
+		return
+	}
+
+	urls := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		urls = append(urls, attachmentURL(attachment.MediaId))
+	}
+	resolved := mmc.Media.Resolve(context.Background(), urls)
+	for _, attachment := range attachments {
+		if presigned := resolved[attachmentURL(attachment.MediaId)]; len(presigned) > 0 {
+			attachment.Url = presigned[0]
+		}
+	}
+}
+
+// attachmentsOf returns pointers to the attachments of the messages, to be signed in place.
+func attachmentsOf(messages []Messages.Message) []*Messages.Attachment {
+	var attachments []*Messages.Attachment
+	for i := range messages {
+		attachments = append(attachments, refs(messages[i].Attachments)...)
+	}
+	return attachments
+}
+
+// refs returns pointers to the attachments, to be signed in place.
+func refs(attachments []Messages.Attachment) []*Messages.Attachment {
+	pointers := make([]*Messages.Attachment, 0, len(attachments))
+	for i := range attachments {
+		pointers = append(pointers, &attachments[i])
+	}
+	return pointers
+}
+
+// attachmentURL returns the media service URL answering with the presigned URL of an attachment.
+func attachmentURL(mediaId string) string {
+	return fmt.Sprintf("%s?media_id=%s", BaseController.MediaServiceURL, url.QueryEscape(mediaId))
+}
@@ -1,68 +1,585 @@
 package messagecontroller
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 
 	BaseController "messenger_engine/controllers/base_controller"
 	Messages "messenger_engine/models/message"
 )
 
+var (
+	// ErrMessageNotFound is returned when the referenced message does not exist.
+	ErrMessageNotFound = errors.New("message not found")
+	// ErrNotMessageAuthor is returned when a user tries to change a message they did not write.
+	ErrNotMessageAuthor = errors.New("only the author can change this message")
+	// ErrMessageDeleted is returned when a user tries to edit a deleted message.
+	ErrMessageDeleted = errors.New("message has been deleted")
+)
+
 // MessageController handles message-related logic, including saving and loading messages.
 type MessageController struct {
-	*BaseController.BaseController // Embeds the base controller for shared functionality
+	*BaseController.BaseController             // Embeds the base controller for shared functionality
+	Media                          UrlResolver // Resolves the presigned URLs of attachments; nil leaves them empty
+}
+
+// nextChatSeq allocates the next sequence number of a chat inside the transaction.
+// The counter row stays locked until the transaction ends, so messages of the same
+// chat are numbered one after another without gaps or duplicates.
+func nextChatSeq(tx *sql.Tx, chatId int) (int64, error) {
+	var seq int64
+	err := tx.QueryRow(`
+		INSERT INTO base_chat_sequence (chat_id, last_seq) VALUES ($1, 1)
+		ON CONFLICT (chat_id) DO UPDATE SET last_seq = base_chat_sequence.last_seq + 1
+		RETURNING last_seq`, chatId).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("error allocating chat sequence: %w", err)
+	}
+	return seq, nil
+}
+
+// findByClientMsgId loads the identity of a message an author already stored under
+// the given client_msg_id: its ID, chat, sequence number, timestamp and attachments.
+func (mmc *MessageController) findByClientMsgId(authorId int, clientMsgId string) (Messages.Message, error) {
+	db := mmc.Database.GetConnection()
+
+	stored := Messages.Message{AuthorId: authorId, ClientMsgId: clientMsgId}
+	var attachments []byte
+	err := db.QueryRow(`
+		SELECT m.id, m.chat_id, m.seq, m.timestamp, at.attachments FROM base_chatmessage AS m`+
+		messageAttachments+`
+		WHERE m.author_id = $1 AND m.client_msg_id = $2`, authorId, clientMsgId).
+		Scan(&stored.MessageId, &stored.ChatId, &stored.Seq, &stored.Timestamp, &attachments)
+	if err != nil {
+		return Messages.Message{}, fmt.Errorf("error loading stored message: %w", err)
+	}
+	if len(attachments) > 0 {
+		if err := json.Unmarshal(attachments, &stored.Attachments); err != nil {
+			return Messages.Message{}, fmt.Errorf("error decoding attachments: %w", err)
+		}
+	}
+	return stored, nil
 }
 
 // SaveMessage saves a new message into the database.
 // This function inserts a message with the provided content, timestamp, author ID, chat ID, and receiver ID.
-// The message is saved as not edited and without a parent (indicating it's not a reply).
-func (mmc *MessageController) SaveMessage(msg Messages.Message) error {
+// The message is saved as not edited and without a parent (indicating it's not a reply),
+// and gets the next sequence number of its chat.
+// A message carrying a client_msg_id the author already used is not inserted again; the
+// stored message's ID, sequence number, timestamp and attachments are returned instead.
+// The attachments are stored with the message and come back with presigned download URLs.
+//
+// Returns:
+//   - The saved message with its ID and sequence number.
+//   - Whether the message is a duplicate of an already stored one.
+//   - ErrForeignAttachment if an attachment was uploaded by another user, or an error
+//     if the message could not be saved.
+func (mmc *MessageController) SaveMessage(msg Messages.Message) (Messages.Message, bool, error) {
+	if err := checkAttachments(msg.AuthorId, msg.Attachments); err != nil {
+		return Messages.Message{}, false, err
+	}
+
 	db := mmc.Database.GetConnection()
-	_, err := db.Exec(`
-		INSERT INTO base_chatmessage (content, timestamp, author_id, chat_id, receiver_id, is_edited, parent)
-		VALUES ($1, $2, $3, $4, $5, false, null)`,
-		msg.Message, msg.Timestamp, msg.AuthorId, msg.ChatId, msg.ReceiverId)
-	return err
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Messages.Message{}, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	if msg.Seq, err = nextChatSeq(tx, msg.ChatId); err != nil {
+		return Messages.Message{}, false, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO base_chatmessage (content, timestamp, author_id, chat_id, receiver_id, is_edited, parent_id, seq, client_msg_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), false, null, $6, NULLIF($7, ''))
+		ON CONFLICT (author_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING id`,
+		msg.Message, msg.Timestamp, msg.AuthorId, msg.ChatId, msg.ReceiverId, msg.Seq, msg.ClientMsgId).Scan(&msg.MessageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A retry: rolling back also releases the sequence number allocated above
+		tx.Rollback()
+		stored, err := mmc.findByClientMsgId(msg.AuthorId, msg.ClientMsgId)
+		if err != nil {
+			return Messages.Message{}, false, err
+		}
+		msg.MessageId, msg.ChatId, msg.Seq, msg.Timestamp = stored.MessageId, stored.ChatId, stored.Seq, stored.Timestamp
+		msg.Attachments = stored.Attachments
+		mmc.signAttachments(refs(msg.Attachments))
+		return msg, true, nil
+	}
+	if err != nil {
+		return Messages.Message{}, false, fmt.Errorf("error saving message: %w", err)
+	}
+	if err := saveAttachments(tx, msg.MessageId, msg.Attachments); err != nil {
+		return Messages.Message{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Messages.Message{}, false, fmt.Errorf("error committing message: %w", err)
+	}
+	msg.IsEdited = false
+	msg.Status = Messages.StatusSent
+	mmc.signAttachments(refs(msg.Attachments))
+	return msg, false, nil
 }
 
 // SaveMessageReply saves a reply to a message in the database.
 // This function inserts a reply message with the provided content, timestamp, author ID, chat ID, receiver ID, and parent message ID.
-// The reply message is saved as not edited.
-func (mmc *MessageController) SaveMessageReply(msg Messages.MessageReply) error {
+// The reply message is saved as not edited and gets the next sequence number of its chat.
+// Like SaveMessage, a reply carrying an already used client_msg_id is not inserted again,
+// and the attachments are stored with the reply.
+//
+// Returns:
+//   - The saved reply with its ID and sequence number.
+//   - Whether the reply is a duplicate of an already stored message.
+//   - ErrMessageNotFound if the parent is not a message of the reply's chat or has been deleted,
+//     ErrForeignAttachment if an attachment was uploaded by another user, or an error
+//     if the reply could not be saved.
+func (mmc *MessageController) SaveMessageReply(msg Messages.MessageReply) (Messages.MessageReply, bool, error) {
+	if err := checkAttachments(msg.AuthorId, msg.Attachments); err != nil {
+		return Messages.MessageReply{}, false, err
+	}
+
 	db := mmc.Database.GetConnection()
-	_, err := db.Exec(`
-		INSERT INTO base_chatmessage (content, timestamp, author_id, chat_id, receiver_id, parent_id, is_edited)
-		VALUES ($1, $2, $3, $4, $5, $6, false)`,
-		msg.Message, msg.Timestamp, msg.AuthorId, msg.ChatId, msg.ReceiverId, msg.ParentMessageId)
-	return err
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Messages.MessageReply{}, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	if msg.Seq, err = nextChatSeq(tx, msg.ChatId); err != nil {
+		return Messages.MessageReply{}, false, err
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO base_chatmessage (content, timestamp, author_id, chat_id, receiver_id, parent_id, is_edited, seq, client_msg_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, false, $7, NULLIF($8, ''))
+		ON CONFLICT (author_id, client_msg_id) WHERE client_msg_id IS NOT NULL DO NOTHING
+		RETURNING id`,
+		msg.Message, msg.Timestamp, msg.AuthorId, msg.ChatId, msg.ReceiverId, msg.ParentMessageId, msg.Seq, msg.ClientMsgId).Scan(&msg.MessageId)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A retry: rolling back also releases the sequence number allocated above
+		tx.Rollback()
+		stored, err := mmc.findByClientMsgId(msg.AuthorId, msg.ClientMsgId)
+		if err != nil {
+			return Messages.MessageReply{}, false, err
+		}
+		msg.MessageId, msg.ChatId, msg.Seq, msg.Timestamp = stored.MessageId, stored.ChatId, stored.Seq, stored.Timestamp
+		msg.Attachments = stored.Attachments
+		mmc.signAttachments(refs(msg.Attachments))
+		return msg, true, nil
+	}
+	if err != nil {
+		return Messages.MessageReply{}, false, fmt.Errorf("error saving message reply: %w", err)
+	}
+	// Checked after the insert, so a retry of a stored reply is still acknowledged
+	// when its parent has been deleted since
+	if err := checkParent(tx, msg.ChatId, msg.ParentMessageId); err != nil {
+		return Messages.MessageReply{}, false, err
+	}
+	if err := saveAttachments(tx, msg.MessageId, msg.Attachments); err != nil {
+		return Messages.MessageReply{}, false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Messages.MessageReply{}, false, fmt.Errorf("error committing message reply: %w", err)
+	}
+	msg.IsEdited = false
+	msg.Status = Messages.StatusSent
+	mmc.signAttachments(refs(msg.Attachments))
+	return msg, false, nil
+}
+
+// checkParent verifies that the parent of a reply is a message of the reply's chat that has
+// not been deleted for everyone. Parents in other chats are reported like unknown messages,
+// so replies reveal nothing about chats their author does not take part in.
+func checkParent(tx *sql.Tx, chatId, parentId int) error {
+	var parentChatId int
+	var deleted bool
+	err := tx.QueryRow(`SELECT chat_id, is_deleted FROM base_chatmessage WHERE id = $1 FOR SHARE`, parentId).
+		Scan(&parentChatId, &deleted)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (parentChatId != chatId || deleted)) {
+		return ErrMessageNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error loading parent message: %w", err)
+	}
+	return nil
 }
 
-// LoadMessages loads messages for a given chat ID from the database.
-// This function retrieves all messages for a specific chat and returns them as a slice of Message objects.
-func (mmc *MessageController) LoadMessages(chatId int) ([]Messages.Message, error) {
+// viewerMessageColumns projects base_chatmessage rows (aliased m) as seen by the viewer.
+// It expects base_chatmessage_hidden (aliased h) to be joined for that viewer, so messages
+// deleted for everyone or hidden by the viewer come back as tombstones without content,
+// messageReceiptCounts (aliased rs) to be joined for the delivery status,
+// messageReactions (aliased rx) for the reactions and messageAttachments (aliased at)
+// for the attachments, neither of which tombstones show.
+const viewerMessageColumns = `
+	m.id,
+	CASE WHEN m.is_deleted OR h.user_id IS NOT NULL THEN '' ELSE m.content END,
+	m.is_edited,
+	m.timestamp,
+	m.author_id,
+	m.chat_id,
+	COALESCE(m.receiver_id, 0),
+	m.is_deleted OR h.user_id IS NOT NULL,
+	m.parent_id,
+	m.seq,
+	CASE
+		WHEN rs.read >= rs.recipients THEN 'read'
+		WHEN rs.delivered >= rs.recipients THEN 'delivered'
+		ELSE 'sent'
+	END,
+	CASE WHEN m.is_deleted OR h.user_id IS NOT NULL THEN NULL ELSE rx.reactions END,
+	CASE WHEN m.is_deleted OR h.user_id IS NOT NULL THEN NULL ELSE at.attachments END`
+
+// messageReceiptCounts counts, for every base_chatmessage row (aliased m), its recipients and
+// how many of them received and read it. The recipients are the chat's members other than the
+// author; a 1:1 chat without a chat row has a single recipient. Reading implies delivery.
+const messageReceiptCounts = `
+	CROSS JOIN LATERAL (
+		SELECT
+			GREATEST((SELECT count(*) FROM base_chat_member AS cm
+				WHERE cm.chat_id = m.chat_id AND cm.user_id <> m.author_id), 1) AS recipients,
+			(SELECT count(*) FROM base_chat_read AS cr
+				WHERE cr.chat_id = m.chat_id AND cr.user_id <> m.author_id AND cr.last_read_seq >= m.seq) AS read,
+			(SELECT count(*) FROM (
+				SELECT user_id FROM base_chatmessage_receipt
+				WHERE message_id = m.id AND user_id <> m.author_id
+				UNION
+				SELECT user_id FROM base_chat_read
+				WHERE chat_id = m.chat_id AND user_id <> m.author_id AND last_read_seq >= m.seq
+			) AS reached) AS delivered
+	) AS rs`
+
+// messageReactions sums up the reactions to every base_chatmessage row (aliased m) as a JSON
+// array with one entry per emoji, in the order the emojis were first used. The viewer's ID
+// must be bound to $2 to tell which reactions are their own.
+const messageReactions = `
+	LEFT JOIN LATERAL (
+		SELECT json_agg(json_build_object('emoji', r.emoji, 'count', r.count, 'mine', r.mine)
+			ORDER BY r.first_at, r.emoji) AS reactions
+		FROM (
+			SELECT emoji, count(*) AS count, bool_or(user_id = $2) AS mine, min(created_at) AS first_at
+			FROM base_chatmessage_reaction
+			WHERE message_id = m.id
+			GROUP BY emoji
+		) AS r
+	) AS rx ON true`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage scans a row selected with viewerMessageColumns into a Message.
+func scanMessage(row rowScanner) (Messages.Message, error) {
+	var msg Messages.Message
+	var reactions, attachments []byte
+	err := row.Scan(&msg.MessageId, &msg.Message, &msg.IsEdited, &msg.Timestamp, &msg.AuthorId,
+		&msg.ChatId, &msg.ReceiverId, &msg.IsDeleted, &msg.ParentMessageId, &msg.Seq, &msg.Status, &reactions, &attachments)
+	if err != nil {
+		return msg, err
+	}
+	if len(reactions) > 0 {
+		if err := json.Unmarshal(reactions, &msg.Reactions); err != nil {
+			return msg, fmt.Errorf("error decoding reactions: %w", err)
+		}
+	}
+	if len(attachments) > 0 {
+		if err := json.Unmarshal(attachments, &msg.Attachments); err != nil {
+			return msg, fmt.Errorf("error decoding attachments: %w", err)
+		}
+	}
+	return msg, nil
+}
+
+const (
+	// DefaultHistoryLimit is the page size used when a history request does not specify one.
+	DefaultHistoryLimit = 50
+	// MaxHistoryLimit caps the page size of a single history request.
+	MaxHistoryLimit = 100
+)
+
+// ErrConflictingCursors is returned when a history query sets both cursors.
+var ErrConflictingCursors = errors.New("only one of before_message_id and after_message_id may be set")
+
+// LoadMessages loads a page of messages for a given chat from the database.
+// Messages are ordered by ID, which is assigned in insertion order, and returned from the
+// oldest to the newest. Without a cursor the latest page is returned. Deleted messages are
+// returned as tombstones so reply chains stay intact. Every message carries its delivery status,
+// its reactions, counted per emoji and marked where the viewer reacted, and its attachments
+// with freshly presigned download URLs.
+//
+// Parameters:
+//   - query: The HistoryQuery describing the chat, the viewer, the cursor and the page size.
+//
+// Returns:
+//   - A HistoryPage with the messages and whether more messages exist past the page.
+//   - An error if the query is invalid or fails.
+func (mmc *MessageController) LoadMessages(query Messages.HistoryQuery) (Messages.HistoryPage, error) {
+	if query.BeforeMessageId > 0 && query.AfterMessageId > 0 {
+		return Messages.HistoryPage{}, ErrConflictingCursors
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultHistoryLimit
+	}
+	if limit > MaxHistoryLimit {
+		limit = MaxHistoryLimit
+	}
+
+	// Paging forward reads in ascending order; everything else reads the newest messages first
+	forward := query.AfterMessageId > 0
+	condition, order, cursor := "m.id < $3", "DESC", query.BeforeMessageId
+	if forward {
+		condition, order, cursor = "m.id > $3", "ASC", query.AfterMessageId
+	} else if cursor <= 0 {
+		condition = "$3 = 0"
+	}
+
 	db := mmc.Database.GetConnection()
 
-	// Query to fetch messages for the given chat ID
-	query := `SELECT * FROM base_chatmessage WHERE chat_id = $1`
-	rows, err := db.Query(query, chatId)
+	// Fetch one extra row to find out whether another page exists
+	sqlQuery := `SELECT ` + viewerMessageColumns + `
+		FROM base_chatmessage AS m
+		LEFT JOIN base_chatmessage_hidden AS h ON h.message_id = m.id AND h.user_id = $2` +
+		messageReceiptCounts +
+		messageReactions +
+		messageAttachments + `
+		WHERE m.chat_id = $1 AND ` + condition + `
+		ORDER BY m.id ` + order + `
+		LIMIT $4`
+	rows, err := db.Query(sqlQuery, query.ChatId, query.ViewerId, max(cursor, 0), limit+1)
 	if err != nil {
 		// Return an error if the query execution fails
-		return nil, fmt.Errorf("error loading messages: %w", err)
+		return Messages.HistoryPage{}, fmt.Errorf("error loading messages: %w", err)
 	}
 	defer rows.Close() // Ensure rows are closed after processing
 
-	var messages []Messages.Message
+	messages := []Messages.Message{}
 	// Iterate through the query results
 	for rows.Next() {
-		var msg Messages.Message
 		// Scan the row into the Message struct
-		if err := rows.Scan(&msg.MessageId, &msg.Message, &msg.IsEdited, &msg.Timestamp, &msg.AuthorId, &msg.ChatId, &msg.ReceiverId, &msg.ParentMessageId); err != nil {
+		msg, err := scanMessage(rows)
+		if err != nil {
 			// Return an error if scanning the row fails
-			return nil, fmt.Errorf("error scanning row: %w", err)
+			return Messages.HistoryPage{}, fmt.Errorf("error scanning row: %w", err)
 		}
-		// Append the message to the result list
 		messages = append(messages, msg)
 	}
+	if err := rows.Err(); err != nil {
+		return Messages.HistoryPage{}, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	page := Messages.HistoryPage{HasMore: len(messages) > limit}
+	if page.HasMore {
+		messages = messages[:limit]
+	}
+	// Pages are always returned from the oldest to the newest message
+	if !forward {
+		slices.Reverse(messages)
+	}
+	page.Messages = messages
+	mmc.signAttachments(attachmentsOf(messages))
+
+	if len(messages) > 0 {
+		page.NextCursor = messages[0].MessageId
+		if forward {
+			page.NextCursor = messages[len(messages)-1].MessageId
+		}
+	}
+	return page, nil
+}
+
+// EditMessage replaces the content of a message and records its previous content
+// in the edit history. Only the original author may edit a message.
+// The lookup, the history insert and the update run in a single transaction.
+//
+// Parameters:
+//   - edit: The MessageEdit holding the message ID, the editing user and the new content.
+//
+// Returns:
+//   - The updated message, marked as edited, with its delivery status, reactions and
+//     attachments, to be broadcast to the whole chat.
+//   - ErrMessageNotFound, ErrNotMessageAuthor or a database error.
+func (mmc *MessageController) EditMessage(edit Messages.MessageEdit) (Messages.Message, error) {
+	db := mmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Messages.Message{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	// Lock the message so concurrent edits are applied one after another
+	var previousContent string
+	var authorId int
+	var isDeleted bool
+	err = tx.QueryRow(`SELECT content, author_id, is_deleted FROM base_chatmessage WHERE id = $1 FOR UPDATE`, edit.MessageId).
+		Scan(&previousContent, &authorId, &isDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Messages.Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return Messages.Message{}, fmt.Errorf("error loading message: %w", err)
+	}
+	if authorId != edit.AuthorId {
+		return Messages.Message{}, ErrNotMessageAuthor
+	}
+	if isDeleted {
+		return Messages.Message{}, ErrMessageDeleted
+	}
+
+	// Keep the previous revision before overwriting it
+	if _, err := tx.Exec(`
+		INSERT INTO base_chatmessage_edit (message_id, editor_id, previous_content)
+		VALUES ($1, $2, $3)`,
+		edit.MessageId, edit.AuthorId, previousContent); err != nil {
+		return Messages.Message{}, fmt.Errorf("error saving message revision: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE base_chatmessage SET content = $1, is_edited = true WHERE id = $2`,
+		edit.Message, edit.MessageId); err != nil {
+		return Messages.Message{}, fmt.Errorf("error updating message: %w", err)
+	}
+
+	msg, err := loadMessage(tx, edit.MessageId, 0)
+	if err != nil {
+		return Messages.Message{}, err
+	}
 
-	// Return the list of messages
-	return messages, nil
+	if err := tx.Commit(); err != nil {
+		return Messages.Message{}, fmt.Errorf("error committing message edit: %w", err)
+	}
+	mmc.signAttachments(refs(msg.Attachments))
+	return msg, nil
+}
+
+// loadMessage loads a single message with the columns of a history page: its delivery status,
+// reactions and attachments. The attachments still need to be signed.
+//
+// Parameters:
+//   - tx: The transaction to read the message in.
+//   - messageId: ID of the message.
+//   - viewerId: ID of the user the message is loaded for, or 0 for a message broadcast to
+//     the whole chat, whose reactions are then not marked as anyone's own.
+//
+// Returns:
+//   - The message as seen by the viewer.
+//   - An error if the message could not be loaded.
+func loadMessage(tx *sql.Tx, messageId, viewerId int) (Messages.Message, error) {
+	row := tx.QueryRow(`SELECT `+viewerMessageColumns+`
+		FROM base_chatmessage AS m
+		LEFT JOIN base_chatmessage_hidden AS h ON h.message_id = m.id AND h.user_id = $2`+
+		messageReceiptCounts+
+		messageReactions+
+		messageAttachments+`
+		WHERE m.id = $1`, messageId, viewerId)
+	msg, err := scanMessage(row)
+	if err != nil {
+		return Messages.Message{}, fmt.Errorf("error loading message: %w", err)
+	}
+	return msg, nil
+}
+
+// DeleteMessage deletes a message on behalf of its author.
+// Deleting for everyone turns the row into a tombstone: the content and the edit history
+// are erased but the row stays, so LoadMessages and replies referencing it through
+// parent_id remain consistent. Deleting only for the author hides the message from them.
+//
+// Parameters:
+//   - del: The MessageDelete holding the message ID, the deleting user and the scope.
+//
+// Returns:
+//   - The tombstone of the deleted message.
+//   - ErrMessageNotFound, ErrNotMessageAuthor or a database error.
+func (mmc *MessageController) DeleteMessage(del Messages.MessageDelete) (Messages.Message, error) {
+	db := mmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Messages.Message{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	// Lock the message and keep the fields the tombstone is built from
+	tombstone := Messages.Message{IsDeleted: true}
+	var alreadyDeleted bool
+	err = tx.QueryRow(`
+		SELECT id, is_edited, timestamp, author_id, chat_id, COALESCE(receiver_id, 0), parent_id, seq, is_deleted
+		FROM base_chatmessage WHERE id = $1 FOR UPDATE`, del.MessageId).
+		Scan(&tombstone.MessageId, &tombstone.IsEdited, &tombstone.Timestamp, &tombstone.AuthorId,
+			&tombstone.ChatId, &tombstone.ReceiverId, &tombstone.ParentMessageId, &tombstone.Seq, &alreadyDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Messages.Message{}, ErrMessageNotFound
+	}
+	if err != nil {
+		return Messages.Message{}, fmt.Errorf("error loading message: %w", err)
+	}
+	if tombstone.AuthorId != del.AuthorId {
+		return Messages.Message{}, ErrNotMessageAuthor
+	}
+
+	switch {
+	case del.ForEveryone && !alreadyDeleted:
+		// Previous revisions would leak the deleted content
+		if _, err := tx.Exec(`DELETE FROM base_chatmessage_edit WHERE message_id = $1`, del.MessageId); err != nil {
+			return Messages.Message{}, fmt.Errorf("error deleting message revisions: %w", err)
+		}
+		if _, err := tx.Exec(`
+			UPDATE base_chatmessage SET content = '', is_deleted = true, deleted_at = now()
+			WHERE id = $1`, del.MessageId); err != nil {
+			return Messages.Message{}, fmt.Errorf("error deleting message: %w", err)
+		}
+	case !del.ForEveryone:
+		if _, err := tx.Exec(`
+			INSERT INTO base_chatmessage_hidden (message_id, user_id) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING`, del.MessageId, del.AuthorId); err != nil {
+			return Messages.Message{}, fmt.Errorf("error hiding message: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Messages.Message{}, fmt.Errorf("error committing message deletion: %w", err)
+	}
+	return tombstone, nil
+}
+
+// LoadRevisions loads the edit history of a message, oldest revision first.
+//
+// Parameters:
+//   - messageId: The ID of the message whose revisions are requested.
+//
+// Returns:
+//   - A slice of MessageRevision objects.
+//   - An error if the query fails.
+func (mmc *MessageController) LoadRevisions(messageId int) ([]Messages.MessageRevision, error) {
+	db := mmc.Database.GetConnection()
+
+	rows, err := db.Query(`
+		SELECT id, message_id, editor_id, previous_content, edited_at
+		FROM base_chatmessage_edit
+		WHERE message_id = $1
+		ORDER BY edited_at, id`, messageId)
+	if err != nil {
+		return nil, fmt.Errorf("error loading revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []Messages.MessageRevision{}
+	for rows.Next() {
+		var rev Messages.MessageRevision
+		if err := rows.Scan(&rev.RevisionId, &rev.MessageId, &rev.EditorId, &rev.Message, &rev.EditedAt); err != nil {
+			return nil, fmt.Errorf("error scanning revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
 }
@@ -0,0 +1,150 @@
+package messagecontroller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	Messages "messenger_engine/models/message"
+)
+
+// MessageChat returns the ID of the chat a message belongs to, e.g. to check the
+// membership of a user who acts on the message before acting.
+//
+// Parameters:
+//   - messageId: ID of the message.
+//
+// Returns:
+//   - The ID of the message's chat.
+//   - ErrMessageNotFound if there is no such message, or a database error.
+func (mmc *MessageController) MessageChat(messageId int) (int, error) {
+	db := mmc.Database.GetConnection()
+
+	var chatId int
+	err := db.QueryRow(`SELECT chat_id FROM base_chatmessage WHERE id = $1`, messageId).Scan(&chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrMessageNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error loading message: %w", err)
+	}
+	return chatId, nil
+}
+
+// AddReaction records that a user reacted to a message with an emoji.
+// Every user can react once per emoji; repeating a reaction changes nothing.
+//
+// Parameters:
+//   - userId: ID of the reacting user.
+//   - messageId: ID of the message.
+//   - emoji: The emoji to react with.
+//
+// Returns:
+//   - The update to broadcast to the message's chat, with the emoji's new count.
+//   - Whether the reaction was added now; false if the user had already reacted with the emoji.
+//   - ErrMessageNotFound, ErrMessageDeleted or a database error.
+func (mmc *MessageController) AddReaction(userId, messageId int, emoji string) (Messages.ReactionUpdate, bool, error) {
+	db := mmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	// Lock the message so it cannot be deleted while the reaction is added
+	var chatId int
+	var isDeleted bool
+	err = tx.QueryRow(`SELECT chat_id, is_deleted FROM base_chatmessage WHERE id = $1 FOR SHARE`, messageId).
+		Scan(&chatId, &isDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Messages.ReactionUpdate{}, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error loading message: %w", err)
+	}
+	if isDeleted {
+		return Messages.ReactionUpdate{}, false, ErrMessageDeleted
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO base_chatmessage_reaction (message_id, user_id, emoji) VALUES ($1, $2, $3)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING`, messageId, userId, emoji)
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error saving reaction: %w", err)
+	}
+	added, err := result.RowsAffected()
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error saving reaction: %w", err)
+	}
+
+	update := Messages.ReactionUpdate{Type: "reaction_added", ChatId: chatId, MessageId: messageId, UserId: userId, Emoji: emoji}
+	if update.Count, err = countReactions(tx, messageId, emoji); err != nil {
+		return Messages.ReactionUpdate{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error committing reaction: %w", err)
+	}
+	return update, added > 0, nil
+}
+
+// RemoveReaction takes back a user's reaction to a message.
+//
+// Parameters:
+//   - userId: ID of the user who reacted.
+//   - messageId: ID of the message.
+//   - emoji: The emoji to take back.
+//
+// Returns:
+//   - The update to broadcast to the message's chat, with the emoji's new count.
+//   - Whether a reaction was removed; false if the user had not reacted with the emoji.
+//   - ErrMessageNotFound or a database error.
+func (mmc *MessageController) RemoveReaction(userId, messageId int, emoji string) (Messages.ReactionUpdate, bool, error) {
+	db := mmc.Database.GetConnection()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed
+
+	var chatId int
+	err = tx.QueryRow(`SELECT chat_id FROM base_chatmessage WHERE id = $1`, messageId).Scan(&chatId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Messages.ReactionUpdate{}, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error loading message: %w", err)
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM base_chatmessage_reaction WHERE message_id = $1 AND user_id = $2 AND emoji = $3`,
+		messageId, userId, emoji)
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error removing reaction: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error removing reaction: %w", err)
+	}
+
+	update := Messages.ReactionUpdate{Type: "reaction_removed", ChatId: chatId, MessageId: messageId, UserId: userId, Emoji: emoji}
+	if update.Count, err = countReactions(tx, messageId, emoji); err != nil {
+		return Messages.ReactionUpdate{}, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Messages.ReactionUpdate{}, false, fmt.Errorf("error committing reaction removal: %w", err)
+	}
+	return update, removed > 0, nil
+}
+
+// countReactions counts the users who reacted to the message with the emoji.
+func countReactions(tx *sql.Tx, messageId int, emoji string) (int, error) {
+	var count int
+	err := tx.QueryRow(`SELECT count(*) FROM base_chatmessage_reaction WHERE message_id = $1 AND emoji = $2`, messageId, emoji).
+		Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting reactions: %w", err)
+	}
+	return count, nil
+}
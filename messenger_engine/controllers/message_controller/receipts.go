@@ -0,0 +1,129 @@
+package messagecontroller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	Messages "messenger_engine/models/message"
+)
+
+// messageAuthor loads the author and sequence number of a message of the given chat.
+func (mmc *MessageController) messageAuthor(chatId, messageId int) (authorId int, seq int64, err error) {
+	db := mmc.Database.GetConnection()
+
+	err = db.QueryRow(`SELECT author_id, seq FROM base_chatmessage WHERE id = $1 AND chat_id = $2`, messageId, chatId).
+		Scan(&authorId, &seq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, ErrMessageNotFound
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("error loading message: %w", err)
+	}
+	return authorId, seq, nil
+}
+
+// MarkDelivered records that a recipient received a message.
+// Receipts for one's own messages and repeated receipts are ignored.
+//
+// Parameters:
+//   - userId: ID of the recipient.
+//   - chatId: ID of the chat the message belongs to.
+//   - messageId: ID of the received message.
+//
+// Returns:
+//   - The receipt to send to the author of the message.
+//   - The ID of the author.
+//   - Whether the receipt was recorded now; false if it was ignored.
+//   - ErrMessageNotFound if the chat has no such message, or a database error.
+func (mmc *MessageController) MarkDelivered(userId, chatId, messageId int) (Messages.DeliveryReceipt, int, bool, error) {
+	authorId, _, err := mmc.messageAuthor(chatId, messageId)
+	if err != nil {
+		return Messages.DeliveryReceipt{}, 0, false, err
+	}
+	if authorId == userId {
+		return Messages.DeliveryReceipt{}, authorId, false, nil
+	}
+
+	db := mmc.Database.GetConnection()
+
+	receipt := Messages.DeliveryReceipt{Type: "message_delivered", ChatId: chatId, MessageId: messageId, UserId: userId}
+	err = db.QueryRow(`
+		INSERT INTO base_chatmessage_receipt (message_id, user_id) VALUES ($1, $2)
+		ON CONFLICT (message_id, user_id) DO NOTHING
+		RETURNING delivered_at`, messageId, userId).Scan(&receipt.DeliveredAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Already recorded by an earlier receipt
+		return Messages.DeliveryReceipt{}, authorId, false, nil
+	}
+	if err != nil {
+		return Messages.DeliveryReceipt{}, 0, false, fmt.Errorf("error saving delivery receipt: %w", err)
+	}
+	return receipt, authorId, true, nil
+}
+
+// MarkRead moves the reader's high-water mark of a chat up to the given message, which marks
+// that message and every earlier one as read. Marks never move backwards; a receipt for a
+// message at or below the current mark is ignored.
+//
+// Parameters:
+//   - userId: ID of the reader.
+//   - chatId: ID of the chat that was read.
+//   - messageId: ID of the last message read.
+//
+// Returns:
+//   - The receipt to send to the authors of the newly read messages.
+//   - The IDs of those authors, excluding the reader.
+//   - Whether the mark moved; false if the receipt was ignored.
+//   - ErrMessageNotFound if the chat has no such message, or a database error.
+func (mmc *MessageController) MarkRead(userId, chatId, messageId int) (Messages.ReadReceipt, []int, bool, error) {
+	_, seq, err := mmc.messageAuthor(chatId, messageId)
+	if err != nil {
+		return Messages.ReadReceipt{}, nil, false, err
+	}
+
+	db := mmc.Database.GetConnection()
+
+	receipt := Messages.ReadReceipt{Type: "message_read", ChatId: chatId, MessageId: messageId, LastReadSeq: seq, UserId: userId}
+	var previousSeq int64
+	err = db.QueryRow(`
+		WITH previous AS (
+			SELECT last_read_seq FROM base_chat_read WHERE chat_id = $1 AND user_id = $2
+		)
+		INSERT INTO base_chat_read (chat_id, user_id, last_read_seq, read_at) VALUES ($1, $2, $3, now())
+		ON CONFLICT (chat_id, user_id) DO UPDATE
+			SET last_read_seq = EXCLUDED.last_read_seq, read_at = EXCLUDED.read_at
+			WHERE base_chat_read.last_read_seq < EXCLUDED.last_read_seq
+		RETURNING read_at, COALESCE((SELECT last_read_seq FROM previous), 0)`,
+		chatId, userId, seq).Scan(&receipt.ReadAt, &previousSeq)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The reader already read this far
+		return Messages.ReadReceipt{}, nil, false, nil
+	}
+	if err != nil {
+		return Messages.ReadReceipt{}, nil, false, fmt.Errorf("error saving read receipt: %w", err)
+	}
+
+	// Only the authors of the messages between the previous and the new mark learn about the read
+	rows, err := db.Query(`
+		SELECT DISTINCT author_id FROM base_chatmessage
+		WHERE chat_id = $1 AND seq > $2 AND seq <= $3 AND author_id <> $4`,
+		chatId, previousSeq, seq, userId)
+	if err != nil {
+		return Messages.ReadReceipt{}, nil, false, fmt.Errorf("error loading read message authors: %w", err)
+	}
+	defer rows.Close()
+
+	authors := []int{}
+	for rows.Next() {
+		var authorId int
+		if err := rows.Scan(&authorId); err != nil {
+			return Messages.ReadReceipt{}, nil, false, fmt.Errorf("error scanning row: %w", err)
+		}
+		authors = append(authors, authorId)
+	}
+	if err := rows.Err(); err != nil {
+		return Messages.ReadReceipt{}, nil, false, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return receipt, authors, true, nil
+}
@@ -0,0 +1,167 @@
+package presencecontroller
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	BaseController "messenger_engine/controllers/base_controller"
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/models/event"
+	Presence "messenger_engine/models/presence"
+)
+
+// PresenceController tracks which users are online and when they were last seen.
+// It is the broadcaster's PresenceListener: it announces users coming online and going
+// offline to their chat partners, and persists the last-seen time on disconnect.
+type PresenceController struct {
+	*BaseController.BaseController                      // Embeds the base controller for shared functionality
+	Broadcast                      *Broadcast.Broadcast // Knows the live connections and delivers presence events
+}
+
+// UserConnected announces that the user came online.
+//
+// Parameters:
+//   - userId: ID of the user whose first connection opened.
+func (pc *PresenceController) UserConnected(userId int) {
+	pc.publish(Presence.Presence{Type: Presence.TypePresence, UserId: userId, Online: true})
+}
+
+// UserDisconnected stores the user's last-seen time and announces that they went offline.
+//
+// Parameters:
+//   - userId: ID of the user whose last connection closed.
+func (pc *PresenceController) UserDisconnected(userId int) {
+	lastSeenAt, err := pc.touchLastSeen(userId)
+	if err != nil {
+		log.Printf("Error saving last seen time of user %d: %v", userId, err)
+		lastSeenAt = time.Now()
+	}
+	pc.publish(Presence.Presence{Type: Presence.TypePresence, UserId: userId, Online: false, LastSeenAt: &lastSeenAt})
+}
+
+// publish sends a presence update to the user's chat partners. It is published even when the
+// user has no partners, so other instances learn about the change as well.
+func (pc *PresenceController) publish(update Presence.Presence) {
+	partners, err := pc.ChatPartners(update.UserId)
+	if err != nil {
+		log.Printf("Error loading chat partners of user %d: %v", update.UserId, err)
+	}
+
+	pc.Broadcast.Publish(event.Event{
+		Type:           event.PresenceChanged,
+		Payload:        update,
+		Recipients:     partners,
+		RecipientsOnly: true,
+	})
+}
+
+// touchLastSeen records that the user was seen just now.
+func (pc *PresenceController) touchLastSeen(userId int) (time.Time, error) {
+	db := pc.Database.GetConnection()
+
+	var lastSeenAt time.Time
+	err := db.QueryRow(`
+		INSERT INTO base_user_presence (user_id, last_seen_at) VALUES ($1, now())
+		ON CONFLICT (user_id) DO UPDATE SET last_seen_at = EXCLUDED.last_seen_at
+		RETURNING last_seen_at`, userId).Scan(&lastSeenAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error saving last seen time: %w", err)
+	}
+	return lastSeenAt, nil
+}
+
+// ChatPartners returns the users the given user shares a chat with: the other members
+// of their group chats and the other side of their 1:1 conversations.
+//
+// Parameters:
+//   - userId: ID of the user.
+//
+// Returns:
+//   - The IDs of the user's chat partners, each listed once.
+//   - An error if the partners could not be loaded.
+func (pc *PresenceController) ChatPartners(userId int) ([]int, error) {
+	db := pc.Database.GetConnection()
+
+	rows, err := db.Query(`
+		SELECT other.user_id FROM base_chat_member AS own
+		JOIN base_chat_member AS other ON other.chat_id = own.chat_id
+		WHERE own.user_id = $1 AND other.user_id <> $1
+		UNION
+		SELECT receiver_id FROM base_chatmessage
+		WHERE author_id = $1 AND receiver_id IS NOT NULL AND receiver_id <> $1
+		UNION
+		SELECT author_id FROM base_chatmessage
+		WHERE receiver_id = $1 AND author_id <> $1`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error loading chat partners: %w", err)
+	}
+	defer rows.Close()
+
+	partners := []int{}
+	for rows.Next() {
+		var partnerId int
+		if err := rows.Scan(&partnerId); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		partners = append(partners, partnerId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return partners, nil
+}
+
+// GetPresence looks up whether the given users are online and when they were last seen.
+//
+// Parameters:
+//   - userIds: IDs of the users; duplicates are reported once.
+//
+// Returns:
+//   - The presence of every user, in the order of userIds.
+//   - An error if the last-seen times could not be loaded.
+func (pc *PresenceController) GetPresence(userIds []int) ([]Presence.Presence, error) {
+	unique := make([]int, 0, len(userIds))
+	seen := make(map[int]bool, len(userIds))
+	for _, userId := range userIds {
+		if !seen[userId] {
+			seen[userId] = true
+			unique = append(unique, userId)
+		}
+	}
+
+	db := pc.Database.GetConnection()
+
+	rows, err := db.Query(`SELECT user_id, last_seen_at FROM base_user_presence WHERE user_id = ANY($1)`, pq.Array(unique))
+	if err != nil {
+		return nil, fmt.Errorf("error loading last seen times: %w", err)
+	}
+	defer rows.Close()
+
+	lastSeen := make(map[int]time.Time, len(unique))
+	for rows.Next() {
+		var (
+			userId     int
+			lastSeenAt time.Time
+		)
+		if err := rows.Scan(&userId, &lastSeenAt); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		lastSeen[userId] = lastSeenAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	result := make([]Presence.Presence, 0, len(unique))
+	for _, userId := range unique {
+		entry := Presence.Presence{Type: Presence.TypePresence, UserId: userId, Online: pc.Broadcast.IsOnline(userId)}
+		if lastSeenAt, ok := lastSeen[userId]; ok {
+			entry.LastSeenAt = &lastSeenAt
+		}
+		result = append(result, entry)
+	}
+	return result, nil
+}
@@ -1,12 +1,21 @@
 package chathandler
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
+	"sync"
+	"time"
 
+	Broadcast "messenger_engine/controllers/broadcast_controller"
 	"messenger_engine/controllers/chat_controller"
 	ErrorHandler "messenger_engine/controllers/websocket_controller/handlers/error_handler"
+	MessageParser "messenger_engine/controllers/websocket_controller/parsers"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	Chats "messenger_engine/models/chat"
+	Auth "shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
+	"shared/ratelimit"
 
 	"github.com/gorilla/websocket"
 )
@@ -16,68 +25,161 @@ type ChatsHandler struct {
 	upgrader     websocket.Upgrader  // WebSocket upgrader to upgrade the HTTP connection
 	chatCtrl     *chatcontroller.ChatController // Controller for managing chat-related operations
 	ErrorHandler *ErrorHandler.ErrorHandler // Error handler for managing WebSocket-related errors
+	MessageParser *MessageParser.Parser // Parser used to reconcile the requested user with the authenticated one
+	Authenticator *Auth.Authenticator // Verifies the handshake token; nil accepts unauthenticated clients
+	Lifecycle lifecycle.Config // Heartbeat, deadline and frame size settings applied to every connection
+	RateLimiter *ratelimit.Limiter // Limits chat list requests per user (or remote IP); nil disables limiting
+	Broadcast *Broadcast.Broadcast // Writes to the connections and keeps them updated; nil answers requests only
+
+	mu       sync.Mutex                            // Guards watchers and watching.
+	watchers map[int]map[*Broadcast.Client]bool    // Connections watching every user's inbox, keyed by user ID.
+	watching map[*Broadcast.Client]int             // User whose inbox every connection watches.
 }
 
+// ChatsFrameType is the rate limit type of a chat list request.
+const ChatsFrameType = "chats"
+
 // NewChatsHandler initializes a new ChatsHandler instance with the given WebSocket upgrader and chat controller.
 // Returns a pointer to a new ChatsHandler.
 func NewChatsHandler(upgrader websocket.Upgrader, ctrl *chatcontroller.ChatController) *ChatsHandler {
+	// Allow WebSocket connections from any origin
+	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+
 	return &ChatsHandler{
-		upgrader: upgrader,
-		chatCtrl: ctrl,
+		upgrader:      upgrader,
+		chatCtrl:      ctrl,
+		ErrorHandler:  ErrorHandler.NewErrorHandler(),
+		MessageParser: MessageParser.New(),
+		Lifecycle:     lifecycle.DefaultConfig(),
+		RateLimiter:   ratelimit.NewLimiter(DefaultRateLimits()),
+		watchers:      make(map[int]map[*Broadcast.Client]bool),
+		watching:      make(map[*Broadcast.Client]int),
+	}
+}
+
+// DefaultRateLimits returns the built-in request limits of the /chats socket.
+//
+// Returns:
+//   - The default ratelimit.Config, to be overridden with ratelimit.LoadConfig.
+func DefaultRateLimits() ratelimit.Config {
+	return ratelimit.Config{
+		Rules:           map[string]ratelimit.Rule{ChatsFrameType: {Rate: 2, Burst: 5}},
+		MaxViolations:   20,
+		ViolationWindow: time.Minute,
 	}
 }
 
-// ChatsMessage represents the expected JSON message structure containing the user ID.
+// ChatsMessage represents the expected message structure containing the user ID.
 type ChatsMessage struct {
-	UserID int `json:"user_id"` // The user ID for retrieving their chats
+	UserID int                `json:"user_id"` // The user ID for retrieving their chats
+	Before *Chats.InboxCursor `json:"before"`  // The next_cursor of the previous page; omitted for the first page
+	Limit  int                `json:"limit"`   // Maximum number of chats in the page; 0 uses the default
 }
 
 // ServeHTTP upgrades the connection to WebSocket, processes incoming chat requests,
 // and sends back the relevant chat data to the client.
 // It listens for incoming messages, parses them, and retrieves chats for the given user.
+// When an Authenticator is configured, only the chats of the authenticated user can be requested.
+// When a Broadcast is configured, the connection stays subscribed after its first request and
+// receives an inbox update whenever one of the user's chats changes.
+// Frames are encoded in the format negotiated through Sec-WebSocket-Protocol (JSON by default).
 func (h *ChatsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// Allow WebSocket connections from any origin
-	h.upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	var userID int
+	if h.Authenticator != nil {
+		var err error
+		if userID, err = h.Authenticator.Authenticate(r); err != nil {
+			// Reject the handshake before upgrading the connection
+			log.Printf("Rejected unauthenticated chats connection: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
 
 	// Upgrade the HTTP connection to a WebSocket connection
-	conn, err := h.upgrader.Upgrade(w, r, nil)
+	ws, err := h.upgrader.Upgrade(w, r, codec.Negotiate(r))
 	if err != nil {
 		// Handle WebSocket upgrade error
 		h.ErrorHandler.HandleWebSocketError(err, nil, "Error upgrading connection to WebSocket: %s", err)
 		return
 	}
-	defer conn.Close() // Ensure the connection is closed when the function exits
+	defer ws.Close() // Ensure the connection is closed when the function exits
+
+	// Ping the client and stop reading once it no longer answers
+	heartbeat := lifecycle.Start(ws, h.Lifecycle)
+	defer heartbeat.Stop()
+
+	// Encode every reply, including error frames, in the negotiated format
+	conn := codec.Wrap(ws)
+	conn.WriteTimeout = h.Lifecycle.WriteTimeout
+
+	// Inbox updates are written concurrently with the replies, so with a broadcaster every
+	// write goes through the client's outbound queue, drained by its own writer goroutine
+	var out ErrorHandler.WebSocketWriter = conn
+	var client *Broadcast.Client
+	if h.Broadcast != nil {
+		client = h.Broadcast.RegisterClient(ws)
+		defer h.Broadcast.RemoveClient(client)
+		defer h.unwatch(client)
+		out = client
+	}
+
+	// Requests are rate limited per authenticated user, or per remote IP for anonymous connections
+	key := ratelimit.Key(userID, r)
 
 	// Process incoming messages in a loop
 	for {
 		// Read message from the WebSocket connection
-		messageType, message, err := conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			// Handle error in reading the message
-			h.ErrorHandler.HandleWebSocketError(err, conn, "Error reading message: %s", err)
+			h.ErrorHandler.HandleWebSocketError(err, out, "Error reading message: %s", err)
 			break
 		}
 
+		// Answer requests over the limit, and disconnect callers that keep exceeding it
+		if h.RateLimiter != nil {
+			if decision := h.RateLimiter.Allow(key, ChatsFrameType); !decision.Allowed {
+				h.ErrorHandler.HandleWebSocketError(protocol.RateLimited(decision.RetryAfter), out, "Rate limit exceeded for chat list requests")
+				if decision.Disconnect {
+					log.Printf("Disconnecting %s for repeatedly exceeding its rate limit", key)
+					heartbeat.Close(websocket.ClosePolicyViolation, "rate limit exceeded")
+					break
+				}
+				continue
+			}
+		}
+
 		// Parse the received message into ChatsMessage
 		var msg ChatsMessage
-		if err := json.Unmarshal(message, &msg); err != nil {
-			// Handle error in parsing the JSON message
-			h.ErrorHandler.HandleWebSocketError(err, conn, "Error parsing message JSON: %s", err)
+		if err := conn.Codec.Unmarshal(message, &msg); err != nil {
+			// Handle error in decoding the message
+			h.ErrorHandler.HandleWebSocketError(err, out, "Error parsing message: %s", err)
 			continue
 		}
 
-		// Use the chat controller to fetch the user's chats
-		jsonData, err := h.chatCtrl.GetUserChats(msg.UserID)
+		// Never return the chats of a user other than the authenticated one
+		if msg.UserID, err = h.MessageParser.ResolveUserID(msg.UserID, userID); err != nil {
+			h.ErrorHandler.HandleWebSocketError(err, out, "Invalid user_id: %s", err)
+			continue
+		}
+
+		// Watch the user's inbox before taking the snapshot, so no change is missed in between
+		if client != nil {
+			h.watch(client, msg.UserID)
+		}
+
+		// Use the chat controller to fetch a page of the user's inbox
+		page, err := h.chatCtrl.GetUserChats(Chats.InboxQuery{UserId: msg.UserID, Before: msg.Before, Limit: msg.Limit})
 		if err != nil {
 			// Handle error in fetching user chats
-			h.ErrorHandler.HandleWebSocketError(err, conn, "Error fetching users by ID: %s", err)
+			h.ErrorHandler.HandleWebSocketError(err, out, "Error fetching users by ID: %s", err)
 			return
 		}
 
 		// Send the fetched chat data back to the client
-		if err := conn.WriteMessage(messageType, jsonData); err != nil {
+		if err := out.WriteJSON(page); err != nil {
 			// Handle error in sending message to client
-			h.ErrorHandler.HandleWebSocketError(err, conn, "Error sending message: %v", err)
+			h.ErrorHandler.HandleWebSocketError(err, out, "Error sending message: %v", err)
 			break
 		}
 
@@ -0,0 +1,152 @@
+package chathandler
+
+import (
+	"encoding/json"
+	"log"
+
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	Chats "messenger_engine/models/chat"
+	"messenger_engine/models/event"
+)
+
+// inboxTouch holds the fields of event payloads that name the users whose inbox an event changes.
+type inboxTouch struct {
+	UserId  int `json:"user_id"`
+	Message struct {
+		AuthorId   int `json:"author_id"`
+		ReceiverId int `json:"receiver_id"`
+	} `json:"message"`
+}
+
+// watch subscribes the connection to the inbox changes of the given user,
+// replacing the user it watched before.
+func (h *ChatsHandler) watch(client *Broadcast.Client, userId int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if previous, ok := h.watching[client]; ok {
+		if previous == userId {
+			return
+		}
+		h.unwatchLocked(client, previous)
+	}
+	if h.watchers[userId] == nil {
+		h.watchers[userId] = make(map[*Broadcast.Client]bool)
+	}
+	h.watchers[userId][client] = true
+	h.watching[client] = userId
+}
+
+// unwatch stops pushing inbox changes to the connection.
+func (h *ChatsHandler) unwatch(client *Broadcast.Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if userId, ok := h.watching[client]; ok {
+		h.unwatchLocked(client, userId)
+	}
+}
+
+// unwatchLocked removes a single watcher. The caller must hold h.mu.
+func (h *ChatsHandler) unwatchLocked(client *Broadcast.Client, userId int) {
+	delete(h.watchers[userId], client)
+	if len(h.watchers[userId]) == 0 {
+		delete(h.watchers, userId)
+	}
+	delete(h.watching, client)
+}
+
+// watchersOf returns a snapshot of the connections watching the user's inbox.
+func (h *ChatsHandler) watchersOf(userId int) []*Broadcast.Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clients := make([]*Broadcast.Client, 0, len(h.watchers[userId]))
+	for client := range h.watchers[userId] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Observe turns an event delivered by the broadcaster into inbox updates for the users it
+// touches: the participants of a chat that got a new, edited or deleted message, the reader
+// whose unread count changed, and the members of a chat whose membership changed. Every update
+// carries the chat as it now appears in the inbox, so clients move it to the top by its
+// last_activity_at. Users who no longer take part in the chat are told to drop it.
+//
+// Parameters:
+//   - ev: The delivered event.
+func (h *ChatsHandler) Observe(ev event.Event) {
+	h.mu.Lock()
+	idle := len(h.watchers) == 0
+	h.mu.Unlock()
+	if idle {
+		return
+	}
+
+	switch ev.Type {
+	case event.MessageCreated, event.ReplyCreated, event.MessageEdited, event.MessageDeleted,
+		event.MessageRead, event.ChatUpdated:
+	default:
+		return
+	}
+
+	var touch inboxTouch
+	if err := decodePayload(ev.Payload, &touch); err != nil {
+		log.Printf("Error decoding %s event: %v", ev.Type, err)
+		return
+	}
+
+	// Read receipts go to the authors of the read messages, but only the reader's unread count changes
+	users := []int{touch.UserId}
+	if ev.Type != event.MessageRead {
+		users = append(append([]int{}, ev.Recipients...), touch.Message.AuthorId, touch.Message.ReceiverId)
+	}
+
+	seen := make(map[int]bool)
+	for _, userId := range users {
+		if userId == 0 || seen[userId] {
+			continue
+		}
+		seen[userId] = true
+
+		clients := h.watchersOf(userId)
+		if len(clients) == 0 {
+			continue
+		}
+		update, err := h.inboxUpdate(userId, ev.ChatId)
+		if err != nil {
+			log.Printf("Error loading chat %d for the inbox of user %d: %v", ev.ChatId, userId, err)
+			continue
+		}
+		for _, client := range clients {
+			if err := client.WriteJSON(update); err != nil {
+				log.Printf("Error pushing inbox update: %v", err)
+			}
+		}
+	}
+}
+
+// inboxUpdate loads the chat as it now appears in the user's inbox.
+func (h *ChatsHandler) inboxUpdate(userId, chatId int) (Chats.InboxUpdate, error) {
+	entry, ok, err := h.chatCtrl.GetInboxEntry(userId, chatId)
+	if err != nil {
+		return Chats.InboxUpdate{}, err
+	}
+	if !ok {
+		return Chats.InboxUpdate{Type: Chats.InboxRemoved, ChatId: chatId}, nil
+	}
+	return Chats.InboxUpdate{Type: Chats.InboxUpdated, ChatId: chatId, Chat: &entry}, nil
+}
+
+// decodePayload decodes an event payload into v. Events published by this instance carry
+// their payload as a value, events relayed from other instances as raw JSON.
+func decodePayload(payload interface{}, v interface{}) error {
+	data, ok := payload.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
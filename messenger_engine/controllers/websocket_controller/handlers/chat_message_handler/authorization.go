@@ -0,0 +1,96 @@
+package chatmessagehandler
+
+import (
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	ChatController "messenger_engine/controllers/chat_controller"
+	MessageController "messenger_engine/controllers/message_controller"
+)
+
+// ChatAuthorizer decides whether a user takes part in a chat.
+// It is implemented by *ChatController.ChatController.
+type ChatAuthorizer interface {
+	// IsParticipant reports whether the user may load the chat's history and subscribe to it.
+	IsParticipant(userId, chatId int) (bool, error)
+	// CanPost reports whether the user may post messages and replies to the chat.
+	CanPost(userId, chatId int) (bool, error)
+}
+
+// authorizeRead checks that the user may load and subscribe to the chat.
+// Denials are answered with a forbidden error frame.
+//
+// Returns:
+//   - Whether the request can be processed; always true when no Authorizer is configured.
+func (h *ChatMessageHandler) authorizeRead(client *Broadcast.Client, requestId string, userId, chatId int) bool {
+	if h.Authorizer == nil {
+		return true
+	}
+	return h.authorize(client, requestId, userId, chatId, h.Authorizer.IsParticipant)
+}
+
+// authorizePost checks that the user may post to the chat.
+// Denials are answered with a forbidden error frame.
+//
+// Returns:
+//   - Whether the request can be processed; always true when no Authorizer is configured.
+func (h *ChatMessageHandler) authorizePost(client *Broadcast.Client, requestId string, userId, chatId int) bool {
+	if h.Authorizer == nil {
+		return true
+	}
+	return h.authorize(client, requestId, userId, chatId, h.Authorizer.CanPost)
+}
+
+// authorizeMessagePost checks that the user may post to the chat of the message, which
+// editing, deleting and reacting to it require. Denials are answered with a forbidden error frame.
+//
+// Returns:
+//   - Whether the request can be processed; always true when no Authorizer is configured.
+func (h *ChatMessageHandler) authorizeMessagePost(client *Broadcast.Client, requestId string, userId, messageId int) bool {
+	if h.Authorizer == nil {
+		return true
+	}
+	chatId, err := h.msgCtrl.MessageChat(messageId)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, requestId, "Error loading message: %s", err)
+		return false
+	}
+	return h.authorizePost(client, requestId, userId, chatId)
+}
+
+// authorizeMessageRead checks that the user may read the chat of the message. Users outside
+// the chat are answered with the same not found error frame as unknown messages, so message
+// IDs do not reveal whether a message exists in somebody else's chat.
+//
+// Returns:
+//   - Whether the request can be processed; always true when no Authorizer is configured.
+func (h *ChatMessageHandler) authorizeMessageRead(client *Broadcast.Client, requestId string, userId, messageId int) bool {
+	if h.Authorizer == nil {
+		return true
+	}
+	chatId, err := h.msgCtrl.MessageChat(messageId)
+	if err == nil {
+		var allowed bool
+		if allowed, err = h.Authorizer.IsParticipant(userId, chatId); err == nil && !allowed {
+			err = MessageController.ErrMessageNotFound
+		}
+	}
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, requestId, "Error loading message: %s", err)
+		return false
+	}
+	return true
+}
+
+// authorize runs a membership check and reports denials and failures to the client.
+func (h *ChatMessageHandler) authorize(client *Broadcast.Client, requestId string, userId, chatId int, check func(userId, chatId int) (bool, error)) bool {
+	allowed, err := check(userId, chatId)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, requestId, "Error checking chat membership: %s", err)
+		return false
+	}
+	if !allowed {
+		err := ChatController.ErrNotChatMember
+		h.ErrorHandler.HandleRequestError(err, client, requestId, "User %d may not access chat %d", userId, chatId)
+		return false
+	}
+	return true
+}
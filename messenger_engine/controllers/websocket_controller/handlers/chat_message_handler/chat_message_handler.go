@@ -1,25 +1,44 @@
 package chatmessagehandler
 
 import (
-	"net/http"
 	"log"
+	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 
-	Messages "messenger_engine/models/message"
 	Broadcast "messenger_engine/controllers/broadcast_controller"
+	ChatController "messenger_engine/controllers/chat_controller"
 	MessageController "messenger_engine/controllers/message_controller"
 	ErrorHandler "messenger_engine/controllers/websocket_controller/handlers/error_handler"
 	MessageParser "messenger_engine/controllers/websocket_controller/parsers"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/event"
+	Messages "messenger_engine/models/message"
+	Auth "shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
+	"shared/ratelimit"
 )
 
+// InvalidFrameType is the rate limit type shared by frames that cannot be decoded or name an unknown type.
+const InvalidFrameType = "invalid"
+
 // ChatMessageHandler handles WebSocket connections for sending and receiving chat messages.
 type ChatMessageHandler struct {
-	upgrader      websocket.Upgrader // WebSocket upgrader for upgrading HTTP connection
+	upgrader      websocket.Upgrader                   // WebSocket upgrader for upgrading HTTP connection
 	msgCtrl       *MessageController.MessageController // Controller for managing messages
-	ErrorHandler  *ErrorHandler.ErrorHandler // Error handler for WebSocket errors
-	MessageParser *MessageParser.Parser // Message parser for parsing incoming messages
-	Broadcast     *Broadcast.Broadcast // Broadcast controller for broadcasting messages to clients
+	ChatCtrl      *ChatController.ChatController       // Manages group chats and their members; nil disables group chats
+	Authorizer    ChatAuthorizer                       // Checks chat membership before loads, sends and subscriptions; nil allows every chat
+	Presence      PresenceReader                       // Answers presence queries; nil disables them
+	ErrorHandler  *ErrorHandler.ErrorHandler           // Error handler for WebSocket errors
+	MessageParser *MessageParser.Parser                // Message parser for parsing incoming messages
+	Broadcast     *Broadcast.Broadcast                 // Broadcast controller for broadcasting messages to clients
+	Authenticator *Auth.Authenticator                  // Verifies the handshake token; nil accepts unauthenticated clients
+	Lifecycle     lifecycle.Config                     // Heartbeat, deadline and frame size settings applied to every connection
+	RateLimiter   *ratelimit.Limiter                   // Limits frames per user (or remote IP) and type; nil disables limiting
+	TypingTimeout time.Duration                        // How long a typing indicator lasts without a refresh
+	typing        *typingTracker                       // Typing indicators started on this instance
 }
 
 // NewChatMessageHandler initializes a new ChatMessageHandler with the given dependencies.
@@ -32,114 +51,592 @@ func NewChatMessageHandler(
 		log.Fatal("NewChatMessageHandler: broadcast instance cannot be nil")
 	}
 
+	// Allow WebSocket connections from any origin
+	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+
 	return &ChatMessageHandler{
 		upgrader:      upgrader,
 		msgCtrl:       ctrl,
 		Broadcast:     broadcast,
 		MessageParser: MessageParser.New(),
-		ErrorHandler:  ErrorHandler.NewErrorHandler(),
+		ErrorHandler:  newErrorHandler(),
+		Lifecycle:     lifecycle.DefaultConfig(),
+		RateLimiter:   ratelimit.NewLimiter(DefaultRateLimits()),
+		TypingTimeout: DefaultTypingTimeout,
+		typing:        newTypingTracker(),
 	}
 }
 
+// DefaultRateLimits returns the built-in frame limits of the /chat socket.
+// Sends, which each run an INSERT, are limited the most; reads are more permissive.
+//
+// Returns:
+//   - The default ratelimit.Config, to be overridden with ratelimit.LoadConfig.
+func DefaultRateLimits() ratelimit.Config {
+	return ratelimit.Config{
+		Rules: map[string]ratelimit.Rule{
+			protocol.TypeMessage:        {Rate: 5, Burst: 10},
+			protocol.TypeMessageReply:   {Rate: 5, Burst: 10},
+			protocol.TypeMessageEdit:    {Rate: 2, Burst: 5},
+			protocol.TypeMessageDelete:  {Rate: 2, Burst: 5},
+			protocol.TypeReactionAdd:    {Rate: 5, Burst: 10},
+			protocol.TypeReactionRemove: {Rate: 5, Burst: 10},
+			// A reconnecting client acknowledges every message of a replayed page at once
+			protocol.TypeDelivered: {Rate: 20, Burst: 100},
+			// Clients refresh a typing indicator every few seconds, not on every keystroke
+			protocol.TypeTypingStart: {Rate: 1, Burst: 3},
+			protocol.TypeTypingStop:  {Rate: 1, Burst: 3},
+		},
+		Default:         ratelimit.Rule{Rate: 20, Burst: 40},
+		MaxViolations:   20,
+		ViolationWindow: time.Minute,
+	}
+}
+
+// newErrorHandler returns an error handler that reports the message controller's,
+// the chat controller's and the parser's sentinel errors with their protocol error codes.
+func newErrorHandler() *ErrorHandler.ErrorHandler {
+	errorHandler := ErrorHandler.NewErrorHandler()
+	errorHandler.RegisterCode(MessageParser.ErrIdentityMismatch, protocol.CodeForbidden)
+	errorHandler.RegisterCode(MessageController.ErrNotMessageAuthor, protocol.CodeForbidden)
+	errorHandler.RegisterCode(MessageController.ErrMessageNotFound, protocol.CodeNotFound)
+	errorHandler.RegisterCode(MessageController.ErrMessageDeleted, protocol.CodeConflict)
+	errorHandler.RegisterCode(MessageController.ErrConflictingCursors, protocol.CodeInvalidField)
+	errorHandler.RegisterCode(MessageController.ErrForeignAttachment, protocol.CodeForbidden)
+	errorHandler.RegisterCode(ChatController.ErrChatNotFound, protocol.CodeNotFound)
+	errorHandler.RegisterCode(ChatController.ErrNotChatMember, protocol.CodeForbidden)
+	errorHandler.RegisterCode(ChatController.ErrInsufficientRole, protocol.CodeForbidden)
+	errorHandler.RegisterCode(ChatController.ErrAlreadyMember, protocol.CodeConflict)
+	errorHandler.RegisterCode(ChatController.ErrNotGroupChat, protocol.CodeConflict)
+	return errorHandler
+}
+
 // ServeHTTP upgrades the HTTP connection to a WebSocket connection and handles incoming chat messages.
 // It processes the WebSocket connection and delegates message handling to respective methods based on message type.
+// When an Authenticator is configured, the handshake is rejected unless it carries a valid token,
+// and the authenticated user is bound to the connection for its whole lifetime.
+// Frames are exchanged in the format negotiated through Sec-WebSocket-Protocol (JSON by default);
+// other formats are converted to JSON on the way in, so decoding and validation are shared.
 func (h *ChatMessageHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-    h.upgrader.CheckOrigin = func(r *http.Request) bool { return true }
-
-    ws, err := h.upgrader.Upgrade(w, r, nil)
-    if err != nil {
-        // Handle WebSocket upgrade error
-        h.ErrorHandler.HandleWebSocketError(err, nil, "Error upgrading to WebSocket: %s", err)
-        return
-    }
-    defer ws.Close()
-
-    // Register the client for broadcasts.
-    h.Broadcast.Clients[ws] = true
-
-    for {
-        var msg map[string]interface{}
-        if err := ws.ReadJSON(&msg); err != nil {
-            // Handle error reading the message from WebSocket
-            h.ErrorHandler.HandleWebSocketError(err, ws, "Error reading message: %s", err)
-            delete(h.Broadcast.Clients, ws)
-            break
-        }
-
-        // Handle different message types
-        switch msg["type"] {
-        case "initial":
-            h.handleInitialMessage(ws, msg)
-        case "message":
-            h.handleMessage(ws, msg)
-        case "message_reply":
-            h.handleMessageReply(ws, msg)
-        }
-    }
-}
-
-// handleInitialMessage processes the initial message sent by the client. 
-// It retrieves previous messages from the database and sends them back to the client.
-func (h *ChatMessageHandler) handleInitialMessage(ws *websocket.Conn, msg map[string]interface{}) {
-	chatID, err := h.MessageParser.ParseChatID(msg)
+	var userID int
+	if h.Authenticator != nil {
+		var err error
+		if userID, err = h.Authenticator.Authenticate(r); err != nil {
+			// Reject the handshake before upgrading the connection
+			log.Printf("Rejected unauthenticated chat connection: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	ws, err := h.upgrader.Upgrade(w, r, codec.Negotiate(r))
 	if err != nil {
+		// Handle WebSocket upgrade error
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error upgrading to WebSocket: %s", err)
+		return
+	}
+	defer ws.Close()
+
+	// Ping the client and reap the connection once it stops answering: the read below
+	// then fails, and the deferred RemoveClient unregisters it from the broadcaster.
+	heartbeat := lifecycle.Start(ws, h.Lifecycle)
+	defer heartbeat.Stop()
+
+	// Register the client for broadcasts. From now on every write goes through
+	// the client's outbound queue, drained by its own writer goroutine.
+	client := h.Broadcast.RegisterClient(ws)
+	defer h.Broadcast.RemoveClient(client)
+
+	// Typing indicators of a closed connection stop right away instead of waiting for their timeout
+	defer h.stopClientTyping(client)
+
+	// Authenticated connections also receive the events of the group chats their user belongs to
+	if userID != 0 {
+		h.Broadcast.Identify(client, userID)
+	}
+
+	// Frames are rate limited per authenticated user, or per remote IP for anonymous connections
+	key := ratelimit.Key(userID, r)
+
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			// The connection is gone; there is nobody left to report the error to
+			h.ErrorHandler.HandleWebSocketError(err, nil, "Error reading message: %s", err)
+			break
+		}
+		if data, err = codec.ToJSON(client.Codec, data); err != nil {
+			h.ErrorHandler.HandleRequestError(protocol.NewError(protocol.CodeBadRequest, "frame could not be decoded"), client, "", "Invalid frame: %s", err)
+			continue
+		}
+		if !h.dispatch(client, userID, key, data) {
+			// Give the writer a chance to flush the error and close frames before tearing down
+			select {
+			case <-client.Done():
+			case <-time.After(h.Lifecycle.WriteTimeout):
+			}
+			break
+		}
+	}
+}
+
+// dispatch decodes one inbound frame and hands it to the handler of its type.
+// Malformed frames, unsupported versions and unknown types are answered with an error frame,
+// as are frames over the caller's rate limit.
+// It returns false once the caller has been disconnected for repeatedly exceeding its limit.
+func (h *ChatMessageHandler) dispatch(client *Broadcast.Client, userID int, key string, data []byte) bool {
+	env, err := h.MessageParser.Decode(data)
+	if decision := h.limit(client, key, env, err); !decision.Allowed {
+		return !decision.Disconnect
+	}
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid frame: %s", err)
+		return true
+	}
+
+	switch env.Type {
+	case protocol.TypeInitial:
+		h.handleInitialMessage(client, userID, env)
+	case protocol.TypeHistory:
+		h.handleHistory(client, userID, env)
+	case protocol.TypeResume:
+		h.handleResume(client, userID, env)
+	case protocol.TypeMessage:
+		h.handleMessage(client, userID, env)
+	case protocol.TypeMessageReply:
+		h.handleMessageReply(client, userID, env)
+	case protocol.TypeMessageEdit:
+		h.handleMessageEdit(client, userID, env)
+	case protocol.TypeMessageDelete:
+		h.handleMessageDelete(client, userID, env)
+	case protocol.TypeMessageRevisions:
+		h.handleMessageRevisions(client, userID, env)
+	case protocol.TypeUnsubscribe:
+		h.handleUnsubscribe(client, env)
+	case protocol.TypeChatCreate, protocol.TypeChatAddMember, protocol.TypeChatRemoveMember,
+		protocol.TypeChatLeave, protocol.TypeChatRename:
+		h.dispatchChatManagement(client, userID, env)
+	case protocol.TypeDelivered, protocol.TypeRead:
+		h.handleReceipt(client, userID, env)
+	case protocol.TypeTypingStart, protocol.TypeTypingStop:
+		h.handleTyping(client, userID, env)
+	case protocol.TypePresenceQuery:
+		h.handlePresenceQuery(client, env)
+	case protocol.TypeReactionAdd, protocol.TypeReactionRemove:
+		h.handleReaction(client, userID, env)
+	default:
+		err := protocol.NewError(protocol.CodeUnknownType, "unknown frame type "+env.Type)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid frame: %s", err)
+	}
+	return true
+}
+
+// limit checks the frame against the caller's rate limit. Frames over the limit are answered
+// with a rate_limited error frame; repeat offenders are also sent a policy violation close frame.
+// Frames that could not be decoded or name an unknown type share the InvalidFrameType limit,
+// so clients cannot make up types to get fresh limits.
+//
+// Returns:
+//   - The rate limit decision; always allowed when no RateLimiter is configured.
+func (h *ChatMessageHandler) limit(client *Broadcast.Client, key string, env protocol.Envelope, decodeErr error) ratelimit.Decision {
+	if h.RateLimiter == nil {
+		return ratelimit.Decision{Allowed: true}
+	}
+	frameType := env.Type
+	if decodeErr != nil || !protocol.IsKnownType(frameType) {
+		frameType = InvalidFrameType
+	}
+	decision := h.RateLimiter.Allow(key, frameType)
+	if decision.Allowed {
+		return decision
+	}
+
+	err := protocol.RateLimited(decision.RetryAfter)
+	h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Rate limit exceeded for %q frames", frameType)
+	if decision.Disconnect {
+		log.Printf("Disconnecting %s for repeatedly exceeding its rate limit", key)
+		if err := client.Disconnect(websocket.ClosePolicyViolation, "rate limit exceeded"); err != nil {
+			log.Printf("Error disconnecting %s: %v", key, err)
+		}
+	}
+	return decision
+}
+
+// handleInitialMessage processes the initial message sent by the client.
+// It subscribes the client to the chat, retrieves the latest page of messages from the database
+// and sends it back to the client. Older messages are fetched with "history" requests.
+// Users who do not take part in the chat are answered with a forbidden error frame.
+func (h *ChatMessageHandler) handleInitialMessage(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ChatPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
 		// Handle error in parsing chat ID
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Invalid chat_id format: %s", err)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid initial request: %s", err)
 		return
 	}
+	if !h.authorizeRead(client, env.RequestId, userID, payload.ChatId) {
+		return
+	}
+
+	// Subscribe the client to the chat so it receives live messages.
+	h.Broadcast.Subscribe(client, payload.ChatId)
 
-	messages, err := h.msgCtrl.LoadMessages(chatID)
+	page, err := h.msgCtrl.LoadMessages(Messages.HistoryQuery{ChatId: payload.ChatId, ViewerId: userID})
 	if err != nil {
 		// Handle error loading messages
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Error loading messages: %s", err)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading messages: %s", err)
 		return
 	}
 
 	// Send the initial messages back to the client
-	if err := ws.WriteJSON(map[string]interface{}{"type": "initial", "messages": messages}); err != nil {
+	if err := client.WriteJSON(historyResponse(protocol.TypeInitial, env.RequestId, payload.ChatId, page)); err != nil {
 		// Handle error sending the messages
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Error sending initial messages: %s", err)
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending initial messages: %s", err)
 	}
 }
 
-// handleMessage processes a new message sent by the client. 
-// It parses, saves the message to the database, and broadcasts it to other clients.
-func (h *ChatMessageHandler) handleMessage(ws *websocket.Conn, msg map[string]interface{}) {
-	messageData, err := h.MessageParser.ParseMessageData(msg)
+// handleHistory sends a page of older or newer messages of a chat back to the client.
+// The page is selected with before_message_id or after_message_id and limit.
+// Users who do not take part in the chat are answered with a forbidden error frame.
+func (h *ChatMessageHandler) handleHistory(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.HistoryPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the history request
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid history request: %s", err)
+		return
+	}
+	if !h.authorizeRead(client, env.RequestId, userID, payload.ChatId) {
+		return
+	}
+
+	page, err := h.msgCtrl.LoadMessages(payload.ToQuery(userID))
 	if err != nil {
+		// Handle error loading messages
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading messages: %s", err)
+		return
+	}
+
+	if err := client.WriteJSON(historyResponse(protocol.TypeHistory, env.RequestId, payload.ChatId, page)); err != nil {
+		// Handle error sending the page
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending history: %s", err)
+	}
+}
+
+// handleResume catches a reconnecting client up on the chats it was following.
+// For every chat it subscribes the client first and then replays the messages saved after
+// the last message the client saw, so nothing falls between the replay and live delivery.
+// A message saved in that window may arrive twice; clients drop duplicates by message ID or seq.
+// At most one page is replayed per chat; when has_more is set the client continues with
+// "history" requests using after_message_id.
+func (h *ChatMessageHandler) handleResume(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ResumePayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the resume request
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid resume request: %s", err)
+		return
+	}
+
+	for _, cursor := range payload.Chats {
+		// Chats the user does not take part in are answered with an error frame and skipped
+		if !h.authorizeRead(client, env.RequestId, userID, cursor.ChatId) {
+			continue
+		}
+
+		// Subscribe before loading the gap so live messages cannot slip in between
+		h.Broadcast.Subscribe(client, cursor.ChatId)
+
+		page, err := h.msgCtrl.LoadMessages(Messages.HistoryQuery{
+			ChatId:         cursor.ChatId,
+			ViewerId:       userID,
+			AfterMessageId: cursor.LastMessageId,
+			Limit:          MessageController.MaxHistoryLimit,
+		})
+		if err != nil {
+			// Handle error loading the missed messages
+			h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading messages: %s", err)
+			continue
+		}
+
+		if err := client.WriteJSON(historyResponse(protocol.TypeResume, env.RequestId, cursor.ChatId, page)); err != nil {
+			// Handle error sending the missed messages
+			h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending missed messages: %s", err)
+			return
+		}
+	}
+}
+
+// historyResponse builds the frame carrying a page of chat history.
+func historyResponse(frameType string, requestId string, chatID int, page Messages.HistoryPage) map[string]interface{} {
+	response := map[string]interface{}{
+		"type":        frameType,
+		"chat_id":     chatID,
+		"messages":    page.Messages,
+		"has_more":    page.HasMore,
+		"next_cursor": page.NextCursor,
+	}
+	if requestId != "" {
+		response["request_id"] = requestId
+	}
+	return response
+}
+
+// handleMessage processes a new message sent by the client.
+// It parses, saves the message to the database, and broadcasts it to other clients.
+// The author of the message is always the user authenticated on the connection.
+// A message without a chat_id goes to the 1:1 chat of its author and receiver, whose ID the
+// server assigns when the chat is opened and returns in the ack and the broadcast message.
+// Messages of group chats are delivered to every member and stored without a receiver.
+func (h *ChatMessageHandler) handleMessage(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.MessagePayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
 		// Handle error in parsing message data
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Invalid message format: %s", err)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid message format: %s", err)
 		return
 	}
+	messageData := payload.ToMessage()
 
-	if err := h.msgCtrl.SaveMessage(messageData); err != nil {
+	var err error
+	if messageData.AuthorId, err = h.MessageParser.ResolveUserID(messageData.AuthorId, userID); err != nil {
+		// Reject messages sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid author: %s", err)
+		return
+	}
+	if messageData.ChatId == 0 {
+		var ok bool
+		if messageData.ChatId, ok = h.openDirectChat(client, env.RequestId, messageData.AuthorId, messageData.ReceiverId); !ok {
+			return
+		}
+	}
+	if !h.authorizePost(client, env.RequestId, messageData.AuthorId, messageData.ChatId) {
+		return
+	}
+
+	var recipients []int
+	recipients, messageData.ReceiverId, err = h.postRecipients(messageData.ChatId, messageData.AuthorId, messageData.ReceiverId)
+	if err != nil {
+		// Handle error loading the chat members
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading chat: %s", err)
+		return
+	}
+
+	savedMsg, duplicate, err := h.msgCtrl.SaveMessage(messageData)
+	if err != nil {
 		// Handle error saving message to database
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Error saving message to database: %s", err)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error saving message to database: %s", err)
+		return
+	}
+
+	h.sendAck(client, Messages.MessageAck{
+		RequestId:   env.RequestId,
+		ClientMsgId: savedMsg.ClientMsgId,
+		MessageId:   savedMsg.MessageId,
+		ChatId:      savedMsg.ChatId,
+		Seq:         savedMsg.Seq,
+		Timestamp:   savedMsg.Timestamp,
+		Duplicate:   duplicate,
+	})
+	if duplicate {
+		// A retried send: the message was already broadcast by the first attempt
 		return
 	}
 
+	// Sending the message ends the author's typing indicator
+	h.stopTyping(savedMsg.ChatId, savedMsg.AuthorId)
+
 	// Create a final message structure and broadcast to other clients
-	finalMsg := Messages.FinalMessage{Type: "message", Message: messageData}
-	h.Broadcast.Broadcast <- finalMsg
+	finalMsg := Messages.FinalMessage{Type: "message", Message: savedMsg}
+	h.publishMessage(event.FromMessage(finalMsg), recipients)
+}
+
+// sendAck confirms a stored message to its sender by mapping the client_msg_id to the
+// server-assigned message ID. Messages sent without a client_msg_id are not acknowledged.
+func (h *ChatMessageHandler) sendAck(client *Broadcast.Client, ack Messages.MessageAck) {
+	if ack.ClientMsgId == "" {
+		return
+	}
+
+	ack.Type = "message_ack"
+	if err := client.WriteJSON(ack); err != nil {
+		// Handle error sending the acknowledgement
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending message ack: %s", err)
+	}
 }
 
-// handleMessageReply processes a message reply sent by the client. 
+// handleMessageReply processes a message reply sent by the client.
 // It parses, saves the message reply to the database, and broadcasts it to other clients.
-func (h *ChatMessageHandler) handleMessageReply(ws *websocket.Conn, msg map[string]interface{}) {
-	messageReplyData, err := h.MessageParser.ParseMessageReplyData(msg)
-	if err != nil {
+// The author of the reply is always the user authenticated on the connection.
+// Replies in group chats are delivered to every member and stored without a receiver.
+func (h *ChatMessageHandler) handleMessageReply(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ReplyPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
 		// Handle error in parsing message reply data
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Invalid message format: %s", err)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid message format: %s", err)
+		return
+	}
+	messageReplyData := payload.ToReply()
+
+	var err error
+	if messageReplyData.AuthorId, err = h.MessageParser.ResolveUserID(messageReplyData.AuthorId, userID); err != nil {
+		// Reject replies sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid author: %s", err)
+		return
+	}
+	if !h.authorizePost(client, env.RequestId, messageReplyData.AuthorId, messageReplyData.ChatId) {
 		return
 	}
 
-	if err := h.msgCtrl.SaveMessageReply(messageReplyData); err != nil {
+	var recipients []int
+	recipients, messageReplyData.ReceiverId, err = h.postRecipients(messageReplyData.ChatId, messageReplyData.AuthorId, messageReplyData.ReceiverId)
+	if err != nil {
+		// Handle error loading the chat members
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading chat: %s", err)
+		return
+	}
+
+	savedReply, duplicate, err := h.msgCtrl.SaveMessageReply(messageReplyData)
+	if err != nil {
 		// Handle error saving message reply to database
-		h.ErrorHandler.HandleWebSocketError(err, ws, "Error saving message reply to database: %s", err)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error saving message reply to database: %s", err)
+		return
+	}
+
+	h.sendAck(client, Messages.MessageAck{
+		RequestId:   env.RequestId,
+		ClientMsgId: savedReply.ClientMsgId,
+		MessageId:   savedReply.MessageId,
+		ChatId:      savedReply.ChatId,
+		Seq:         savedReply.Seq,
+		Timestamp:   savedReply.Timestamp,
+		Duplicate:   duplicate,
+	})
+	if duplicate {
+		// A retried send: the reply was already broadcast by the first attempt
 		return
 	}
 
+	// Sending the reply ends the author's typing indicator
+	h.stopTyping(savedReply.ChatId, savedReply.AuthorId)
+
 	// Create a final message reply structure and broadcast to other clients
-	finalMsgReply := Messages.FinalMessageReply{Type: "message_reply", Message: messageReplyData}
-	h.Broadcast.RepliesBroadcast <- finalMsgReply
+	finalMsgReply := Messages.FinalMessageReply{Type: "message_reply", Message: savedReply}
+	h.publishMessage(event.FromReply(finalMsgReply), recipients)
+}
+
+// handleMessageEdit processes an edit of an existing message sent by the client.
+// Only the original author may edit a message, and only while they may still post to its chat.
+// The previous content is kept in the edit history and the updated message is broadcast to the
+// chat as "message_edited".
+func (h *ChatMessageHandler) handleMessageEdit(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.EditPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing message edit data
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid message format: %s", err)
+		return
+	}
+	editData := payload.ToEdit()
+
+	var err error
+	if editData.AuthorId, err = h.MessageParser.ResolveUserID(editData.AuthorId, userID); err != nil {
+		// Reject edits sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid author: %s", err)
+		return
+	}
+	if !h.authorizeMessagePost(client, env.RequestId, editData.AuthorId, editData.MessageId) {
+		return
+	}
+
+	editedMsg, err := h.msgCtrl.EditMessage(editData)
+	if err != nil {
+		// Handle unknown messages, foreign messages and database errors
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error editing message: %s", err)
+		return
+	}
+
+	// Notify the chat about the new content
+	finalMsg := Messages.FinalMessage{Type: "message_edited", Message: editedMsg}
+	h.publishToChat(finalMsg)
+}
+
+// handleMessageDelete processes a deletion of the client's own message, in a chat the client
+// may still post to. Deleting for everyone broadcasts the tombstone to the chat as
+// "message_deleted"; deleting only for the author sends it to the author's own connections only.
+func (h *ChatMessageHandler) handleMessageDelete(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.DeletePayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing message deletion data
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid message format: %s", err)
+		return
+	}
+	deleteData := payload.ToDelete()
+
+	var err error
+	if deleteData.AuthorId, err = h.MessageParser.ResolveUserID(deleteData.AuthorId, userID); err != nil {
+		// Reject deletions sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid author: %s", err)
+		return
+	}
+	if !h.authorizeMessagePost(client, env.RequestId, deleteData.AuthorId, deleteData.MessageId) {
+		return
+	}
+
+	tombstone, err := h.msgCtrl.DeleteMessage(deleteData)
+	if err != nil {
+		// Handle unknown messages, foreign messages and database errors
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error deleting message: %s", err)
+		return
+	}
+
+	finalMsg := Messages.FinalMessage{Type: "message_deleted", Message: tombstone}
+	if !deleteData.ForEveryone {
+		// Hide the message on every connection of the author, on every instance
+		ev := event.FromMessage(finalMsg)
+		ev.Recipients = []int{deleteData.AuthorId}
+		ev.RecipientsOnly = true
+		h.Broadcast.Publish(ev)
+		return
+	}
+	h.publishToChat(finalMsg)
+}
+
+// handleMessageRevisions sends the edit history of a message back to the client.
+// Users who do not take part in the message's chat are told that the message does not exist.
+func (h *ChatMessageHandler) handleMessageRevisions(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.MessageRefPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing message ID
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid revisions request: %s", err)
+		return
+	}
+
+	if !h.authorizeMessageRead(client, env.RequestId, userID, payload.MessageId) {
+		return
+	}
+
+	revisions, err := h.msgCtrl.LoadRevisions(payload.MessageId)
+	if err != nil {
+		// Handle error loading revisions
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading message revisions: %s", err)
+		return
+	}
+
+	response := map[string]interface{}{"type": protocol.TypeMessageRevisions, "message_id": payload.MessageId, "revisions": revisions}
+	if env.RequestId != "" {
+		response["request_id"] = env.RequestId
+	}
+	if err := client.WriteJSON(response); err != nil {
+		// Handle error sending the revisions
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending message revisions: %s", err)
+	}
+}
+
+// handleUnsubscribe stops delivering live messages of the given chat to the client.
+// The connection itself stays open and keeps its other subscriptions.
+func (h *ChatMessageHandler) handleUnsubscribe(client *Broadcast.Client, env protocol.Envelope) {
+	var payload protocol.ChatPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing chat ID
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid unsubscribe request: %s", err)
+		return
+	}
+
+	h.Broadcast.Unsubscribe(client, payload.ChatId)
 }
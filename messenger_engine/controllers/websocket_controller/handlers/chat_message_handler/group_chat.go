@@ -0,0 +1,291 @@
+package chatmessagehandler
+
+import (
+	"errors"
+
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	ChatController "messenger_engine/controllers/chat_controller"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	Chats "messenger_engine/models/chat"
+	"messenger_engine/models/event"
+	Messages "messenger_engine/models/message"
+)
+
+// chatRecipients looks up the members of a chat, who receive its messages on every connection.
+// Chats without a chat row (or handlers without a chat controller) have no known members;
+// their messages only reach the clients subscribed to the chat, as before.
+//
+// Returns:
+//   - The IDs of the chat's members, or nil if they are unknown.
+//   - Whether the chat is a group chat, whose messages have no single receiver.
+//   - An error if the chat could not be loaded.
+func (h *ChatMessageHandler) chatRecipients(chatId int) ([]int, bool, error) {
+	if h.ChatCtrl == nil {
+		return nil, false, nil
+	}
+	chat, err := h.ChatCtrl.GetChat(chatId)
+	if errors.Is(err, ChatController.ErrChatNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return chat.MemberIds(), chat.IsGroup, nil
+}
+
+// postRecipients looks up the members of the chat a message is posted to, like chatRecipients,
+// and the receiver the message is stored with: nobody in group chats, and the author's partner
+// in 1:1 chats, whatever receiver the client sent. Without a chat controller the members are
+// unknown and the receiver is kept as sent.
+// Messages are never stored for a chat that does not exist, where nobody could read them.
+//
+// Returns:
+//   - The IDs of the chat's members, or nil if they are unknown.
+//   - The ID of the message's receiver, or 0 for group chats.
+//   - ErrChatNotFound if the chat does not exist, or another error if it could not be loaded.
+func (h *ChatMessageHandler) postRecipients(chatId, authorId, receiverId int) ([]int, int, error) {
+	if h.ChatCtrl == nil {
+		return nil, receiverId, nil
+	}
+	chat, err := h.ChatCtrl.GetChat(chatId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if chat.IsGroup {
+		return chat.MemberIds(), 0, nil
+	}
+	return chat.MemberIds(), chat.Partner(authorId), nil
+}
+
+// openDirectChat resolves a message posted without a chat_id to the 1:1 chat of its author and
+// receiver, which is created on first use. Errors are answered with error frames.
+//
+// Returns:
+//   - The ID of the chat, assigned by the server.
+//   - Whether the message can be posted.
+func (h *ChatMessageHandler) openDirectChat(client *Broadcast.Client, requestId string, authorId, receiverId int) (int, bool) {
+	if h.ChatCtrl == nil {
+		// Without a chat controller, chats have no rows to look the pair up in
+		err := protocol.InvalidField("chat_id", "must be a positive integer")
+		h.ErrorHandler.HandleRequestError(err, client, requestId, "Invalid message format: %s", err)
+		return 0, false
+	}
+	chat, err := h.ChatCtrl.OpenDirectChat(authorId, receiverId)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, requestId, "Error opening chat: %s", err)
+		return 0, false
+	}
+	return chat.ChatId, true
+}
+
+// publishMessage broadcasts a message frame to the subscribers of its chat and to the
+// connections of the chat's members, if they are known.
+func (h *ChatMessageHandler) publishMessage(ev event.Event, recipients []int) {
+	ev.Recipients = recipients
+	h.Broadcast.Publish(ev)
+}
+
+// publishToChat broadcasts a change of an existing message to its chat. The edit or deletion
+// is already stored, so when the chat's members cannot be loaded it still reaches the subscribers.
+func (h *ChatMessageHandler) publishToChat(finalMsg Messages.FinalMessage) {
+	recipients, _, err := h.chatRecipients(finalMsg.Message.ChatId)
+	if err != nil {
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error loading chat members: %s", err)
+	}
+	h.publishMessage(event.FromMessage(finalMsg), recipients)
+}
+
+// dispatchChatManagement hands a chat management frame to the handler of its type.
+// Without a chat controller, group chats are not available and the frame type is unknown.
+func (h *ChatMessageHandler) dispatchChatManagement(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	if h.ChatCtrl == nil {
+		err := protocol.NewError(protocol.CodeUnknownType, "unknown frame type "+env.Type)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid frame: %s", err)
+		return
+	}
+
+	switch env.Type {
+	case protocol.TypeChatCreate:
+		h.handleChatCreate(client, userID, env)
+	case protocol.TypeChatAddMember:
+		h.handleChatAddMember(client, userID, env)
+	case protocol.TypeChatRemoveMember:
+		h.handleChatRemoveMember(client, userID, env)
+	case protocol.TypeChatLeave:
+		h.handleChatLeave(client, userID, env)
+	case protocol.TypeChatRename:
+		h.handleChatRename(client, userID, env)
+	}
+}
+
+// handleChatCreate creates a group chat owned by the connection's user and announces it
+// to every member as a "chat_updated" frame with action "created".
+func (h *ChatMessageHandler) handleChatCreate(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ChatCreatePayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the chat
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid chat creation request: %s", err)
+		return
+	}
+
+	creatorId, err := h.MessageParser.ResolveUserID(payload.CreatorId, userID)
+	if err == nil && creatorId == 0 {
+		err = protocol.InvalidField("creator_id", "must be a positive integer")
+	}
+	if err != nil {
+		// Reject chats created on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid creator: %s", err)
+		return
+	}
+
+	chat, err := h.ChatCtrl.CreateChat(creatorId, payload.Title, payload.AvatarUrl, payload.MemberIds)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error creating chat: %s", err)
+		return
+	}
+
+	h.replyChat(client, env.RequestId, chat)
+	h.publishChatUpdate(Chats.ActionCreated, creatorId, 0, chat)
+}
+
+// handleChatAddMember adds a user to a group chat and announces the change to every member,
+// including the new one.
+func (h *ChatMessageHandler) handleChatAddMember(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ChatMemberPayload
+	actorId, ok := h.decodeChatRequest(client, userID, env, &payload, &payload.ActorId)
+	if !ok {
+		return
+	}
+
+	chat, err := h.ChatCtrl.AddMember(actorId, payload.ChatId, payload.UserId, payload.Role)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error adding chat member: %s", err)
+		return
+	}
+
+	h.replyChat(client, env.RequestId, chat)
+	h.publishChatUpdate(Chats.ActionMemberAdded, actorId, payload.UserId, chat)
+}
+
+// handleChatRemoveMember removes a member from a group chat and announces the change to the
+// remaining members and the removed user. Delivering the announcement unsubscribes the
+// removed user from the chat on every instance.
+func (h *ChatMessageHandler) handleChatRemoveMember(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ChatMemberPayload
+	actorId, ok := h.decodeChatRequest(client, userID, env, &payload, &payload.ActorId)
+	if !ok {
+		return
+	}
+
+	chat, err := h.ChatCtrl.RemoveMember(actorId, payload.ChatId, payload.UserId)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error removing chat member: %s", err)
+		return
+	}
+
+	action := Chats.ActionMemberRemoved
+	if actorId == payload.UserId {
+		action = Chats.ActionMemberLeft
+	}
+	h.replyChat(client, env.RequestId, chat)
+	h.publishChatUpdate(action, actorId, payload.UserId, chat)
+}
+
+// handleChatLeave removes the connection's user from a group chat. When the owner leaves,
+// ownership passes to another member; the change is announced to everyone involved, and
+// delivering the announcement unsubscribes the user from the chat on every instance.
+func (h *ChatMessageHandler) handleChatLeave(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ChatLeavePayload
+	leavingId, ok := h.decodeChatRequest(client, userID, env, &payload, &payload.UserId)
+	if !ok {
+		return
+	}
+
+	chat, err := h.ChatCtrl.LeaveChat(leavingId, payload.ChatId)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error leaving chat: %s", err)
+		return
+	}
+
+	h.replyChat(client, env.RequestId, chat)
+	h.publishChatUpdate(Chats.ActionMemberLeft, leavingId, leavingId, chat)
+}
+
+// handleChatRename changes the title, and optionally the avatar, of a group chat
+// and announces the change to every member.
+func (h *ChatMessageHandler) handleChatRename(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ChatRenamePayload
+	actorId, ok := h.decodeChatRequest(client, userID, env, &payload, &payload.ActorId)
+	if !ok {
+		return
+	}
+
+	chat, err := h.ChatCtrl.RenameChat(actorId, payload.ChatId, payload.Title, payload.AvatarUrl)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error renaming chat: %s", err)
+		return
+	}
+
+	h.replyChat(client, env.RequestId, chat)
+	h.publishChatUpdate(Chats.ActionRenamed, actorId, 0, chat)
+}
+
+// decodeChatRequest decodes a chat management payload and resolves the acting user
+// against the connection's user. Failures are answered with an error frame.
+//
+// Parameters:
+//   - dst: The payload to decode into.
+//   - claimed: The payload field naming the acting user, read after decoding.
+//
+// Returns:
+//   - The ID of the acting user.
+//   - Whether the request can be processed.
+func (h *ChatMessageHandler) decodeChatRequest(client *Broadcast.Client, userID int, env protocol.Envelope, dst protocol.Payload, claimed *int) (int, bool) {
+	if err := h.MessageParser.DecodePayload(env, dst); err != nil {
+		// Handle error in parsing the request
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid %s request: %s", env.Type, err)
+		return 0, false
+	}
+
+	actorId, err := h.MessageParser.ResolveUserID(*claimed, userID)
+	if err != nil {
+		// Reject changes made on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid user: %s", err)
+		return 0, false
+	}
+	return actorId, true
+}
+
+// replyChat answers a chat management request with the chat as it is after the change.
+func (h *ChatMessageHandler) replyChat(client *Broadcast.Client, requestId string, chat Chats.Chat) {
+	response := map[string]interface{}{"type": "chat", "chat": chat}
+	if requestId != "" {
+		response["request_id"] = requestId
+	}
+	if err := client.WriteJSON(response); err != nil {
+		// Handle error sending the chat
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending chat: %s", err)
+	}
+}
+
+// publishChatUpdate announces a change of a chat to all of its members. A member who was
+// removed or left is told as well, so their clients can drop the chat.
+func (h *ChatMessageHandler) publishChatUpdate(action string, actorId, userId int, chat Chats.Chat) {
+	recipients := chat.MemberIds()
+	if _, ok := chat.Member(userId); userId != 0 && !ok {
+		recipients = append(recipients, userId)
+	}
+
+	h.Broadcast.Publish(event.Event{
+		Type:   event.ChatUpdated,
+		ChatId: chat.ChatId,
+		Payload: Chats.ChatUpdate{
+			Type:    string(event.ChatUpdated),
+			Action:  action,
+			ActorId: actorId,
+			UserId:  userId,
+			Chat:    chat,
+		},
+		Recipients: recipients,
+	})
+}
@@ -0,0 +1,46 @@
+package chatmessagehandler
+
+import (
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	Presence "messenger_engine/models/presence"
+)
+
+// PresenceReader looks up whether users are online and when they were last seen.
+// It is implemented by *PresenceController.PresenceController.
+type PresenceReader interface {
+	GetPresence(userIds []int) ([]Presence.Presence, error)
+}
+
+// handlePresenceQuery sends the presence of the requested users back to the client.
+// Frames are answered with unknown_type when no Presence reader is configured.
+func (h *ChatMessageHandler) handlePresenceQuery(client *Broadcast.Client, env protocol.Envelope) {
+	if h.Presence == nil {
+		err := protocol.NewError(protocol.CodeUnknownType, "unknown frame type "+env.Type)
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid frame: %s", err)
+		return
+	}
+
+	var payload protocol.PresenceQueryPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the presence query
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid presence query: %s", err)
+		return
+	}
+
+	users, err := h.Presence.GetPresence(payload.UserIds)
+	if err != nil {
+		// Handle error loading the presence
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error loading presence: %s", err)
+		return
+	}
+
+	response := map[string]interface{}{"type": protocol.TypePresenceQuery, "users": users}
+	if env.RequestId != "" {
+		response["request_id"] = env.RequestId
+	}
+	if err := client.WriteJSON(response); err != nil {
+		// Handle error sending the presence
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error sending presence: %s", err)
+	}
+}
@@ -0,0 +1,56 @@
+package chatmessagehandler
+
+import (
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/event"
+	Messages "messenger_engine/models/message"
+)
+
+// handleReaction adds or removes a reaction of the connection's user to a message and
+// broadcasts the change to the message's chat. Users who do not take part in the chat are
+// answered with a forbidden error frame. Repeated additions and removals of reactions that
+// do not exist change nothing and are not broadcast.
+func (h *ChatMessageHandler) handleReaction(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ReactionPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the reaction
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid reaction: %s", err)
+		return
+	}
+
+	reactorId, err := h.MessageParser.ResolveUserID(payload.UserId, userID)
+	if err != nil {
+		// Reject reactions sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid user: %s", err)
+		return
+	}
+
+	if !h.authorizeMessagePost(client, env.RequestId, reactorId, payload.MessageId) {
+		return
+	}
+
+	var (
+		update  Messages.ReactionUpdate
+		changed bool
+	)
+	if env.Type == protocol.TypeReactionAdd {
+		update, changed, err = h.msgCtrl.AddReaction(reactorId, payload.MessageId, payload.Emoji)
+	} else {
+		update, changed, err = h.msgCtrl.RemoveReaction(reactorId, payload.MessageId, payload.Emoji)
+	}
+	if err != nil {
+		// Handle unknown and deleted messages and database errors
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error saving reaction: %s", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	recipients, _, err := h.chatRecipients(update.ChatId)
+	if err != nil {
+		h.ErrorHandler.HandleWebSocketError(err, nil, "Error loading chat members: %s", err)
+	}
+	h.publishMessage(event.Event{Type: event.Type(update.Type), ChatId: update.ChatId, Payload: update}, recipients)
+}
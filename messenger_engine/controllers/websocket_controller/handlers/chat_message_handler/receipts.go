@@ -0,0 +1,62 @@
+package chatmessagehandler
+
+import (
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/event"
+)
+
+// handleReceipt records a "delivered" or "read" acknowledgement of the connection's user
+// and forwards it to the connections of the affected authors only. Receipts that change
+// nothing, such as repeated ones or reads below the current high-water mark, are not forwarded.
+func (h *ChatMessageHandler) handleReceipt(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.ReceiptPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the receipt
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid receipt: %s", err)
+		return
+	}
+
+	readerId, err := h.MessageParser.ResolveUserID(payload.UserId, userID)
+	if err != nil {
+		// Reject receipts sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid user: %s", err)
+		return
+	}
+	if !h.authorizeRead(client, env.RequestId, readerId, payload.ChatId) {
+		return
+	}
+
+	if env.Type == protocol.TypeDelivered {
+		receipt, authorId, recorded, err := h.msgCtrl.MarkDelivered(readerId, payload.ChatId, payload.MessageId)
+		if err != nil {
+			h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error saving delivery receipt: %s", err)
+			return
+		}
+		if recorded {
+			h.publishReceipt(event.MessageDelivered, payload.ChatId, receipt, []int{authorId})
+		}
+		return
+	}
+
+	receipt, authors, moved, err := h.msgCtrl.MarkRead(readerId, payload.ChatId, payload.MessageId)
+	if err != nil {
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Error saving read receipt: %s", err)
+		return
+	}
+	if moved && len(authors) > 0 {
+		h.publishReceipt(event.MessageRead, payload.ChatId, receipt, authors)
+	}
+}
+
+// publishReceipt delivers a receipt to the connections of the given authors, without
+// sending it to the other subscribers of the chat.
+func (h *ChatMessageHandler) publishReceipt(eventType event.Type, chatId int, receipt interface{}, authors []int) {
+	h.Broadcast.Publish(event.Event{
+		Type:           eventType,
+		ChatId:         chatId,
+		Payload:        receipt,
+		Recipients:     authors,
+		RecipientsOnly: true,
+	})
+}
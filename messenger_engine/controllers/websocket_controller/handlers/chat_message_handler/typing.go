@@ -0,0 +1,167 @@
+package chatmessagehandler
+
+import (
+	"sync"
+	"time"
+
+	Broadcast "messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	Chats "messenger_engine/models/chat"
+	"messenger_engine/models/event"
+)
+
+// DefaultTypingTimeout is how long a typing indicator lasts unless it is refreshed
+// with another "typing_start" frame or ended with "typing_stop".
+const DefaultTypingTimeout = 5 * time.Second
+
+// typingKey identifies the typing indicator of a user in a chat.
+type typingKey struct {
+	chatId int
+	userId int
+}
+
+// typingEntry is a running typing indicator. It belongs to the connection that started it
+// and is stopped by its timer unless it is refreshed first.
+type typingEntry struct {
+	client *Broadcast.Client
+	timer  *time.Timer
+}
+
+// typingTracker keeps the typing indicators started on this instance. Indicators only live
+// in memory; they are never persisted and never reach the MessageController.
+type typingTracker struct {
+	mu     sync.Mutex
+	active map[typingKey]*typingEntry
+}
+
+// newTypingTracker returns an empty typingTracker.
+func newTypingTracker() *typingTracker {
+	return &typingTracker{active: make(map[typingKey]*typingEntry)}
+}
+
+// handleTyping starts or stops the typing indicator of the connection's user.
+// Starting requires that the user may post to the chat; stopping an indicator
+// that is not running does nothing.
+func (h *ChatMessageHandler) handleTyping(client *Broadcast.Client, userID int, env protocol.Envelope) {
+	var payload protocol.TypingPayload
+	if err := h.MessageParser.DecodePayload(env, &payload); err != nil {
+		// Handle error in parsing the typing indicator
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid typing indicator: %s", err)
+		return
+	}
+
+	typistId, err := h.MessageParser.ResolveUserID(payload.UserId, userID)
+	if err != nil {
+		// Reject indicators sent on behalf of another user
+		h.ErrorHandler.HandleRequestError(err, client, env.RequestId, "Invalid user: %s", err)
+		return
+	}
+
+	if env.Type == protocol.TypeTypingStop {
+		h.stopTyping(payload.ChatId, typistId)
+		return
+	}
+	if !h.authorizePost(client, env.RequestId, typistId, payload.ChatId) {
+		return
+	}
+	h.startTyping(client, payload.ChatId, typistId)
+}
+
+// startTyping starts or refreshes a typing indicator and announces it with its new expiry.
+// The indicator stops by itself once TypingTimeout passes without a refresh.
+func (h *ChatMessageHandler) startTyping(client *Broadcast.Client, chatId, userId int) {
+	timeout := h.TypingTimeout
+	if timeout <= 0 {
+		timeout = DefaultTypingTimeout
+	}
+	key := typingKey{chatId: chatId, userId: userId}
+	entry := &typingEntry{client: client}
+
+	h.typing.mu.Lock()
+	if previous, ok := h.typing.active[key]; ok {
+		previous.timer.Stop()
+	}
+	h.typing.active[key] = entry
+	entry.timer = time.AfterFunc(timeout, func() { h.expireTyping(key, entry) })
+	h.typing.mu.Unlock()
+
+	expiresAt := time.Now().Add(timeout)
+	h.publishTyping(event.TypingStarted, Chats.TypingIndicator{
+		Type:      string(event.TypingStarted),
+		ChatId:    chatId,
+		UserId:    userId,
+		ExpiresAt: &expiresAt,
+	})
+}
+
+// stopTyping ends the user's typing indicator in the chat, if one is running.
+func (h *ChatMessageHandler) stopTyping(chatId, userId int) {
+	key := typingKey{chatId: chatId, userId: userId}
+
+	h.typing.mu.Lock()
+	entry, ok := h.typing.active[key]
+	if ok {
+		entry.timer.Stop()
+		delete(h.typing.active, key)
+	}
+	h.typing.mu.Unlock()
+
+	if ok {
+		h.publishTypingStopped(key)
+	}
+}
+
+// stopClientTyping ends every typing indicator started by the client, e.g. once it disconnected.
+func (h *ChatMessageHandler) stopClientTyping(client *Broadcast.Client) {
+	var stopped []typingKey
+
+	h.typing.mu.Lock()
+	for key, entry := range h.typing.active {
+		if entry.client == client {
+			entry.timer.Stop()
+			delete(h.typing.active, key)
+			stopped = append(stopped, key)
+		}
+	}
+	h.typing.mu.Unlock()
+
+	for _, key := range stopped {
+		h.publishTypingStopped(key)
+	}
+}
+
+// expireTyping stops an indicator whose timeout passed. Indicators that were
+// refreshed or stopped in the meantime are left alone.
+func (h *ChatMessageHandler) expireTyping(key typingKey, entry *typingEntry) {
+	h.typing.mu.Lock()
+	current, ok := h.typing.active[key]
+	if ok && current == entry {
+		delete(h.typing.active, key)
+	}
+	h.typing.mu.Unlock()
+
+	if ok && current == entry {
+		h.publishTypingStopped(key)
+	}
+}
+
+// publishTypingStopped announces that the user of the key stopped typing.
+func (h *ChatMessageHandler) publishTypingStopped(key typingKey) {
+	h.publishTyping(event.TypingStopped, Chats.TypingIndicator{
+		Type:   string(event.TypingStopped),
+		ChatId: key.chatId,
+		UserId: key.userId,
+	})
+}
+
+// publishTyping delivers a typing indicator to the subscribers of its chat, except for the
+// connections of the typing user. Connections without an authenticated user cannot be told
+// apart, so on unauthenticated setups the typist's own connection receives the indicator too.
+func (h *ChatMessageHandler) publishTyping(eventType event.Type, indicator Chats.TypingIndicator) {
+	h.Broadcast.Publish(event.Event{
+		Type:          eventType,
+		ChatId:        indicator.ChatId,
+		Payload:       indicator,
+		ExcludeUserId: indicator.UserId,
+	})
+}
@@ -1,11 +1,25 @@
 package errorhandler
 
 import (
+	"errors"
 	"fmt"
+	"log"
+
+	"messenger_engine/controllers/websocket_controller/protocol"
 )
 
 // ErrorHandler provides methods for handling WebSocket errors.
-type ErrorHandler struct{}
+// Errors are reported to the client as structured error frames; the error code comes from
+// a *protocol.Error in the error chain or from the sentinel errors registered with RegisterCode.
+type ErrorHandler struct {
+	codes []registeredCode // Sentinel errors and the codes they are reported with.
+}
+
+// registeredCode maps a sentinel error to its error code.
+type registeredCode struct {
+	target error
+	code   protocol.Code
+}
 
 // NewErrorHandler creates and returns a new instance of ErrorHandler.
 //
@@ -15,26 +29,81 @@ func NewErrorHandler() *ErrorHandler {
 	return &ErrorHandler{}
 }
 
+// WebSocketWriter is implemented by anything error frames can be written to.
 type WebSocketWriter interface {
-    WriteJSON(v interface{}) error
+	WriteJSON(v interface{}) error
+}
+
+// RegisterCode reports every error matching target (as per errors.Is) with the given code.
+//
+// Parameters:
+//   - target: The sentinel error, e.g. messagecontroller.ErrMessageNotFound.
+//   - code: The code sent to the client for it.
+func (e *ErrorHandler) RegisterCode(target error, code protocol.Code) {
+	e.codes = append(e.codes, registeredCode{target: target, code: code})
+}
+
+// Classify returns the error body describing err.
+// Errors that are neither a *protocol.Error nor registered are reported as CodeInternal.
+//
+// Parameters:
+//   - err: The error to describe.
+//   - message: The human-readable description used for non-protocol errors.
+//
+// Returns:
+//   - The ErrorBody sent to the client.
+func (e *ErrorHandler) Classify(err error, message string) protocol.ErrorBody {
+	if protocolErr, ok := protocol.AsError(err); ok {
+		return protocol.ErrorBody{
+			Code:         protocolErr.Code,
+			Message:      message,
+			Field:        protocolErr.Field,
+			RetryAfterMs: protocolErr.RetryAfter.Milliseconds(),
+		}
+	}
+	for _, registered := range e.codes {
+		if errors.Is(err, registered.target) {
+			return protocol.ErrorBody{Code: registered.code, Message: message}
+		}
+	}
+	return protocol.ErrorBody{Code: protocol.CodeInternal, Message: message}
 }
 
-// HandleWebSocketError logs the given error and sends a formatted error message to the WebSocket client.
+// HandleWebSocketError logs the given error and sends a structured error frame to the WebSocket client.
 //
 // Parameters:
 //   - err: The error encountered (if nil, the function returns without any action).
-//   - ws: A pointer to the WebSocket connection to which the error message will be sent.
+//   - ws: The connection the error frame is written to; nil only logs the error.
 //   - format: A format string for the error message (similar to fmt.Sprintf).
 //   - args: Additional arguments to be formatted into the error message.
-//
-// Behavior:
-//   - If `err` is nil, the function does nothing.
-//   - Logs the error message with the provided format.
-//   - Attempts to send a JSON-encoded error response to the WebSocket client.
-// HandleWebSocketError writes the error message to the WebSocket connection.
 func (e *ErrorHandler) HandleWebSocketError(err error, ws WebSocketWriter, format string, args ...interface{}) {
-    message := map[string]string{
-        "error": fmt.Sprintf(format, args...),
-    }
-    ws.WriteJSON(message)
+	e.HandleRequestError(err, ws, "", format, args...)
+}
+
+// HandleRequestError logs the given error and sends a structured error frame answering
+// the request with the given ID.
+//
+// Parameters:
+//   - err: The error encountered (if nil, the function returns without any action).
+//   - ws: The connection the error frame is written to; nil only logs the error.
+//   - requestId: The request_id of the failed request, echoed in the frame.
+//   - format: A format string for the error message (similar to fmt.Sprintf).
+//   - args: Additional arguments to be formatted into the error message.
+func (e *ErrorHandler) HandleRequestError(err error, ws WebSocketWriter, requestId string, format string, args ...interface{}) {
+	if err == nil {
+		return
+	}
+
+	message := fmt.Sprintf(format, args...)
+	log.Println(message)
+	if ws == nil {
+		return
+	}
+
+	ws.WriteJSON(protocol.ErrorFrame{
+		Type:      "error",
+		Version:   protocol.Version,
+		RequestId: requestId,
+		Error:     e.Classify(err, message),
+	})
 }
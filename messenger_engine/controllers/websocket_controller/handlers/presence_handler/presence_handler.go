@@ -0,0 +1,128 @@
+package presencehandler
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"messenger_engine/controllers/websocket_controller/protocol"
+	Presence "messenger_engine/models/presence"
+	Auth "shared/auth"
+	"shared/ratelimit"
+)
+
+// PresenceReader looks up whether users are online and when they were last seen.
+// It is implemented by *PresenceController.PresenceController.
+type PresenceReader interface {
+	GetPresence(userIds []int) ([]Presence.Presence, error)
+}
+
+// PresenceFrameType is the rate limit type of a presence lookup.
+const PresenceFrameType = "presence"
+
+// PresenceHandler serves the presence of a list of users over plain HTTP, for services
+// such as user_search that show who is online without holding a chat connection.
+type PresenceHandler struct {
+	presence      PresenceReader      // Looks up the presence of the requested users
+	Authenticator *Auth.Authenticator // Verifies the request's token; nil accepts unauthenticated requests
+	RateLimiter   *ratelimit.Limiter  // Limits lookups per user (or remote IP); nil disables limiting
+}
+
+// PresenceResponse is the body of a successful presence lookup.
+//
+// Fields:
+//   - Users: The presence of every requested user, in the order they were requested.
+type PresenceResponse struct {
+	Users []Presence.Presence `json:"users"`
+}
+
+// NewPresenceHandler initializes a new PresenceHandler that answers lookups with the given reader.
+func NewPresenceHandler(presence PresenceReader) *PresenceHandler {
+	return &PresenceHandler{
+		presence:    presence,
+		RateLimiter: ratelimit.NewLimiter(DefaultRateLimits()),
+	}
+}
+
+// DefaultRateLimits returns the built-in request limits of the /presence endpoint.
+//
+// Returns:
+//   - The default ratelimit.Config, to be overridden with ratelimit.LoadConfig.
+func DefaultRateLimits() ratelimit.Config {
+	return ratelimit.Config{
+		Rules:           map[string]ratelimit.Rule{PresenceFrameType: {Rate: 5, Burst: 10}},
+		MaxViolations:   20,
+		ViolationWindow: time.Minute,
+	}
+}
+
+// ServeHTTP answers GET /presence?user_ids=1,2,3 with the presence of the listed users.
+// When an Authenticator is configured, requests must carry a valid access token in the
+// Authorization header or the token query parameter.
+func (h *PresenceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var userID int
+	if h.Authenticator != nil {
+		var err error
+		if userID, err = h.Authenticator.Authenticate(r); err != nil {
+			log.Printf("Rejected unauthenticated presence request: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if h.RateLimiter != nil {
+		if decision := h.RateLimiter.Allow(ratelimit.Key(userID, r), PresenceFrameType); !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	userIds, err := parseUserIds(r.URL.Query().Get("user_ids"))
+	if err == nil {
+		err = protocol.ValidatePresenceUsers(userIds)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	users, err := h.presence.GetPresence(userIds)
+	if err != nil {
+		log.Printf("Error loading presence: %v", err)
+		http.Error(w, "error loading presence", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(PresenceResponse{Users: users}); err != nil {
+		log.Printf("Error sending presence: %v", err)
+	}
+}
+
+// parseUserIds parses a comma-separated list of user IDs.
+func parseUserIds(raw string) ([]int, error) {
+	var userIds []int
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		userId, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, protocol.InvalidField("user_ids", "must be a comma-separated list of user IDs")
+		}
+		userIds = append(userIds, userId)
+	}
+	return userIds, nil
+}
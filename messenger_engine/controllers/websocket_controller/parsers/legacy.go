@@ -0,0 +1,77 @@
+package parsers
+
+import (
+	"encoding/json"
+	"time"
+
+	"messenger_engine/controllers/websocket_controller/protocol"
+)
+
+// legacyMessage is the PascalCase "message" object of unversioned message,
+// reply and edit frames. JSON keys are matched case-insensitively.
+type legacyMessage struct {
+	MessageId       int
+	AuthorId        int
+	Timestamp       float64
+	ReceiverId      int
+	Message         string
+	ChatId          int
+	ParentMessageId int
+	ClientMsgId     string `json:"client_msg_id"`
+}
+
+// legacyTimestamp converts the Unix seconds of a legacy frame; zero means "not sent".
+func legacyTimestamp(seconds float64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0)
+}
+
+// upgradeLegacy converts an unversioned frame into an envelope.
+// Message, reply and edit frames carry their data in a PascalCase "message" object, which
+// is translated into the matching payload; every other legacy frame keeps its snake_case
+// fields at the top level, so the frame itself already is the payload.
+func upgradeLegacy(env protocol.Envelope, fields map[string]json.RawMessage, data []byte) (protocol.Envelope, error) {
+	env.Version = protocol.LegacyVersion
+
+	var payload interface{}
+	switch env.Type {
+	case protocol.TypeMessage, protocol.TypeMessageReply, protocol.TypeMessageEdit:
+		raw, present := fields["message"]
+		if !present {
+			return env, protocol.InvalidField("message", "is required")
+		}
+		var legacy legacyMessage
+		if err := json.Unmarshal(raw, &legacy); err != nil {
+			return env, decodeError("message", err)
+		}
+
+		message := protocol.MessagePayload{
+			ChatId:      legacy.ChatId,
+			ReceiverId:  legacy.ReceiverId,
+			AuthorId:    legacy.AuthorId,
+			Message:     legacy.Message,
+			Timestamp:   legacyTimestamp(legacy.Timestamp),
+			ClientMsgId: legacy.ClientMsgId,
+		}
+		switch env.Type {
+		case protocol.TypeMessage:
+			payload = message
+		case protocol.TypeMessageReply:
+			payload = protocol.ReplyPayload{MessagePayload: message, ParentMessageId: legacy.ParentMessageId}
+		default:
+			payload = protocol.EditPayload{MessageId: legacy.MessageId, AuthorId: legacy.AuthorId, Message: legacy.Message}
+		}
+	default:
+		env.Payload = data
+		return env, nil
+	}
+
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return env, protocol.NewError(protocol.CodeBadRequest, "frame could not be converted")
+	}
+	env.Payload = encoded
+	return env, nil
+}
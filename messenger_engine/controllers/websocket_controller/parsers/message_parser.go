@@ -1,12 +1,18 @@
 package parsers
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"time"
 
-	Messages "messenger_engine/models/message"
+	"messenger_engine/controllers/websocket_controller/protocol"
 )
 
+// ErrIdentityMismatch is returned when a payload claims to act on behalf of a user
+// other than the one authenticated on the connection.
+var ErrIdentityMismatch = errors.New("user id does not match the authenticated user")
+
 // Parser encapsulates methods for parsing message data.
 type Parser struct{}
 
@@ -18,69 +24,113 @@ func New() *Parser {
 	return &Parser{}
 }
 
-// ParseChatID extracts the chat ID from the incoming message.
+// Decode parses one inbound frame into an envelope.
+// Frames carrying "version" or "payload" are read as versioned envelopes; any other frame
+// is treated as the legacy unversioned format and converted by the compatibility shim.
 //
 // Parameters:
-//   - msg: A map[string]interface{} representing the incoming JSON message.
+//   - data: The raw JSON frame read from the WebSocket.
 //
 // Returns:
-//   - An integer representing the chat ID.
-//   - An error if the chat_id is missing or invalid.
-func (p *Parser) ParseChatID(msg map[string]interface{}) (int, error) {
-	chatIdFloat, ok := msg["chat_id"].(float64)
-	if !ok {
-		return 0, fmt.Errorf("invalid chat_id")
+//   - The decoded Envelope. Its Type and RequestId are filled in as far as they could be read,
+//     so they can be echoed in an error frame even when decoding fails.
+//   - A *protocol.Error describing why the frame was rejected.
+func (p *Parser) Decode(data []byte) (protocol.Envelope, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil || fields == nil {
+		return protocol.Envelope{}, protocol.NewError(protocol.CodeBadRequest, "frame must be a JSON object")
+	}
+
+	var env protocol.Envelope
+	if err := decodeField(fields, "type", &env.Type); err != nil {
+		return env, err
+	}
+	if err := decodeField(fields, "request_id", &env.RequestId); err != nil {
+		return env, err
+	}
+	if env.Type == "" {
+		return env, protocol.InvalidField("type", "is required")
+	}
+
+	_, hasVersion := fields["version"]
+	_, hasPayload := fields["payload"]
+	if !hasVersion && !hasPayload {
+		return upgradeLegacy(env, fields, data)
+	}
+
+	if err := decodeField(fields, "version", &env.Version); err != nil {
+		return env, err
+	}
+	if env.Version != protocol.Version {
+		return env, protocol.NewError(protocol.CodeUnsupportedVersion, fmt.Sprintf("unsupported protocol version %d", env.Version))
 	}
-	return int(chatIdFloat), nil
+	env.Payload = fields["payload"]
+	return env, nil
 }
 
-// ParseMessageData extracts and converts a message from the incoming JSON payload.
+// DecodePayload decodes the envelope's payload into dst and validates it field by field.
 //
 // Parameters:
-//   - msg: A map[string]interface{} representing the incoming JSON message.
+//   - env: The envelope returned by Decode.
+//   - dst: A pointer to the payload struct matching the envelope type.
 //
 // Returns:
-//   - A Messages.Message struct containing the parsed message data.
-//   - An error if the message format is invalid.
-func (p *Parser) ParseMessageData(msg map[string]interface{}) (Messages.Message, error) {
-	messageData, ok := msg["message"].(map[string]interface{})
-	if !ok {
-		return Messages.Message{}, fmt.Errorf("invalid message format")
+//   - A *protocol.Error naming the invalid field, or nil if the payload is valid.
+func (p *Parser) DecodePayload(env protocol.Envelope, dst protocol.Payload) error {
+	payload := env.Payload
+	if len(bytes.TrimSpace(payload)) == 0 {
+		payload = json.RawMessage("{}")
 	}
+	if err := json.Unmarshal(payload, dst); err != nil {
+		return decodeError("payload", err)
+	}
+	return dst.Validate()
+}
 
-	return Messages.Message{
-		MessageId:  int(messageData["MessageId"].(float64)),
-		AuthorId:   int(messageData["AuthorId"].(float64)),
-		Timestamp:  time.Unix(int64(messageData["Timestamp"].(float64)), 0),
-		ReceiverId: int(messageData["ReceiverId"].(float64)),
-		Message:    messageData["Message"].(string),
-		ChatId:     int(messageData["ChatId"].(float64)),
-		IsEdited:   messageData["IsEdited"].(bool),
-	}, nil
+// decodeField decodes a single top-level field of a frame, if present.
+func decodeField(fields map[string]json.RawMessage, name string, dst interface{}) error {
+	raw, present := fields[name]
+	if !present || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return decodeError(name, err)
+	}
+	return nil
 }
 
-// ParseMessageReplyData extracts and converts a message reply from the incoming JSON payload.
+// decodeError converts a JSON decoding error into a *protocol.Error.
+// Type mismatches name the offending field; anything else is reported on the enclosing one.
+func decodeError(field string, err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		name := field
+		if typeErr.Field != "" {
+			name = typeErr.Field
+		}
+		return protocol.InvalidField(name, "must be of type "+typeErr.Type.String())
+	}
+	return protocol.InvalidField(field, "is malformed")
+}
+
+// ResolveUserID reconciles a user ID claimed in a payload with the user authenticated
+// on the connection. An omitted (zero) claim is replaced by the authenticated user,
+// while a claim naming any other user is rejected.
+// Connections without an authenticated user (authUserID == 0) keep the claimed ID.
 //
 // Parameters:
-//   - msg: A map[string]interface{} representing the incoming JSON message.
+//   - claimed: The user ID sent by the client (e.g. AuthorId or user_id).
+//   - authUserID: The user ID bound to the connection during the handshake.
 //
 // Returns:
-//   - A Messages.MessageReply struct containing the parsed reply data.
-//   - An error if the message reply format is invalid.
-func (p *Parser) ParseMessageReplyData(msg map[string]interface{}) (Messages.MessageReply, error) {
-	messageReplyData, ok := msg["message"].(map[string]interface{})
-	if !ok {
-		return Messages.MessageReply{}, fmt.Errorf("invalid message format")
+//   - The user ID to act on behalf of.
+//   - ErrIdentityMismatch if the claimed ID belongs to another user.
+func (p *Parser) ResolveUserID(claimed int, authUserID int) (int, error) {
+	if authUserID == 0 {
+		return claimed, nil
 	}
-
-	return Messages.MessageReply{
-		MessageId:       int(messageReplyData["MessageId"].(float64)),
-		AuthorId:        int(messageReplyData["AuthorId"].(float64)),
-		Timestamp:       time.Unix(int64(messageReplyData["Timestamp"].(float64)), 0),
-		ReceiverId:      int(messageReplyData["ReceiverId"].(float64)),
-		Message:         messageReplyData["Message"].(string),
-		ChatId:          int(messageReplyData["ChatId"].(float64)),
-		IsEdited:        messageReplyData["IsEdited"].(bool),
-		ParentMessageId: int(messageReplyData["ParentMessageId"].(float64)),
-	}, nil
+	if claimed != 0 && claimed != authUserID {
+		return 0, ErrIdentityMismatch
+	}
+	return authUserID, nil
 }
@@ -0,0 +1,72 @@
+package protocol
+
+import (
+	"encoding/json"
+)
+
+const (
+	// Version is the current version of the WebSocket protocol.
+	Version = 1
+	// LegacyVersion marks frames decoded from the unversioned format that predates the envelope.
+	LegacyVersion = 0
+)
+
+// Frame types accepted on the /chat socket.
+const (
+	TypeInitial          = "initial"
+	TypeHistory          = "history"
+	TypeResume           = "resume"
+	TypeMessage          = "message"
+	TypeMessageReply     = "message_reply"
+	TypeMessageEdit      = "message_edit"
+	TypeMessageDelete    = "message_delete"
+	TypeMessageRevisions = "message_revisions"
+	TypeUnsubscribe      = "unsubscribe"
+	TypeChatCreate       = "chat_create"
+	TypeChatAddMember    = "chat_add_member"
+	TypeChatRemoveMember = "chat_remove_member"
+	TypeChatLeave        = "chat_leave"
+	TypeChatRename       = "chat_rename"
+	TypeDelivered        = "delivered"
+	TypeRead             = "read"
+	TypeTypingStart      = "typing_start"
+	TypeTypingStop       = "typing_stop"
+	TypePresenceQuery    = "presence_query"
+	TypeReactionAdd      = "reaction_add"
+	TypeReactionRemove   = "reaction_remove"
+)
+
+// knownTypes holds every frame type accepted on the /chat socket.
+var knownTypes = map[string]bool{
+	TypeInitial: true, TypeHistory: true, TypeResume: true,
+	TypeMessage: true, TypeMessageReply: true, TypeMessageEdit: true, TypeMessageDelete: true,
+	TypeMessageRevisions: true, TypeUnsubscribe: true,
+	TypeChatCreate: true, TypeChatAddMember: true, TypeChatRemoveMember: true, TypeChatLeave: true, TypeChatRename: true,
+	TypeDelivered: true, TypeRead: true, TypeTypingStart: true, TypeTypingStop: true,
+	TypePresenceQuery: true, TypeReactionAdd: true, TypeReactionRemove: true,
+}
+
+// IsKnownType reports whether the frame type is accepted on the /chat socket.
+func IsKnownType(frameType string) bool {
+	return knownTypes[frameType]
+}
+
+// Envelope is the wrapper of every inbound frame.
+//
+// Fields:
+//   - Type: The kind of request, which selects the payload struct.
+//   - Version: The protocol version the client speaks; LegacyVersion for unversioned frames.
+//   - RequestId: Optional client-chosen ID echoed in the response and in error frames.
+//   - Payload: The request body, decoded according to Type.
+type Envelope struct {
+	Type      string          `json:"type"`
+	Version   int             `json:"version"`
+	RequestId string          `json:"request_id,omitempty"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// Payload is implemented by every request body. Validate checks the decoded
+// fields and returns an *Error with CodeInvalidField naming the offending field.
+type Payload interface {
+	Validate() error
+}
@@ -0,0 +1,97 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Code is a machine-readable error code carried by error frames.
+type Code string
+
+const (
+	// CodeBadRequest means the frame is not a well-formed JSON envelope.
+	CodeBadRequest Code = "bad_request"
+	// CodeUnsupportedVersion means the envelope names a protocol version the server does not speak.
+	CodeUnsupportedVersion Code = "unsupported_version"
+	// CodeUnknownType means the frame type is not handled by the socket.
+	CodeUnknownType Code = "unknown_type"
+	// CodeInvalidField means a payload field is missing, has the wrong type or an invalid value.
+	CodeInvalidField Code = "invalid_field"
+	// CodeForbidden means the user may not perform the request.
+	CodeForbidden Code = "forbidden"
+	// CodeNotFound means the referenced resource does not exist.
+	CodeNotFound Code = "not_found"
+	// CodeConflict means the request conflicts with the current state of the resource.
+	CodeConflict Code = "conflict"
+	// CodeRateLimited means the caller sent too many requests; the frame says when to retry.
+	CodeRateLimited Code = "rate_limited"
+	// CodeInternal means the server failed to process a valid request.
+	CodeInternal Code = "internal"
+)
+
+// Error is an error with a machine-readable code and, for invalid fields, the field name.
+type Error struct {
+	Code       Code
+	Field      string
+	Message    string
+	RetryAfter time.Duration // For CodeRateLimited, how long to wait before retrying.
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	return e.Message
+}
+
+// NewError returns an *Error with the given code and message.
+func NewError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// InvalidField returns an *Error reporting an invalid payload field.
+func InvalidField(field string, message string) *Error {
+	return &Error{Code: CodeInvalidField, Field: field, Message: message}
+}
+
+// RateLimited returns an *Error telling the client to retry after the given delay.
+func RateLimited(retryAfter time.Duration) *Error {
+	return &Error{Code: CodeRateLimited, Message: "rate limit exceeded", RetryAfter: retryAfter}
+}
+
+// AsError returns the *Error wrapped in err, if any.
+func AsError(err error) (*Error, bool) {
+	var protocolErr *Error
+	ok := errors.As(err, &protocolErr)
+	return protocolErr, ok
+}
+
+// ErrorBody is the description of the failure inside an error frame.
+//
+// Fields:
+//   - Code: The machine-readable error code.
+//   - Message: A human-readable description.
+//   - Field: The offending payload field, for CodeInvalidField.
+//   - RetryAfterMs: For CodeRateLimited, the milliseconds to wait before retrying.
+type ErrorBody struct {
+	Code         Code   `json:"code"`
+	Message      string `json:"message"`
+	Field        string `json:"field,omitempty"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// ErrorFrame is sent to the client when a request fails.
+//
+// Fields:
+//   - Type: Always "error".
+//   - Version: The protocol version of the server.
+//   - RequestId: The request_id of the failed request, if it had one.
+//   - Error: The description of the failure.
+type ErrorFrame struct {
+	Type      string    `json:"type"`
+	Version   int       `json:"version"`
+	RequestId string    `json:"request_id,omitempty"`
+	Error     ErrorBody `json:"error"`
+}
@@ -0,0 +1,546 @@
+package protocol
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	Chats "messenger_engine/models/chat"
+	Messages "messenger_engine/models/message"
+)
+
+const (
+	// MaxMessageLength caps the length of a message's content, in bytes.
+	MaxMessageLength = 4096
+	// MaxClientMsgIdLength caps the length of client-generated message IDs.
+	MaxClientMsgIdLength = 128
+	// MaxChatTitleLength caps the length of a chat's title, in bytes.
+	MaxChatTitleLength = 255
+	// MaxAvatarUrlLength caps the length of a chat's avatar URL, in bytes.
+	MaxAvatarUrlLength = 2048
+	// MaxChatMembers caps the number of members a chat can be created with.
+	MaxChatMembers = 500
+	// MaxResumeChats caps the number of chats a single resume request can catch up on.
+	MaxResumeChats = 100
+	// MaxPresenceUsers caps the number of users whose presence can be looked up at once.
+	MaxPresenceUsers = 200
+	// MaxEmojiLength caps the length of a reaction's emoji, in bytes.
+	MaxEmojiLength = 64
+	// MaxAttachments caps the number of attachments of a single message.
+	MaxAttachments = 10
+	// MaxMediaIdLength caps the length of an attachment's media ID, in bytes.
+	MaxMediaIdLength = 512
+	// MaxMimeTypeLength caps the length of an attachment's MIME type, in bytes.
+	MaxMimeTypeLength = 255
+)
+
+// requirePositive reports the field as invalid unless its value is greater than zero.
+func requirePositive(field string, value int) error {
+	if value <= 0 {
+		return InvalidField(field, "must be a positive integer")
+	}
+	return nil
+}
+
+// requireNonNegative reports the field as invalid if its value is below zero.
+func requireNonNegative(field string, value int) error {
+	if value < 0 {
+		return InvalidField(field, "must not be negative")
+	}
+	return nil
+}
+
+// validateContent checks the content of a new or edited message.
+func validateContent(content string) error {
+	if content == "" {
+		return InvalidField("message", "must not be empty")
+	}
+	if len(content) > MaxMessageLength {
+		return InvalidField("message", "is too long")
+	}
+	return nil
+}
+
+// validateTitle checks the title of a new or renamed chat.
+func validateTitle(title string) error {
+	if strings.TrimSpace(title) == "" {
+		return InvalidField("title", "must not be empty")
+	}
+	if len(title) > MaxChatTitleLength {
+		return InvalidField("title", "is too long")
+	}
+	return nil
+}
+
+// validateAvatarUrl checks the avatar URL of a new or renamed chat.
+func validateAvatarUrl(avatarUrl string) error {
+	if len(avatarUrl) > MaxAvatarUrlLength {
+		return InvalidField("avatar_url", "is too long")
+	}
+	return nil
+}
+
+// ChatPayload is the body of requests that only name a chat: "initial" and "unsubscribe".
+type ChatPayload struct {
+	ChatId int `json:"chat_id"`
+}
+
+// Validate implements Payload.
+func (p *ChatPayload) Validate() error {
+	return requirePositive("chat_id", p.ChatId)
+}
+
+// HistoryPayload is the body of a "history" request.
+type HistoryPayload struct {
+	ChatId          int `json:"chat_id"`
+	BeforeMessageId int `json:"before_message_id"`
+	AfterMessageId  int `json:"after_message_id"`
+	Limit           int `json:"limit"`
+}
+
+// Validate implements Payload.
+func (p *HistoryPayload) Validate() error {
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("before_message_id", p.BeforeMessageId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("after_message_id", p.AfterMessageId); err != nil {
+		return err
+	}
+	if p.BeforeMessageId > 0 && p.AfterMessageId > 0 {
+		return InvalidField("after_message_id", "cannot be combined with before_message_id")
+	}
+	return requireNonNegative("limit", p.Limit)
+}
+
+// ToQuery converts the payload into a history query for the given viewer.
+func (p *HistoryPayload) ToQuery(viewerId int) Messages.HistoryQuery {
+	return Messages.HistoryQuery{
+		ChatId:          p.ChatId,
+		ViewerId:        viewerId,
+		BeforeMessageId: p.BeforeMessageId,
+		AfterMessageId:  p.AfterMessageId,
+		Limit:           p.Limit,
+	}
+}
+
+// ResumePayload is the body of a "resume" request.
+type ResumePayload struct {
+	Chats []Messages.ResumeCursor `json:"chats"`
+}
+
+// Validate implements Payload.
+func (p *ResumePayload) Validate() error {
+	if len(p.Chats) == 0 {
+		return InvalidField("chats", "must name at least one chat")
+	}
+	if len(p.Chats) > MaxResumeChats {
+		return InvalidField("chats", "names too many chats")
+	}
+	for _, cursor := range p.Chats {
+		if err := requirePositive("chats.chat_id", cursor.ChatId); err != nil {
+			return err
+		}
+		if err := requireNonNegative("chats.last_message_id", cursor.LastMessageId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessagePayload is the body of a "message" request.
+// The author is optional and resolved against the authenticated user;
+// the timestamp defaults to the time the server received the message.
+// A message with attachments may have no text.
+type MessagePayload struct {
+	ChatId      int                   `json:"chat_id"`
+	ReceiverId  int                   `json:"receiver_id"`
+	AuthorId    int                   `json:"author_id"`
+	Message     string                `json:"message"`
+	Timestamp   time.Time             `json:"timestamp"`
+	ClientMsgId string                `json:"client_msg_id"`
+	Attachments []Messages.Attachment `json:"attachments"`
+}
+
+// Validate implements Payload. A message without a chat_id opens the 1:1 chat of its
+// author and receiver, so it needs a receiver_id.
+func (p *MessagePayload) Validate() error {
+	if p.ChatId != 0 || p.ReceiverId <= 0 {
+		if err := requirePositive("chat_id", p.ChatId); err != nil {
+			return err
+		}
+	}
+	if err := requireNonNegative("receiver_id", p.ReceiverId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("author_id", p.AuthorId); err != nil {
+		return err
+	}
+	if p.Message != "" || len(p.Attachments) == 0 {
+		if err := validateContent(p.Message); err != nil {
+			return err
+		}
+	}
+	if len(p.ClientMsgId) > MaxClientMsgIdLength {
+		return InvalidField("client_msg_id", "is too long")
+	}
+	return validateAttachments(p.Attachments)
+}
+
+// validateAttachments checks the attachments of a new message.
+func validateAttachments(attachments []Messages.Attachment) error {
+	if len(attachments) > MaxAttachments {
+		return InvalidField("attachments", "has too many entries")
+	}
+	for _, attachment := range attachments {
+		if attachment.MediaId == "" || len(attachment.MediaId) > MaxMediaIdLength {
+			return InvalidField("attachments.media_id", "must be the media ID of an upload")
+		}
+		if !validMimeType(attachment.MimeType) {
+			return InvalidField("attachments.mime_type", "must be a MIME type such as image/png")
+		}
+		if attachment.Size <= 0 {
+			return InvalidField("attachments.size", "must be a positive integer")
+		}
+		if err := requireNonNegative("attachments.width", attachment.Width); err != nil {
+			return err
+		}
+		if err := requireNonNegative("attachments.height", attachment.Height); err != nil {
+			return err
+		}
+		if err := requireNonNegative("attachments.duration_ms", attachment.DurationMs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validMimeType reports whether the value has the type/subtype form of a MIME type.
+func validMimeType(mimeType string) bool {
+	if len(mimeType) > MaxMimeTypeLength {
+		return false
+	}
+	kind, subtype, ok := strings.Cut(mimeType, "/")
+	if !ok || kind == "" || subtype == "" {
+		return false
+	}
+	return strings.IndexFunc(mimeType, func(r rune) bool {
+		return r > unicode.MaxASCII || unicode.IsSpace(r) || unicode.IsControl(r)
+	}) < 0
+}
+
+// attachmentsOf copies the attachments of a payload, dropping any download URL the client sent.
+func attachmentsOf(attachments []Messages.Attachment) []Messages.Attachment {
+	if len(attachments) == 0 {
+		return nil
+	}
+	copied := make([]Messages.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		attachment.Url = ""
+		copied[i] = attachment
+	}
+	return copied
+}
+
+// timestampOrNow returns the client timestamp, or the current time when none was sent.
+func timestampOrNow(timestamp time.Time) time.Time {
+	if timestamp.IsZero() {
+		return time.Now()
+	}
+	return timestamp
+}
+
+// ToMessage converts the payload into a new message.
+func (p *MessagePayload) ToMessage() Messages.Message {
+	return Messages.Message{
+		AuthorId:    p.AuthorId,
+		Timestamp:   timestampOrNow(p.Timestamp),
+		ReceiverId:  p.ReceiverId,
+		Message:     p.Message,
+		ChatId:      p.ChatId,
+		ClientMsgId: p.ClientMsgId,
+		Attachments: attachmentsOf(p.Attachments),
+	}
+}
+
+// ReplyPayload is the body of a "message_reply" request.
+type ReplyPayload struct {
+	MessagePayload
+	ParentMessageId int `json:"parent_message_id"`
+}
+
+// Validate implements Payload.
+func (p *ReplyPayload) Validate() error {
+	// Replies go to the chat of their parent message, which always exists
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	if err := p.MessagePayload.Validate(); err != nil {
+		return err
+	}
+	return requirePositive("parent_message_id", p.ParentMessageId)
+}
+
+// ToReply converts the payload into a new reply.
+func (p *ReplyPayload) ToReply() Messages.MessageReply {
+	return Messages.MessageReply{
+		AuthorId:        p.AuthorId,
+		Timestamp:       timestampOrNow(p.Timestamp),
+		ReceiverId:      p.ReceiverId,
+		Message:         p.Message,
+		ChatId:          p.ChatId,
+		ParentMessageId: p.ParentMessageId,
+		ClientMsgId:     p.ClientMsgId,
+		Attachments:     attachmentsOf(p.Attachments),
+	}
+}
+
+// EditPayload is the body of a "message_edit" request.
+type EditPayload struct {
+	MessageId int    `json:"message_id"`
+	AuthorId  int    `json:"author_id"`
+	Message   string `json:"message"`
+}
+
+// Validate implements Payload.
+func (p *EditPayload) Validate() error {
+	if err := requirePositive("message_id", p.MessageId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("author_id", p.AuthorId); err != nil {
+		return err
+	}
+	return validateContent(p.Message)
+}
+
+// ToEdit converts the payload into a message edit.
+func (p *EditPayload) ToEdit() Messages.MessageEdit {
+	return Messages.MessageEdit{MessageId: p.MessageId, AuthorId: p.AuthorId, Message: p.Message}
+}
+
+// DeletePayload is the body of a "message_delete" request.
+type DeletePayload struct {
+	MessageId   int  `json:"message_id"`
+	AuthorId    int  `json:"author_id"`
+	ForEveryone bool `json:"for_everyone"`
+}
+
+// Validate implements Payload.
+func (p *DeletePayload) Validate() error {
+	if err := requirePositive("message_id", p.MessageId); err != nil {
+		return err
+	}
+	return requireNonNegative("author_id", p.AuthorId)
+}
+
+// ToDelete converts the payload into a message deletion.
+func (p *DeletePayload) ToDelete() Messages.MessageDelete {
+	return Messages.MessageDelete{MessageId: p.MessageId, AuthorId: p.AuthorId, ForEveryone: p.ForEveryone}
+}
+
+// MessageRefPayload is the body of requests that only name a message: "message_revisions".
+type MessageRefPayload struct {
+	MessageId int `json:"message_id"`
+}
+
+// Validate implements Payload.
+func (p *MessageRefPayload) Validate() error {
+	return requirePositive("message_id", p.MessageId)
+}
+
+// ChatCreatePayload is the body of a "chat_create" request.
+// The creator is optional and resolved against the authenticated user.
+type ChatCreatePayload struct {
+	CreatorId int    `json:"creator_id"`
+	Title     string `json:"title"`
+	AvatarUrl string `json:"avatar_url"`
+	MemberIds []int  `json:"member_ids"`
+}
+
+// Validate implements Payload.
+func (p *ChatCreatePayload) Validate() error {
+	if err := requireNonNegative("creator_id", p.CreatorId); err != nil {
+		return err
+	}
+	if err := validateTitle(p.Title); err != nil {
+		return err
+	}
+	if err := validateAvatarUrl(p.AvatarUrl); err != nil {
+		return err
+	}
+	if len(p.MemberIds) > MaxChatMembers {
+		return InvalidField("member_ids", "names too many members")
+	}
+	for _, memberId := range p.MemberIds {
+		if err := requirePositive("member_ids", memberId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChatMemberPayload is the body of "chat_add_member" and "chat_remove_member" requests.
+// The role only applies to added members and defaults to "member".
+// The actor is optional and resolved against the authenticated user.
+type ChatMemberPayload struct {
+	ChatId  int        `json:"chat_id"`
+	ActorId int        `json:"actor_id"`
+	UserId  int        `json:"user_id"`
+	Role    Chats.Role `json:"role"`
+}
+
+// Validate implements Payload.
+func (p *ChatMemberPayload) Validate() error {
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("actor_id", p.ActorId); err != nil {
+		return err
+	}
+	if err := requirePositive("user_id", p.UserId); err != nil {
+		return err
+	}
+	if p.Role != "" && !p.Role.Valid() {
+		return InvalidField("role", "must be one of owner, admin or member")
+	}
+	return nil
+}
+
+// ChatLeavePayload is the body of a "chat_leave" request.
+// The user is optional and resolved against the authenticated user.
+type ChatLeavePayload struct {
+	ChatId int `json:"chat_id"`
+	UserId int `json:"user_id"`
+}
+
+// Validate implements Payload.
+func (p *ChatLeavePayload) Validate() error {
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	return requireNonNegative("user_id", p.UserId)
+}
+
+// ChatRenamePayload is the body of a "chat_rename" request.
+// Omitting avatar_url keeps the current avatar; an empty string removes it.
+// The actor is optional and resolved against the authenticated user.
+type ChatRenamePayload struct {
+	ChatId    int     `json:"chat_id"`
+	ActorId   int     `json:"actor_id"`
+	Title     string  `json:"title"`
+	AvatarUrl *string `json:"avatar_url"`
+}
+
+// Validate implements Payload.
+func (p *ChatRenamePayload) Validate() error {
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("actor_id", p.ActorId); err != nil {
+		return err
+	}
+	if err := validateTitle(p.Title); err != nil {
+		return err
+	}
+	if p.AvatarUrl != nil {
+		return validateAvatarUrl(*p.AvatarUrl)
+	}
+	return nil
+}
+
+// ReceiptPayload is the body of "delivered" and "read" requests.
+// The user is optional and resolved against the authenticated user.
+type ReceiptPayload struct {
+	ChatId    int `json:"chat_id"`
+	MessageId int `json:"message_id"`
+	UserId    int `json:"user_id"`
+}
+
+// Validate implements Payload.
+func (p *ReceiptPayload) Validate() error {
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	if err := requirePositive("message_id", p.MessageId); err != nil {
+		return err
+	}
+	return requireNonNegative("user_id", p.UserId)
+}
+
+// TypingPayload is the body of "typing_start" and "typing_stop" requests.
+// The user is optional and resolved against the authenticated user.
+type TypingPayload struct {
+	ChatId int `json:"chat_id"`
+	UserId int `json:"user_id"`
+}
+
+// Validate implements Payload.
+func (p *TypingPayload) Validate() error {
+	if err := requirePositive("chat_id", p.ChatId); err != nil {
+		return err
+	}
+	return requireNonNegative("user_id", p.UserId)
+}
+
+// PresenceQueryPayload is the body of "presence_query" requests.
+type PresenceQueryPayload struct {
+	UserIds []int `json:"user_ids"`
+}
+
+// Validate implements Payload.
+func (p *PresenceQueryPayload) Validate() error {
+	return ValidatePresenceUsers(p.UserIds)
+}
+
+// ValidatePresenceUsers checks the users of a presence lookup, which must name
+// between one and MaxPresenceUsers users.
+func ValidatePresenceUsers(userIds []int) error {
+	if len(userIds) == 0 {
+		return InvalidField("user_ids", "must not be empty")
+	}
+	if len(userIds) > MaxPresenceUsers {
+		return InvalidField("user_ids", "names too many users")
+	}
+	for _, userId := range userIds {
+		if err := requirePositive("user_ids", userId); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReactionPayload is the body of "reaction_add" and "reaction_remove" requests.
+// The user is optional and resolved against the authenticated user.
+type ReactionPayload struct {
+	MessageId int    `json:"message_id"`
+	UserId    int    `json:"user_id"`
+	Emoji     string `json:"emoji"`
+}
+
+// Validate implements Payload.
+func (p *ReactionPayload) Validate() error {
+	if err := requirePositive("message_id", p.MessageId); err != nil {
+		return err
+	}
+	if err := requireNonNegative("user_id", p.UserId); err != nil {
+		return err
+	}
+	return validateEmoji(p.Emoji)
+}
+
+// validateEmoji checks the emoji of a reaction: a short string without spaces or control characters.
+func validateEmoji(emoji string) error {
+	if emoji == "" {
+		return InvalidField("emoji", "must not be empty")
+	}
+	if len(emoji) > MaxEmojiLength || !utf8.ValidString(emoji) {
+		return InvalidField("emoji", "is not a valid emoji")
+	}
+	if strings.IndexFunc(emoji, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return InvalidField("emoji", "is not a valid emoji")
+	}
+	return nil
+}
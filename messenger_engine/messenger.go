@@ -18,15 +18,23 @@ import (
 	"messenger_engine/controllers/chat_controller"
 	"messenger_engine/controllers/message_controller"
 	"messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/controllers/presence_controller"
 
 	// WebSocket Handlers
 	"messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
 	"messenger_engine/controllers/websocket_controller/handlers/chat_handler"
+	"messenger_engine/controllers/websocket_controller/handlers/presence_handler"
 
+	"messenger_engine/modules/backplane"
 	"messenger_engine/utls/env"
+	"shared/auth"
+	"shared/lifecycle"
+	"shared/ratelimit"
+	"shared/urlresolver"
 )
 
-const serverAddr = "localhost:8440"
+// defaultServerAddr is the address the server listens on when MESSENGER_LISTEN_ADDR is not set.
+const defaultServerAddr = "localhost:8440"
 
 // main is the entry point of the application. It initializes environment variables,
 // database connections, controllers, WebSocket handlers, and starts the HTTP server.
@@ -40,21 +48,52 @@ func main() {
 
 	// Initialize controllers
 	baseCtrl := basecontroller.BaseController{Database: dbPool.GetDb()}
-	chatCtrl := chatcontroller.ChatController{BaseController: &baseCtrl}
-	messageCtrl := messagecontroller.MessageController{BaseController: &baseCtrl}
-	broadcastCtrl := broadcastcontroller.NewBroadcaster()
+	mediaResolver := urlresolver.New(urlresolver.LoadConfig())
+	chatCtrl := chatcontroller.ChatController{BaseController: &baseCtrl, Avatars: mediaResolver}
+	messageCtrl := messagecontroller.MessageController{BaseController: &baseCtrl, Media: mediaResolver}
+	broadcastCtrl := broadcastcontroller.NewBroadcasterWithBackplane(broadcastcontroller.LoadConfig(), initializeBackplane(dbPool))
+	presenceCtrl := presencecontroller.PresenceController{BaseController: &baseCtrl, Broadcast: broadcastCtrl}
+	chatCtrl.Presence = broadcastCtrl
+
+	// Announce users coming online and going offline to their chat partners
+	broadcastCtrl.OnPresence(&presenceCtrl)
 	
+	// Load the token verification settings used by the WebSocket handshakes
+	authConfig, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading auth config: %v", err)
+	}
+	authenticator := auth.NewAuthenticator(authConfig)
+
+	// Load the heartbeat and deadline settings shared by every WebSocket connection
+	lifecycleConfig := lifecycle.LoadConfig()
+
 	// Initialize WebSocket handlers
 	wsHandler := chathandler.NewChatsHandler(websocket.Upgrader{}, &chatCtrl)
+	wsHandler.Authenticator = authenticator
+	wsHandler.Lifecycle = lifecycleConfig
+	wsHandler.RateLimiter = ratelimit.NewLimiter(ratelimit.LoadConfig(chathandler.DefaultRateLimits()))
+	wsHandler.Broadcast = broadcastCtrl
+	broadcastCtrl.OnEvent(wsHandler)
 	chatMsgHandler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messageCtrl, broadcastCtrl)
+	chatMsgHandler.Authenticator = authenticator
+	chatMsgHandler.ChatCtrl = &chatCtrl
+	chatMsgHandler.Authorizer = &chatCtrl
+	chatMsgHandler.Presence = &presenceCtrl
+	chatMsgHandler.Lifecycle = lifecycleConfig
+	chatMsgHandler.RateLimiter = ratelimit.NewLimiter(ratelimit.LoadConfig(chatmessagehandler.DefaultRateLimits()))
+	presenceHandler := presencehandler.NewPresenceHandler(&presenceCtrl)
+	presenceHandler.Authenticator = authenticator
+	presenceHandler.RateLimiter = ratelimit.NewLimiter(ratelimit.LoadConfig(presencehandler.DefaultRateLimits()))
 
 	// Configure HTTP routes
 	mux := http.NewServeMux()
 	mux.Handle("/chats", wsHandler)
 	mux.Handle("/chat", chatMsgHandler)
+	mux.Handle("/presence", presenceHandler)
 
 	// Start message broadcasting routine
-	go broadcastcontroller.NewBroadcaster().HandleMessages(&messageCtrl)
+	go broadcastCtrl.HandleMessages(&messageCtrl)
 
 	// Start HTTP server with graceful shutdown handling
 	startServer(mux)
@@ -67,12 +106,39 @@ func initializeDatabase() *databasepool.DatabasePoolController {
 	return dbPool
 }
 
+// initializeBackplane creates the backplane that relays chat events between instances.
+// The in-memory backplane is used unless BACKPLANE=postgres is configured.
+//
+// Parameters:
+//   - dbPool: The database pool whose connection settings are reused for LISTEN.
+func initializeBackplane(dbPool *databasepool.DatabasePoolController) backplane.Backplane {
+	config, err := backplane.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading backplane config: %v", err)
+	}
+	if config.Kind != backplane.PostgresKind {
+		return backplane.NewMemoryBackplane()
+	}
+
+	db := dbPool.GetDb()
+	bp, err := backplane.NewPostgresBackplane(db.GetConnection(), db.ConnectionString(), config.Channel)
+	if err != nil {
+		log.Fatalf("Error starting postgres backplane: %v", err)
+	}
+	log.Printf("Relaying chat events through postgres channel %q", config.Channel)
+	return bp
+}
+
 // startServer initializes and starts the HTTP server in a separate goroutine.
 // It also triggers the graceful shutdown handling mechanism.
 //
 // Parameters:
 //   - handler: The HTTP handler (mux router) to handle incoming requests.
 func startServer(handler http.Handler) {
+	serverAddr := os.Getenv("MESSENGER_LISTEN_ADDR")
+	if serverAddr == "" {
+		serverAddr = defaultServerAddr
+	}
 	server := &http.Server{
 		Addr:    serverAddr,
 		Handler: handler,
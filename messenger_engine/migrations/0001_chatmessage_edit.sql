@@ -0,0 +1,12 @@
+-- Revisions of edited chat messages.
+-- Every "message_edit" stores the content a message had before the edit.
+CREATE TABLE IF NOT EXISTS base_chatmessage_edit (
+    id               SERIAL PRIMARY KEY,
+    message_id       INTEGER NOT NULL REFERENCES base_chatmessage (id) ON DELETE CASCADE,
+    editor_id        INTEGER NOT NULL,
+    previous_content TEXT NOT NULL,
+    edited_at        TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS base_chatmessage_edit_message_id_idx
+    ON base_chatmessage_edit (message_id, edited_at);
@@ -0,0 +1,13 @@
+-- Tombstones for messages deleted for everyone.
+-- The row is kept so replies pointing at it through parent_id stay valid.
+ALTER TABLE base_chatmessage
+    ADD COLUMN IF NOT EXISTS is_deleted BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP WITH TIME ZONE NULL;
+
+-- Messages their author deleted only for themselves.
+CREATE TABLE IF NOT EXISTS base_chatmessage_hidden (
+    message_id INTEGER NOT NULL REFERENCES base_chatmessage (id) ON DELETE CASCADE,
+    user_id    INTEGER NOT NULL,
+    hidden_at  TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (message_id, user_id)
+);
@@ -0,0 +1,30 @@
+-- Per-chat sequence numbers.
+-- Every message gets the next number of its chat, so clients can detect gaps
+-- in what they received and resume from the last message they saw.
+CREATE TABLE IF NOT EXISTS base_chat_sequence (
+    chat_id  INTEGER PRIMARY KEY,
+    last_seq BIGINT NOT NULL
+);
+
+ALTER TABLE base_chatmessage
+    ADD COLUMN IF NOT EXISTS seq BIGINT;
+
+-- Number the existing messages of every chat in insertion order.
+UPDATE base_chatmessage AS m
+SET seq = numbered.seq
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY chat_id ORDER BY id) AS seq
+    FROM base_chatmessage
+) AS numbered
+WHERE m.id = numbered.id AND m.seq IS NULL;
+
+INSERT INTO base_chat_sequence (chat_id, last_seq)
+SELECT chat_id, max(seq) FROM base_chatmessage GROUP BY chat_id
+ON CONFLICT (chat_id) DO UPDATE
+    SET last_seq = GREATEST(base_chat_sequence.last_seq, EXCLUDED.last_seq);
+
+ALTER TABLE base_chatmessage
+    ALTER COLUMN seq SET NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS base_chatmessage_chat_seq_idx
+    ON base_chatmessage (chat_id, seq);
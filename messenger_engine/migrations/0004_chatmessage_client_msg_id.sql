@@ -0,0 +1,9 @@
+-- Client-generated message IDs.
+-- A client may tag every send with its own ID; retries carrying the same ID
+-- map to the row saved by the first attempt instead of inserting a duplicate.
+ALTER TABLE base_chatmessage
+    ADD COLUMN IF NOT EXISTS client_msg_id TEXT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS base_chatmessage_author_client_msg_id_idx
+    ON base_chatmessage (author_id, client_msg_id)
+    WHERE client_msg_id IS NOT NULL;
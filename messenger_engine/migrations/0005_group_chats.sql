@@ -0,0 +1,49 @@
+-- Chats with metadata, members and roles.
+-- A chat used to exist only as the chat_id shared by its messages, with a single receiver_id
+-- per message, so only 1:1 conversations could be modelled. Chats are now rows of their own,
+-- and messages of group chats are delivered to every member instead of a single receiver.
+CREATE TABLE IF NOT EXISTS base_chat (
+    id SERIAL PRIMARY KEY
+);
+
+ALTER TABLE base_chat
+    ADD COLUMN IF NOT EXISTS title      TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS avatar_url TEXT        NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS creator_id INTEGER     NULL,
+    ADD COLUMN IF NOT EXISTS is_group   BOOLEAN     NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+CREATE TABLE IF NOT EXISTS base_chat_member (
+    chat_id   INTEGER     NOT NULL REFERENCES base_chat (id) ON DELETE CASCADE,
+    user_id   INTEGER     NOT NULL,
+    role      TEXT        NOT NULL DEFAULT 'member' CHECK (role IN ('owner', 'admin', 'member')),
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS base_chat_member_user_idx
+    ON base_chat_member (user_id);
+
+-- Turn every existing conversation into a 1:1 chat owned by the author of its first message.
+INSERT INTO base_chat (id, creator_id, is_group, created_at)
+SELECT DISTINCT ON (chat_id) chat_id, author_id, false, timestamp
+FROM base_chatmessage
+ORDER BY chat_id, id
+ON CONFLICT (id) DO NOTHING;
+
+INSERT INTO base_chat_member (chat_id, user_id, role)
+SELECT participants.chat_id, participants.user_id,
+       CASE WHEN participants.user_id = c.creator_id THEN 'owner' ELSE 'member' END
+FROM (
+    SELECT chat_id, author_id AS user_id FROM base_chatmessage
+    UNION
+    SELECT chat_id, receiver_id FROM base_chatmessage WHERE receiver_id IS NOT NULL
+) AS participants
+JOIN base_chat AS c ON c.id = participants.chat_id
+ON CONFLICT (chat_id, user_id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('base_chat', 'id'), GREATEST((SELECT max(id) FROM base_chat), 1));
+
+-- Group messages have no single receiver.
+ALTER TABLE base_chatmessage
+    ALTER COLUMN receiver_id DROP NOT NULL;
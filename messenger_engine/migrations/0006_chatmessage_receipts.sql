@@ -0,0 +1,17 @@
+-- Delivery receipts: the recipients a message reached, one row per message and recipient.
+CREATE TABLE IF NOT EXISTS base_chatmessage_receipt (
+    message_id   INTEGER NOT NULL REFERENCES base_chatmessage (id) ON DELETE CASCADE,
+    user_id      INTEGER NOT NULL,
+    delivered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (message_id, user_id)
+);
+
+-- Read receipts: a high-water mark per chat and reader.
+-- Reading a message marks it and every earlier message of the chat (by seq) as read.
+CREATE TABLE IF NOT EXISTS base_chat_read (
+    chat_id       INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    last_read_seq BIGINT  NOT NULL,
+    read_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, user_id)
+);
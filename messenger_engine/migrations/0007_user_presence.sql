@@ -0,0 +1,6 @@
+-- Last-seen timestamps, written whenever a user's last connection to an instance closes.
+-- Whether a user is online right now is only kept in memory by the messenger engine.
+CREATE TABLE IF NOT EXISTS base_user_presence (
+    user_id      INTEGER PRIMARY KEY,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
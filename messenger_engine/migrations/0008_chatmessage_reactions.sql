@@ -0,0 +1,8 @@
+-- Emoji reactions: each user can react to a message once per emoji.
+CREATE TABLE IF NOT EXISTS base_chatmessage_reaction (
+    message_id INTEGER     NOT NULL REFERENCES base_chatmessage (id) ON DELETE CASCADE,
+    user_id    INTEGER     NOT NULL,
+    emoji      VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    PRIMARY KEY (message_id, user_id, emoji)
+);
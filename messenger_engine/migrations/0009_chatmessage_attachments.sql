@@ -0,0 +1,12 @@
+-- Attachments: files stored by the media service and referenced by messages, in the order they were sent.
+CREATE TABLE IF NOT EXISTS base_chatmessage_attachment (
+    message_id  INTEGER      NOT NULL REFERENCES base_chatmessage (id) ON DELETE CASCADE,
+    position    SMALLINT     NOT NULL,
+    media_id    VARCHAR(512) NOT NULL,
+    mime_type   VARCHAR(255) NOT NULL,
+    size        BIGINT       NOT NULL,
+    width       INTEGER,
+    height      INTEGER,
+    duration_ms INTEGER,
+    PRIMARY KEY (message_id, position)
+);
@@ -0,0 +1,24 @@
+-- 1:1 chats started after 0005 exist only as the chat_id of their messages, while group chats
+-- take their IDs from the base_chat sequence, so a new group could be given the ID of such a
+-- conversation and inherit it. Give those chats rows and members as well; the messenger engine
+-- now creates them with the first message, and membership is decided by base_chat_member alone.
+INSERT INTO base_chat (id, creator_id, is_group, created_at)
+SELECT DISTINCT ON (chat_id) chat_id, author_id, false, timestamp
+FROM base_chatmessage
+ORDER BY chat_id, id
+ON CONFLICT (id) DO NOTHING;
+
+-- Group chats keep their members; a conversation that already shares its ID with a group
+-- cannot be told apart from the group's own messages and is left alone.
+INSERT INTO base_chat_member (chat_id, user_id, role)
+SELECT participants.chat_id, participants.user_id,
+       CASE WHEN participants.user_id = c.creator_id THEN 'owner' ELSE 'member' END
+FROM (
+    SELECT chat_id, author_id AS user_id FROM base_chatmessage
+    UNION
+    SELECT chat_id, receiver_id FROM base_chatmessage WHERE receiver_id IS NOT NULL
+) AS participants
+JOIN base_chat AS c ON c.id = participants.chat_id AND NOT c.is_group
+ON CONFLICT (chat_id, user_id) DO NOTHING;
+
+SELECT setval(pg_get_serial_sequence('base_chat', 'id'), GREATEST((SELECT max(id) FROM base_chat), 1));
@@ -0,0 +1,27 @@
+-- 1:1 chats used to take the chat ID the client sent with their first message, and moved the
+-- chat ID sequence past it. They are now identified by the pair of their users instead, and
+-- get their ID from the sequence like group chats.
+ALTER TABLE base_chat
+    ADD COLUMN IF NOT EXISTS direct_user_low  INTEGER NULL,
+    ADD COLUMN IF NOT EXISTS direct_user_high INTEGER NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS base_chat_direct_pair_idx
+    ON base_chat (direct_user_low, direct_user_high)
+    WHERE NOT is_group;
+
+-- Pair up the existing 1:1 chats. Where a pair already has several chats, the oldest one is
+-- opened for new conversations; the others keep their history under their own IDs.
+UPDATE base_chat AS c
+SET direct_user_low = pairs.user_low, direct_user_high = pairs.user_high
+FROM (
+    SELECT DISTINCT ON (user_low, user_high) chat_id, user_low, user_high
+    FROM (
+        SELECT m.chat_id, min(m.user_id) AS user_low, max(m.user_id) AS user_high
+        FROM base_chat_member AS m
+        JOIN base_chat AS dc ON dc.id = m.chat_id AND NOT dc.is_group
+        GROUP BY m.chat_id
+        HAVING count(*) <= 2
+    ) AS members
+    ORDER BY user_low, user_high, chat_id
+) AS pairs
+WHERE c.id = pairs.chat_id AND c.direct_user_low IS NULL;
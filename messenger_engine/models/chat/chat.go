@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"time"
+)
+
+// Role is the permission level of a chat member.
+type Role string
+
+const (
+	// RoleOwner can do everything an admin can, and also promote admins and remove them.
+	RoleOwner Role = "owner"
+	// RoleAdmin can add and remove members and rename the chat.
+	RoleAdmin Role = "admin"
+	// RoleMember can read and post messages.
+	RoleMember Role = "member"
+)
+
+// rank orders the roles by permission level.
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// Valid reports whether the role is one of the known roles.
+func (r Role) Valid() bool {
+	return r.rank() > 0
+}
+
+// CanManageChat reports whether the role may add members and rename the chat.
+func (r Role) CanManageChat() bool {
+	return r.rank() >= RoleAdmin.rank()
+}
+
+// Outranks reports whether the role may change or remove a member holding the other role.
+// Admins manage plain members only; the owner manages everyone else.
+func (r Role) Outranks(other Role) bool {
+	return r.CanManageChat() && r.rank() > other.rank()
+}
+
+// Member is a user taking part in a chat.
+//
+// Fields:
+//   - UserId: ID of the member.
+//   - Role: The member's permission level.
+//   - JoinedAt: Time the member joined the chat.
+type Member struct {
+	UserId   int       `json:"user_id"`
+	Role     Role      `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+// Chat is a conversation with its metadata and members.
+//
+// Fields:
+//   - ChatId: Unique identifier of the chat.
+//   - Title: Display name of the chat; empty for 1:1 chats.
+//   - AvatarUrl: URL of the chat's avatar; empty if it has none.
+//   - CreatorId: ID of the user who created the chat.
+//   - IsGroup: Whether the chat is a group chat rather than a 1:1 conversation.
+//   - CreatedAt: Time the chat was created.
+//   - Members: The members of the chat, in the order they joined.
+type Chat struct {
+	ChatId    int       `json:"chat_id"`
+	Title     string    `json:"title"`
+	AvatarUrl string    `json:"avatar_url"`
+	CreatorId int       `json:"creator_id"`
+	IsGroup   bool      `json:"is_group"`
+	CreatedAt time.Time `json:"created_at"`
+	Members   []Member  `json:"members"`
+}
+
+// Member returns the membership of the given user, if they belong to the chat.
+func (c Chat) Member(userId int) (Member, bool) {
+	for _, member := range c.Members {
+		if member.UserId == userId {
+			return member, true
+		}
+	}
+	return Member{}, false
+}
+
+// MemberIds returns the IDs of all members of the chat.
+func (c Chat) MemberIds() []int {
+	ids := make([]int, 0, len(c.Members))
+	for _, member := range c.Members {
+		ids = append(ids, member.UserId)
+	}
+	return ids
+}
+
+// Partner returns the member of a 1:1 chat the given user talks to, which is the user
+// themselves in a chat with themselves.
+func (c Chat) Partner(userId int) int {
+	for _, member := range c.Members {
+		if member.UserId != userId {
+			return member.UserId
+		}
+	}
+	return userId
+}
+
+// ChatUpdate is broadcast to the members of a chat when its metadata or membership changes.
+//
+// Fields:
+//   - Type: Always "chat_updated".
+//   - Action: What changed, e.g. "member_added".
+//   - ActorId: ID of the user who made the change.
+//   - UserId: ID of the member affected by the change, for membership actions.
+//   - Chat: The chat after the change.
+type ChatUpdate struct {
+	Type    string `json:"type"`
+	Action  string `json:"action"`
+	ActorId int    `json:"actor_id"`
+	UserId  int    `json:"user_id,omitempty"`
+	Chat    Chat   `json:"chat"`
+}
+
+// Actions reported by ChatUpdate.
+const (
+	ActionCreated       = "created"
+	ActionMemberAdded   = "member_added"
+	ActionMemberRemoved = "member_removed"
+	ActionMemberLeft    = "member_left"
+	ActionRenamed       = "renamed"
+)
+
+// TypingIndicator tells the other participants of a chat that a user started or stopped typing.
+// Indicators are never persisted.
+//
+// Fields:
+//   - Type: "typing_started" or "typing_stopped".
+//   - ChatId: ID of the chat the user is typing in.
+//   - UserId: ID of the typing user.
+//   - ExpiresAt: When a started indicator expires unless it is refreshed; omitted when stopped.
+type TypingIndicator struct {
+	Type      string     `json:"type"`
+	ChatId    int        `json:"chat_id"`
+	UserId    int        `json:"user_id"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"time"
+)
+
+// InboxCursor marks the last chat of an inbox page. Chats are ordered by their last
+// activity, newest first, and by ID among chats that were active at the same time.
+//
+// Fields:
+//   - LastActivityAt: Last activity of the chat the previous page ended with.
+//   - ChatId: ID of the chat the previous page ended with.
+type InboxCursor struct {
+	LastActivityAt time.Time `json:"last_activity_at"`
+	ChatId         int       `json:"chat_id"`
+}
+
+// InboxQuery describes a page of a user's inbox to load.
+//
+// Fields:
+//   - UserId: ID of the user whose chats are listed.
+//   - Before: Load chats that were last active before this cursor; nil loads the first page.
+//   - Limit: Maximum number of chats in the page.
+type InboxQuery struct {
+	UserId int          `json:"user_id"`
+	Before *InboxCursor `json:"before,omitempty"`
+	Limit  int          `json:"limit"`
+}
+
+// InboxMessage is the latest message of a chat, as shown in the inbox.
+//
+// Fields:
+//   - MessageId: ID of the message.
+//   - Content: Text of the message; empty if it was deleted.
+//   - AuthorId: ID of the user who sent the message.
+//   - Timestamp: Time the message was sent.
+//   - IsDeleted: Whether the message was deleted for everyone.
+type InboxMessage struct {
+	MessageId int       `json:"message_id"`
+	Content   string    `json:"content"`
+	AuthorId  int       `json:"author_id"`
+	Timestamp time.Time `json:"timestamp"`
+	IsDeleted bool      `json:"is_deleted"`
+}
+
+// Participant is another user taking part in a chat of the inbox.
+//
+// Fields:
+//   - UserId: ID of the participant.
+//   - Username: Username of the participant; empty if the user no longer exists.
+//   - AvatarUrl: Presigned URL of the participant's avatar; omitted if it could not be fetched.
+//   - Online: Whether the participant is connected; omitted when presence is not tracked.
+type Participant struct {
+	UserId    int    `json:"user_id"`
+	Username  string `json:"username"`
+	AvatarUrl string `json:"avatar_url,omitempty"`
+	Online    *bool  `json:"online,omitempty"`
+}
+
+// InboxEntry is a chat as listed in a user's inbox.
+//
+// Fields:
+//   - ChatId: ID of the chat.
+//   - IsGroup: Whether the chat is a group chat.
+//   - Title: Display name of a group chat; empty for 1:1 chats.
+//   - AvatarUrl: URL of a group chat's avatar; empty if it has none.
+//   - LastMessage: The latest message the user can see; nil if the chat has none.
+//   - Participants: The other users taking part in the chat, ordered by ID.
+//   - UnreadCount: Number of messages from others the user has not read yet.
+//   - LastActivityAt: Time of the latest message, or the chat's creation if it has none.
+type InboxEntry struct {
+	ChatId         int           `json:"chat_id"`
+	IsGroup        bool          `json:"is_group"`
+	Title          string        `json:"title"`
+	AvatarUrl      string        `json:"avatar_url"`
+	LastMessage    *InboxMessage `json:"last_message"`
+	Participants   []Participant `json:"participants"`
+	UnreadCount    int           `json:"unread_count"`
+	LastActivityAt time.Time     `json:"last_activity_at"`
+}
+
+// InboxPage is a page of a user's inbox, ordered from the most to the least recently active chat.
+//
+// Fields:
+//   - Chats: The chats of the page.
+//   - HasMore: Whether chats that were active earlier exist beyond the page.
+//   - NextCursor: The cursor to pass as before to load the next page; nil when the page is empty.
+type InboxPage struct {
+	Chats      []InboxEntry `json:"chats"`
+	HasMore    bool         `json:"has_more"`
+	NextCursor *InboxCursor `json:"next_cursor"`
+}
+
+// InboxUpdate is pushed over an open inbox when one of its chats changes.
+//
+// Fields:
+//   - Type: "inbox_updated" when the chat changed, or "inbox_removed" once the user no longer takes part in it.
+//   - ChatId: ID of the chat.
+//   - Chat: The chat as it now appears in the inbox; omitted when it was removed.
+type InboxUpdate struct {
+	Type   string      `json:"type"`
+	ChatId int         `json:"chat_id"`
+	Chat   *InboxEntry `json:"chat,omitempty"`
+}
+
+// Types of InboxUpdate.
+const (
+	InboxUpdated = "inbox_updated"
+	InboxRemoved = "inbox_removed"
+)
@@ -0,0 +1,80 @@
+package event
+
+import (
+	Messages "messenger_engine/models/message"
+)
+
+// Type identifies the kind of an event delivered to chat subscribers.
+type Type string
+
+const (
+	// MessageCreated is emitted when a new message is posted to a chat.
+	MessageCreated Type = "message"
+	// ReplyCreated is emitted when a reply to an existing message is posted to a chat.
+	ReplyCreated Type = "message_reply"
+	// MessageEdited is emitted when the content of a message changes.
+	MessageEdited Type = "message_edited"
+	// MessageDeleted is emitted when a message is replaced by a tombstone for everyone.
+	MessageDeleted Type = "message_deleted"
+	// ChatUpdated is emitted when the metadata or the membership of a chat changes.
+	ChatUpdated Type = "chat_updated"
+	// MessageDelivered is emitted to the author of a message when a recipient received it.
+	MessageDelivered Type = "message_delivered"
+	// MessageRead is emitted to the authors of messages when a reader read a chat up to them.
+	MessageRead Type = "message_read"
+	// TypingStarted is emitted to the other participants of a chat when a user starts typing.
+	TypingStarted Type = "typing_started"
+	// TypingStopped is emitted when a user stops typing, or when their indicator expires.
+	TypingStopped Type = "typing_stopped"
+	// PresenceChanged is emitted to a user's chat partners when the user comes online or goes offline.
+	PresenceChanged Type = "presence"
+	// ReactionAdded is emitted when a user reacts to a message with an emoji.
+	ReactionAdded Type = "reaction_added"
+	// ReactionRemoved is emitted when a user takes back a reaction.
+	ReactionRemoved Type = "reaction_removed"
+)
+
+// Event is a single entry of the broadcaster's event stream.
+// Every kind of update that has to reach the subscribers of a chat is published as an Event,
+// so one dispatcher can fan all of them out in the order they were published.
+//
+// Fields:
+//   - Type: The kind of the event.
+//   - ChatId: ID of the chat whose subscribers receive the event.
+//   - Payload: The frame written to every subscriber.
+//   - Recipients: IDs of users who receive the event on every connection, whether or not
+//     they are subscribed to the chat; used for the members of group chats.
+//   - RecipientsOnly: Whether the event skips the chat's subscribers and only reaches the
+//     recipients, e.g. receipts meant for the author of a message.
+//   - ExcludeUserId: ID of a user whose connections never receive the event, e.g. the typing
+//     user of a typing indicator; 0 excludes nobody.
+type Event struct {
+	Type           Type
+	ChatId         int
+	Payload        interface{}
+	Recipients     []int
+	RecipientsOnly bool
+	ExcludeUserId  int
+}
+
+// FromMessage wraps a message frame into an event of the frame's type.
+//
+// Parameters:
+//   - msg: The message frame to deliver.
+//
+// Returns:
+//   - An Event addressed to the message's chat.
+func FromMessage(msg Messages.FinalMessage) Event {
+	return Event{Type: Type(msg.Type), ChatId: msg.Message.ChatId, Payload: msg}
+}
+
+// FromReply wraps a reply frame into an event of the frame's type.
+//
+// Parameters:
+//   - msg: The reply frame to deliver.
+//
+// Returns:
+//   - An Event addressed to the reply's chat.
+func FromReply(msg Messages.FinalMessageReply) Event {
+	return Event{Type: Type(msg.Type), ChatId: msg.Message.ChatId, Payload: msg}
+}
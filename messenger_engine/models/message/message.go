@@ -14,8 +14,14 @@ import (
 //   - ReceiverId: ID of the user or group receiving the message.
 //   - Message: The actual message content.
 //   - ChatId: ID of the chat where the message belongs.
+//   - Seq: Position of the message in its chat; increases by one with every message.
 //   - IsEdited: Indicates if the message has been edited.
+//   - IsDeleted: Indicates if the message is a tombstone of a deleted message.
 //   - ParentMessageId: Optional ID of the parent message (for replies).
+//   - ClientMsgId: Optional ID the sending client generated to make retries idempotent.
+//   - Status: How far the message got with its recipients: "sent", "delivered" or "read".
+//   - Reactions: The message's reactions, one entry per emoji; tombstones have none.
+//   - Attachments: The files sent with the message; tombstones have none.
 type Message struct {
 	MessageId       int           `json:"message_id"`
 	AuthorId        int           `json:"author_id"`
@@ -23,8 +29,14 @@ type Message struct {
 	ReceiverId      int           `json:"receiver_id"`
 	Message         string        `json:"message"`
 	ChatId          int           `json:"chat_id"`
+	Seq             int64         `json:"seq"`
 	IsEdited        bool          `json:"is_edited"`
+	IsDeleted       bool          `json:"is_deleted"`
 	ParentMessageId sql.NullInt64 `json:"parent_message_id"`
+	ClientMsgId     string        `json:"client_msg_id,omitempty"`
+	Status          string        `json:"status,omitempty"`
+	Reactions       []Reaction    `json:"reactions,omitempty"`
+	Attachments     []Attachment  `json:"attachments,omitempty"`
 }
 
 // MessageReply represents a reply to an existing message.
@@ -36,17 +48,25 @@ type Message struct {
 //   - ReceiverId: ID of the user or group receiving the reply.
 //   - Message: The content of the reply message.
 //   - ChatId: ID of the chat where the reply belongs.
+//   - Seq: Position of the reply in its chat; increases by one with every message.
 //   - IsEdited: Indicates if the reply has been edited.
 //   - ParentMessageId: ID of the original message being replied to.
+//   - ClientMsgId: Optional ID the sending client generated to make retries idempotent.
+//   - Status: How far the reply got with its recipients: "sent", "delivered" or "read".
+//   - Attachments: The files sent with the reply.
 type MessageReply struct {
-	MessageId       int       `json:"message_id"`
-	AuthorId        int       `json:"author_id"`
-	Timestamp       time.Time `json:"timestamp"`
-	ReceiverId      int       `json:"receiver_id"`
-	Message         string    `json:"message"`
-	ChatId          int       `json:"chat_id"`
-	IsEdited        bool      `json:"is_edited"`
-	ParentMessageId int       `json:"parent_message_id"`
+	MessageId       int          `json:"message_id"`
+	AuthorId        int          `json:"author_id"`
+	Timestamp       time.Time    `json:"timestamp"`
+	ReceiverId      int          `json:"receiver_id"`
+	Message         string       `json:"message"`
+	ChatId          int          `json:"chat_id"`
+	Seq             int64        `json:"seq"`
+	IsEdited        bool         `json:"is_edited"`
+	ParentMessageId int          `json:"parent_message_id"`
+	ClientMsgId     string       `json:"client_msg_id,omitempty"`
+	Status          string       `json:"status,omitempty"`
+	Attachments     []Attachment `json:"attachments,omitempty"`
 }
 
 // FinalMessage represents the final message format to be sent to the client.
@@ -68,3 +88,204 @@ type FinalMessageReply struct {
 	Message MessageReply `json:"message"`
 	Type    string       `json:"type"`
 }
+
+// MessageAck confirms to the sender that a message tagged with a client_msg_id is stored.
+// It is also sent when a retry hits an already stored message, which is then not broadcast again.
+//
+// Fields:
+//   - Type: Always "message_ack".
+//   - RequestId: The request_id of the acknowledged request, if it had one.
+//   - ClientMsgId: The ID the client generated for the message.
+//   - MessageId: The ID the server assigned to the message.
+//   - ChatId: ID of the chat the message belongs to.
+//   - Seq: Position of the message in its chat.
+//   - Timestamp: The stored time of the message.
+//   - Duplicate: Whether the message had already been stored by an earlier attempt.
+type MessageAck struct {
+	Type        string    `json:"type"`
+	RequestId   string    `json:"request_id,omitempty"`
+	ClientMsgId string    `json:"client_msg_id"`
+	MessageId   int       `json:"message_id"`
+	ChatId      int       `json:"chat_id"`
+	Seq         int64     `json:"seq"`
+	Timestamp   time.Time `json:"timestamp"`
+	Duplicate   bool      `json:"duplicate"`
+}
+
+// MessageEdit represents a request to change the content of an existing message.
+//
+// Fields:
+//   - MessageId: ID of the message being edited.
+//   - AuthorId: ID of the user requesting the edit; must be the original author.
+//   - Message: The new message content.
+type MessageEdit struct {
+	MessageId int    `json:"message_id"`
+	AuthorId  int    `json:"author_id"`
+	Message   string `json:"message"`
+}
+
+// MessageRevision represents a previous version of an edited message.
+//
+// Fields:
+//   - RevisionId: Unique identifier for the revision.
+//   - MessageId: ID of the edited message.
+//   - EditorId: ID of the user who made the edit.
+//   - Message: The content the message had before the edit.
+//   - EditedAt: Time when the edit replaced this content.
+type MessageRevision struct {
+	RevisionId int       `json:"revision_id"`
+	MessageId  int       `json:"message_id"`
+	EditorId   int       `json:"editor_id"`
+	Message    string    `json:"message"`
+	EditedAt   time.Time `json:"edited_at"`
+}
+
+// MessageDelete represents a request to delete a message.
+//
+// Fields:
+//   - MessageId: ID of the message being deleted.
+//   - AuthorId: ID of the user requesting the deletion; must be the original author.
+//   - ForEveryone: Whether the message is replaced by a tombstone for every participant
+//     or only hidden from the author.
+type MessageDelete struct {
+	MessageId   int  `json:"message_id"`
+	AuthorId    int  `json:"author_id"`
+	ForEveryone bool `json:"for_everyone"`
+}
+
+// HistoryQuery describes a page of chat history to load.
+// At most one of BeforeMessageId and AfterMessageId may be set; with neither,
+// the latest page of the chat is loaded.
+//
+// Fields:
+//   - ChatId: ID of the chat whose history is requested.
+//   - ViewerId: ID of the user the history is loaded for.
+//   - BeforeMessageId: Load messages older than this message ID.
+//   - AfterMessageId: Load messages newer than this message ID.
+//   - Limit: Maximum number of messages in the page.
+type HistoryQuery struct {
+	ChatId          int `json:"chat_id"`
+	ViewerId        int `json:"viewer_id"`
+	BeforeMessageId int `json:"before_message_id"`
+	AfterMessageId  int `json:"after_message_id"`
+	Limit           int `json:"limit"`
+}
+
+// HistoryPage is a page of chat history ordered from the oldest to the newest message.
+//
+// Fields:
+//   - Messages: The messages of the page.
+//   - HasMore: Whether more messages exist beyond the page in the requested direction.
+//   - NextCursor: The message ID to pass as before_message_id (or after_message_id when
+//     paging forward) to load the next page; 0 when the page is empty.
+type HistoryPage struct {
+	Messages   []Message `json:"messages"`
+	HasMore    bool      `json:"has_more"`
+	NextCursor int       `json:"next_cursor"`
+}
+
+// ResumeCursor marks the last message a client saw in a chat before its connection dropped.
+//
+// Fields:
+//   - ChatId: ID of the chat to resume.
+//   - LastMessageId: ID of the last message the client received; 0 if it received none.
+type ResumeCursor struct {
+	ChatId        int `json:"chat_id"`
+	LastMessageId int `json:"last_message_id"`
+}
+
+// Delivery statuses of a message. A message is delivered or read once every recipient
+// received or read it.
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusRead      = "read"
+)
+
+// DeliveryReceipt tells the author of a message that a recipient received it.
+//
+// Fields:
+//   - Type: Always "message_delivered".
+//   - ChatId: ID of the chat the message belongs to.
+//   - MessageId: ID of the delivered message.
+//   - UserId: ID of the recipient who received the message.
+//   - DeliveredAt: Time the delivery was recorded.
+type DeliveryReceipt struct {
+	Type        string    `json:"type"`
+	ChatId      int       `json:"chat_id"`
+	MessageId   int       `json:"message_id"`
+	UserId      int       `json:"user_id"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// ReadReceipt tells the authors of messages that a reader read a chat up to a message.
+// Every message of the chat up to LastReadSeq counts as read by the reader.
+//
+// Fields:
+//   - Type: Always "message_read".
+//   - ChatId: ID of the chat that was read.
+//   - MessageId: ID of the last message read.
+//   - LastReadSeq: Sequence number of the last message read; the reader's high-water mark.
+//   - UserId: ID of the reader.
+//   - ReadAt: Time the read was recorded.
+type ReadReceipt struct {
+	Type        string    `json:"type"`
+	ChatId      int       `json:"chat_id"`
+	MessageId   int       `json:"message_id"`
+	LastReadSeq int64     `json:"last_read_seq"`
+	UserId      int       `json:"user_id"`
+	ReadAt      time.Time `json:"read_at"`
+}
+
+// Reaction sums up the reactions to a message with one emoji, as seen by the viewer.
+//
+// Fields:
+//   - Emoji: The emoji users reacted with.
+//   - Count: How many users reacted with the emoji.
+//   - Mine: Whether the viewer is one of them.
+type Reaction struct {
+	Emoji string `json:"emoji"`
+	Count int    `json:"count"`
+	Mine  bool   `json:"mine"`
+}
+
+// ReactionUpdate tells the chat that a user added or removed a reaction to a message.
+//
+// Fields:
+//   - Type: "reaction_added" or "reaction_removed".
+//   - ChatId: ID of the chat the message belongs to.
+//   - MessageId: ID of the message.
+//   - UserId: ID of the user who reacted.
+//   - Emoji: The emoji added or removed.
+//   - Count: How many users reacted to the message with the emoji after the change.
+type ReactionUpdate struct {
+	Type      string `json:"type"`
+	ChatId    int    `json:"chat_id"`
+	MessageId int    `json:"message_id"`
+	UserId    int    `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	Count     int    `json:"count"`
+}
+
+// Attachment is a file sent with a message: an image, a video, a voice note or any other file.
+// The file is uploaded to the media service through a presigned upload URL first, and then
+// referenced by the media ID the upload URL was issued for.
+//
+// Fields:
+//   - MediaId: The key the media service stored the file under.
+//   - MimeType: The MIME type of the file, e.g. "image/png" or "audio/ogg".
+//   - Size: The size of the file in bytes.
+//   - Width: The width of an image or video in pixels; 0 for other files.
+//   - Height: The height of an image or video in pixels; 0 for other files.
+//   - DurationMs: The length of a voice note, audio or video in milliseconds; 0 for other files.
+//   - Url: A presigned download URL of the file, signed when the message is sent or loaded;
+//     empty if the media service could not be reached.
+type Attachment struct {
+	MediaId    string `json:"media_id"`
+	MimeType   string `json:"mime_type"`
+	Size       int64  `json:"size"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	DurationMs int    `json:"duration_ms,omitempty"`
+	Url        string `json:"url,omitempty"`
+}
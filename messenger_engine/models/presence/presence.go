@@ -0,0 +1,22 @@
+package presence
+
+import (
+	"time"
+)
+
+// Presence tells whether a user has at least one live connection, and when they were last seen.
+//
+// Fields:
+//   - Type: Always "presence".
+//   - UserId: ID of the user.
+//   - Online: Whether the user is connected right now.
+//   - LastSeenAt: When the user's last connection closed; nil if they were never seen.
+type Presence struct {
+	Type       string     `json:"type"`
+	UserId     int        `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// TypePresence is the frame type of presence updates.
+const TypePresence = "presence"
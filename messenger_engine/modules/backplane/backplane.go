@@ -0,0 +1,109 @@
+package backplane
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+
+	"messenger_engine/models/event"
+)
+
+// ErrBackplaneClosed is returned when an event is published on a closed backplane.
+var ErrBackplaneClosed = errors.New("backplane closed")
+
+// Backplane relays events between messenger_engine instances.
+// Every instance publishes the events it produces and receives the events produced by the
+// other instances, so subscribers connected to any replica see every update of their chats.
+// Events published by an instance are never handed back to that same instance.
+type Backplane interface {
+	// Publish sends the event to every other instance attached to the backplane.
+	Publish(ev event.Event) error
+	// Events returns the stream of events published by the other instances.
+	Events() <-chan event.Event
+	// Close detaches the instance from the backplane and closes its event stream.
+	Close() error
+}
+
+// envelope is the wire representation of an event travelling between instances.
+type envelope struct {
+	Origin         string          `json:"origin"`
+	Type           event.Type      `json:"type"`
+	ChatId         int             `json:"chat_id"`
+	Payload        json.RawMessage `json:"payload"`
+	Recipients     []int           `json:"recipients,omitempty"`
+	RecipientsOnly bool            `json:"recipients_only,omitempty"`
+	ExcludeUserId  int             `json:"exclude_user_id,omitempty"`
+}
+
+// encode serializes the event together with the ID of the instance that published it.
+func encode(origin string, ev event.Event) ([]byte, error) {
+	payload, err := json.Marshal(ev.Payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Origin: origin, Type: ev.Type, ChatId: ev.ChatId, Payload: payload, Recipients: ev.Recipients, RecipientsOnly: ev.RecipientsOnly, ExcludeUserId: ev.ExcludeUserId})
+}
+
+// decode restores an event from its wire representation. The payload is kept as raw
+// JSON, so it is written to subscribers exactly as the publishing instance encoded it.
+func decode(data []byte) (string, event.Event, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return "", event.Event{}, err
+	}
+	return env.Origin, event.Event{Type: env.Type, ChatId: env.ChatId, Payload: env.Payload, Recipients: env.Recipients, RecipientsOnly: env.RecipientsOnly, ExcludeUserId: env.ExcludeUserId}, nil
+}
+
+// newInstanceID returns a random identifier used to recognize an instance's own events.
+func newInstanceID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		log.Fatalf("Error generating backplane instance ID: %v", err)
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Kind selects the backplane implementation.
+type Kind string
+
+const (
+	// MemoryKind keeps events inside the process; used for tests and single-node deployments.
+	MemoryKind Kind = "memory"
+	// PostgresKind relays events through Postgres LISTEN/NOTIFY.
+	PostgresKind Kind = "postgres"
+)
+
+// Config holds the backplane settings.
+type Config struct {
+	Kind    Kind   // Which implementation to use.
+	Channel string // Postgres notification channel shared by all instances.
+}
+
+// DefaultChannel is the notification channel used when BACKPLANE_CHANNEL is not set.
+const DefaultChannel = "messenger_events"
+
+// LoadConfig reads the backplane settings from environment variables:
+//   - BACKPLANE: "memory" (default) or "postgres".
+//   - BACKPLANE_CHANNEL: the Postgres notification channel, "messenger_events" by default.
+//
+// Returns:
+//   - The backplane configuration, or an error for an unknown backplane kind.
+func LoadConfig() (Config, error) {
+	config := Config{Kind: MemoryKind, Channel: DefaultChannel}
+
+	switch kind := Kind(os.Getenv("BACKPLANE")); kind {
+	case "":
+	case MemoryKind, PostgresKind:
+		config.Kind = kind
+	default:
+		return config, errors.New("unknown BACKPLANE " + string(kind))
+	}
+
+	if channel := os.Getenv("BACKPLANE_CHANNEL"); channel != "" {
+		config.Channel = channel
+	}
+	return config, nil
+}
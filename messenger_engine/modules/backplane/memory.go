@@ -0,0 +1,93 @@
+package backplane
+
+import (
+	"log"
+	"sync"
+
+	"messenger_engine/models/event"
+)
+
+// memoryBufferSize is the number of events buffered for every attached instance.
+const memoryBufferSize = 1024
+
+// MemoryHub connects in-process backplanes. Instances joined to the same hub
+// behave like replicas sharing one Postgres channel.
+type MemoryHub struct {
+	mu    sync.Mutex
+	nodes map[*MemoryBackplane]bool
+}
+
+// NewMemoryHub creates an empty hub.
+//
+// Returns:
+//   - A pointer to a newly created MemoryHub.
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{nodes: make(map[*MemoryBackplane]bool)}
+}
+
+// Join attaches a new instance to the hub.
+//
+// Returns:
+//   - The backplane of the new instance.
+func (h *MemoryHub) Join() *MemoryBackplane {
+	node := &MemoryBackplane{hub: h, events: make(chan event.Event, memoryBufferSize)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodes[node] = true
+	return node
+}
+
+// MemoryBackplane is an in-process Backplane attached to a MemoryHub.
+type MemoryBackplane struct {
+	hub    *MemoryHub
+	events chan event.Event
+}
+
+// NewMemoryBackplane returns a backplane with no other instances attached,
+// which is what a single-node deployment needs.
+//
+// Returns:
+//   - A pointer to a newly created MemoryBackplane.
+func NewMemoryBackplane() *MemoryBackplane {
+	return NewMemoryHub().Join()
+}
+
+// Publish hands the event to every other instance joined to the hub.
+// Instances whose buffer is full miss the event rather than stalling the publisher.
+func (m *MemoryBackplane) Publish(ev event.Event) error {
+	m.hub.mu.Lock()
+	defer m.hub.mu.Unlock()
+
+	if !m.hub.nodes[m] {
+		return ErrBackplaneClosed
+	}
+	for node := range m.hub.nodes {
+		if node == m {
+			continue
+		}
+		select {
+		case node.events <- ev:
+		default:
+			log.Println("Backplane buffer full, dropping event")
+		}
+	}
+	return nil
+}
+
+// Events returns the stream of events published by the other instances.
+func (m *MemoryBackplane) Events() <-chan event.Event {
+	return m.events
+}
+
+// Close detaches the instance from the hub and closes its event stream.
+func (m *MemoryBackplane) Close() error {
+	m.hub.mu.Lock()
+	defer m.hub.mu.Unlock()
+
+	if m.hub.nodes[m] {
+		delete(m.hub.nodes, m)
+		close(m.events)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package backplane
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"messenger_engine/models/event"
+)
+
+// MaxNotifyPayload is the largest payload Postgres accepts in a NOTIFY.
+const MaxNotifyPayload = 7999
+
+// ErrPayloadTooLarge is returned when an encoded event does not fit in a notification.
+var ErrPayloadTooLarge = errors.New("event too large for a postgres notification")
+
+// PostgresBackplane relays events between instances through Postgres LISTEN/NOTIFY.
+// Events are published with pg_notify on the shared pool and received on a dedicated
+// listener connection, which reconnects by itself when the connection drops.
+type PostgresBackplane struct {
+	db       *sql.DB
+	listener *pq.Listener
+	channel  string
+	origin   string
+	events   chan event.Event
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewPostgresBackplane starts listening on the channel and returns the backplane.
+//
+// Parameters:
+//   - db: The connection pool used to publish notifications.
+//   - connStr: The connection string used for the dedicated listener connection.
+//   - channel: The notification channel shared by all instances.
+//
+// Returns:
+//   - A pointer to the started PostgresBackplane, or an error if listening fails.
+func NewPostgresBackplane(db *sql.DB, connStr string, channel string) (*PostgresBackplane, error) {
+	listener := pq.NewListener(connStr, time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("Backplane listener error: %v", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	p := &PostgresBackplane{
+		db:       db,
+		listener: listener,
+		channel:  channel,
+		origin:   newInstanceID(),
+		events:   make(chan event.Event, memoryBufferSize),
+		done:     make(chan struct{}),
+	}
+	go p.listen()
+	return p, nil
+}
+
+// Publish notifies the other instances of the event. Events larger than a notification
+// can carry are rejected with ErrPayloadTooLarge; they still reach local subscribers.
+func (p *PostgresBackplane) Publish(ev event.Event) error {
+	select {
+	case <-p.done:
+		return ErrBackplaneClosed
+	default:
+	}
+
+	data, err := encode(p.origin, ev)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxNotifyPayload {
+		return ErrPayloadTooLarge
+	}
+	_, err = p.db.Exec(`SELECT pg_notify($1, $2)`, p.channel, string(data))
+	return err
+}
+
+// Events returns the stream of events published by the other instances.
+func (p *PostgresBackplane) Events() <-chan event.Event {
+	return p.events
+}
+
+// Close stops listening and closes the event stream.
+func (p *PostgresBackplane) Close() error {
+	var err error
+	p.once.Do(func() {
+		close(p.done)
+		err = p.listener.Close()
+	})
+	return err
+}
+
+// listen decodes incoming notifications and forwards the events of other instances.
+func (p *PostgresBackplane) listen() {
+	defer close(p.events)
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case n, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+			// A nil notification signals a reconnect; notifications sent meanwhile are lost.
+			if n == nil {
+				log.Println("Backplane listener reconnected")
+				continue
+			}
+			origin, ev, err := decode([]byte(n.Extra))
+			if err != nil {
+				log.Printf("Dropping malformed backplane event: %v", err)
+				continue
+			}
+			if origin == p.origin {
+				continue
+			}
+			select {
+			case p.events <- ev:
+			default:
+				log.Println("Backplane buffer full, dropping event")
+			}
+		}
+	}
+}
@@ -16,16 +16,19 @@ type Database struct {
 	config *DatabaseConfig
 }
 
+// NewDatabaseFromConnection wraps an already opened connection pool.
+// It allows controllers to run against a mocked connection in tests.
+func NewDatabaseFromConnection(db *sql.DB) *Database {
+	return &Database{db: db}
+}
+
 // Connect initializes the database connection using the configuration provided
 // in the Database instance. It constructs a connection string from the config,
 // opens the connection, and verifies it with a ping. If any step fails, the
 // function logs the error and terminates the application.
 func (d *Database) Connect() {
-	connStr := fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=%s",
-		d.config.Host, d.config.User, d.config.Password, d.config.Name, d.config.SslMode)
-
 	var err error
-	d.db, err = sql.Open("postgres", connStr)
+	d.db, err = sql.Open("postgres", d.ConnectionString())
 	if err != nil {
 		log.Fatalf("Error connecting to the database: %v", err)
 	}
@@ -38,6 +41,13 @@ func (d *Database) Connect() {
 	log.Println("Database connection established successfully")
 }
 
+// ConnectionString builds the lib/pq connection string from the configuration.
+// It is also used to open dedicated connections, such as LISTEN connections.
+func (d *Database) ConnectionString() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s sslmode=%s",
+		d.config.Host, d.config.User, d.config.Password, d.config.Name, d.config.SslMode)
+}
+
 // GetConnection returns the underlying *sql.DB connection pool.
 // This connection can be used to perform database operations.
 func (d *Database) GetConnection() *sql.DB {
@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	messagecontroller "messenger_engine/controllers/message_controller"
+	"messenger_engine/controllers/websocket_controller/parsers"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	Messages "messenger_engine/models/message"
+)
+
+// stubAttachmentResolver signs every attachment lookup with a URL naming its media ID.
+type stubAttachmentResolver struct {
+	requests [][]string
+}
+
+// Resolve records the batch and answers every lookup.
+func (s *stubAttachmentResolver) Resolve(ctx context.Context, urls []string) map[string][]string {
+	s.requests = append(s.requests, urls)
+	resolved := make(map[string][]string, len(urls))
+	for _, lookup := range urls {
+		parsed, _ := url.Parse(lookup)
+		resolved[lookup] = []string{"http://media.test/media/" + parsed.Query().Get("media_id") + "?expires=1"}
+	}
+	return resolved
+}
+
+// TestSaveMessage_Attachments verifies that attachments are stored with the message and
+// come back with presigned URLs.
+func TestSaveMessage_Attachments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	resolver := &stubAttachmentResolver{}
+	mmc := newTestMessageController(db)
+	mmc.Media = resolver
+
+	msg := Messages.Message{
+		Timestamp:  time.Now(),
+		AuthorId:   1,
+		ChatId:     10,
+		ReceiverId: 2,
+		Attachments: []Messages.Attachment{
+			{MediaId: "attachments/1/photo", MimeType: "image/png", Size: 2048, Width: 640, Height: 480},
+			{MediaId: "attachments/1/voice", MimeType: "audio/ogg", Size: 512, DurationMs: 3200},
+		},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(3))
+	mock.ExpectQuery("INSERT INTO base_chatmessage (.+) RETURNING id").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectExec("INSERT INTO base_chatmessage_attachment").
+		WithArgs(42, 0, "attachments/1/photo", "image/png", int64(2048), 640, 480, 0).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO base_chatmessage_attachment").
+		WithArgs(42, 1, "attachments/1/voice", "audio/ogg", int64(512), 0, 0, 3200).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	saved, _, err := mmc.SaveMessage(msg)
+	if err != nil {
+		t.Fatalf("SaveMessage() returned an unexpected error: %v", err)
+	}
+	if len(resolver.requests) != 1 || len(resolver.requests[0]) != 2 {
+		t.Errorf("expected the attachments to be signed in one batch, got %v", resolver.requests)
+	}
+	if saved.Attachments[0].Url != "http://media.test/media/attachments/1/photo?expires=1" ||
+		saved.Attachments[1].Url != "http://media.test/media/attachments/1/voice?expires=1" {
+		t.Errorf("expected signed attachment URLs, got %+v", saved.Attachments)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+// TestSaveMessageReply_DuplicateAttachments verifies that a retried reply comes back with the
+// attachments stored with the original, signed like those of a new message.
+func TestSaveMessageReply_DuplicateAttachments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	resolver := &stubAttachmentResolver{}
+	mmc := newTestMessageController(db)
+	mmc.Media = resolver
+
+	retry := Messages.MessageReply{
+		Timestamp:       time.Now(),
+		AuthorId:        1,
+		ChatId:          10,
+		ParentMessageId: 40,
+		ClientMsgId:     "c-1",
+		Attachments:     []Messages.Attachment{{MediaId: "attachments/1/photo", MimeType: "image/png", Size: 2048}},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(8))
+	mock.ExpectQuery("INSERT INTO base_chatmessage (.+) RETURNING id").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT m.id, m.chat_id, m.seq, m.timestamp, at.attachments FROM base_chatmessage AS m (.+) base_chatmessage_attachment").
+		WithArgs(1, "c-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_id", "seq", "timestamp", "attachments"}).
+			AddRow(42, 10, 7, time.Now(), []byte(`[{"media_id":"attachments/1/photo","mime_type":"image/png","size":2048,"width":640,"height":480,"duration_ms":0}]`)))
+
+	saved, duplicate, err := mmc.SaveMessageReply(retry)
+	if err != nil {
+		t.Fatalf("SaveMessageReply() returned an unexpected error: %v", err)
+	}
+	if !duplicate {
+		t.Errorf("expected the retry to be reported as a duplicate")
+	}
+	if len(saved.Attachments) != 1 || saved.Attachments[0].Width != 640 ||
+		saved.Attachments[0].Url != "http://media.test/media/attachments/1/photo?expires=1" {
+		t.Errorf("expected the stored attachment with a signed URL, got %+v", saved.Attachments)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+// TestSaveMessage_ForeignAttachment verifies that media uploaded by another user cannot be attached.
+func TestSaveMessage_ForeignAttachment(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	_, _, err = newTestMessageController(db).SaveMessage(Messages.Message{
+		AuthorId:    1,
+		ChatId:      10,
+		Attachments: []Messages.Attachment{{MediaId: "attachments/2/photo", MimeType: "image/png", Size: 1}},
+	})
+	if !errors.Is(err, messagecontroller.ErrForeignAttachment) {
+		t.Errorf("expected ErrForeignAttachment, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("expected nothing to be stored: %v", err)
+	}
+}
+
+// TestLoadMessages_Attachments verifies that history pages carry the attachments of their
+// messages with freshly signed URLs, resolved for the whole page at once.
+func TestLoadMessages_Attachments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	resolver := &stubAttachmentResolver{}
+	mmc := newTestMessageController(db)
+	mmc.Media = resolver
+
+	timestamp := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m (.+) base_chatmessage_attachment (.+) WHERE m.chat_id = \\$1").
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(2, "", false, timestamp, 1, 10, 2, false, nil, 2, "sent", nil,
+				`[{"media_id":"attachments/1/b","mime_type":"video/mp4","size":900,"width":1280,"height":720,"duration_ms":5000}]`).
+			AddRow(1, "look", false, timestamp, 1, 10, 2, false, nil, 1, "sent", nil,
+				`[{"media_id":"attachments/1/a","mime_type":"image/jpeg","size":100,"width":10,"height":20,"duration_ms":0}]`))
+
+	page, err := mmc.LoadMessages(Messages.HistoryQuery{ChatId: 10, ViewerId: 2})
+	if err != nil {
+		t.Fatalf("LoadMessages() returned an unexpected error: %v", err)
+	}
+	if len(page.Messages) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(page.Messages))
+	}
+
+	photo, video := page.Messages[0].Attachments, page.Messages[1].Attachments
+	if len(photo) != 1 || photo[0].MimeType != "image/jpeg" || photo[0].Width != 10 || photo[0].Height != 20 {
+		t.Errorf("unexpected attachments of the first message: %+v", photo)
+	}
+	if len(video) != 1 || video[0].DurationMs != 5000 || video[0].Size != 900 {
+		t.Errorf("unexpected attachments of the second message: %+v", video)
+	}
+	if photo[0].Url != "http://media.test/media/attachments/1/a?expires=1" || video[0].Url == "" {
+		t.Errorf("expected signed attachment URLs, got %q and %q", photo[0].Url, video[0].Url)
+	}
+	if len(resolver.requests) != 1 {
+		t.Errorf("expected one batch of lookups for the page, got %d", len(resolver.requests))
+	}
+}
+
+// TestMessagePayload_Attachments verifies the validation of attachments in message frames.
+func TestMessagePayload_Attachments(t *testing.T) {
+	parser := parsers.New()
+	env, err := parser.Decode([]byte(`{"type":"message","version":1,"payload":{"chat_id":10,
+		"attachments":[{"media_id":"attachments/1/a","mime_type":"image/png","size":10,"url":"http://evil.test"}]}}`))
+	if err != nil {
+		t.Fatalf("Decode() returned an unexpected error: %v", err)
+	}
+
+	// A message may consist of attachments only; client-provided URLs are dropped.
+	var payload protocol.MessagePayload
+	if err := parser.DecodePayload(env, &payload); err != nil {
+		t.Fatalf("DecodePayload() returned an unexpected error: %v", err)
+	}
+	if msg := payload.ToMessage(); len(msg.Attachments) != 1 || msg.Attachments[0].Url != "" {
+		t.Errorf("unexpected attachments: %+v", msg.Attachments)
+	}
+
+	invalid := map[string]protocol.MessagePayload{
+		"message": {ChatId: 10},
+		"attachments.mime_type": {ChatId: 10, Attachments: []Messages.Attachment{
+			{MediaId: "attachments/1/a", MimeType: "png", Size: 10}}},
+		"attachments.size": {ChatId: 10, Attachments: []Messages.Attachment{
+			{MediaId: "attachments/1/a", MimeType: "image/png"}}},
+		"attachments.media_id": {ChatId: 10, Attachments: []Messages.Attachment{
+			{MimeType: "image/png", Size: 10}}},
+		"attachments.duration_ms": {ChatId: 10, Attachments: []Messages.Attachment{
+			{MediaId: "attachments/1/a", MimeType: "audio/ogg", Size: 10, DurationMs: -1}}},
+		"attachments": {ChatId: 10, Attachments: make([]Messages.Attachment, protocol.MaxAttachments+1)},
+	}
+	for field, payload := range invalid {
+		expectProtocolError(t, payload.Validate(), protocol.CodeInvalidField, field)
+	}
+}
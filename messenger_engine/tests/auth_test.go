@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	messagecontroller "messenger_engine/controllers/message_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/parsers"
+	"shared/auth"
+)
+
+// testAuthConfig returns a verification config backed by a locally generated key.
+func testAuthConfig() *auth.Config {
+	return &auth.Config{Secret: []byte("test-secret"), Leeway: time.Second}
+}
+
+// signTestToken issues a token for the given user that expires in an hour.
+func signTestToken(t *testing.T, config *auth.Config, userID int) string {
+	t.Helper()
+	token, err := auth.SignToken(auth.Claims{UserId: userID, ExpiresAt: time.Now().Add(time.Hour).Unix()}, config.Secret)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+// TestVerifyToken_Valid verifies that a correctly signed token yields its user ID.
+func TestVerifyToken_Valid(t *testing.T) {
+	config := testAuthConfig()
+	token := signTestToken(t, config, 42)
+
+	claims, err := auth.VerifyToken(token, config, time.Now())
+	if err != nil {
+		t.Fatalf("VerifyToken() returned an unexpected error: %v", err)
+	}
+	userID, err := claims.UserID()
+	if err != nil || userID != 42 {
+		t.Errorf("expected user 42, got %d (%v)", userID, err)
+	}
+}
+
+// TestVerifyToken_SubjectClaim verifies that the user ID can be carried in "sub".
+func TestVerifyToken_SubjectClaim(t *testing.T) {
+	config := testAuthConfig()
+	token, _ := auth.SignToken(auth.Claims{Subject: "7", ExpiresAt: time.Now().Add(time.Hour).Unix()}, config.Secret)
+
+	claims, err := auth.VerifyToken(token, config, time.Now())
+	if err != nil {
+		t.Fatalf("VerifyToken() returned an unexpected error: %v", err)
+	}
+	if userID, _ := claims.UserID(); userID != 7 {
+		t.Errorf("expected user 7, got %d", userID)
+	}
+}
+
+// TestVerifyToken_Rejected verifies that tampered, expired, unexpiring and foreign tokens are rejected.
+func TestVerifyToken_Rejected(t *testing.T) {
+	config := testAuthConfig()
+
+	foreign, _ := auth.SignToken(auth.Claims{UserId: 1}, []byte("other-secret"))
+	expired, _ := auth.SignToken(auth.Claims{UserId: 1, ExpiresAt: time.Now().Add(-time.Hour).Unix()}, config.Secret)
+	unsigned := "eyJhbGciOiJub25lIn0.eyJ1c2VyX2lkIjoxfQ."
+	unexpiring, _ := auth.SignToken(auth.Claims{UserId: 1}, config.Secret)
+
+	cases := map[string]struct {
+		token string
+		want  error
+	}{
+		"foreign key": {foreign, auth.ErrInvalidSignature},
+		"expired":     {expired, auth.ErrExpiredToken},
+		"without exp": {unexpiring, auth.ErrInvalidClaims},
+		"alg none":    {unsigned, auth.ErrMalformedToken},
+		"garbage":     {"not-a-token", auth.ErrMalformedToken},
+	}
+
+	for name, tc := range cases {
+		if _, err := auth.VerifyToken(tc.token, config, time.Now()); !errors.Is(err, tc.want) {
+			t.Errorf("%s: expected %v, got %v", name, tc.want, err)
+		}
+	}
+}
+
+// TestAuthenticate_HeaderAndQuery verifies that the token is read from the
+// Authorization header and from the "token" query parameter.
+func TestAuthenticate_HeaderAndQuery(t *testing.T) {
+	config := testAuthConfig()
+	authenticator := auth.NewAuthenticator(config)
+	token := signTestToken(t, config, 5)
+
+	headerReq := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	headerReq.Header.Set("Authorization", "Bearer "+token)
+	if userID, err := authenticator.Authenticate(headerReq); err != nil || userID != 5 {
+		t.Errorf("header: expected user 5, got %d (%v)", userID, err)
+	}
+
+	queryReq := httptest.NewRequest(http.MethodGet, "/chat?token="+url.QueryEscape(token), nil)
+	if userID, err := authenticator.Authenticate(queryReq); err != nil || userID != 5 {
+		t.Errorf("query: expected user 5, got %d (%v)", userID, err)
+	}
+
+	missingReq := httptest.NewRequest(http.MethodGet, "/chat", nil)
+	if _, err := authenticator.Authenticate(missingReq); !errors.Is(err, auth.ErrMissingToken) {
+		t.Errorf("expected ErrMissingToken, got %v", err)
+	}
+}
+
+// TestResolveUserID verifies that spoofed user IDs are rejected and omitted ones are filled in.
+func TestResolveUserID(t *testing.T) {
+	parser := parsers.New()
+
+	if id, err := parser.ResolveUserID(0, 3); err != nil || id != 3 {
+		t.Errorf("expected omitted ID to resolve to 3, got %d (%v)", id, err)
+	}
+	if id, err := parser.ResolveUserID(3, 3); err != nil || id != 3 {
+		t.Errorf("expected matching ID to resolve to 3, got %d (%v)", id, err)
+	}
+	if _, err := parser.ResolveUserID(4, 3); !errors.Is(err, parsers.ErrIdentityMismatch) {
+		t.Errorf("expected ErrIdentityMismatch, got %v", err)
+	}
+	if id, _ := parser.ResolveUserID(4, 0); id != 4 {
+		t.Errorf("expected unauthenticated connection to keep claimed ID, got %d", id)
+	}
+}
+
+// TestChatMessageHandler_RejectsUnauthenticatedHandshake verifies that the chat socket
+// refuses to upgrade without a valid token and accepts a signed one.
+func TestChatMessageHandler_RejectsUnauthenticatedHandshake(t *testing.T) {
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messagecontroller.MessageController{}, broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	wsURL := "ws" + server.URL[4:]
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err == nil {
+		t.Fatalf("expected handshake without token to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 response, got %v", resp)
+	}
+
+	header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, 1)}}
+	ws, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("expected authenticated handshake to succeed: %v", err)
+	}
+	ws.Close()
+}
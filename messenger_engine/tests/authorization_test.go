@@ -0,0 +1,270 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"shared/auth"
+)
+
+// stubAuthorizer lets users into the chats listed for them.
+type stubAuthorizer map[int][]int
+
+func (s stubAuthorizer) IsParticipant(userId, chatId int) (bool, error) {
+	for _, allowed := range s[userId] {
+		if allowed == chatId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s stubAuthorizer) CanPost(userId, chatId int) (bool, error) {
+	return s.IsParticipant(userId, chatId)
+}
+
+// TestIsParticipant verifies that reads and posts are limited to the members of a chat, so
+// nobody can post to a chat that does not exist.
+func TestIsParticipant(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM base_chat_member WHERE chat_id = \\$1 AND user_id = \\$2\\)").WithArgs(10, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM base_chat_member WHERE chat_id = \\$1 AND user_id = \\$2\\)").WithArgs(99, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	ctrl := newTestChatController(db)
+	if participant, err := ctrl.IsParticipant(1, 10); err != nil || !participant {
+		t.Errorf("IsParticipant() = %v, %v; want true, nil", participant, err)
+	}
+	if allowed, err := ctrl.CanPost(1, 99); err != nil || allowed {
+		t.Errorf("CanPost() = %v, %v; want false, nil", allowed, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_UnknownChat verifies that messages to a chat that does not exist are
+// rejected instead of being stored where nobody could read them: as forbidden by the chat
+// membership check, and as not found where no Authorizer is configured.
+func TestChatMessageHandler_UnknownChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT EXISTS \\(SELECT 1 FROM base_chat_member").WithArgs(99, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT id, title, avatar_url, COALESCE\\(creator_id, 0\\), is_group, created_at FROM base_chat WHERE id = \\$1").WithArgs(99).
+		WillReturnRows(sqlmock.NewRows(chatColumns))
+
+	config := testAuthConfig()
+	header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, 1)}}
+	for _, tc := range []struct {
+		authorizer chatmessagehandler.ChatAuthorizer
+		code       protocol.Code
+	}{
+		{newTestChatController(db), protocol.CodeForbidden},
+		{nil, protocol.CodeNotFound},
+	} {
+		handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+		handler.Authenticator = auth.NewAuthenticator(config)
+		handler.ChatCtrl = newTestChatController(db)
+		handler.Authorizer = tc.authorizer
+		server := httptest.NewServer(handler)
+		defer server.Close()
+
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		defer ws.Close()
+
+		ws.WriteJSON(map[string]interface{}{
+			"type": "message", "version": protocol.Version, "request_id": "r",
+			"payload": map[string]interface{}{"chat_id": 99, "message": "Hi"},
+		})
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var errorFrame protocol.ErrorFrame
+		if err := ws.ReadJSON(&errorFrame); err != nil {
+			t.Fatalf("failed to read error frame: %v", err)
+		}
+		if errorFrame.Type != "error" || errorFrame.Error.Code != tc.code {
+			t.Errorf("expected a %s error for a message to an unknown chat, got %+v", tc.code, errorFrame)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_Forbidden verifies that loads, resumes and sends of chats the user
+// does not take part in are answered with forbidden error frames, without subscribing the
+// client or touching the database.
+func TestChatMessageHandler_Forbidden(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcaster)
+	handler.Authorizer = stubAuthorizer{}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	frames := []map[string]interface{}{
+		{"type": "initial", "version": 1, "request_id": "r-1", "payload": map[string]interface{}{"chat_id": 10}},
+		{"type": "history", "version": 1, "request_id": "r-2", "payload": map[string]interface{}{"chat_id": 10}},
+		{"type": "resume", "version": 1, "request_id": "r-3", "payload": map[string]interface{}{"chats": []map[string]int{{"chat_id": 10}}}},
+		{"type": "message", "version": 1, "request_id": "r-4", "payload": map[string]interface{}{"chat_id": 10, "author_id": 1, "message": "Hi"}},
+		{"type": "message_reply", "version": 1, "request_id": "r-5", "payload": map[string]interface{}{"chat_id": 10, "author_id": 1, "message": "Hi", "parent_message_id": 1}},
+	}
+	for _, frame := range frames {
+		if err := ws.WriteJSON(frame); err != nil {
+			t.Fatalf("failed to write JSON: %v", err)
+		}
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var errorFrame protocol.ErrorFrame
+		if err := ws.ReadJSON(&errorFrame); err != nil {
+			t.Fatalf("failed to read error frame: %v", err)
+		}
+		if errorFrame.Type != "error" || errorFrame.RequestId != frame["request_id"] || errorFrame.Error.Code != protocol.CodeForbidden {
+			t.Errorf("expected a forbidden error for %s, got %+v", frame["type"], errorFrame)
+		}
+	}
+
+	if subscribers := broadcaster.Subscribers(10); len(subscribers) != 0 {
+		t.Errorf("expected no subscription to a forbidden chat, got %d subscribers", len(subscribers))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unexpected database access: %v", err)
+	}
+}
+
+// TestChatMessageHandler_RevisionsOfForeignChat verifies that the edit history of a message in a
+// chat the user does not take part in is answered like that of an unknown message, without
+// loading the revisions.
+func TestChatMessageHandler_RevisionsOfForeignChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT chat_id FROM base_chatmessage WHERE id = \\$1").WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id"}).AddRow(10))
+	mock.ExpectQuery("SELECT chat_id FROM base_chatmessage WHERE id = \\$1").WithArgs(6).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id"}))
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	handler.Authorizer = stubAuthorizer{1: {20}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, 1)}}
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	var errorFrames []protocol.ErrorFrame
+	for _, messageId := range []int{5, 6} {
+		ws.WriteJSON(map[string]interface{}{
+			"type": "message_revisions", "version": protocol.Version, "request_id": "r",
+			"payload": map[string]interface{}{"message_id": messageId},
+		})
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var errorFrame protocol.ErrorFrame
+		if err := ws.ReadJSON(&errorFrame); err != nil {
+			t.Fatalf("failed to read error frame: %v", err)
+		}
+		errorFrames = append(errorFrames, errorFrame)
+	}
+
+	if errorFrames[0].Type != "error" || errorFrames[0].Error.Code != protocol.CodeNotFound {
+		t.Errorf("expected a not found error for a message of a foreign chat, got %+v", errorFrames[0])
+	}
+	if errorFrames[0].Error != errorFrames[1].Error {
+		t.Errorf("expected foreign and unknown messages to be answered alike, got %+v and %+v", errorFrames[0].Error, errorFrames[1].Error)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_RemovedMemberChanges verifies that authors who no longer take part in
+// a chat cannot edit or delete the messages they wrote there.
+func TestChatMessageHandler_RemovedMemberChanges(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT chat_id FROM base_chatmessage WHERE id = \\$1").WithArgs(5).
+			WillReturnRows(sqlmock.NewRows([]string{"chat_id"}).AddRow(10))
+	}
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	handler.Authorizer = stubAuthorizer{1: {20}}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, 1)}}
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	frames := []map[string]interface{}{
+		{"type": "message_edit", "version": protocol.Version, "request_id": "r-1", "payload": map[string]interface{}{"message_id": 5, "message": "Edited"}},
+		{"type": "message_delete", "version": protocol.Version, "request_id": "r-2", "payload": map[string]interface{}{"message_id": 5, "for_everyone": true}},
+	}
+	for _, frame := range frames {
+		if err := ws.WriteJSON(frame); err != nil {
+			t.Fatalf("failed to write JSON: %v", err)
+		}
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var errorFrame protocol.ErrorFrame
+		if err := ws.ReadJSON(&errorFrame); err != nil {
+			t.Fatalf("failed to read error frame: %v", err)
+		}
+		if errorFrame.Type != "error" || errorFrame.RequestId != frame["request_id"] || errorFrame.Error.Code != protocol.CodeForbidden {
+			t.Errorf("expected a forbidden error for %s, got %+v", frame["type"], errorFrame)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	"messenger_engine/models/chat"
+	"messenger_engine/models/event"
+	"messenger_engine/models/message"
+	"messenger_engine/modules/backplane"
+)
+
+// TestMemoryBackplane_DeliversToOtherInstances verifies that events reach every other
+// instance joined to the hub but are not echoed back to the publisher.
+func TestMemoryBackplane_DeliversToOtherInstances(t *testing.T) {
+	hub := backplane.NewMemoryHub()
+	first, second := hub.Join(), hub.Join()
+
+	if err := first.Publish(event.Event{Type: event.MessageCreated, ChatId: 3}); err != nil {
+		t.Fatalf("Publish() returned an unexpected error: %v", err)
+	}
+
+	select {
+	case ev := <-second.Events():
+		if ev.ChatId != 3 {
+			t.Errorf("Expected event of chat 3, got %d", ev.ChatId)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Other instance did not receive the event")
+	}
+
+	select {
+	case ev := <-first.Events():
+		t.Errorf("Publisher received its own event: %+v", ev)
+	default:
+	}
+}
+
+// TestMemoryBackplane_Close verifies that a closed instance stops publishing and receiving.
+func TestMemoryBackplane_Close(t *testing.T) {
+	hub := backplane.NewMemoryHub()
+	first, second := hub.Join(), hub.Join()
+	second.Close()
+
+	if _, ok := <-second.Events(); ok {
+		t.Errorf("Expected the event stream of a closed instance to be closed")
+	}
+	if err := second.Publish(event.Event{}); err != backplane.ErrBackplaneClosed {
+		t.Errorf("Expected ErrBackplaneClosed, got %v", err)
+	}
+	if err := first.Publish(event.Event{}); err != nil {
+		t.Errorf("Publishing with a detached peer returned an error: %v", err)
+	}
+}
+
+// TestBroadcast_CrossInstanceFanOut verifies that a message published on one
+// instance reaches the subscribers connected to another instance.
+func TestBroadcast_CrossInstanceFanOut(t *testing.T) {
+	hub := backplane.NewMemoryHub()
+	config := broadcastcontroller.DefaultConfig()
+	instanceA := broadcastcontroller.NewBroadcasterWithBackplane(config, hub.Join())
+	instanceB := broadcastcontroller.NewBroadcasterWithBackplane(config, hub.Join())
+	go instanceA.HandleMessages(nil)
+	go instanceB.HandleMessages(nil)
+
+	localConn, localPeer := newConnPair(t)
+	remoteConn, remotePeer := newConnPair(t)
+	instanceA.Subscribe(instanceA.RegisterClient(localConn), 5)
+	instanceB.Subscribe(instanceB.RegisterClient(remoteConn), 5)
+
+	instanceA.BroadcastMessage(message.FinalMessage{Type: "message", Message: message.Message{MessageId: 9, ChatId: 5, Message: "Hi"}})
+
+	for name, peer := range map[string]*websocket.Conn{"local": localPeer, "remote": remotePeer} {
+		peer.SetReadDeadline(time.Now().Add(time.Second))
+		var received message.FinalMessage
+		if err := peer.ReadJSON(&received); err != nil {
+			t.Fatalf("%s subscriber failed to read message: %v", name, err)
+		}
+		if received.Type != "message" || received.Message.MessageId != 9 || received.Message.Message != "Hi" {
+			t.Errorf("%s subscriber received unexpected message: %+v", name, received)
+		}
+	}
+}
+
+// TestBroadcast_CrossInstanceMemberRemoval verifies that a member removed on one instance
+// is unsubscribed from the chat on another instance and stops receiving its messages there.
+func TestBroadcast_CrossInstanceMemberRemoval(t *testing.T) {
+	hub := backplane.NewMemoryHub()
+	config := broadcastcontroller.DefaultConfig()
+	instanceA := broadcastcontroller.NewBroadcasterWithBackplane(config, hub.Join())
+	instanceB := broadcastcontroller.NewBroadcasterWithBackplane(config, hub.Join())
+	go instanceA.HandleMessages(nil)
+	go instanceB.HandleMessages(nil)
+
+	remoteConn, remotePeer := newConnPair(t)
+	remoteClient := instanceB.RegisterClient(remoteConn)
+	instanceB.Identify(remoteClient, 7)
+	instanceB.Subscribe(remoteClient, 5)
+
+	instanceA.Publish(event.Event{
+		Type:   event.ChatUpdated,
+		ChatId: 5,
+		Payload: chat.ChatUpdate{
+			Type:    string(event.ChatUpdated),
+			Action:  chat.ActionMemberRemoved,
+			ActorId: 1,
+			UserId:  7,
+			Chat:    chat.Chat{ChatId: 5},
+		},
+		Recipients: []int{1, 7},
+	})
+
+	// The removed user is still told about the removal
+	remotePeer.SetReadDeadline(time.Now().Add(time.Second))
+	var update chat.ChatUpdate
+	if err := remotePeer.ReadJSON(&update); err != nil || update.Action != chat.ActionMemberRemoved {
+		t.Fatalf("expected member_removed update, got %+v (%v)", update, err)
+	}
+	if instanceB.IsSubscribed(remoteClient, 5) {
+		t.Errorf("removed member is still subscribed on the other instance")
+	}
+
+	instanceA.BroadcastMessage(message.FinalMessage{Type: "message", Message: message.Message{MessageId: 9, ChatId: 5, Message: "Hi"}})
+
+	remotePeer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var received message.FinalMessage
+	if err := remotePeer.ReadJSON(&received); err == nil {
+		t.Errorf("removed member received a message of the chat: %+v", received)
+	}
+}
@@ -1,95 +1,296 @@
 package tests
 
 import (
-	"net/http"
 	"messenger_engine/controllers/broadcast_controller"
 	"messenger_engine/models/message"
+	"net/http"
 	"net/http/httptest"
-	"sync"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-// TestRegisterClient verifies that a WebSocket client can successfully connect 
-// and be registered in the broadcaster's client list.
-func TestRegisterClient(t *testing.T) {
-	broadcaster := broadcastcontroller.NewBroadcaster()
+// newConnPair starts a test WebSocket server and returns the server-side connection
+// together with the client connected to it.
+func newConnPair(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+
+	serverConns := make(chan *websocket.Conn, 1)
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		conn, _ := websocket.Upgrade(w, r, nil, 1024, 1024)
-		broadcaster.RegisterClient(conn)
+		conn, err := websocket.Upgrade(w, r, nil, 1024, 1024)
+		if err != nil {
+			t.Errorf("Failed to upgrade connection: %v", err)
+			return
+		}
+		serverConns <- conn
 	}))
-	defer server.Close()
+	t.Cleanup(server.Close)
 
 	wsURL := "ws" + server.URL[4:]
 	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	if err != nil {
 		t.Fatalf("Failed to connect WebSocket: %v", err)
 	}
-	defer client.Close()
+	t.Cleanup(func() { client.Close() })
+
+	select {
+	case conn := <-serverConns:
+		t.Cleanup(func() { conn.Close() })
+		return conn, client
+	case <-time.After(time.Second):
+		t.Fatalf("Timeout waiting for server-side connection")
+	}
+	return nil, nil
+}
+
+// TestRegisterClient verifies that a WebSocket client can successfully connect
+// and be registered in the broadcaster's client list.
+func TestRegisterClient(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	conn, _ := newConnPair(t)
+
+	client := broadcaster.RegisterClient(conn)
 
 	if _, exists := broadcaster.Clients[client]; !exists {
 		t.Errorf("Client was not registered correctly")
 	}
+	if client.Conn != conn {
+		t.Errorf("Client does not wrap the registered connection")
+	}
 }
 
-// TestBroadcastMessage verifies that a message sent via the broadcaster is 
-// received by the connected WebSocket clients.
+// TestBroadcastMessage verifies that a message sent via the broadcaster is
+// received by the clients subscribed to the message's chat.
 func TestBroadcastMessage(t *testing.T) {
 	broadcaster := broadcastcontroller.NewBroadcaster()
-	var wg sync.WaitGroup
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		conn, _ := websocket.Upgrade(w, r, nil, 1024, 1024)
-		broadcaster.RegisterClient(conn)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			var receivedMsg message.FinalMessage
-			err := conn.ReadJSON(&receivedMsg)
-			if err != nil {
-				t.Errorf("Failed to read message: %v", err)
-			}
-		}()
-	}))
-	defer server.Close()
+	go broadcaster.HandleMessages(nil)
 
-	wsURL := "ws" + server.URL[4:]
-	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		t.Fatalf("Failed to connect WebSocket: %v", err)
-	}
-	defer client.Close()
+	conn, peer := newConnPair(t)
+	broadcaster.Subscribe(broadcaster.RegisterClient(conn), 7)
 
 	msg := message.FinalMessage{
 		Type: "message",
-		Message: message.Message{ 
+		Message: message.Message{
 			Message: "Hello, World!",
+			ChatId:  7,
 		},
 	}
 	broadcaster.BroadcastMessage(msg)
-	wg.Wait()
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	var receivedMsg message.FinalMessage
+	if err := peer.ReadJSON(&receivedMsg); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if receivedMsg.Message.Message != "Hello, World!" {
+		t.Errorf("Expected 'Hello, World!', got %q", receivedMsg.Message.Message)
+	}
 }
 
-// TestRemoveClient verifies that a WebSocket client is properly removed from the 
-// broadcaster's client list and its connection is closed.
-func TestRemoveClient(t *testing.T) {
+// TestBroadcastReplyMessage verifies that replies are delivered to the chat
+// subscribers through the same event stream as plain messages, in publish order.
+func TestBroadcastReplyMessage(t *testing.T) {
 	broadcaster := broadcastcontroller.NewBroadcaster()
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		conn, _ := websocket.Upgrade(w, r, nil, 1024, 1024)
-		broadcaster.RegisterClient(conn)
-		broadcaster.RemoveClient(conn)
-	}))
-	defer server.Close()
+	go broadcaster.HandleMessages(nil)
 
-	wsURL := "ws" + server.URL[4:]
-	client, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		t.Fatalf("Failed to connect WebSocket: %v", err)
+	conn, peer := newConnPair(t)
+	broadcaster.Subscribe(broadcaster.RegisterClient(conn), 7)
+
+	broadcaster.BroadcastMessage(message.FinalMessage{Type: "message", Message: message.Message{MessageId: 1, ChatId: 7}})
+	broadcaster.BroadcastReplyMessage(message.FinalMessageReply{
+		Type:    "message_reply",
+		Message: message.MessageReply{MessageId: 2, ChatId: 7, Message: "Reply", ParentMessageId: 1},
+	})
+
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	var first message.FinalMessage
+	if err := peer.ReadJSON(&first); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if first.Type != "message" {
+		t.Errorf("Expected the message first, got %q", first.Type)
+	}
+
+	var reply message.FinalMessageReply
+	if err := peer.ReadJSON(&reply); err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if reply.Type != "message_reply" || reply.Message.ParentMessageId != 1 {
+		t.Errorf("Unexpected reply: %+v", reply)
+	}
+}
+
+// TestBroadcastMessage_OtherChat verifies that clients do not receive messages
+// of chats they are not subscribed to.
+func TestBroadcastMessage_OtherChat(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	go broadcaster.HandleMessages(nil)
+
+	subscribed, subscribedPeer := newConnPair(t)
+	outsider, outsiderPeer := newConnPair(t)
+	broadcaster.Subscribe(broadcaster.RegisterClient(subscribed), 1)
+	broadcaster.Subscribe(broadcaster.RegisterClient(outsider), 2)
+
+	broadcaster.BroadcastMessage(message.FinalMessage{Type: "message", Message: message.Message{ChatId: 1}})
+
+	subscribedPeer.SetReadDeadline(time.Now().Add(time.Second))
+	var receivedMsg message.FinalMessage
+	if err := subscribedPeer.ReadJSON(&receivedMsg); err != nil {
+		t.Fatalf("Subscribed client failed to read message: %v", err)
+	}
+
+	outsiderPeer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := outsiderPeer.ReadJSON(&receivedMsg); err == nil {
+		t.Errorf("Client of another chat received message: %+v", receivedMsg)
 	}
-	defer client.Close()
+}
+
+// TestSubscribe_MultipleChats verifies that one connection can be subscribed
+// to several chats and that unsubscribing from one keeps the others.
+func TestSubscribe_MultipleChats(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	conn, _ := newConnPair(t)
+	client := broadcaster.RegisterClient(conn)
+
+	broadcaster.Subscribe(client, 1)
+	broadcaster.Subscribe(client, 2)
+
+	if len(broadcaster.Subscriptions(client)) != 2 {
+		t.Fatalf("Expected 2 subscriptions, got %v", broadcaster.Subscriptions(client))
+	}
+
+	broadcaster.Unsubscribe(client, 1)
+
+	if broadcaster.IsSubscribed(client, 1) {
+		t.Errorf("Client is still subscribed to chat 1")
+	}
+	if !broadcaster.IsSubscribed(client, 2) {
+		t.Errorf("Client lost its subscription to chat 2")
+	}
+	if _, exists := broadcaster.Clients[client]; !exists {
+		t.Errorf("Unsubscribe should not unregister the client")
+	}
+	if len(broadcaster.Subscribers(1)) != 0 {
+		t.Errorf("Expected no subscribers for chat 1, got %d", len(broadcaster.Subscribers(1)))
+	}
+}
+
+// TestRemoveClient verifies that a WebSocket client is properly removed from the
+// broadcaster's client list, loses its subscriptions and its connection is closed.
+func TestRemoveClient(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	conn, _ := newConnPair(t)
+
+	client := broadcaster.RegisterClient(conn)
+	broadcaster.Subscribe(client, 3)
+	broadcaster.RemoveClient(client)
 
 	if _, exists := broadcaster.Clients[client]; exists {
 		t.Errorf("Client was not removed correctly")
 	}
+	if broadcaster.IsSubscribed(client, 3) {
+		t.Errorf("Client subscriptions were not removed")
+	}
+	if len(broadcaster.Subscriptions(client)) != 0 {
+		t.Errorf("Expected no subscriptions after removal")
+	}
+	if err := client.WriteJSON("late"); err != broadcastcontroller.ErrClientClosed {
+		t.Errorf("Expected ErrClientClosed after removal, got %v", err)
+	}
+
+	// A late subscription must not resurrect a removed client.
+	broadcaster.Subscribe(client, 4)
+	if broadcaster.IsSubscribed(client, 4) {
+		t.Errorf("Removed client was subscribed again")
+	}
+}
+
+// floodSlowConsumer broadcasts payloads far larger than the socket buffers to a peer
+// that never reads, so the client's writer blocks and its queue fills up.
+func floodSlowConsumer(t *testing.T, policy broadcastcontroller.SlowConsumerPolicy) (*broadcastcontroller.Broadcast, *broadcastcontroller.Client) {
+	t.Helper()
+
+	broadcaster := broadcastcontroller.NewBroadcasterWithConfig(broadcastcontroller.Config{
+		QueueSize: 1,
+		Policy:    policy,
+	})
+	go broadcaster.HandleMessages(nil)
+
+	conn, _ := newConnPair(t)
+	slow := broadcaster.RegisterClient(conn)
+	broadcaster.Subscribe(slow, 1)
+
+	big := strings.Repeat("x", 32<<20)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 4; i++ {
+			broadcaster.BroadcastMessage(message.FinalMessage{Type: "message", Message: message.Message{ChatId: 1, Message: big}})
+		}
+		close(done)
+	}()
+
+	// Fan-out must never block on the slow client's network I/O.
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Broadcast blocked on a slow consumer")
+	}
+	return broadcaster, slow
+}
+
+// TestSlowConsumer_Evicted verifies that, with the evict policy, a client whose queue
+// overflows is disconnected and unsubscribed.
+func TestSlowConsumer_Evicted(t *testing.T) {
+	broadcaster, slow := floodSlowConsumer(t, broadcastcontroller.EvictSlowConsumer)
+
+	select {
+	case <-slow.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Slow consumer was not evicted")
+	}
+	if broadcaster.IsSubscribed(slow, 1) {
+		t.Errorf("Evicted client is still subscribed")
+	}
+}
+
+// TestSlowConsumer_Dropped verifies that, with the drop policy, a client whose queue
+// overflows stays connected and only loses the payloads that did not fit.
+func TestSlowConsumer_Dropped(t *testing.T) {
+	broadcaster, slow := floodSlowConsumer(t, broadcastcontroller.DropForSlowConsumer)
+
+	if !broadcaster.IsSubscribed(slow, 1) {
+		t.Errorf("Slow consumer should stay subscribed with the drop policy")
+	}
+}
+
+// TestDisconnect_QueueFull verifies that a client whose queue is full is still disconnected,
+// without the close frame waiting behind the pending payloads.
+func TestDisconnect_QueueFull(t *testing.T) {
+	broadcaster, slow := floodSlowConsumer(t, broadcastcontroller.DropForSlowConsumer)
+
+	// The writer is stuck on a payload the peer never reads, so the queue fills up for good
+	deadline := time.Now().Add(5 * time.Second)
+	for slow.WriteJSON("ping") != broadcastcontroller.ErrQueueFull {
+		if time.Now().After(deadline) {
+			t.Fatalf("Client queue never filled up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := slow.Disconnect(websocket.ClosePolicyViolation, "rate limit exceeded"); err != nil {
+		t.Fatalf("Disconnect() returned an unexpected error: %v", err)
+	}
+
+	select {
+	case <-slow.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Client with a full queue was not disconnected")
+	}
+	if broadcaster.ClientCount() != 0 || broadcaster.IsSubscribed(slow, 1) {
+		t.Errorf("Disconnected client is still registered")
+	}
+	if err := slow.Disconnect(websocket.ClosePolicyViolation, "rate limit exceeded"); err != broadcastcontroller.ErrClientClosed {
+		t.Errorf("Expected ErrClientClosed for a removed client, got %v", err)
+	}
 }
@@ -1,36 +1,54 @@
 package tests
 
 import (
-	"encoding/json"
+	"context"
 	"errors"
-	"messenger_engine/controllers/chat_controller"
-	"messenger_engine/controllers/url_controller"
-	"messenger_engine/models/presigned_url"
 	"messenger_engine/controllers/base_controller"
+	"messenger_engine/controllers/chat_controller"
+	"messenger_engine/models/chat"
 	"messenger_engine/modules/database/database"
+	"shared/urlresolver"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
 )
 
-// MockUrlFetcher is a struct for mocking the presigned URL fetch request.
-type MockUrlFetcher struct{}
+// MockUrlResolver is a struct for mocking the presigned URL resolver.
+type MockUrlResolver struct{}
 
-// Fetch simulates fetching a presigned URL and always returns a fixed URL.
-func (m *MockUrlFetcher) Fetch(url string) (*presignedurl.PresignedUrlResponse, error) {
-	return &presignedurl.PresignedUrlResponse{PresignedURL: "http://example.com/avatar.jpg"}, nil
+// Resolve simulates resolving presigned URLs and always returns a fixed URL.
+func (m *MockUrlResolver) Resolve(ctx context.Context, urls []string) map[string][]string {
+	resolved := make(map[string][]string, len(urls))
+	for _, url := range urls {
+		resolved[url] = []string{"http://example.com/avatar.jpg"}
+	}
+	return resolved
+}
+
+// inboxColumns are the columns GetUserChats scans, in order.
+var inboxColumns = []string{
+	"chat_id", "is_group", "title", "avatar_url",
+	"message_id", "content", "author_id", "timestamp", "is_deleted",
+	"last_activity_at", "unread_count", "participants",
+}
+
+// stubOnlineChecker reports the users listed in it as online.
+type stubOnlineChecker map[int]bool
+
+func (s stubOnlineChecker) IsOnline(userId int) bool {
+	return s[userId]
 }
 
 // TestGetUserChats verifies the successful execution of the GetUserChats method.
 //
 // Steps:
-//  1. Creates a mock database.
-//  2. Adds test data to the messages table.
-//  3. Calls `GetUserChats` and checks if the result is correct.
+//  1. Creates a mock database returning a 1:1 chat with a message and an empty group chat.
+//  2. Calls `GetUserChats` and checks the entries, the participants and the cursor.
 //
 // Expected result:
-//  - The function should return a valid JSON containing the chat data.
+//  - Every chat is returned with its latest message, its other participants and its unread count.
 func TestGetUserChats(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -38,34 +56,71 @@ func TestGetUserChats(t *testing.T) {
 	}
 	defer db.Close()
 
-	// Mock query response
-	mockRows := sqlmock.NewRows([]string{"content", "timestamp", "chat_id", "receiver_id", "receiver_username"}).
-		AddRow("Hello!", "2025-03-02T12:00:00Z", 1, 2, "Alice")
-	mock.ExpectQuery("SELECT ").WillReturnRows(mockRows)
-
-	// Initialize ChatController with a mock database and URL fetcher
-	baseController := &chatcontroller.ChatController{
-		BaseController: &basecontroller.BaseController{
-			Database: &database.Database{}, 
-		},
-		UrlFetcher: urlcontroller.HttpPresignedUrlFetcher{},
+	sentAt := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+	createdAt := sentAt.Add(-time.Hour)
+	mockRows := sqlmock.NewRows(inboxColumns).
+		AddRow(1, false, "", "", 7, "Hello!", 2, sentAt, false, sentAt, 3, `[{"user_id": 2, "username": "Alice"}]`).
+		AddRow(4, true, "Team", "", nil, nil, nil, nil, false, createdAt, 0, `[{"user_id": 2, "username": "Alice"}, {"user_id": 3, "username": "Bob"}]`)
+	mock.ExpectQuery("WITH user_chats AS (.+) ORDER BY i.last_activity_at DESC, i.chat_id DESC").
+		WithArgs(1, time.Time{}, 0, chatcontroller.DefaultInboxLimit+1).
+		WillReturnRows(mockRows)
+
+	ctrl := &chatcontroller.ChatController{
+		BaseController: &basecontroller.BaseController{Database: database.NewDatabaseFromConnection(db)},
+		Avatars:        &MockUrlResolver{},
+		Presence:       stubOnlineChecker{2: true},
 	}
 
-	baseController.Database.GetConnection()
-
 	// Execute the function and check for errors
-	result, err := baseController.GetUserChats(1)
-	assert.NoError(t, err)
-
-	// Unmarshal JSON response
-	var chats []map[string]interface{}
-	err = json.Unmarshal(result, &chats)
+	page, err := ctrl.GetUserChats(chat.InboxQuery{UserId: 1})
 	assert.NoError(t, err)
 
 	// Verify the content of the response
-	assert.Len(t, chats, 1)
-	assert.Equal(t, "Hello!", chats[0]["messge_content"])
-	assert.Equal(t, "http://example.com/avatar.jpg", chats[0]["user_avatar_url"])
+	assert.Len(t, page.Chats, 2)
+	direct, group := page.Chats[0], page.Chats[1]
+	assert.Equal(t, "Hello!", direct.LastMessage.Content)
+	assert.Equal(t, 3, direct.UnreadCount)
+	assert.Equal(t, "Alice", direct.Participants[0].Username)
+	assert.Equal(t, "http://example.com/avatar.jpg", direct.Participants[0].AvatarUrl)
+	assert.True(t, *direct.Participants[0].Online)
+
+	// Group chats carry their own avatar and no last message until someone posts
+	assert.Nil(t, group.LastMessage)
+	assert.Len(t, group.Participants, 2)
+	assert.Empty(t, group.Participants[0].AvatarUrl)
+	assert.False(t, *group.Participants[1].Online)
+
+	assert.False(t, page.HasMore)
+	assert.Equal(t, &chat.InboxCursor{LastActivityAt: createdAt, ChatId: 4}, page.NextCursor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestGetUserChats_Cursor verifies that GetUserChats continues after the cursor and detects further pages.
+func TestGetUserChats_Cursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create mock database: %v", err)
+	}
+	defer db.Close()
+
+	before := time.Date(2025, 3, 2, 12, 0, 0, 0, time.UTC)
+	active := before.Add(-time.Minute)
+	mock.ExpectQuery("WITH user_chats AS").
+		WithArgs(1, before, 9, 2).
+		WillReturnRows(sqlmock.NewRows(inboxColumns).
+			AddRow(8, false, "", "", 3, "a", 1, active, false, active, 0, `[]`).
+			AddRow(5, false, "", "", 2, "b", 2, active, true, active, 0, `[]`))
+
+	page, err := newTestChatController(db).GetUserChats(chat.InboxQuery{
+		UserId: 1,
+		Before: &chat.InboxCursor{LastActivityAt: before, ChatId: 9},
+		Limit:  1,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, page.Chats, 1)
+	assert.True(t, page.HasMore)
+	assert.Equal(t, 8, page.NextCursor.ChatId)
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
 // TestGetUserChats_QueryError verifies that GetUserChats handles query errors properly.
@@ -86,17 +141,15 @@ func TestGetUserChats_QueryError(t *testing.T) {
 	// Simulate a database query failure
 	mock.ExpectQuery("SELECT ").WillReturnError(errors.New("database error"))
 
-	// Initialize ChatController with a mock database and URL fetcher
+	// Initialize ChatController with a mock database and URL resolver
 	baseController := &chatcontroller.ChatController{
 		BaseController: &basecontroller.BaseController{
-			Database: &database.Database{}, 
+			Database: database.NewDatabaseFromConnection(db),
 		},
-		UrlFetcher: urlcontroller.HttpPresignedUrlFetcher{},
+		Avatars: urlresolver.New(urlresolver.DefaultConfig()),
 	}
 
-	baseController.Database.GetConnection()
-
 	// Execute the function and check for errors
-	_, err = baseController.GetUserChats(1)
+	_, err = baseController.GetUserChats(chat.InboxQuery{UserId: 1})
 	assert.Error(t, err)
 }
@@ -2,6 +2,7 @@
 package tests
 
 import (
+	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"testing"
@@ -10,8 +11,12 @@ import (
 	"messenger_engine/controllers/broadcast_controller" // assumed package path for broadcast type
 	"messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
 	"messenger_engine/controllers/message_controller"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/event"
 	"messenger_engine/models/message"
+	"shared/auth"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/websocket"
 )
 
@@ -26,29 +31,33 @@ func (d *DummyMessageController) SaveMessageReply(msg message.MessageReply) erro
 	return nil
 }
 
-func (d *DummyMessageController) LoadMessages(chatId int) ([]message.Message, error) {
+func (d *DummyMessageController) LoadMessages(query message.HistoryQuery) (message.HistoryPage, error) {
 	// Return one dummy message for testing.
-	return []message.Message{
+	return message.HistoryPage{Messages: []message.Message{
 		{
 			MessageId:  1,
 			Message:    "Hello",
 			AuthorId:   1,
-			ChatId:     chatId,
+			ChatId:     query.ChatId,
 			ReceiverId: 2,
 			Timestamp:  time.Now(),
 			IsEdited:   false,
 		},
-	}, nil
+	}}, nil
 }
 
 func TestChatMessageHandler_InitialMessage(t *testing.T) {
-	// Create dummy dependencies.
-	dummyMsgCtrl := &messagecontroller.MessageController{}
-	dummyBroadcast := &broadcastcontroller.Broadcast{
-		Clients:          make(map[*websocket.Conn]bool),
-		Broadcast:        make(chan message.FinalMessage, 1),
-		RepliesBroadcast: make(chan message.FinalMessageReply, 1),
+	// Create dummy dependencies backed by a mocked database holding one message.
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
 	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m").
+		WillReturnRows(sqlmock.NewRows(historyColumns).AddRow(1, "Hello", false, time.Now(), 1, 10, 2, false, nil, 1, "sent", nil, nil))
+
+	dummyMsgCtrl := newTestMessageController(db)
+	dummyBroadcast := broadcastcontroller.NewBroadcaster()
 	upgrader := websocket.Upgrader{}
 
 	// Create the ChatMessageHandler.
@@ -96,13 +105,26 @@ func TestChatMessageHandler_InitialMessage(t *testing.T) {
 }
 
 func TestChatMessageHandler_MessageAndReply(t *testing.T) {
-	// Create dummy dependencies.
-	dummyMsgCtrl := &messagecontroller.MessageController{}
-	dummyBroadcast := &broadcastcontroller.Broadcast{
-		Clients:          make(map[*websocket.Conn]bool),
-		Broadcast:        make(chan message.FinalMessage, 1),
-		RepliesBroadcast: make(chan message.FinalMessageReply, 1),
+	// Create dummy dependencies backed by a mocked database.
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
 	}
+	defer db.Close()
+	for id := 1; id <= 2; id++ {
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO base_chat_sequence").WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(id))
+		mock.ExpectQuery("INSERT INTO base_chatmessage").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(id))
+		if id == 2 {
+			// The reply's parent is message 1 of the same chat
+			mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(10, false))
+		}
+		mock.ExpectCommit()
+	}
+
+	dummyMsgCtrl := newTestMessageController(db)
+	dummyBroadcast := broadcastcontroller.NewBroadcaster()
 	upgrader := websocket.Upgrader{}
 	handler := chatmessagehandler.NewChatMessageHandler(upgrader, dummyMsgCtrl, dummyBroadcast)
 
@@ -141,9 +163,9 @@ func TestChatMessageHandler_MessageAndReply(t *testing.T) {
 	}
 	// The "message" type does not send a response directly. Instead, check the broadcast channel.
 	select {
-	case finalMsg := <-dummyBroadcast.Broadcast:
-		if finalMsg.Type != "message" {
-			t.Errorf("expected broadcast message type 'message', got: %s", finalMsg.Type)
+	case ev := <-dummyBroadcast.Events:
+		if ev.Type != event.MessageCreated || ev.ChatId != 10 {
+			t.Errorf("expected 'message' event for chat 10, got: %s for chat %d", ev.Type, ev.ChatId)
 		}
 	case <-time.After(time.Second):
 		t.Errorf("timeout waiting for broadcast message")
@@ -167,11 +189,215 @@ func TestChatMessageHandler_MessageAndReply(t *testing.T) {
 		t.Fatalf("failed to write JSON reply: %v", err)
 	}
 	select {
-	case finalReply := <-dummyBroadcast.RepliesBroadcast:
-		if finalReply.Type != "message_reply" {
-			t.Errorf("expected broadcast reply type 'message_reply', got: %s", finalReply.Type)
+	case ev := <-dummyBroadcast.Events:
+		if ev.Type != event.ReplyCreated || ev.ChatId != 10 {
+			t.Errorf("expected 'message_reply' event for chat 10, got: %s for chat %d", ev.Type, ev.ChatId)
+		}
+		if _, ok := ev.Payload.(message.FinalMessageReply); !ok {
+			t.Errorf("expected reply payload, got: %T", ev.Payload)
 		}
 	case <-time.After(time.Second):
 		t.Errorf("timeout waiting for broadcast reply")
 	}
 }
+
+// TestChatMessageHandler_Resume verifies that a "resume" frame subscribes the client
+// to the chat and replays the messages saved after the last message it saw.
+func TestChatMessageHandler_Resume(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	timestamp := time.Now()
+	mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m (.+) WHERE m.chat_id = \\$1 AND m.id > \\$3 ORDER BY m.id ASC LIMIT \\$4").
+		WithArgs(10, 0, 41, messagecontroller.MaxHistoryLimit+1).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(42, "missed", false, timestamp, 2, 10, 1, false, nil, 12, "sent", nil, nil).
+			AddRow(43, "missed too", false, timestamp, 2, 10, 1, false, nil, 13, "sent", nil, nil))
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcaster)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	request := map[string]interface{}{
+		"type":  "resume",
+		"chats": []map[string]interface{}{{"chat_id": 10, "last_message_id": 41}},
+	}
+	if err := ws.WriteJSON(request); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var response struct {
+		Type     string            `json:"type"`
+		ChatId   int               `json:"chat_id"`
+		Messages []message.Message `json:"messages"`
+		HasMore  bool              `json:"has_more"`
+	}
+	if err := ws.ReadJSON(&response); err != nil {
+		t.Fatalf("failed to read JSON response: %v", err)
+	}
+	if response.Type != "resume" || response.ChatId != 10 {
+		t.Errorf("expected resume frame for chat 10, got %q for chat %d", response.Type, response.ChatId)
+	}
+	if len(response.Messages) != 2 || response.Messages[0].MessageId != 42 || response.Messages[1].Seq != 13 {
+		t.Errorf("unexpected replayed messages: %+v", response.Messages)
+	}
+	if response.HasMore {
+		t.Errorf("expected the whole gap to fit in one page")
+	}
+	if len(broadcaster.Subscribers(10)) != 1 {
+		t.Errorf("expected the resumed client to be subscribed to chat 10")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_MessageAck verifies that a message tagged with a client_msg_id is
+// acknowledged to its sender, and that a retry is acknowledged again without a second broadcast.
+func TestChatMessageHandler_MessageAck(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	// First attempt is stored as message 42; the retry conflicts and maps to it.
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(7))
+	mock.ExpectQuery("INSERT INTO base_chatmessage").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(8))
+	mock.ExpectQuery("INSERT INTO base_chatmessage").WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT m.id, m.chat_id, m.seq, m.timestamp, at.attachments FROM base_chatmessage").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_id", "seq", "timestamp", "attachments"}).AddRow(42, 10, 7, time.Now(), nil))
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcaster)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	send := map[string]interface{}{
+		"type": "message",
+		"message": map[string]interface{}{
+			"MessageId":     float64(0),
+			"AuthorId":      float64(1),
+			"Timestamp":     float64(time.Now().Unix()),
+			"ReceiverId":    float64(2),
+			"Message":       "Hello",
+			"ChatId":        float64(10),
+			"IsEdited":      false,
+			"client_msg_id": "c-1",
+		},
+	}
+
+	for attempt, wantDuplicate := range []bool{false, true} {
+		if err := ws.WriteJSON(send); err != nil {
+			t.Fatalf("failed to write JSON: %v", err)
+		}
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var ack message.MessageAck
+		if err := ws.ReadJSON(&ack); err != nil {
+			t.Fatalf("attempt %d: failed to read ack: %v", attempt, err)
+		}
+		if ack.Type != "message_ack" || ack.ClientMsgId != "c-1" || ack.MessageId != 42 || ack.Seq != 7 {
+			t.Errorf("attempt %d: unexpected ack: %+v", attempt, ack)
+		}
+		if ack.Duplicate != wantDuplicate {
+			t.Errorf("attempt %d: expected duplicate=%v, got %v", attempt, wantDuplicate, ack.Duplicate)
+		}
+	}
+
+	// Only the first attempt reaches the event stream.
+	if len(broadcaster.Events) != 1 {
+		t.Errorf("expected exactly one broadcast event, got %d", len(broadcaster.Events))
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_DeleteForMe verifies that a message deleted only for its author is
+// hidden on every connection of the author, not just the one that deleted it.
+func TestChatMessageHandler_DeleteForMe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, is_edited, timestamp, author_id, chat_id, COALESCE\\(receiver_id, 0\\), parent_id, seq, is_deleted FROM base_chatmessage").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_edited", "timestamp", "author_id", "chat_id", "receiver_id", "parent_id", "seq", "is_deleted"}).
+			AddRow(5, false, time.Now(), 1, 10, 2, nil, 5, false))
+	mock.ExpectExec("INSERT INTO base_chatmessage_hidden").WithArgs(5, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, 1)}}
+	dial := func() *websocket.Conn {
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws
+	}
+
+	// A round trip guarantees the other device's connection is registered before the deletion
+	otherDevice := dial()
+	otherDevice.WriteJSON(map[string]interface{}{"type": "teleport", "version": protocol.Version, "payload": map[string]interface{}{}})
+	otherDevice.SetReadDeadline(time.Now().Add(time.Second))
+	var errorFrame protocol.ErrorFrame
+	if err := otherDevice.ReadJSON(&errorFrame); err != nil {
+		t.Fatalf("failed to read error frame: %v", err)
+	}
+
+	device := dial()
+	if err := device.WriteJSON(map[string]interface{}{
+		"type": "message_delete", "version": protocol.Version,
+		"payload": map[string]interface{}{"message_id": 5},
+	}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	for name, ws := range map[string]*websocket.Conn{"deleting device": device, "other device": otherDevice} {
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var deleted message.FinalMessage
+		if err := ws.ReadJSON(&deleted); err != nil {
+			t.Fatalf("%s failed to read the deletion: %v", name, err)
+		}
+		if deleted.Type != "message_deleted" || deleted.Message.MessageId != 5 {
+			t.Errorf("unexpected deletion on the %s: %+v", name, deleted)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -7,9 +7,10 @@ import (
 	"testing"
 
 	chathandler "messenger_engine/controllers/websocket_controller/handlers/chat_handler"
-	chatcontroller "messenger_engine/controllers/chat_controller"
 	errorhandler "messenger_engine/controllers/websocket_controller/handlers/error_handler"
+	"messenger_engine/models/chat"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/gorilla/websocket"
 )
 
@@ -17,9 +18,9 @@ import (
 // It provides a static JSON response for testing purposes.
 type DummyChatController struct{}
 
-// GetUserChats returns a dummy JSON response containing sample chat data.
-func (d *DummyChatController) GetUserChats(userID int) ([]byte, error) {
-	return []byte(`{"chats": ["chat1", "chat2"]}`), nil
+// GetUserChats returns a dummy inbox page containing sample chat data.
+func (d *DummyChatController) GetUserChats(query chat.InboxQuery) (chat.InboxPage, error) {
+	return chat.InboxPage{Chats: []chat.InboxEntry{{ChatId: 1}, {ChatId: 2}}}, nil
 }
 
 // DummyErrorHandler is a dummy implementation of an error handler for WebSocket errors.
@@ -36,11 +37,17 @@ func (d *DummyErrorHandler) HandleWebSocketError(err error, ws *websocket.Conn,
 // processes an incoming JSON message containing a user_id, and returns a response that
 // includes the expected "chats" key.
 func TestChatsHandler_ServeHTTP(t *testing.T) {
-	// NOTE: The implementation below uses a concrete ChatController.
+	// NOTE: The implementation below uses a concrete ChatController backed by a mocked database.
 	// If your design allows dependency injection via an interface,
 	// you can use &DummyChatController{} instead.
-	dummyChatCtrl := &chatcontroller.ChatController{}
-	handler := chathandler.NewChatsHandler(websocket.Upgrader{}, dummyChatCtrl)
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("WITH user_chats AS").WillReturnRows(sqlmock.NewRows(inboxColumns))
+
+	handler := chathandler.NewChatsHandler(websocket.Upgrader{}, newTestChatController(db))
 
 	// Assign the error handler. You can also use a dummy if needed:
 	// handler.ErrorHandler = &DummyErrorHandler{}
@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	messagecontroller "messenger_engine/controllers/message_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"shared/codec"
+)
+
+// dialChatMessageHandler starts a ChatMessageHandler and connects to it offering the given subprotocols.
+func dialChatMessageHandler(t *testing.T, subprotocols ...string) *websocket.Conn {
+	t.Helper()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messagecontroller.MessageController{}, broadcastcontroller.NewBroadcaster())
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	ws, _, err := dialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// TestCodec_ForSubprotocol verifies codec lookup, including the JSON fallback.
+func TestCodec_ForSubprotocol(t *testing.T) {
+	if got := codec.ForSubprotocol(codec.MsgpackSubprotocol); got != codec.Msgpack {
+		t.Errorf("expected the msgpack codec, got %s", got.Subprotocol())
+	}
+	for _, name := range []string{"", "protobuf.v1"} {
+		if got := codec.ForSubprotocol(name); got != codec.JSON {
+			t.Errorf("expected %q to fall back to JSON, got %s", name, got.Subprotocol())
+		}
+	}
+}
+
+// TestMsgpackCodec_RoundTrip verifies that msgpack frames use the JSON field names
+// and that pre-encoded JSON payloads are transcoded rather than sent as raw bytes.
+func TestMsgpackCodec_RoundTrip(t *testing.T) {
+	frame := protocol.ErrorFrame{Type: "error", Version: protocol.Version, RequestId: "r-1",
+		Error: protocol.ErrorBody{Code: protocol.CodeNotFound, Message: "missing"}}
+	data, err := codec.Msgpack.Marshal(frame)
+	if err != nil {
+		t.Fatalf("Marshal() returned an unexpected error: %v", err)
+	}
+	asJSON, err := codec.ToJSON(codec.Msgpack, data)
+	if err != nil {
+		t.Fatalf("ToJSON() returned an unexpected error: %v", err)
+	}
+	var decoded protocol.ErrorFrame
+	if err := json.Unmarshal(asJSON, &decoded); err != nil {
+		t.Fatalf("failed to decode transcoded frame: %v", err)
+	}
+	if decoded != frame {
+		t.Errorf("expected %+v, got %+v", frame, decoded)
+	}
+
+	data, err = codec.Msgpack.Marshal(json.RawMessage(`{"type":"message","chat_id":10}`))
+	if err != nil {
+		t.Fatalf("Marshal() returned an unexpected error: %v", err)
+	}
+	var event map[string]interface{}
+	if err := codec.Msgpack.Unmarshal(data, &event); err != nil {
+		t.Fatalf("Unmarshal() returned an unexpected error: %v", err)
+	}
+	if event["type"] != "message" {
+		t.Errorf("expected the raw JSON payload to be transcoded, got %v", event)
+	}
+}
+
+// TestChatMessageHandler_Msgpack verifies that a client negotiating msgpack.v1 can send
+// binary frames and receives its replies as binary msgpack frames. The first supported
+// subprotocol in the client's order of preference is selected.
+func TestChatMessageHandler_Msgpack(t *testing.T) {
+	ws := dialChatMessageHandler(t, "protobuf.v1", codec.MsgpackSubprotocol, codec.JSONSubprotocol)
+	if ws.Subprotocol() != codec.MsgpackSubprotocol {
+		t.Fatalf("expected %q to be negotiated, got %q", codec.MsgpackSubprotocol, ws.Subprotocol())
+	}
+
+	request, err := codec.Msgpack.Marshal(map[string]interface{}{
+		"type": "teleport", "version": 1, "request_id": "r-1", "payload": map[string]interface{}{},
+	})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	if err := ws.WriteMessage(websocket.BinaryMessage, request); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Errorf("expected a binary frame, got type %d", messageType)
+	}
+	var frame protocol.ErrorFrame
+	if err := codec.Msgpack.Unmarshal(data, &frame); err != nil {
+		t.Fatalf("failed to decode msgpack frame: %v", err)
+	}
+	if frame.RequestId != "r-1" || frame.Error.Code != protocol.CodeUnknownType {
+		t.Errorf("unexpected error frame: %+v", frame)
+	}
+}
+
+// TestChatMessageHandler_DefaultsToJSON verifies that clients offering no subprotocol keep receiving JSON text frames.
+func TestChatMessageHandler_DefaultsToJSON(t *testing.T) {
+	ws := dialChatMessageHandler(t)
+	if ws.Subprotocol() != "" {
+		t.Errorf("expected no subprotocol, got %q", ws.Subprotocol())
+	}
+
+	if err := ws.WriteJSON(map[string]interface{}{"type": "teleport", "version": 1, "payload": map[string]interface{}{}}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	messageType, data, err := ws.ReadMessage()
+	if err != nil {
+		t.Fatalf("failed to read frame: %v", err)
+	}
+	var frame protocol.ErrorFrame
+	if messageType != websocket.TextMessage || json.Unmarshal(data, &frame) != nil || frame.Error.Code != protocol.CodeUnknownType {
+		t.Errorf("expected a JSON text error frame, got type %d: %s", messageType, data)
+	}
+}
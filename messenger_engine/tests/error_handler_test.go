@@ -3,9 +3,11 @@ package tests
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"messenger_engine/controllers/websocket_controller/handlers/error_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
 )
 
 // DummyWS is a mock WebSocket connection that records messages sent via WriteJSON.
@@ -36,14 +38,41 @@ func TestHandleWebSocketError_WithWS(t *testing.T) {
 	if len(dummyWS.messages) == 0 {
 		t.Error("expected error message to be written to websocket, got none")
 	} else {
-		// Validate that the message is a map with an "error" field
-		msg, ok := dummyWS.messages[0].(map[string]string)
+		// Validate that the message is a structured error frame
+		frame, ok := dummyWS.messages[0].(protocol.ErrorFrame)
 		if !ok {
-			t.Error("expected message to be a map[string]string")
+			t.Fatalf("expected message to be a protocol.ErrorFrame, got %T", dummyWS.messages[0])
 		}
-		if msg["error"] == "" {
-			t.Error("expected non-empty error field in the message")
+		if frame.Type != "error" || frame.Error.Message != "Error: failed" {
+			t.Errorf("unexpected error frame: %+v", frame)
 		}
+		if frame.Error.Code != protocol.CodeInternal {
+			t.Errorf("expected unclassified errors to be reported as %q, got %q", protocol.CodeInternal, frame.Error.Code)
+		}
+	}
+}
+
+// TestHandleRequestError_Codes verifies that protocol errors keep their code and field,
+// that registered sentinel errors are mapped to their code and that the request ID is echoed.
+func TestHandleRequestError_Codes(t *testing.T) {
+	errNotFound := errors.New("not found")
+	eh := errorhandler.NewErrorHandler()
+	eh.RegisterCode(errNotFound, protocol.CodeNotFound)
+
+	dummyWS := &DummyWS{}
+	eh.HandleRequestError(protocol.InvalidField("chat_id", "is required"), dummyWS, "r-1", "Invalid: %s", "chat_id")
+	eh.HandleRequestError(fmt.Errorf("loading: %w", errNotFound), dummyWS, "r-2", "Missing")
+
+	if len(dummyWS.messages) != 2 {
+		t.Fatalf("expected 2 error frames, got %d", len(dummyWS.messages))
+	}
+	invalid := dummyWS.messages[0].(protocol.ErrorFrame)
+	if invalid.RequestId != "r-1" || invalid.Error.Code != protocol.CodeInvalidField || invalid.Error.Field != "chat_id" {
+		t.Errorf("unexpected invalid field frame: %+v", invalid)
+	}
+	missing := dummyWS.messages[1].(protocol.ErrorFrame)
+	if missing.RequestId != "r-2" || missing.Error.Code != protocol.CodeNotFound {
+		t.Errorf("unexpected not found frame: %+v", missing)
 	}
 }
 
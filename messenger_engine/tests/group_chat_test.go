@@ -0,0 +1,518 @@
+package tests
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	BaseController "messenger_engine/controllers/base_controller"
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	chatcontroller "messenger_engine/controllers/chat_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/chat"
+	"messenger_engine/models/event"
+	"messenger_engine/models/message"
+	"messenger_engine/modules/database/database"
+	"shared/auth"
+)
+
+// chatColumns and chatMemberColumns are the columns loadChat scans, in order.
+var (
+	chatColumns       = []string{"id", "title", "avatar_url", "creator_id", "is_group", "created_at"}
+	chatMemberColumns = []string{"user_id", "role", "joined_at"}
+)
+
+func newTestChatController(db *sql.DB) *chatcontroller.ChatController {
+	return &chatcontroller.ChatController{
+		BaseController: &BaseController.BaseController{Database: database.NewDatabaseFromConnection(db)},
+	}
+}
+
+// expectGroupChat expects a chat to be loaded with the given members, in join order.
+func expectGroupChat(mock sqlmock.Sqlmock, chatId int, members ...chat.Member) {
+	mock.ExpectQuery("SELECT id, title, avatar_url, COALESCE\\(creator_id, 0\\), is_group, created_at FROM base_chat WHERE id = \\$1").
+		WithArgs(chatId).
+		WillReturnRows(sqlmock.NewRows(chatColumns).AddRow(chatId, "Team", "", 1, true, time.Now()))
+	rows := sqlmock.NewRows(chatMemberColumns)
+	for _, member := range members {
+		rows.AddRow(member.UserId, string(member.Role), member.JoinedAt)
+	}
+	mock.ExpectQuery("SELECT user_id, role, joined_at FROM base_chat_member").WithArgs(chatId).WillReturnRows(rows)
+}
+
+// TestCreateChat verifies that the creator becomes the owner and that duplicate members are skipped.
+func TestCreateChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat \\(title, avatar_url, creator_id, is_group\\)").
+		WithArgs("Team", "", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(10, now))
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(10, 1, chat.RoleOwner).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(now))
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(10, 2, chat.RoleMember).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(now))
+	mock.ExpectCommit()
+
+	created, err := newTestChatController(db).CreateChat(1, " Team ", "", []int{2, 2, 1})
+	if err != nil {
+		t.Fatalf("CreateChat() returned an unexpected error: %v", err)
+	}
+	if created.ChatId != 10 || created.Title != "Team" || !created.IsGroup || len(created.Members) != 2 {
+		t.Errorf("unexpected chat: %+v", created)
+	}
+	if owner, _ := created.Member(1); owner.Role != chat.RoleOwner {
+		t.Errorf("expected the creator to own the chat, got %q", owner.Role)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestOpenDirectChat verifies that the first message between two users creates their 1:1 chat
+// under an ID taken from the chat sequence, with the author and receiver as members.
+func TestOpenDirectChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat \\(creator_id, is_group, direct_user_low, direct_user_high\\) (.+) ON CONFLICT \\(direct_user_low, direct_user_high\\)").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(25))
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(25, 2, chat.RoleOwner).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(now))
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(25, 1, chat.RoleMember).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(now))
+	mock.ExpectQuery("SELECT id, title, avatar_url, COALESCE\\(creator_id, 0\\), is_group, created_at FROM base_chat WHERE id = \\$1").
+		WithArgs(25).
+		WillReturnRows(sqlmock.NewRows(chatColumns).AddRow(25, "", "", 2, false, now))
+	mock.ExpectQuery("SELECT user_id, role, joined_at FROM base_chat_member").WithArgs(25).
+		WillReturnRows(sqlmock.NewRows(chatMemberColumns).AddRow(2, "owner", now).AddRow(1, "member", now))
+	mock.ExpectCommit()
+
+	opened, err := newTestChatController(db).OpenDirectChat(2, 1)
+	if err != nil {
+		t.Fatalf("OpenDirectChat() returned an unexpected error: %v", err)
+	}
+	if opened.ChatId != 25 || opened.IsGroup || len(opened.MemberIds()) != 2 {
+		t.Errorf("unexpected chat: %+v", opened)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestOpenDirectChat_Existing verifies that later messages between the same users, in either
+// direction, find their existing 1:1 chat instead of creating another one.
+func TestOpenDirectChat_Existing(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat \\(creator_id, is_group, direct_user_low, direct_user_high\\)").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery("SELECT id FROM base_chat WHERE NOT is_group AND direct_user_low = LEAST(.+) AND direct_user_high = GREATEST(.+)").
+		WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(25))
+	mock.ExpectQuery("SELECT id, title, avatar_url, COALESCE\\(creator_id, 0\\), is_group, created_at FROM base_chat WHERE id = \\$1").
+		WithArgs(25).
+		WillReturnRows(sqlmock.NewRows(chatColumns).AddRow(25, "", "", 2, false, now))
+	mock.ExpectQuery("SELECT user_id, role, joined_at FROM base_chat_member").WithArgs(25).
+		WillReturnRows(sqlmock.NewRows(chatMemberColumns).AddRow(2, "owner", now).AddRow(1, "member", now))
+	mock.ExpectCommit()
+
+	opened, err := newTestChatController(db).OpenDirectChat(1, 2)
+	if err != nil {
+		t.Fatalf("OpenDirectChat() returned an unexpected error: %v", err)
+	}
+	if opened.ChatId != 25 {
+		t.Errorf("expected the existing chat 25, got %+v", opened)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestAddMember_Roles verifies that plain members cannot add users and admins cannot add admins.
+func TestAddMember_Roles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	members := []chat.Member{{UserId: 1, Role: chat.RoleOwner}, {UserId: 2, Role: chat.RoleAdmin}, {UserId: 3, Role: chat.RoleMember}}
+	ctrl := newTestChatController(db)
+
+	for _, tc := range []struct {
+		actorId int
+		role    chat.Role
+	}{{3, chat.RoleMember}, {2, chat.RoleAdmin}} {
+		mock.ExpectBegin()
+		expectGroupChat(mock, 10, members...)
+		mock.ExpectRollback()
+
+		if _, err := ctrl.AddMember(tc.actorId, 10, 4, tc.role); !errors.Is(err, chatcontroller.ErrInsufficientRole) {
+			t.Errorf("user %d adding a %s: expected ErrInsufficientRole, got %v", tc.actorId, tc.role, err)
+		}
+	}
+
+	mock.ExpectBegin()
+	expectGroupChat(mock, 10, members...)
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(10, 4, chat.RoleMember).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+
+	updated, err := ctrl.AddMember(2, 10, 4, "")
+	if err != nil {
+		t.Fatalf("AddMember() returned an unexpected error: %v", err)
+	}
+	if _, ok := updated.Member(4); !ok {
+		t.Errorf("expected user 4 to be a member, got %+v", updated.Members)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestRemoveMember_AdminCannotRemoveAdmin verifies that members can only be removed by someone outranking them.
+func TestRemoveMember_AdminCannotRemoveAdmin(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectGroupChat(mock, 10, chat.Member{UserId: 1, Role: chat.RoleOwner}, chat.Member{UserId: 2, Role: chat.RoleAdmin}, chat.Member{UserId: 3, Role: chat.RoleAdmin})
+	mock.ExpectRollback()
+
+	if _, err := newTestChatController(db).RemoveMember(2, 10, 3); !errors.Is(err, chatcontroller.ErrInsufficientRole) {
+		t.Errorf("expected ErrInsufficientRole, got %v", err)
+	}
+}
+
+// TestLeaveChat_TransfersOwnership verifies that a leaving owner hands the chat to the oldest admin.
+func TestLeaveChat_TransfersOwnership(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	expectGroupChat(mock, 10, chat.Member{UserId: 1, Role: chat.RoleOwner}, chat.Member{UserId: 2, Role: chat.RoleMember}, chat.Member{UserId: 3, Role: chat.RoleAdmin})
+	mock.ExpectExec("DELETE FROM base_chat_member WHERE chat_id = \\$1 AND user_id = \\$2").WithArgs(10, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE base_chat_member SET role = \\$3").WithArgs(10, 3, chat.RoleOwner).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	updated, err := newTestChatController(db).LeaveChat(1, 10)
+	if err != nil {
+		t.Fatalf("LeaveChat() returned an unexpected error: %v", err)
+	}
+	if successor, _ := updated.Member(3); successor.Role != chat.RoleOwner {
+		t.Errorf("expected user 3 to own the chat, got %+v", updated.Members)
+	}
+	if _, ok := updated.Member(1); ok {
+		t.Errorf("expected user 1 to have left, got %+v", updated.Members)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBroadcast_Recipients verifies that events reach the connections of their recipients
+// without a subscription, and that subscribed recipients receive them only once.
+func TestBroadcast_Recipients(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	go broadcaster.HandleMessages(nil)
+
+	subscribed, subscribedPeer := newConnPair(t)
+	identified, identifiedPeer := newConnPair(t)
+	subscribedClient := broadcaster.RegisterClient(subscribed)
+	broadcaster.Subscribe(subscribedClient, 10)
+	broadcaster.Identify(subscribedClient, 1)
+	broadcaster.Identify(broadcaster.RegisterClient(identified), 2)
+
+	msg := message.FinalMessage{Type: "message", Message: message.Message{MessageId: 1, ChatId: 10}}
+	broadcaster.Publish(event.Event{Type: event.MessageCreated, ChatId: 10, Payload: msg, Recipients: []int{1, 2}})
+	broadcaster.Publish(event.Event{Type: event.MessageCreated, ChatId: 10, Payload: message.FinalMessage{Type: "message", Message: message.Message{MessageId: 2, ChatId: 10}}})
+
+	for _, peer := range []*websocket.Conn{subscribedPeer, identifiedPeer} {
+		peer.SetReadDeadline(time.Now().Add(time.Second))
+		var received message.FinalMessage
+		if err := peer.ReadJSON(&received); err != nil || received.Message.MessageId != 1 {
+			t.Fatalf("expected message 1, got %+v (%v)", received, err)
+		}
+	}
+
+	// The subscriber gets the second message next, not a duplicate of the first
+	subscribedPeer.SetReadDeadline(time.Now().Add(time.Second))
+	var next message.FinalMessage
+	if err := subscribedPeer.ReadJSON(&next); err != nil || next.Message.MessageId != 2 {
+		t.Errorf("expected message 2, got %+v (%v)", next, err)
+	}
+
+	// The second message had no recipients, so the unsubscribed client does not get it
+	identifiedPeer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := identifiedPeer.ReadJSON(&next); err == nil {
+		t.Errorf("unsubscribed client received a message without being a recipient: %+v", next)
+	}
+}
+
+// TestChatMessageHandler_GroupMessage verifies that a group message is stored without a receiver
+// and delivered to every member, including members not subscribed to the chat.
+func TestChatMessageHandler_GroupMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	expectGroupChat(mock, 10, chat.Member{UserId: 1, Role: chat.RoleOwner}, chat.Member{UserId: 2, Role: chat.RoleMember})
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(1))
+	mock.ExpectQuery("INSERT INTO base_chatmessage").
+		WithArgs("Hello team", sqlmock.AnyArg(), 1, 10, 0, int64(1), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	handler.ChatCtrl = newTestChatController(db)
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	dial := func(userID int) *websocket.Conn {
+		header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, userID)}}
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws
+	}
+
+	// A round trip guarantees the member's connection is registered before the message is sent
+	member := dial(2)
+	member.WriteJSON(map[string]interface{}{"type": "teleport", "version": protocol.Version, "payload": map[string]interface{}{}})
+	member.SetReadDeadline(time.Now().Add(time.Second))
+	var errorFrame protocol.ErrorFrame
+	if err := member.ReadJSON(&errorFrame); err != nil {
+		t.Fatalf("failed to read error frame: %v", err)
+	}
+
+	author := dial(1)
+	if err := author.WriteJSON(map[string]interface{}{
+		"type": "message", "version": protocol.Version,
+		"payload": map[string]interface{}{"chat_id": 10, "receiver_id": 2, "message": "Hello team"},
+	}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	member.SetReadDeadline(time.Now().Add(time.Second))
+	var received message.FinalMessage
+	if err := member.ReadJSON(&received); err != nil {
+		t.Fatalf("member failed to read the group message: %v", err)
+	}
+	if received.Message.MessageId != 42 || received.Message.ReceiverId != 0 {
+		t.Errorf("unexpected group message: %+v", received.Message)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_DirectMessage verifies that a message without a chat_id opens the 1:1
+// chat of its author and receiver, and that the ack and the delivered message carry the chat ID
+// assigned by the server.
+func TestChatMessageHandler_DirectMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	expectDirectChat := func() {
+		mock.ExpectQuery("SELECT id, title, avatar_url, COALESCE\\(creator_id, 0\\), is_group, created_at FROM base_chat WHERE id = \\$1").
+			WithArgs(25).
+			WillReturnRows(sqlmock.NewRows(chatColumns).AddRow(25, "", "", 1, false, now))
+		mock.ExpectQuery("SELECT user_id, role, joined_at FROM base_chat_member").WithArgs(25).
+			WillReturnRows(sqlmock.NewRows(chatMemberColumns).AddRow(1, "owner", now).AddRow(2, "member", now))
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat \\(creator_id, is_group, direct_user_low, direct_user_high\\)").WithArgs(1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(25))
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(25, 1, chat.RoleOwner).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(now))
+	mock.ExpectQuery("INSERT INTO base_chat_member").WithArgs(25, 2, chat.RoleMember).
+		WillReturnRows(sqlmock.NewRows([]string{"joined_at"}).AddRow(now))
+	expectDirectChat()
+	mock.ExpectCommit()
+	expectDirectChat()
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(1))
+	mock.ExpectQuery("INSERT INTO base_chatmessage").
+		WithArgs("Hi", sqlmock.AnyArg(), 1, 25, 2, int64(1), "c-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	handler.ChatCtrl = newTestChatController(db)
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	dial := func(userID int) *websocket.Conn {
+		header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, userID)}}
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws
+	}
+
+	// A round trip guarantees the receiver's connection is registered before the message is sent
+	receiver := dial(2)
+	receiver.WriteJSON(map[string]interface{}{"type": "teleport", "version": protocol.Version, "payload": map[string]interface{}{}})
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	var errorFrame protocol.ErrorFrame
+	if err := receiver.ReadJSON(&errorFrame); err != nil {
+		t.Fatalf("failed to read error frame: %v", err)
+	}
+
+	author := dial(1)
+	if err := author.WriteJSON(map[string]interface{}{
+		"type": "message", "version": protocol.Version,
+		"payload": map[string]interface{}{"receiver_id": 2, "message": "Hi", "client_msg_id": "c-1"},
+	}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	author.SetReadDeadline(time.Now().Add(time.Second))
+	var ack message.MessageAck
+	if err := author.ReadJSON(&ack); err != nil {
+		t.Fatalf("author failed to read the ack: %v", err)
+	}
+	if ack.Type != "message_ack" || ack.ChatId != 25 || ack.MessageId != 42 {
+		t.Errorf("expected an ack for message 42 in chat 25, got %+v", ack)
+	}
+
+	receiver.SetReadDeadline(time.Now().Add(time.Second))
+	var received message.FinalMessage
+	if err := receiver.ReadJSON(&received); err != nil {
+		t.Fatalf("receiver failed to read the message: %v", err)
+	}
+	if received.Message.MessageId != 42 || received.Message.ChatId != 25 {
+		t.Errorf("unexpected direct message: %+v", received.Message)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_DirectMessageForeignReceiver verifies that a message posted to an
+// existing 1:1 chat is stored with, and delivered to, the author's partner in the chat, not a
+// receiver_id sent by the client.
+func TestChatMessageHandler_DirectMessageForeignReceiver(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	mock.ExpectQuery("SELECT id, title, avatar_url, COALESCE\\(creator_id, 0\\), is_group, created_at FROM base_chat WHERE id = \\$1").
+		WithArgs(25).
+		WillReturnRows(sqlmock.NewRows(chatColumns).AddRow(25, "", "", 1, false, now))
+	mock.ExpectQuery("SELECT user_id, role, joined_at FROM base_chat_member").WithArgs(25).
+		WillReturnRows(sqlmock.NewRows(chatMemberColumns).AddRow(1, "owner", now).AddRow(2, "member", now))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(1))
+	mock.ExpectQuery("INSERT INTO base_chatmessage").
+		WithArgs("Hi", sqlmock.AnyArg(), 1, 25, 2, int64(1), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	handler.ChatCtrl = newTestChatController(db)
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	dial := func(userID int) *websocket.Conn {
+		header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, userID)}}
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		// A round trip guarantees the connection is registered before the message is sent
+		ws.WriteJSON(map[string]interface{}{"type": "teleport", "version": protocol.Version, "payload": map[string]interface{}{}})
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var errorFrame protocol.ErrorFrame
+		if err := ws.ReadJSON(&errorFrame); err != nil {
+			t.Fatalf("failed to read error frame: %v", err)
+		}
+		return ws
+	}
+
+	partner := dial(2)
+	stranger := dial(3)
+	author := dial(1)
+	if err := author.WriteJSON(map[string]interface{}{
+		"type": "message", "version": protocol.Version,
+		"payload": map[string]interface{}{"chat_id": 25, "receiver_id": 3, "message": "Hi"},
+	}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	partner.SetReadDeadline(time.Now().Add(time.Second))
+	var received message.FinalMessage
+	if err := partner.ReadJSON(&received); err != nil {
+		t.Fatalf("partner failed to read the message: %v", err)
+	}
+	if received.Message.MessageId != 42 || received.Message.ReceiverId != 2 {
+		t.Errorf("expected message 42 for user 2, got %+v", received.Message)
+	}
+
+	stranger.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var leaked map[string]interface{}
+	if err := stranger.ReadJSON(&leaked); err == nil {
+		t.Errorf("the foreign receiver should not get the message, got %v", leaked)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
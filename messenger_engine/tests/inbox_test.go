@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	chathandler "messenger_engine/controllers/websocket_controller/handlers/chat_handler"
+	"messenger_engine/models/chat"
+	"messenger_engine/models/event"
+	"messenger_engine/models/message"
+)
+
+// readInboxUpdate reads the next inbox update from the connection.
+func readInboxUpdate(t *testing.T, ws *websocket.Conn) chat.InboxUpdate {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var update chat.InboxUpdate
+	if err := ws.ReadJSON(&update); err != nil {
+		t.Fatalf("failed to read inbox update: %v", err)
+	}
+	return update
+}
+
+// TestChatsHandler_InboxUpdates verifies that an open inbox is updated by new messages, by the
+// user's own read receipts and by membership changes, including those relayed from other instances.
+func TestChatsHandler_InboxUpdates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	sentAt := time.Now().UTC().Truncate(time.Second)
+	mock.ExpectQuery("WITH user_chats AS (.+) LIMIT \\$4").
+		WithArgs(2, time.Time{}, 0, 21).
+		WillReturnRows(sqlmock.NewRows(inboxColumns))
+	mock.ExpectQuery("WITH user_chats AS (.+) AND i.chat_id = \\$2").
+		WithArgs(2, 10).
+		WillReturnRows(sqlmock.NewRows(inboxColumns).
+			AddRow(10, false, "", "", 7, "Hello!", 1, sentAt, false, sentAt, 1, `[{"user_id": 1, "username": "Alice"}]`))
+	mock.ExpectQuery("AND i.chat_id = \\$2").
+		WithArgs(2, 10).
+		WillReturnRows(sqlmock.NewRows(inboxColumns).
+			AddRow(10, false, "", "", 7, "Hello!", 1, sentAt, false, sentAt, 0, `[{"user_id": 1, "username": "Alice"}]`))
+	mock.ExpectQuery("AND i.chat_id = \\$2").
+		WithArgs(2, 10).
+		WillReturnRows(sqlmock.NewRows(inboxColumns))
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	handler := chathandler.NewChatsHandler(websocket.Upgrader{}, newTestChatController(db))
+	handler.Broadcast = broadcaster
+	broadcaster.OnEvent(handler)
+	go broadcaster.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	// The snapshot subscribes the connection to the inbox of user 2
+	if err := ws.WriteJSON(map[string]interface{}{"user_id": 2}); err != nil {
+		t.Fatalf("failed to write JSON message: %v", err)
+	}
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var snapshot chat.InboxPage
+	if err := ws.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("failed to read the inbox: %v", err)
+	}
+
+	// A message to the user moves the chat to the top with its new unread count
+	broadcaster.Publish(event.FromMessage(message.FinalMessage{
+		Type:    "message",
+		Message: message.Message{MessageId: 7, ChatId: 10, AuthorId: 1, ReceiverId: 2, Message: "Hello!"},
+	}))
+	update := readInboxUpdate(t, ws)
+	if update.Type != chat.InboxUpdated || update.ChatId != 10 || update.Chat == nil ||
+		update.Chat.LastMessage.Content != "Hello!" || update.Chat.UnreadCount != 1 || !update.Chat.LastActivityAt.Equal(sentAt) {
+		t.Errorf("unexpected update after the message: %+v", update)
+	}
+
+	// Reading the chat resets the unread count; the receipt itself goes to the author only
+	broadcaster.Publish(event.Event{
+		Type:           event.MessageRead,
+		ChatId:         10,
+		Payload:        message.ReadReceipt{Type: "message_read", ChatId: 10, MessageId: 7, UserId: 2},
+		Recipients:     []int{1},
+		RecipientsOnly: true,
+	})
+	if update := readInboxUpdate(t, ws); update.Chat == nil || update.Chat.UnreadCount != 0 {
+		t.Errorf("unexpected update after the read receipt: %+v", update)
+	}
+
+	// A removal relayed from another instance drops the chat
+	broadcaster.Events <- event.Event{
+		Type:       event.ChatUpdated,
+		ChatId:     10,
+		Payload:    json.RawMessage(`{"type": "chat_updated", "action": "member_removed", "actor_id": 1, "user_id": 2}`),
+		Recipients: []int{1, 2},
+	}
+	if update := readInboxUpdate(t, ws); update.Type != chat.InboxRemoved || update.ChatId != 10 || update.Chat != nil {
+		t.Errorf("unexpected update after the removal: %+v", update)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatsHandler_IgnoresOtherInboxes verifies that events of chats the user does not take part
+// in, and events that do not change an inbox, are not pushed.
+func TestChatsHandler_IgnoresOtherInboxes(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("WITH user_chats AS").WillReturnRows(sqlmock.NewRows(inboxColumns))
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	handler := chathandler.NewChatsHandler(websocket.Upgrader{}, newTestChatController(db))
+	handler.Broadcast = broadcaster
+	broadcaster.OnEvent(handler)
+	go broadcaster.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	ws.WriteJSON(map[string]interface{}{"user_id": 2})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var snapshot chat.InboxPage
+	if err := ws.ReadJSON(&snapshot); err != nil {
+		t.Fatalf("failed to read the inbox: %v", err)
+	}
+
+	broadcaster.Publish(event.FromMessage(message.FinalMessage{
+		Type:    "message",
+		Message: message.Message{MessageId: 8, ChatId: 11, AuthorId: 1, ReceiverId: 3},
+	}))
+	broadcaster.Publish(event.Event{Type: event.TypingStarted, ChatId: 10, Payload: chat.TypingIndicator{Type: "typing_started", ChatId: 10, UserId: 1}, Recipients: []int{2}})
+
+	ws.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var unexpected map[string]interface{}
+	if err := ws.ReadJSON(&unexpected); err == nil {
+		t.Errorf("expected no inbox update, got %v", unexpected)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	messagecontroller "messenger_engine/controllers/message_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"shared/lifecycle"
+)
+
+// fastLifecycle returns connection settings short enough to observe reaping in a test.
+func fastLifecycle() lifecycle.Config {
+	return lifecycle.Config{
+		PingInterval:   20 * time.Millisecond,
+		PongTimeout:    100 * time.Millisecond,
+		WriteTimeout:   100 * time.Millisecond,
+		MaxMessageSize: 1024,
+	}
+}
+
+// dialWithLifecycle starts a ChatMessageHandler using the given settings and connects to it.
+func dialWithLifecycle(t *testing.T, config lifecycle.Config) (*broadcastcontroller.Broadcast, *websocket.Conn) {
+	t.Helper()
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messagecontroller.MessageController{}, broadcaster)
+	handler.Lifecycle = config
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return broadcaster, ws
+}
+
+// waitForClientCount polls the broadcaster until it has the expected number of clients.
+func waitForClientCount(t *testing.T, broadcaster *broadcastcontroller.Broadcast, expected int, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for broadcaster.ClientCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d registered clients, got %d", expected, broadcaster.ClientCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestHeartbeat_ReapsSilentConnection verifies that a client that never answers pings
+// (it never reads, so its pong handler never runs) is reaped and unregistered.
+func TestHeartbeat_ReapsSilentConnection(t *testing.T) {
+	broadcaster, _ := dialWithLifecycle(t, fastLifecycle())
+	waitForClientCount(t, broadcaster, 1, time.Second)
+	waitForClientCount(t, broadcaster, 0, time.Second)
+}
+
+// TestHeartbeat_KeepsResponsiveConnection verifies that a client answering pings stays registered
+// well past the pong timeout.
+func TestHeartbeat_KeepsResponsiveConnection(t *testing.T) {
+	broadcaster, ws := dialWithLifecycle(t, fastLifecycle())
+
+	// Reading lets the client's default ping handler answer with pongs.
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	waitForClientCount(t, broadcaster, 1, time.Second)
+	time.Sleep(300 * time.Millisecond)
+	if broadcaster.ClientCount() != 1 {
+		t.Errorf("expected the responsive client to stay registered, got %d clients", broadcaster.ClientCount())
+	}
+}
+
+// TestHeartbeat_MaxMessageSize verifies that frames above the size limit close the connection.
+func TestHeartbeat_MaxMessageSize(t *testing.T) {
+	config := fastLifecycle()
+	config.PingInterval, config.PongTimeout = 0, 0
+	broadcaster, ws := dialWithLifecycle(t, config)
+	waitForClientCount(t, broadcaster, 1, time.Second)
+
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 2048))); err != nil {
+		t.Fatalf("failed to write frame: %v", err)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := ws.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("expected the connection to be closed with %d, got %v", websocket.CloseMessageTooBig, err)
+	}
+	waitForClientCount(t, broadcaster, 0, time.Second)
+}
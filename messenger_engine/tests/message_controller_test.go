@@ -2,6 +2,7 @@ package tests
 
 import (
 	"database/sql"
+	"errors"
 	"regexp"
 	"testing"
 	"time"
@@ -26,7 +27,7 @@ func (d *DummyDatabase) GetConnection() *sql.DB {
 }
 
 func newTestMessageController(db *sql.DB) *messagecontroller.MessageController {
-	dummyDB := &database.Database{}
+	dummyDB := database.NewDatabaseFromConnection(db)
 	baseCtrl := &BaseController.BaseController{
 		Database: dummyDB,
 	}
@@ -55,18 +56,23 @@ func TestSaveMessage(t *testing.T) {
 		ReceiverId: 2,
 	}
 
-	// Set up the expectation for the Exec call.
-	query := `
-		INSERT INTO base_chatmessage \(content, timestamp, author_id, chat_id, receiver_id, is_edited, parent\)
-		VALUES \(\$1, \$2, \$3, \$4, \$5, false, null\)`
+	// Expect the chat sequence to be bumped and the message inserted in one transaction.
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence (.+) ON CONFLICT \\(chat_id\\) DO UPDATE (.+) RETURNING last_seq").
+		WithArgs(testMessage.ChatId).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(7))
+	mock.ExpectQuery("INSERT INTO base_chatmessage (.+) RETURNING id").
+		WithArgs(testMessage.Message, testMessage.Timestamp, testMessage.AuthorId, testMessage.ChatId, testMessage.ReceiverId, int64(7), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(42))
+	mock.ExpectCommit()
 
-	mock.ExpectExec(regexp.QuoteMeta(query)).
-		WithArgs(testMessage.Message, testMessage.Timestamp, testMessage.AuthorId, testMessage.ChatId, testMessage.ReceiverId).
-		WillReturnResult(sqlmock.NewResult(1, 1))
-	
-	// Call SaveMessage and check the error.
-	if err := mmc.SaveMessage(testMessage); err != nil {
-		t.Errorf("SaveMessage() returned an unexpected error: %v", err)
+	// Call SaveMessage and check the saved message.
+	saved, duplicate, err := mmc.SaveMessage(testMessage)
+	if err != nil || duplicate {
+		t.Errorf("SaveMessage() returned an unexpected error: %v (duplicate=%v)", err, duplicate)
+	}
+	if saved.MessageId != 42 || saved.Seq != 7 {
+		t.Errorf("expected message 42 with seq 7, got %d with seq %d", saved.MessageId, saved.Seq)
 	}
 
 	// Ensure all expectations were met.
@@ -96,18 +102,26 @@ func TestSaveMessageReply(t *testing.T) {
 		ParentMessageId: 5,
 	}
 
-	// Set up the expectation for the Exec call.
-	query := `
-		INSERT INTO base_chatmessage \(content, timestamp, author_id, chat_id, receiver_id, parent_id, is_edited\)
-		VALUES \(\$1, \$2, \$3, \$4, \$5, \$6, false\)`
-
-	mock.ExpectExec(regexp.QuoteMeta(query)).
-		WithArgs(testReply.Message, testReply.Timestamp, testReply.AuthorId, testReply.ChatId, testReply.ReceiverId, testReply.ParentMessageId).
-		WillReturnResult(sqlmock.NewResult(1, 1))
+	// Expect the chat sequence to be bumped and the reply inserted in one transaction.
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence (.+) RETURNING last_seq").
+		WithArgs(testReply.ChatId).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(8))
+	mock.ExpectQuery("INSERT INTO base_chatmessage (.+) RETURNING id").
+		WithArgs(testReply.Message, testReply.Timestamp, testReply.AuthorId, testReply.ChatId, testReply.ReceiverId, testReply.ParentMessageId, int64(8), "").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(43))
+	mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage WHERE id = \\$1 FOR SHARE").
+		WithArgs(testReply.ParentMessageId).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(testReply.ChatId, false))
+	mock.ExpectCommit()
 
-	// Call SaveMessageReply and check the error.
-	if err := mmc.SaveMessageReply(testReply); err != nil {
-		t.Errorf("SaveMessageReply() returned an unexpected error: %v", err)
+	// Call SaveMessageReply and check the saved reply.
+	saved, duplicate, err := mmc.SaveMessageReply(testReply)
+	if err != nil || duplicate {
+		t.Errorf("SaveMessageReply() returned an unexpected error: %v (duplicate=%v)", err, duplicate)
+	}
+	if saved.MessageId != 43 || saved.Seq != 8 {
+		t.Errorf("expected reply 43 with seq 8, got %d with seq %d", saved.MessageId, saved.Seq)
 	}
 
 	// Ensure all expectations were met.
@@ -116,6 +130,109 @@ func TestSaveMessageReply(t *testing.T) {
 	}
 }
 
+// TestSaveMessageReply_ParentInOtherChat verifies that a reply to a message of another chat is
+// rejected like a reply to an unknown message, and that nothing is stored.
+func TestSaveMessageReply_ParentInOtherChat(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+
+	reply := Messages.MessageReply{
+		Message:         "This is a reply",
+		Timestamp:       time.Now(),
+		AuthorId:        3,
+		ChatId:          10,
+		ParentMessageId: 5,
+	}
+
+	// Message 5 belongs to chat 20, so the insert is rolled back
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(8))
+	mock.ExpectQuery("INSERT INTO base_chatmessage (.+) RETURNING id").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(43))
+	mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(20, false))
+	mock.ExpectRollback()
+
+	if _, _, err := mmc.SaveMessageReply(reply); err != messagecontroller.ErrMessageNotFound {
+		t.Errorf("expected ErrMessageNotFound, got %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+// TestSaveMessage_DuplicateClientMsgId verifies that a retried send carrying an already
+// used client_msg_id is not inserted again and maps to the stored message.
+func TestSaveMessage_DuplicateClientMsgId(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+	storedAt := time.Now().Add(-time.Minute)
+	retry := Messages.Message{
+		Message:     "Hello, world!",
+		Timestamp:   time.Now(),
+		AuthorId:    1,
+		ChatId:      10,
+		ReceiverId:  2,
+		ClientMsgId: "c-1",
+	}
+
+	// The insert hits the unique index and returns no row; the transaction is rolled back
+	// so the allocated sequence number is released, and the stored message is looked up.
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO base_chat_sequence").
+		WillReturnRows(sqlmock.NewRows([]string{"last_seq"}).AddRow(8))
+	mock.ExpectQuery("INSERT INTO base_chatmessage (.+) ON CONFLICT \\(author_id, client_msg_id\\) (.+) DO NOTHING RETURNING id").
+		WithArgs(retry.Message, retry.Timestamp, retry.AuthorId, retry.ChatId, retry.ReceiverId, int64(8), "c-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectRollback()
+	mock.ExpectQuery("SELECT m.id, m.chat_id, m.seq, m.timestamp, at.attachments FROM base_chatmessage AS m (.+) WHERE m.author_id = \\$1 AND m.client_msg_id = \\$2").
+		WithArgs(1, "c-1").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "chat_id", "seq", "timestamp", "attachments"}).AddRow(42, 10, 7, storedAt, nil))
+
+	saved, duplicate, err := mmc.SaveMessage(retry)
+	if err != nil {
+		t.Fatalf("SaveMessage() returned an unexpected error: %v", err)
+	}
+	if !duplicate {
+		t.Errorf("expected the retry to be reported as a duplicate")
+	}
+	if saved.MessageId != 42 || saved.Seq != 7 || !saved.Timestamp.Equal(storedAt) {
+		t.Errorf("expected the stored message 42 (seq 7), got %+v", saved)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+// historyColumns are the columns LoadMessages scans, in order.
+var historyColumns = []string{
+	"id",
+	"content",
+	"is_edited",
+	"timestamp",
+	"author_id",
+	"chat_id",
+	"receiver_id",
+	"is_deleted",
+	"parent_id",
+	"seq",
+	"status",
+	"reactions",
+	"attachments",
+}
+
 func TestLoadMessages(t *testing.T) {
 	// Create a new sqlmock database connection.
 	db, mock, err := sqlmock.New()
@@ -129,44 +246,52 @@ func TestLoadMessages(t *testing.T) {
 
 	chatId := 10
 
-	// Define the columns as expected by LoadMessages.
-	columns := []string{
-		"message_id",
-		"content",
-		"is_edited",
-		"timestamp",
-		"author_id",
-		"chat_id",
-		"receiver_id",
-		"parent_message_id",
-	}
-
-	// Create sample rows.
+	// Create sample rows, newest first as the latest page is read; the older one is a tombstone.
 	timestamp := time.Now()
-	rows := sqlmock.NewRows(columns).
-		AddRow(1, "Hello", false, timestamp, 1, chatId, 2, nil).
-		AddRow(2, "Hi there", false, timestamp, 2, chatId, 1, nil)
-
-	// Expect the query to be executed.
-	query := `SELECT \* FROM base_chatmessage WHERE chat_id = \$1`
-	mock.ExpectQuery(regexp.QuoteMeta(query)).
-		WithArgs(chatId).
+	rows := sqlmock.NewRows(historyColumns).
+		AddRow(2, "Hello", false, timestamp, 1, chatId, 2, false, 1, 2, "read", `[{"emoji":"👍","count":2,"mine":true}]`, nil).
+		AddRow(1, "", false, timestamp, 2, chatId, 1, true, nil, 1, "sent", nil, nil)
+
+	// Expect the latest page to be read for the viewer, with one extra row to detect more pages.
+	mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m LEFT JOIN base_chatmessage_hidden AS h (.+) WHERE m.chat_id = \\$1 AND \\$3 = 0 ORDER BY m.id DESC LIMIT \\$4").
+		WithArgs(chatId, 1, 0, messagecontroller.DefaultHistoryLimit+1).
 		WillReturnRows(rows)
 
 	// Call LoadMessages.
-	msgs, err := mmc.LoadMessages(chatId)
+	page, err := mmc.LoadMessages(Messages.HistoryQuery{ChatId: chatId, ViewerId: 1})
 	if err != nil {
 		t.Errorf("LoadMessages() returned an unexpected error: %v", err)
 	}
+	msgs := page.Messages
 
 	// Check that the correct number of messages were returned.
 	if len(msgs) != 2 {
-		t.Errorf("expected 2 messages, got %d", len(msgs))
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+
+	// Verify that the page is ordered from the oldest to the newest message.
+	if msgs[0].MessageId != 1 || msgs[1].Message != "Hello" {
+		t.Errorf("expected messages in ascending order, got %+v", msgs)
+	}
+
+	// Verify that the tombstone keeps its place in the reply chain.
+	if !msgs[0].IsDeleted || msgs[1].ParentMessageId.Int64 != 1 {
+		t.Errorf("expected first message to be a tombstone replied to by the second, got %+v", msgs)
+	}
+
+	// Verify that every message carries its delivery status.
+	if msgs[0].Status != Messages.StatusSent || msgs[1].Status != Messages.StatusRead {
+		t.Errorf("expected statuses sent and read, got %q and %q", msgs[0].Status, msgs[1].Status)
 	}
 
-	// Verify contents of the first message.
-	if msgs[0].Message != "Hello" {
-		t.Errorf("expected first message to be 'Hello', got '%s'", msgs[0].Message)
+	// Verify that reactions are aggregated per emoji and left out for the tombstone.
+	if len(msgs[0].Reactions) != 0 || len(msgs[1].Reactions) != 1 ||
+		msgs[1].Reactions[0] != (Messages.Reaction{Emoji: "👍", Count: 2, Mine: true}) {
+		t.Errorf("expected one 👍 reaction on the second message, got %+v and %+v", msgs[0].Reactions, msgs[1].Reactions)
+	}
+
+	if page.HasMore || page.NextCursor != 1 {
+		t.Errorf("expected last page with cursor 1, got has_more=%v cursor=%d", page.HasMore, page.NextCursor)
 	}
 
 	// Ensure all expectations were met.
@@ -174,3 +299,259 @@ func TestLoadMessages(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %v", err)
 	}
 }
+
+func TestLoadMessages_BeforeCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+	timestamp := time.Now()
+
+	// Three rows for a limit of two means another page exists.
+	rows := sqlmock.NewRows(historyColumns).
+		AddRow(49, "c", false, timestamp, 1, 10, 2, false, nil, 49, "sent", nil, nil).
+		AddRow(48, "b", false, timestamp, 1, 10, 2, false, nil, 48, "sent", nil, nil).
+		AddRow(47, "a", false, timestamp, 1, 10, 2, false, nil, 47, "sent", nil, nil)
+	mock.ExpectQuery("WHERE m.chat_id = \\$1 AND m.id < \\$3 ORDER BY m.id DESC LIMIT \\$4").
+		WithArgs(10, 1, 50, 3).
+		WillReturnRows(rows)
+
+	page, err := mmc.LoadMessages(Messages.HistoryQuery{ChatId: 10, ViewerId: 1, BeforeMessageId: 50, Limit: 2})
+	if err != nil {
+		t.Fatalf("LoadMessages() returned an unexpected error: %v", err)
+	}
+	if len(page.Messages) != 2 || page.Messages[0].MessageId != 48 || page.Messages[1].MessageId != 49 {
+		t.Errorf("unexpected page: %+v", page.Messages)
+	}
+	if !page.HasMore || page.NextCursor != 48 {
+		t.Errorf("expected more pages before 48, got has_more=%v cursor=%d", page.HasMore, page.NextCursor)
+	}
+}
+
+func TestLoadMessages_AfterCursor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+	timestamp := time.Now()
+
+	rows := sqlmock.NewRows(historyColumns).
+		AddRow(51, "d", false, timestamp, 1, 10, 2, false, nil, 51, "sent", nil, nil).
+		AddRow(52, "e", false, timestamp, 1, 10, 2, false, nil, 52, "sent", nil, nil)
+	mock.ExpectQuery("WHERE m.chat_id = \\$1 AND m.id > \\$3 ORDER BY m.id ASC LIMIT \\$4").
+		WithArgs(10, 1, 50, messagecontroller.MaxHistoryLimit+1).
+		WillReturnRows(rows)
+
+	page, err := mmc.LoadMessages(Messages.HistoryQuery{ChatId: 10, ViewerId: 1, AfterMessageId: 50, Limit: 1000})
+	if err != nil {
+		t.Fatalf("LoadMessages() returned an unexpected error: %v", err)
+	}
+	if len(page.Messages) != 2 || page.HasMore || page.NextCursor != 52 {
+		t.Errorf("unexpected page: %+v", page)
+	}
+}
+
+func TestLoadMessages_ConflictingCursors(t *testing.T) {
+	mmc := newTestMessageController(nil)
+
+	_, err := mmc.LoadMessages(Messages.HistoryQuery{ChatId: 10, BeforeMessageId: 5, AfterMessageId: 1})
+	if !errors.Is(err, messagecontroller.ErrConflictingCursors) {
+		t.Errorf("expected ErrConflictingCursors, got %v", err)
+	}
+}
+
+// TestEditMessage verifies that an edited message comes back like a message of a history page,
+// with its delivery status, reactions and signed attachments, so the edit event loses none of them.
+func TestEditMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+	mmc.Media = &stubAttachmentResolver{}
+	timestamp := time.Now()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT content, author_id, is_deleted FROM base_chatmessage WHERE id = $1 FOR UPDATE`)).
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"content", "author_id", "is_deleted"}).AddRow("Helo", 1, false))
+	mock.ExpectExec("INSERT INTO base_chatmessage_edit").
+		WithArgs(5, 1, "Helo").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE base_chatmessage SET content = \\$1, is_edited = true WHERE id = \\$2").
+		WithArgs("Hello", 5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The message is reloaded for no particular viewer, as the edit is broadcast to the whole chat
+	mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m LEFT JOIN base_chatmessage_hidden AS h (.+) WHERE m.id = \\$1").
+		WithArgs(5, 0).
+		WillReturnRows(sqlmock.NewRows(historyColumns).
+			AddRow(5, "Hello", true, timestamp, 1, 10, 2, false, nil, 5, "read",
+				`[{"emoji":"👍","count":2,"mine":false}]`,
+				`[{"media_id":"attachments/1/photo","mime_type":"image/png","size":2048,"width":640,"height":480,"duration_ms":0}]`))
+	mock.ExpectCommit()
+
+	msg, err := mmc.EditMessage(Messages.MessageEdit{MessageId: 5, AuthorId: 1, Message: "Hello"})
+	if err != nil {
+		t.Fatalf("EditMessage() returned an unexpected error: %v", err)
+	}
+	if msg.Message != "Hello" || !msg.IsEdited || msg.ChatId != 10 {
+		t.Errorf("unexpected edited message: %+v", msg)
+	}
+	if msg.Status != Messages.StatusRead || len(msg.Reactions) != 1 || msg.Reactions[0].Count != 2 {
+		t.Errorf("expected the status and reactions to be kept, got %+v", msg)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Url != "http://media.test/media/attachments/1/photo?expires=1" {
+		t.Errorf("expected the attachment with a signed URL, got %+v", msg.Attachments)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestEditMessage_NotAuthor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT content, author_id, is_deleted FROM base_chatmessage").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"content", "author_id", "is_deleted"}).AddRow("Hello", 1, false))
+	mock.ExpectRollback()
+
+	_, err = mmc.EditMessage(Messages.MessageEdit{MessageId: 5, AuthorId: 2, Message: "Hijacked"})
+	if !errors.Is(err, messagecontroller.ErrNotMessageAuthor) {
+		t.Errorf("expected ErrNotMessageAuthor, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestLoadRevisions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+	editedAt := time.Now()
+
+	mock.ExpectQuery("SELECT id, message_id, editor_id, previous_content, edited_at FROM base_chatmessage_edit").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "message_id", "editor_id", "previous_content", "edited_at"}).
+			AddRow(1, 5, 1, "Helo", editedAt).
+			AddRow(2, 5, 1, "Hello", editedAt))
+
+	revisions, err := mmc.LoadRevisions(5)
+	if err != nil {
+		t.Fatalf("LoadRevisions() returned an unexpected error: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Message != "Helo" {
+		t.Errorf("unexpected revisions: %+v", revisions)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteMessage_ForEveryone(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, is_edited, timestamp, author_id, chat_id, COALESCE\\(receiver_id, 0\\), parent_id, seq, is_deleted FROM base_chatmessage").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_edited", "timestamp", "author_id", "chat_id", "receiver_id", "parent_id", "seq", "is_deleted"}).
+			AddRow(5, false, time.Now(), 1, 10, 2, nil, 5, false))
+	mock.ExpectExec("DELETE FROM base_chatmessage_edit WHERE message_id = \\$1").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("UPDATE base_chatmessage SET content = '', is_deleted = true").
+		WithArgs(5).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	tombstone, err := mmc.DeleteMessage(Messages.MessageDelete{MessageId: 5, AuthorId: 1, ForEveryone: true})
+	if err != nil {
+		t.Fatalf("DeleteMessage() returned an unexpected error: %v", err)
+	}
+	if !tombstone.IsDeleted || tombstone.Message != "" || tombstone.ChatId != 10 {
+		t.Errorf("unexpected tombstone: %+v", tombstone)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteMessage_ForMe(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, is_edited, timestamp, author_id, chat_id, COALESCE\\(receiver_id, 0\\), parent_id, seq, is_deleted FROM base_chatmessage").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_edited", "timestamp", "author_id", "chat_id", "receiver_id", "parent_id", "seq", "is_deleted"}).
+			AddRow(5, false, time.Now(), 1, 10, 2, nil, 5, false))
+	mock.ExpectExec("INSERT INTO base_chatmessage_hidden").
+		WithArgs(5, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if _, err := mmc.DeleteMessage(Messages.MessageDelete{MessageId: 5, AuthorId: 1}); err != nil {
+		t.Fatalf("DeleteMessage() returned an unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %v", err)
+	}
+}
+
+func TestDeleteMessage_NotAuthor(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mmc := newTestMessageController(db)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id, is_edited, timestamp, author_id, chat_id, COALESCE\\(receiver_id, 0\\), parent_id, seq, is_deleted FROM base_chatmessage").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "is_edited", "timestamp", "author_id", "chat_id", "receiver_id", "parent_id", "seq", "is_deleted"}).
+			AddRow(5, false, time.Now(), 1, 10, 2, nil, 5, false))
+	mock.ExpectRollback()
+
+	_, err = mmc.DeleteMessage(Messages.MessageDelete{MessageId: 5, AuthorId: 2, ForEveryone: true})
+	if !errors.Is(err, messagecontroller.ErrNotMessageAuthor) {
+		t.Errorf("expected ErrNotMessageAuthor, got %v", err)
+	}
+}
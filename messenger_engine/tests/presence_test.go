@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	basecontroller "messenger_engine/controllers/base_controller"
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	presencecontroller "messenger_engine/controllers/presence_controller"
+	presencehandler "messenger_engine/controllers/websocket_controller/handlers/presence_handler"
+	"messenger_engine/models/presence"
+	"messenger_engine/modules/database/database"
+)
+
+// recordingPresenceListener records presence changes as "+id" and "-id".
+type recordingPresenceListener chan string
+
+func (l recordingPresenceListener) UserConnected(userId int) {
+	l <- "+" + strconv.Itoa(userId)
+}
+
+func (l recordingPresenceListener) UserDisconnected(userId int) {
+	l <- "-" + strconv.Itoa(userId)
+}
+
+// expectPresenceChange waits for the next presence change.
+func expectPresenceChange(t *testing.T, changes recordingPresenceListener, expected string) {
+	t.Helper()
+	select {
+	case change := <-changes:
+		if change != expected {
+			t.Errorf("expected presence change %s, got %s", expected, change)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected presence change %s, got none", expected)
+	}
+}
+
+// newTestPresenceController returns a PresenceController backed by the given mocked database.
+func newTestPresenceController(db *sql.DB, broadcaster *broadcastcontroller.Broadcast) *presencecontroller.PresenceController {
+	return &presencecontroller.PresenceController{
+		BaseController: &basecontroller.BaseController{Database: database.NewDatabaseFromConnection(db)},
+		Broadcast:      broadcaster,
+	}
+}
+
+// TestPresence_FirstAndLastConnection verifies that the listener hears about a user's first
+// and last connection only.
+func TestPresence_FirstAndLastConnection(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	changes := make(recordingPresenceListener, 4)
+	broadcaster.OnPresence(changes)
+	go broadcaster.HandleMessages(nil)
+
+	first, _ := newConnPair(t)
+	second, _ := newConnPair(t)
+	firstClient := broadcaster.RegisterClient(first)
+	secondClient := broadcaster.RegisterClient(second)
+
+	broadcaster.Identify(firstClient, 5)
+	broadcaster.Identify(secondClient, 5)
+	expectPresenceChange(t, changes, "+5")
+	if !broadcaster.IsOnline(5) {
+		t.Errorf("expected user 5 to be online")
+	}
+
+	broadcaster.RemoveClient(firstClient)
+	broadcaster.RemoveClient(secondClient)
+	expectPresenceChange(t, changes, "-5")
+	if broadcaster.IsOnline(5) {
+		t.Errorf("expected user 5 to be offline")
+	}
+
+	select {
+	case change := <-changes:
+		t.Errorf("unexpected presence change %s", change)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// TestPresenceController_UserDisconnected verifies that going offline stores the last-seen
+// time and tells the user's chat partners.
+func TestPresenceController_UserDisconnected(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	lastSeen := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	mock.ExpectQuery("INSERT INTO base_user_presence").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"last_seen_at"}).AddRow(lastSeen))
+	mock.ExpectQuery("SELECT other.user_id FROM base_chat_member").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(2))
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	go broadcaster.HandleMessages(nil)
+	partner, partnerPeer := newConnPair(t)
+	broadcaster.Identify(broadcaster.RegisterClient(partner), 2)
+
+	newTestPresenceController(db, broadcaster).UserDisconnected(1)
+
+	partnerPeer.SetReadDeadline(time.Now().Add(time.Second))
+	var update presence.Presence
+	if err := partnerPeer.ReadJSON(&update); err != nil {
+		t.Fatalf("partner failed to read presence: %v", err)
+	}
+	if update.Type != "presence" || update.UserId != 1 || update.Online || update.LastSeenAt == nil || !update.LastSeenAt.Equal(lastSeen) {
+		t.Errorf("unexpected presence update: %+v", update)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestPresenceController_GetPresence verifies that lookups combine live connections with last-seen times.
+func TestPresenceController_GetPresence(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT user_id, last_seen_at FROM base_user_presence").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "last_seen_at"}).AddRow(2, time.Now()))
+
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	conn, _ := newConnPair(t)
+	broadcaster.Identify(broadcaster.RegisterClient(conn), 1)
+
+	users, err := newTestPresenceController(db, broadcaster).GetPresence([]int{1, 2, 1, 3})
+	if err != nil {
+		t.Fatalf("GetPresence() returned an unexpected error: %v", err)
+	}
+	if len(users) != 3 {
+		t.Fatalf("expected 3 users, got %+v", users)
+	}
+	if !users[0].Online || users[0].LastSeenAt != nil {
+		t.Errorf("expected user 1 online without a last-seen time, got %+v", users[0])
+	}
+	if users[1].Online || users[1].LastSeenAt == nil {
+		t.Errorf("expected user 2 offline with a last-seen time, got %+v", users[1])
+	}
+	if users[2].UserId != 3 || users[2].Online || users[2].LastSeenAt != nil {
+		t.Errorf("expected user 3 never seen, got %+v", users[2])
+	}
+}
+
+// stubPresenceReader reports the users listed in it as online.
+type stubPresenceReader map[int]bool
+
+func (s stubPresenceReader) GetPresence(userIds []int) ([]presence.Presence, error) {
+	users := make([]presence.Presence, 0, len(userIds))
+	for _, userId := range userIds {
+		users = append(users, presence.Presence{Type: "presence", UserId: userId, Online: s[userId]})
+	}
+	return users, nil
+}
+
+// TestPresenceHandler_ServeHTTP verifies the /presence endpoint's responses and validation.
+func TestPresenceHandler_ServeHTTP(t *testing.T) {
+	server := httptest.NewServer(presencehandler.NewPresenceHandler(stubPresenceReader{1: true}))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?user_ids=1,2")
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body presencehandler.PresenceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || len(body.Users) != 2 || !body.Users[0].Online || body.Users[1].Online {
+		t.Errorf("unexpected response %d: %+v", resp.StatusCode, body)
+	}
+
+	for _, query := range []string{"", "?user_ids=", "?user_ids=1,abc", "?user_ids=-4"} {
+		resp, err := http.Get(server.URL + query)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d", query, resp.StatusCode)
+		}
+	}
+}
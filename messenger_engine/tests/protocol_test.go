@@ -0,0 +1,176 @@
+package tests
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	messagecontroller "messenger_engine/controllers/message_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/parsers"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/message"
+)
+
+// expectProtocolError fails the test unless err is a *protocol.Error with the given code and field.
+func expectProtocolError(t *testing.T, err error, code protocol.Code, field string) {
+	t.Helper()
+	protocolErr, ok := protocol.AsError(err)
+	if !ok {
+		t.Fatalf("expected a protocol error %q, got %v", code, err)
+	}
+	if protocolErr.Code != code || protocolErr.Field != field {
+		t.Errorf("expected %q on field %q, got %q on field %q", code, field, protocolErr.Code, protocolErr.Field)
+	}
+}
+
+// TestDecode_Envelope verifies that a versioned envelope is decoded into a typed payload.
+func TestDecode_Envelope(t *testing.T) {
+	parser := parsers.New()
+	env, err := parser.Decode([]byte(`{"type":"message","version":1,"request_id":"r-1",
+		"payload":{"chat_id":10,"receiver_id":2,"message":"Hello","client_msg_id":"c-1"}}`))
+	if err != nil {
+		t.Fatalf("Decode() returned an unexpected error: %v", err)
+	}
+	if env.Type != protocol.TypeMessage || env.Version != protocol.Version || env.RequestId != "r-1" {
+		t.Errorf("unexpected envelope: %+v", env)
+	}
+
+	var payload protocol.MessagePayload
+	if err := parser.DecodePayload(env, &payload); err != nil {
+		t.Fatalf("DecodePayload() returned an unexpected error: %v", err)
+	}
+	msg := payload.ToMessage()
+	if msg.ChatId != 10 || msg.ReceiverId != 2 || msg.Message != "Hello" || msg.ClientMsgId != "c-1" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Timestamp.IsZero() {
+		t.Errorf("expected the server to assign a timestamp")
+	}
+}
+
+// TestDecode_LegacyMessage verifies that the unversioned PascalCase message frame
+// is converted by the compatibility shim.
+func TestDecode_LegacyMessage(t *testing.T) {
+	parser := parsers.New()
+	env, err := parser.Decode([]byte(`{"type":"message_reply","message":{"AuthorId":1,"Timestamp":1700000000,
+		"ReceiverId":2,"Message":"Reply","ChatId":10,"IsEdited":false,"ParentMessageId":5}}`))
+	if err != nil {
+		t.Fatalf("Decode() returned an unexpected error: %v", err)
+	}
+	if env.Version != protocol.LegacyVersion {
+		t.Errorf("expected legacy version, got %d", env.Version)
+	}
+
+	var payload protocol.ReplyPayload
+	if err := parser.DecodePayload(env, &payload); err != nil {
+		t.Fatalf("DecodePayload() returned an unexpected error: %v", err)
+	}
+	reply := payload.ToReply()
+	if reply.ChatId != 10 || reply.ParentMessageId != 5 || reply.AuthorId != 1 || !reply.Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+}
+
+// TestDecode_Rejected verifies that malformed frames are reported with codes instead of panicking.
+func TestDecode_Rejected(t *testing.T) {
+	parser := parsers.New()
+
+	_, err := parser.Decode([]byte(`not json`))
+	expectProtocolError(t, err, protocol.CodeBadRequest, "")
+
+	_, err = parser.Decode([]byte(`{"type":"message","version":2,"payload":{}}`))
+	expectProtocolError(t, err, protocol.CodeUnsupportedVersion, "")
+
+	_, err = parser.Decode([]byte(`{"version":1,"payload":{}}`))
+	expectProtocolError(t, err, protocol.CodeInvalidField, "type")
+
+	// A legacy message missing most of its fields must not panic.
+	env, err := parser.Decode([]byte(`{"type":"message","message":{"ChatId":10}}`))
+	if err != nil {
+		t.Fatalf("Decode() returned an unexpected error: %v", err)
+	}
+	err = parser.DecodePayload(env, &protocol.MessagePayload{})
+	expectProtocolError(t, err, protocol.CodeInvalidField, "message")
+
+	env, _ = parser.Decode([]byte(`{"type":"history","version":1,"payload":{"chat_id":"ten"}}`))
+	err = parser.DecodePayload(env, &protocol.HistoryPayload{})
+	expectProtocolError(t, err, protocol.CodeInvalidField, "chat_id")
+
+	env, _ = parser.Decode([]byte(`{"type":"history","version":1,"payload":{"chat_id":1,"before_message_id":3,"after_message_id":4}}`))
+	err = parser.DecodePayload(env, &protocol.HistoryPayload{})
+	expectProtocolError(t, err, protocol.CodeInvalidField, "after_message_id")
+}
+
+// TestResumePayload_Validate verifies that a resume request names between one and MaxResumeChats chats.
+func TestResumePayload_Validate(t *testing.T) {
+	payload := protocol.ResumePayload{Chats: make([]message.ResumeCursor, protocol.MaxResumeChats)}
+	for i := range payload.Chats {
+		payload.Chats[i].ChatId = i + 1
+	}
+	if err := payload.Validate(); err != nil {
+		t.Errorf("expected %d chats to be accepted, got %v", protocol.MaxResumeChats, err)
+	}
+
+	payload.Chats = append(payload.Chats, message.ResumeCursor{ChatId: protocol.MaxResumeChats + 1})
+	expectProtocolError(t, payload.Validate(), protocol.CodeInvalidField, "chats")
+
+	expectProtocolError(t, (&protocol.ResumePayload{}).Validate(), protocol.CodeInvalidField, "chats")
+}
+
+// TestMessagePayload_Validate verifies that only messages naming a receiver may leave out the
+// chat_id, and that replies always need one.
+func TestMessagePayload_Validate(t *testing.T) {
+	direct := protocol.MessagePayload{ReceiverId: 2, Message: "Hi"}
+	if err := direct.Validate(); err != nil {
+		t.Errorf("expected a message to a receiver without a chat_id to be accepted, got %v", err)
+	}
+	expectProtocolError(t, (&protocol.MessagePayload{Message: "Hi"}).Validate(), protocol.CodeInvalidField, "chat_id")
+	expectProtocolError(t, (&protocol.MessagePayload{ChatId: -1, ReceiverId: 2, Message: "Hi"}).Validate(), protocol.CodeInvalidField, "chat_id")
+	expectProtocolError(t, (&protocol.ReplyPayload{MessagePayload: direct, ParentMessageId: 1}).Validate(), protocol.CodeInvalidField, "chat_id")
+}
+
+// TestChatMessageHandler_ErrorFrames verifies that invalid requests are answered with
+// structured error frames echoing the request ID, and that the connection stays usable.
+func TestChatMessageHandler_ErrorFrames(t *testing.T) {
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messagecontroller.MessageController{}, broadcastcontroller.NewBroadcaster())
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	requests := []struct {
+		frame map[string]interface{}
+		code  protocol.Code
+		field string
+	}{
+		{map[string]interface{}{"type": "message", "version": 1, "request_id": "r-1", "payload": map[string]interface{}{"chat_id": 10}}, protocol.CodeInvalidField, "message"},
+		{map[string]interface{}{"type": "teleport", "version": 1, "request_id": "r-2", "payload": map[string]interface{}{}}, protocol.CodeUnknownType, ""},
+		{map[string]interface{}{"type": "initial", "version": 9, "request_id": "r-3", "payload": map[string]interface{}{"chat_id": 1}}, protocol.CodeUnsupportedVersion, ""},
+	}
+
+	for _, request := range requests {
+		if err := ws.WriteJSON(request.frame); err != nil {
+			t.Fatalf("failed to write JSON: %v", err)
+		}
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var frame protocol.ErrorFrame
+		if err := ws.ReadJSON(&frame); err != nil {
+			t.Fatalf("failed to read error frame: %v", err)
+		}
+		if frame.Type != "error" || frame.RequestId != request.frame["request_id"] {
+			t.Errorf("unexpected error frame: %+v", frame)
+		}
+		if frame.Error.Code != request.code || frame.Error.Field != request.field {
+			t.Errorf("expected %q on %q, got %q on %q", request.code, request.field, frame.Error.Code, frame.Error.Field)
+		}
+	}
+}
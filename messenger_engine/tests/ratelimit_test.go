@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	messagecontroller "messenger_engine/controllers/message_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"shared/ratelimit"
+)
+
+// fakeClock is a manually advanced clock for deterministic token-bucket tests.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// TestLimiter_TokenBucket verifies that a burst is allowed, that the next request is rejected
+// with the time until a token is available, and that tokens refill at the configured rate.
+func TestLimiter_TokenBucket(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter := ratelimit.NewLimiterWithClock(ratelimit.Config{
+		Rules: map[string]ratelimit.Rule{"message": {Rate: 1, Burst: 2}},
+	}, clock.Now)
+
+	for i := 0; i < 2; i++ {
+		if decision := limiter.Allow("user:1", "message"); !decision.Allowed {
+			t.Fatalf("expected request %d of the burst to be allowed", i+1)
+		}
+	}
+
+	decision := limiter.Allow("user:1", "message")
+	if decision.Allowed || decision.RetryAfter != time.Second {
+		t.Errorf("expected a rejection with a 1s retry-after, got %+v", decision)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if decision := limiter.Allow("user:1", "message"); decision.Allowed || decision.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected a rejection with a 500ms retry-after, got %+v", decision)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if decision := limiter.Allow("user:1", "message"); !decision.Allowed {
+		t.Errorf("expected a refilled token to be allowed, got %+v", decision)
+	}
+}
+
+// TestLimiter_Keys verifies that callers and frame types have separate buckets,
+// and that frame types without a rule fall back to the (here unlimited) default.
+func TestLimiter_Keys(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{
+		Rules: map[string]ratelimit.Rule{"message": {Rate: 1, Burst: 1}, "history": {Rate: 1, Burst: 1}},
+	})
+
+	for _, request := range []struct{ key, frameType string }{
+		{"user:1", "message"}, {"user:2", "message"}, {"user:1", "history"}, {"ip:10.0.0.1", "message"},
+	} {
+		if !limiter.Allow(request.key, request.frameType).Allowed {
+			t.Errorf("expected the first %s request of %s to be allowed", request.frameType, request.key)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if !limiter.Allow("user:1", "initial").Allowed {
+			t.Fatalf("expected frame types without a rule to be unlimited")
+		}
+	}
+}
+
+// TestLimiter_Disconnect verifies that callers are flagged for disconnection after
+// MaxViolations rejections within the violation window, and not before.
+func TestLimiter_Disconnect(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	limiter := ratelimit.NewLimiterWithClock(ratelimit.Config{
+		Default:         ratelimit.Rule{Rate: 0.001, Burst: 1},
+		MaxViolations:   3,
+		ViolationWindow: time.Minute,
+	}, clock.Now)
+
+	limiter.Allow("user:1", "message")
+	limiter.Allow("user:1", "message")
+	limiter.Allow("user:1", "message")
+
+	// The violations expire with the window.
+	clock.Advance(2 * time.Minute)
+	if decision := limiter.Allow("user:1", "message"); decision.Disconnect {
+		t.Fatalf("expected violations outside the window to be forgotten, got %+v", decision)
+	}
+	limiter.Allow("user:1", "message")
+	if decision := limiter.Allow("user:1", "message"); !decision.Disconnect {
+		t.Errorf("expected the third violation within the window to disconnect, got %+v", decision)
+	}
+}
+
+// TestRateLimit_LoadConfig verifies that environment overrides are merged into the defaults.
+func TestRateLimit_LoadConfig(t *testing.T) {
+	t.Setenv("RATE_LIMITS", "message=1.5:3, *=10:20, broken")
+	t.Setenv("RATE_LIMIT_MAX_VIOLATIONS", "7")
+	t.Setenv("RATE_LIMIT_VIOLATION_WINDOW_MS", "5000")
+
+	defaults := ratelimit.Config{Rules: map[string]ratelimit.Rule{"history": {Rate: 2, Burst: 4}}}
+	config := ratelimit.LoadConfig(defaults)
+
+	if rule := config.Rule("message"); rule.Rate != 1.5 || rule.Burst != 3 {
+		t.Errorf("unexpected message rule: %+v", rule)
+	}
+	if rule := config.Rule("history"); rule.Rate != 2 || rule.Burst != 4 {
+		t.Errorf("expected the history default to be kept, got %+v", rule)
+	}
+	if rule := config.Rule("initial"); rule.Rate != 10 || rule.Burst != 20 {
+		t.Errorf("expected the default rule to be overridden, got %+v", rule)
+	}
+	if config.MaxViolations != 7 || config.ViolationWindow != 5*time.Second {
+		t.Errorf("unexpected disconnection policy: %+v", config)
+	}
+	if _, ok := defaults.Rules["message"]; ok {
+		t.Errorf("expected the defaults to be left untouched")
+	}
+}
+
+// TestChatMessageHandler_RateLimited verifies that frames over the limit are answered with
+// a rate_limited error frame carrying a retry-after value, and that repeat offenders are disconnected.
+func TestChatMessageHandler_RateLimited(t *testing.T) {
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messagecontroller.MessageController{}, broadcastcontroller.NewBroadcaster())
+	handler.RateLimiter = ratelimit.NewLimiter(ratelimit.Config{
+		Default:         ratelimit.Rule{Rate: 0.001, Burst: 1},
+		MaxViolations:   2,
+		ViolationWindow: time.Minute,
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	expected := []protocol.Code{protocol.CodeUnknownType, protocol.CodeRateLimited, protocol.CodeRateLimited}
+	for i, code := range expected {
+		if err := ws.WriteJSON(map[string]interface{}{"type": "teleport", "version": 1, "request_id": "r", "payload": map[string]interface{}{}}); err != nil {
+			t.Fatalf("failed to write JSON: %v", err)
+		}
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var frame protocol.ErrorFrame
+		if err := ws.ReadJSON(&frame); err != nil {
+			t.Fatalf("failed to read error frame %d: %v", i+1, err)
+		}
+		if frame.Error.Code != code {
+			t.Errorf("expected frame %d to carry %q, got %q", i+1, code, frame.Error.Code)
+		}
+		if code == protocol.CodeRateLimited && frame.Error.RetryAfterMs <= 0 {
+			t.Errorf("expected a retry-after value, got %+v", frame.Error)
+		}
+	}
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err := ws.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("expected the repeat offender to be disconnected with %d, got %v", websocket.ClosePolicyViolation, err)
+	}
+}
+
+// TestChatMessageHandler_RateLimitedUnknownTypes verifies that made-up frame types share one
+// limit instead of each getting a fresh one.
+func TestChatMessageHandler_RateLimitedUnknownTypes(t *testing.T) {
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, &messagecontroller.MessageController{}, broadcastcontroller.NewBroadcaster())
+	handler.RateLimiter = ratelimit.NewLimiter(ratelimit.Config{
+		Rules: map[string]ratelimit.Rule{chatmessagehandler.InvalidFrameType: {Rate: 0.001, Burst: 1}},
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], nil)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	expected := []protocol.Code{protocol.CodeUnknownType, protocol.CodeRateLimited, protocol.CodeRateLimited}
+	for i, code := range expected {
+		frameType := fmt.Sprintf("teleport-%d", i)
+		if err := ws.WriteJSON(map[string]interface{}{"type": frameType, "version": 1, "payload": map[string]interface{}{}}); err != nil {
+			t.Fatalf("failed to write JSON: %v", err)
+		}
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var frame protocol.ErrorFrame
+		if err := ws.ReadJSON(&frame); err != nil {
+			t.Fatalf("failed to read error frame %d: %v", i+1, err)
+		}
+		if frame.Error.Code != code {
+			t.Errorf("expected %s to be answered with %q, got %q", frameType, code, frame.Error.Code)
+		}
+	}
+}
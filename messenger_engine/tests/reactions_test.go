@@ -0,0 +1,199 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	messagecontroller "messenger_engine/controllers/message_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/message"
+	"shared/auth"
+)
+
+// TestAddReaction verifies that a new reaction is stored and reported with the emoji's count.
+func TestAddReaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage WHERE id = \\$1 FOR SHARE").
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(10, false))
+	mock.ExpectExec("INSERT INTO base_chatmessage_reaction").
+		WithArgs(42, 1, "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM base_chatmessage_reaction").
+		WithArgs(42, "👍").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectCommit()
+
+	update, added, err := newTestMessageController(db).AddReaction(1, 42, "👍")
+	if err != nil {
+		t.Fatalf("AddReaction() returned an unexpected error: %v", err)
+	}
+	if !added || update.Type != "reaction_added" || update.ChatId != 10 || update.Count != 3 {
+		t.Errorf("unexpected update: added=%v %+v", added, update)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestAddReaction_Repeated verifies that reacting twice with the same emoji changes nothing.
+func TestAddReaction_Repeated(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage").
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(10, false))
+	mock.ExpectExec("INSERT INTO base_chatmessage_reaction").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM base_chatmessage_reaction").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectCommit()
+
+	update, added, err := newTestMessageController(db).AddReaction(1, 42, "👍")
+	if err != nil {
+		t.Fatalf("AddReaction() returned an unexpected error: %v", err)
+	}
+	if added || update.Count != 1 {
+		t.Errorf("expected an unchanged reaction, got added=%v %+v", added, update)
+	}
+}
+
+// TestAddReaction_DeletedMessage verifies that deleted messages cannot be reacted to.
+func TestAddReaction_DeletedMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage").
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(10, true))
+	mock.ExpectRollback()
+
+	_, _, err = newTestMessageController(db).AddReaction(1, 42, "👍")
+	if !errors.Is(err, messagecontroller.ErrMessageDeleted) {
+		t.Errorf("expected ErrMessageDeleted, got %v", err)
+	}
+}
+
+// TestRemoveReaction verifies that taking back a reaction reports the emoji's remaining count.
+func TestRemoveReaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT chat_id FROM base_chatmessage WHERE id = \\$1").
+		WithArgs(42).
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id"}).AddRow(10))
+	mock.ExpectExec("DELETE FROM base_chatmessage_reaction").
+		WithArgs(42, 1, "👍").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM base_chatmessage_reaction").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectCommit()
+
+	update, removed, err := newTestMessageController(db).RemoveReaction(1, 42, "👍")
+	if err != nil {
+		t.Fatalf("RemoveReaction() returned an unexpected error: %v", err)
+	}
+	if !removed || update.Type != "reaction_removed" || update.Count != 0 {
+		t.Errorf("unexpected update: removed=%v %+v", removed, update)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestChatMessageHandler_Reaction verifies that a reaction is broadcast to the chat's subscribers
+// and that malformed emoji are rejected.
+func TestChatMessageHandler_Reaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m").WillReturnRows(sqlmock.NewRows(historyColumns))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT chat_id, is_deleted FROM base_chatmessage").
+		WillReturnRows(sqlmock.NewRows([]string{"chat_id", "is_deleted"}).AddRow(10, false))
+	mock.ExpectExec("INSERT INTO base_chatmessage_reaction").
+		WithArgs(42, 1, "🎉").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM base_chatmessage_reaction").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectCommit()
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, 1)}}
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+	if err != nil {
+		t.Fatalf("failed to connect to WebSocket: %v", err)
+	}
+	defer ws.Close()
+
+	// The initial page subscribes the connection to the chat
+	ws.WriteJSON(map[string]interface{}{"type": "initial", "version": protocol.Version, "payload": map[string]interface{}{"chat_id": 10}})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var page map[string]interface{}
+	if err := ws.ReadJSON(&page); err != nil || page["type"] != "initial" {
+		t.Fatalf("failed to load the chat: %v (%v)", page, err)
+	}
+
+	ws.WriteJSON(map[string]interface{}{
+		"type": "reaction_add", "version": protocol.Version, "request_id": "bad",
+		"payload": map[string]interface{}{"message_id": 42, "emoji": "a b"},
+	})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var errorFrame map[string]interface{}
+	if err := ws.ReadJSON(&errorFrame); err != nil {
+		t.Fatalf("failed to read error frame: %v", err)
+	}
+	if errorFrame["type"] != "error" || errorFrame["request_id"] != "bad" {
+		t.Errorf("expected an error frame for the malformed emoji, got %v", errorFrame)
+	}
+
+	ws.WriteJSON(map[string]interface{}{
+		"type": "reaction_add", "version": protocol.Version,
+		"payload": map[string]interface{}{"message_id": 42, "emoji": "🎉"},
+	})
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var update message.ReactionUpdate
+	if err := ws.ReadJSON(&update); err != nil {
+		t.Fatalf("failed to read reaction update: %v", err)
+	}
+	if update.Type != "reaction_added" || update.MessageId != 42 || update.UserId != 1 || update.Emoji != "🎉" || update.Count != 1 {
+		t.Errorf("unexpected reaction update: %+v", update)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
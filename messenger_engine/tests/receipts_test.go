@@ -0,0 +1,183 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/models/event"
+	"messenger_engine/models/message"
+	"shared/auth"
+)
+
+// TestMarkRead verifies that a read moves the high-water mark and names the authors of the newly read messages.
+func TestMarkRead(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT author_id, seq FROM base_chatmessage WHERE id = \\$1 AND chat_id = \\$2").
+		WithArgs(42, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "seq"}).AddRow(2, 5))
+	mock.ExpectQuery("INSERT INTO base_chat_read").
+		WithArgs(10, 1, int64(5)).
+		WillReturnRows(sqlmock.NewRows([]string{"read_at", "coalesce"}).AddRow(time.Now(), 3))
+	mock.ExpectQuery("SELECT DISTINCT author_id FROM base_chatmessage").
+		WithArgs(10, int64(3), int64(5), 1).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id"}).AddRow(2).AddRow(3))
+
+	receipt, authors, moved, err := newTestMessageController(db).MarkRead(1, 10, 42)
+	if err != nil {
+		t.Fatalf("MarkRead() returned an unexpected error: %v", err)
+	}
+	if !moved || receipt.LastReadSeq != 5 || receipt.UserId != 1 || receipt.Type != "message_read" {
+		t.Errorf("unexpected receipt: %+v (moved=%v)", receipt, moved)
+	}
+	if len(authors) != 2 || authors[0] != 2 || authors[1] != 3 {
+		t.Errorf("expected authors [2 3], got %v", authors)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestMarkRead_BelowHighWaterMark verifies that reads never move the mark backwards.
+func TestMarkRead_BelowHighWaterMark(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT author_id, seq FROM base_chatmessage").
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "seq"}).AddRow(2, 2))
+	mock.ExpectQuery("INSERT INTO base_chat_read").
+		WillReturnRows(sqlmock.NewRows([]string{"read_at", "coalesce"}))
+
+	if _, _, moved, err := newTestMessageController(db).MarkRead(1, 10, 40); err != nil || moved {
+		t.Errorf("MarkRead() = moved %v, %v; want false, nil", moved, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestMarkDelivered_OwnMessage verifies that authors do not record receipts for their own messages.
+func TestMarkDelivered_OwnMessage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT author_id, seq FROM base_chatmessage").
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "seq"}).AddRow(1, 2))
+
+	if _, _, recorded, err := newTestMessageController(db).MarkDelivered(1, 10, 42); err != nil || recorded {
+		t.Errorf("MarkDelivered() = recorded %v, %v; want false, nil", recorded, err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+// TestBroadcast_RecipientsOnly verifies that events for recipients only skip the chat's subscribers.
+func TestBroadcast_RecipientsOnly(t *testing.T) {
+	broadcaster := broadcastcontroller.NewBroadcaster()
+	go broadcaster.HandleMessages(nil)
+
+	subscriber, subscriberPeer := newConnPair(t)
+	author, authorPeer := newConnPair(t)
+	broadcaster.Subscribe(broadcaster.RegisterClient(subscriber), 10)
+	broadcaster.Identify(broadcaster.RegisterClient(author), 2)
+
+	broadcaster.Publish(event.Event{
+		Type:           event.MessageDelivered,
+		ChatId:         10,
+		Payload:        message.DeliveryReceipt{Type: "message_delivered", ChatId: 10, MessageId: 42, UserId: 1},
+		Recipients:     []int{2},
+		RecipientsOnly: true,
+	})
+
+	authorPeer.SetReadDeadline(time.Now().Add(time.Second))
+	var receipt message.DeliveryReceipt
+	if err := authorPeer.ReadJSON(&receipt); err != nil || receipt.MessageId != 42 {
+		t.Fatalf("expected the author to receive the receipt, got %+v (%v)", receipt, err)
+	}
+
+	subscriberPeer.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if err := subscriberPeer.ReadJSON(&receipt); err == nil {
+		t.Errorf("chat subscriber received a receipt meant for the author: %+v", receipt)
+	}
+}
+
+// TestChatMessageHandler_DeliveredReceipt verifies that a "delivered" frame is recorded and
+// forwarded to the connections of the message's author.
+func TestChatMessageHandler_DeliveredReceipt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer db.Close()
+
+	deliveredAt := time.Now()
+	mock.ExpectQuery("SELECT author_id, seq FROM base_chatmessage").
+		WithArgs(42, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"author_id", "seq"}).AddRow(2, 7))
+	mock.ExpectQuery("INSERT INTO base_chatmessage_receipt").
+		WithArgs(42, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"delivered_at"}).AddRow(deliveredAt))
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	dial := func(userID int) *websocket.Conn {
+		header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, userID)}}
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		t.Cleanup(func() { ws.Close() })
+		return ws
+	}
+
+	// A round trip guarantees the author's connection is registered before the receipt is sent
+	author := dial(2)
+	author.WriteJSON(map[string]interface{}{"type": "teleport", "version": 1, "payload": map[string]interface{}{}})
+	author.SetReadDeadline(time.Now().Add(time.Second))
+	var errorFrame map[string]interface{}
+	if err := author.ReadJSON(&errorFrame); err != nil {
+		t.Fatalf("failed to read error frame: %v", err)
+	}
+
+	recipient := dial(1)
+	if err := recipient.WriteJSON(map[string]interface{}{
+		"type": "delivered", "version": 1, "payload": map[string]interface{}{"chat_id": 10, "message_id": 42},
+	}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	author.SetReadDeadline(time.Now().Add(time.Second))
+	var receipt message.DeliveryReceipt
+	if err := author.ReadJSON(&receipt); err != nil {
+		t.Fatalf("author failed to read the receipt: %v", err)
+	}
+	if receipt.Type != "message_delivered" || receipt.MessageId != 42 || receipt.UserId != 1 {
+		t.Errorf("unexpected receipt: %+v", receipt)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/websocket"
+
+	broadcastcontroller "messenger_engine/controllers/broadcast_controller"
+	chatmessagehandler "messenger_engine/controllers/websocket_controller/handlers/chat_message_handler"
+	"messenger_engine/controllers/websocket_controller/protocol"
+	"messenger_engine/models/chat"
+	"shared/auth"
+)
+
+// dialTypingChat connects the typist (user 1) and a partner (user 2) to chat 10 and returns both
+// connections. Any database access besides loading the chat's (empty) history fails the test.
+func dialTypingChat(t *testing.T, timeout time.Duration) (*websocket.Conn, *websocket.Conn) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT (.+) FROM base_chatmessage AS m").WillReturnRows(sqlmock.NewRows(historyColumns))
+	}
+
+	config := testAuthConfig()
+	handler := chatmessagehandler.NewChatMessageHandler(websocket.Upgrader{}, newTestMessageController(db), broadcastcontroller.NewBroadcaster())
+	handler.Authenticator = auth.NewAuthenticator(config)
+	handler.TypingTimeout = timeout
+	go handler.Broadcast.HandleMessages(nil)
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	dial := func(userID int) *websocket.Conn {
+		header := http.Header{"Authorization": {"Bearer " + signTestToken(t, config, userID)}}
+		ws, _, err := websocket.DefaultDialer.Dial("ws"+server.URL[4:], header)
+		if err != nil {
+			t.Fatalf("failed to connect to WebSocket: %v", err)
+		}
+		t.Cleanup(func() { ws.Close() })
+
+		// The initial page confirms the subscription before anyone starts typing
+		ws.WriteJSON(map[string]interface{}{"type": "initial", "version": protocol.Version, "payload": map[string]interface{}{"chat_id": 10}})
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		var page map[string]interface{}
+		if err := ws.ReadJSON(&page); err != nil || page["type"] != "initial" {
+			t.Fatalf("failed to load the chat: %v (%v)", page, err)
+		}
+		return ws
+	}
+	return dial(1), dial(2)
+}
+
+// readTyping reads the next typing indicator from the connection.
+func readTyping(t *testing.T, ws *websocket.Conn) chat.TypingIndicator {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	var indicator chat.TypingIndicator
+	if err := ws.ReadJSON(&indicator); err != nil {
+		t.Fatalf("failed to read typing indicator: %v", err)
+	}
+	return indicator
+}
+
+// TestChatMessageHandler_TypingExpires verifies that typing indicators reach the other participants
+// only and stop by themselves when no typing_stop arrives.
+func TestChatMessageHandler_TypingExpires(t *testing.T) {
+	typist, partner := dialTypingChat(t, 100*time.Millisecond)
+
+	if err := typist.WriteJSON(map[string]interface{}{
+		"type": "typing_start", "version": protocol.Version, "payload": map[string]interface{}{"chat_id": 10},
+	}); err != nil {
+		t.Fatalf("failed to write JSON: %v", err)
+	}
+
+	started := readTyping(t, partner)
+	if started.Type != "typing_started" || started.ChatId != 10 || started.UserId != 1 || started.ExpiresAt == nil {
+		t.Errorf("unexpected typing indicator: %+v", started)
+	}
+	if stopped := readTyping(t, partner); stopped.Type != "typing_stopped" || stopped.UserId != 1 {
+		t.Errorf("expected the indicator to expire, got %+v", stopped)
+	}
+
+	typist.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	var echoed map[string]interface{}
+	if err := typist.ReadJSON(&echoed); err == nil {
+		t.Errorf("typist received its own indicator: %v", echoed)
+	}
+}
+
+// TestChatMessageHandler_TypingStopsOnDisconnect verifies that closing the typist's connection
+// stops its indicators without waiting for the timeout.
+func TestChatMessageHandler_TypingStopsOnDisconnect(t *testing.T) {
+	typist, partner := dialTypingChat(t, time.Minute)
+
+	typist.WriteJSON(map[string]interface{}{
+		"type": "typing_start", "version": protocol.Version, "payload": map[string]interface{}{"chat_id": 10},
+	})
+	if started := readTyping(t, partner); started.Type != "typing_started" {
+		t.Fatalf("expected typing_started, got %+v", started)
+	}
+
+	typist.Close()
+	if stopped := readTyping(t, partner); stopped.Type != "typing_stopped" || stopped.UserId != 1 {
+		t.Errorf("expected typing_stopped after disconnect, got %+v", stopped)
+	}
+}
@@ -0,0 +1,157 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shared/urlresolver"
+)
+
+// newMediaServer returns a media service stub answering with the given handler and counting its requests.
+func newMediaServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *int32) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+// TestResolver_FetchesConcurrentlyAndCaches verifies that a result set is resolved with
+// concurrent requests, duplicates are fetched once and results are served from the cache.
+func TestResolver_FetchesConcurrentlyAndCaches(t *testing.T) {
+	expires := time.Now().Add(time.Hour).Unix()
+	server, hits := newMediaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Fprintf(w, `{"STATUS": "success", "PRESIGNED_URL": "https://cdn.example.com/%s.jpg?expires=%d"}`, r.URL.Query().Get("user_id"), expires)
+	})
+
+	resolver := urlresolver.New(urlresolver.DefaultConfig())
+	urls := []string{server.URL + "?user_id=1", server.URL + "?user_id=2", server.URL + "?user_id=3", server.URL + "?user_id=1"}
+
+	started := time.Now()
+	resolved := resolver.Resolve(context.Background(), urls)
+	if elapsed := time.Since(started); elapsed > 250*time.Millisecond {
+		t.Errorf("expected the requests to run concurrently, took %v", elapsed)
+	}
+	if len(resolved) != 3 || resolved[urls[1]][0] != fmt.Sprintf("https://cdn.example.com/2.jpg?expires=%d", expires) {
+		t.Errorf("unexpected result: %v", resolved)
+	}
+	if *hits != 3 {
+		t.Errorf("expected 3 requests, got %d", *hits)
+	}
+
+	if resolved := resolver.Resolve(context.Background(), urls[:2]); len(resolved) != 2 || *hits != 3 {
+		t.Errorf("expected cached results without requests, got %v after %d requests", resolved, *hits)
+	}
+}
+
+// TestResolver_ExpiringURLsAreNotCached verifies that URLs about to expire are fetched again,
+// and that lists of URLs are resolved.
+func TestResolver_ExpiringURLsAreNotCached(t *testing.T) {
+	signedAt := time.Now().UTC().Format("20060102T150405Z")
+	server, hits := newMediaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"STATUS": "success", "PRESIGNED_URL": ["https://cdn.example.com/a.jpg?X-Amz-Date=%s&X-Amz-Expires=10", "https://cdn.example.com/b.jpg"]}`, signedAt)
+	})
+
+	resolver := urlresolver.New(urlresolver.DefaultConfig())
+	for i := 0; i < 2; i++ {
+		resolved := resolver.Resolve(context.Background(), []string{server.URL + "?place_id=1"})
+		if len(resolved[server.URL+"?place_id=1"]) != 2 {
+			t.Fatalf("expected two media URLs, got %v", resolved)
+		}
+	}
+	if *hits != 2 {
+		t.Errorf("expected the URLs expiring within the margin to be fetched twice, got %d requests", *hits)
+	}
+}
+
+// TestResolver_Timeout verifies that a slow media service leaves the URLs out instead of blocking.
+func TestResolver_Timeout(t *testing.T) {
+	server, _ := newMediaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+
+	config := urlresolver.DefaultConfig()
+	config.Timeout = 50 * time.Millisecond
+	resolver := urlresolver.New(config)
+
+	started := time.Now()
+	resolved := resolver.Resolve(context.Background(), []string{server.URL + "?user_id=1"})
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the request to time out, took %v", elapsed)
+	}
+	if len(resolved) != 0 {
+		t.Errorf("expected no URLs, got %v", resolved)
+	}
+}
+
+// TestResolver_CircuitBreaker verifies that a failing media service is skipped after repeated
+// failures and probed again once the cooldown passed.
+func TestResolver_CircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	server, hits := newMediaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, `{"STATUS": "success", "PRESIGNED_URL": "https://cdn.example.com/1.jpg"}`)
+	})
+
+	config := urlresolver.DefaultConfig()
+	config.Concurrency = 1
+	config.FailureThreshold = 2
+	config.Cooldown = 100 * time.Millisecond
+	resolver := urlresolver.New(config)
+
+	urls := []string{server.URL + "?user_id=1", server.URL + "?user_id=2", server.URL + "?user_id=3"}
+	if resolved := resolver.Resolve(context.Background(), urls); len(resolved) != 0 {
+		t.Errorf("expected no URLs, got %v", resolved)
+	}
+	if *hits != 2 {
+		t.Errorf("expected the breaker to open after 2 failures, got %d requests", *hits)
+	}
+	resolver.Resolve(context.Background(), urls)
+	if *hits != 2 {
+		t.Errorf("expected the open breaker to skip the media service, got %d requests", *hits)
+	}
+
+	healthy.Store(true)
+	time.Sleep(150 * time.Millisecond)
+	if resolved := resolver.Resolve(context.Background(), urls[:1]); len(resolved[urls[0]]) != 1 {
+		t.Errorf("expected the probe to succeed, got %v", resolved)
+	}
+	if resolved := resolver.Resolve(context.Background(), urls[1:]); len(resolved) != 2 {
+		t.Errorf("expected the closed breaker to resolve every URL, got %v", resolved)
+	}
+}
+
+// TestResolver_SendsServiceToken verifies that every request carries the configured service token.
+func TestResolver_SendsServiceToken(t *testing.T) {
+	server, _ := newMediaServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer service-token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"STATUS": "success", "PRESIGNED_URL": "https://cdn.example.com/1.jpg"}`)
+	})
+
+	config := urlresolver.DefaultConfig()
+	config.ServiceToken = "service-token"
+	urls := []string{server.URL + "?user_id=1"}
+	if resolved := urlresolver.New(config).Resolve(context.Background(), urls); len(resolved[urls[0]]) != 1 {
+		t.Errorf("expected the URL to be resolved with the service token, got %v", resolved)
+	}
+	if resolved := urlresolver.New(urlresolver.DefaultConfig()).Resolve(context.Background(), urls); len(resolved) != 0 {
+		t.Errorf("expected the lookup without the service token to be rejected, got %v", resolved)
+	}
+}
@@ -1,15 +1,17 @@
 package placecontroller
 
 import (
-	"places_search/controllers/base_controller"
-	"places_search/modules/database/database"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"places_search/utils"
-	"strconv"
+	"places_search/controllers/base_controller"
+	"places_search/modules/database/database"
 )
 
+// PlaceMediaServiceURL is the media service endpoint returning presigned URLs of place media.
+const PlaceMediaServiceURL = "http://127.0.0.1:8170"
+
 // PlaceController handles operations related to retrieving place information from the database.
 //
 // Fields:
@@ -17,9 +19,17 @@ import (
 // PlaceController handles database operations and embeds BaseController for database access.
 type PlaceController struct {
 	*basecontroller.BaseController
+	Media UrlResolver // Resolves the presigned URLs of place media; nil leaves them empty
+}
+
+// UrlResolver fetches the presigned URLs of a whole result set at once.
+// It is implemented by *urlresolver.Resolver.
+type UrlResolver interface {
+	Resolve(ctx context.Context, urls []string) map[string][]string
 }
 
 // NewPlaceController creates a new instance of PlaceController.
+// Media is left nil; set it to resolve the presigned URLs of place media.
 func NewPlaceController(db *database.Database) *PlaceController {
 	return &PlaceController{
 		BaseController: &basecontroller.BaseController{Database: db},
@@ -97,8 +107,9 @@ func (pc *PlaceController) GetPlaceWithHashtag(hashtag string) ([]byte, error) {
 
 // getPlaces executes a query to fetch place details and appends presigned media URLs.
 //
-// The function runs a database query, iterates over results, retrieves media URLs, and
-// returns a JSON-encoded list of places.
+// The function runs a database query, iterates over results, resolves the media URLs of
+// all places in one batch, and returns a JSON-encoded list of places. Places whose media
+// cannot be resolved get an empty "places_media" list.
 //
 // Parameters:
 //   - query: A string containing the SQL query to execute.
@@ -141,14 +152,7 @@ func (pc *PlaceController) getPlaces(query string, arg interface{}) ([]byte, err
 			"created_by_username": createdByUsername,
 			"place_comment_count": placeCommentCount,
 			"place_likes_count":   placeLikesCount,
-		}
-
-		// Fetch the presigned URL for place media.
-		urlString := fmt.Sprintf("http://127.0.0.1:8170?place_id=%s", strconv.Itoa(placeID))
-		if presignedResponse, err := utils.GetPresignedURL(urlString); err != nil {
-			log.Printf("Error retrieving presigned URL for place %d: %v", placeID, err)
-		} else {
-			place["places_media"] = presignedResponse.PresignedURL
+			"places_media":        []string{},
 		}
 
 		results = append(results, place)
@@ -160,6 +164,8 @@ func (pc *PlaceController) getPlaces(query string, arg interface{}) ([]byte, err
 		return nil, err
 	}
 
+	pc.addMedia(results)
+
 	// Convert results to JSON.
 	jsonData, err := json.Marshal(results)
 	if err != nil {
@@ -168,3 +174,31 @@ func (pc *PlaceController) getPlaces(query string, arg interface{}) ([]byte, err
 
 	return jsonData, nil
 }
+
+// addMedia sets "places_media" of every place to the presigned URLs of its media.
+// The media of all places are resolved at once; places whose media cannot be resolved
+// keep an empty list.
+//
+// Parameters:
+//   - places: The places to add the media to.
+func (pc *PlaceController) addMedia(places []map[string]interface{}) {
+	if pc.Media == nil || len(places) == 0 {
+		return
+	}
+
+	urls := make([]string, 0, len(places))
+	for _, place := range places {
+		urls = append(urls, placeMediaURL(place["place_id"].(int)))
+	}
+	media := pc.Media.Resolve(context.Background(), urls)
+	for _, place := range places {
+		if resolved := media[placeMediaURL(place["place_id"].(int))]; len(resolved) > 0 {
+			place["places_media"] = resolved
+		}
+	}
+}
+
+// placeMediaURL returns the media service URL answering with the presigned URLs of a place's media.
+func placeMediaURL(placeID int) string {
+	return fmt.Sprintf("%s?place_id=%d", PlaceMediaServiceURL, placeID)
+}
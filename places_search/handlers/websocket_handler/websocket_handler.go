@@ -8,6 +8,10 @@ import (
 
 	"github.com/gorilla/websocket"
 	placecontroller "places_search/controllers/place_controller"
+	"shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
+	"shared/ratelimit"
 )
 
 // Message represents the incoming WebSocket JSON message.
@@ -18,8 +22,11 @@ type Message struct {
 
 // WebSocketHandler handles WebSocket connections and processes messages from clients.
 type WebSocketHandler struct {
-	upgrader websocket.Upgrader // WebSocket upgrader to upgrade HTTP connection to WebSocket.
-	pCtrl    placecontroller.PlaceControllerInterface // A pointer to the PlaceController for querying place data.
+	upgrader      websocket.Upgrader                       // WebSocket upgrader to upgrade HTTP connection to WebSocket.
+	pCtrl         placecontroller.PlaceControllerInterface // A pointer to the PlaceController for querying place data.
+	Authenticator *auth.Authenticator                      // Verifies the handshake token; nil accepts unauthenticated clients.
+	Lifecycle     lifecycle.Config                         // Heartbeat, deadline and frame size settings applied to every connection.
+	RateLimiter   *ratelimit.Limiter                       // Limits queries per user (or remote IP); nil disables limiting.
 }
 
 // NewWebSocketHandler creates and returns a new WebSocketHandler instance.
@@ -38,7 +45,9 @@ func NewWebSocketHandler(pCtrl placecontroller.PlaceControllerInterface) *WebSoc
 				return true
 			},
 		},
-		pCtrl: pCtrl,
+		pCtrl:       pCtrl,
+		Lifecycle:   lifecycle.DefaultConfig(),
+		RateLimiter: ratelimit.NewLimiter(ratelimit.DefaultQueryLimits()),
 	}
 }
 
@@ -48,27 +57,59 @@ func NewWebSocketHandler(pCtrl placecontroller.PlaceControllerInterface) *WebSoc
 // Parameters:
 //   - w: The HTTP response writer used to send the WebSocket response.
 //   - r: The HTTP request that initiated the WebSocket connection.
+//
+// When an Authenticator is configured, handshakes without a valid token are rejected with 401.
 func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Verify the access token before upgrading the connection.
+	var callerID int
+	if wsh.Authenticator != nil {
+		var err error
+		if callerID, err = wsh.Authenticator.Authenticate(r); err != nil {
+			log.Printf("Rejected unauthenticated connection: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	// Upgrade the HTTP connection to a WebSocket connection.
-	conn, err := wsh.upgrader.Upgrade(w, r, nil)
+	ws, err := wsh.upgrader.Upgrade(w, r, codec.Negotiate(r))
 	if err != nil {
 		log.Printf("Error upgrading to websocket: %v", err)
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+
+	// Ping the client and stop reading once it no longer answers.
+	heartbeat := lifecycle.Start(ws, wsh.Lifecycle)
+	defer heartbeat.Stop()
+
+	// Replies are encoded in the format negotiated through Sec-WebSocket-Protocol (JSON by default).
+	conn := codec.Wrap(ws)
+	conn.WriteTimeout = wsh.Lifecycle.WriteTimeout
+
+	// Queries are rate limited per authenticated user, or per remote IP for anonymous connections.
+	key := ratelimit.Key(callerID, r)
 
 	// Continuously listen for incoming messages from the WebSocket connection.
 	for {
 		// Read the next WebSocket message.
-		msgType, msgData, err := conn.ReadMessage()
+		_, msgData, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Error reading websocket message: %v", err)
 			break
 		}
 
-		// Parse the incoming JSON message.
+		// Reject queries over the rate limit, and disconnect callers that keep exceeding it.
+		if decision := ratelimit.LimitQuery(wsh.RateLimiter, conn, heartbeat, key); !decision.Allowed {
+			if decision.Disconnect {
+				break
+			}
+			continue
+		}
+
+		// Decode the incoming message with the negotiated codec.
 		var msg Message
-		if err := json.Unmarshal(msgData, &msg); err != nil {
+		if err := conn.Codec.Unmarshal(msgData, &msg); err != nil {
 			log.Printf("Error unmarshaling JSON: %v", err)
 			continue
 		}
@@ -90,7 +131,7 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Send the JSON response back to the client.
-		if err := conn.WriteMessage(msgType, jsonResponse); err != nil {
+		if err := conn.WriteJSON(json.RawMessage(jsonResponse)); err != nil {
 			log.Printf("Error sending websocket message: %v", err)
 			break
 		}
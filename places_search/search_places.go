@@ -7,10 +7,14 @@ import (
 	"os/signal"
 	"syscall"
 
-	"places_search/handlers/websocket_handler"
 	"places_search/controllers/base_controller"
-	"places_search/modules/database/database"
 	"places_search/controllers/place_controller"
+	"places_search/handlers/websocket_handler"
+	"places_search/modules/database/database"
+	"shared/auth"
+	"shared/lifecycle"
+	"shared/ratelimit"
+	"shared/urlresolver"
 )
 
 // main is the entry point of the application.
@@ -22,10 +26,19 @@ func main() {
 
 	// Initialize controllers with the database instance.
 	baseCtrl := basecontroller.BaseController{Database: dbPool}
-	dbCtrl := placecontroller.PlaceController{BaseController: &baseCtrl}
+	dbCtrl := placecontroller.PlaceController{BaseController: &baseCtrl, Media: urlresolver.New(urlresolver.LoadConfig())}
+
+	// Load the token verification settings for the WebSocket handshake.
+	authConfig, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading auth config: %v", err)
+	}
 
 	// Set up the WebSocket handler with the PlaceController.
 	wsHandler := websockethandler.NewWebSocketHandler(&dbCtrl)
+	wsHandler.Authenticator = auth.NewAuthenticator(authConfig)
+	wsHandler.Lifecycle = lifecycle.LoadConfig()
+	wsHandler.RateLimiter = ratelimit.NewLimiter(ratelimit.LoadConfig(ratelimit.DefaultQueryLimits()))
 
 	// Register the WebSocket handler and start the HTTP server.
 	http.Handle("/", wsHandler)
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrMissingToken is returned when the request carries no access token.
+var ErrMissingToken = errors.New("missing access token")
+
+// Authenticator verifies the access token presented with a request.
+type Authenticator struct {
+	config *Config
+	now    func() time.Time
+}
+
+// NewAuthenticator creates an Authenticator that verifies tokens with the given config.
+//
+// Parameters:
+//   - config: The token verification settings.
+//
+// Returns:
+//   - A pointer to a newly created Authenticator.
+func NewAuthenticator(config *Config) *Authenticator {
+	return &Authenticator{config: config, now: time.Now}
+}
+
+// Authenticate extracts the access token from the request and returns
+// the ID of the user it was issued to. The token is read from the
+// "Authorization: Bearer <token>" header, or from the "token" query parameter
+// for clients that cannot set headers, such as browsers opening a WebSocket.
+//
+// Parameters:
+//   - r: The HTTP request to authenticate, e.g. a WebSocket handshake.
+//
+// Returns:
+//   - The authenticated user ID.
+//   - An error if the token is missing or invalid.
+func (a *Authenticator) Authenticate(r *http.Request) (int, error) {
+	token := TokenFromRequest(r)
+	if token == "" {
+		return 0, ErrMissingToken
+	}
+
+	claims, err := VerifyToken(token, a.config, a.now())
+	if err != nil {
+		return 0, err
+	}
+	return claims.UserID()
+}
+
+// TokenFromRequest returns the bearer token from the header or the query string,
+// e.g. to forward the caller's token to another service.
+func TokenFromRequest(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return r.URL.Query().Get("token")
+}
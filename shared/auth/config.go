@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the settings used to verify access tokens.
+type Config struct {
+	Secret []byte        // HMAC key used to sign and verify tokens.
+	Issuer string        // Expected "iss" claim; empty disables the check.
+	Leeway time.Duration // Allowed clock skew when checking "exp" and "nbf".
+}
+
+// LoadConfig reads the token verification settings from environment variables:
+//   - JWT_SECRET: the HMAC key (required).
+//   - JWT_ISSUER: the expected issuer (optional).
+//   - JWT_LEEWAY_SECONDS: allowed clock skew in seconds (optional, defaults to 30).
+//
+// Returns:
+//   - A pointer to the loaded Config.
+//   - An error if JWT_SECRET is missing or JWT_LEEWAY_SECONDS is malformed.
+func LoadConfig() (*Config, error) {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("JWT_SECRET is not set")
+	}
+
+	leeway := 30 * time.Second
+	if raw := os.Getenv("JWT_LEEWAY_SECONDS"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid JWT_LEEWAY_SECONDS: %q", raw)
+		}
+		leeway = time.Duration(seconds) * time.Second
+	}
+
+	return &Config{
+		Secret: []byte(secret),
+		Issuer: os.Getenv("JWT_ISSUER"),
+		Leeway: leeway,
+	}, nil
+}
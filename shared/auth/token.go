@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformedToken is returned when a token is not a well-formed JWT.
+	ErrMalformedToken = errors.New("malformed token")
+	// ErrInvalidSignature is returned when the token signature does not match.
+	ErrInvalidSignature = errors.New("invalid token signature")
+	// ErrExpiredToken is returned when the token is expired or not valid yet.
+	ErrExpiredToken = errors.New("token expired or not yet valid")
+	// ErrInvalidClaims is returned when the token does not identify a user or never expires.
+	ErrInvalidClaims = errors.New("invalid token claims")
+)
+
+// header is the JOSE header of an HS256 token.
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// Claims represents the JWT claims understood by the services.
+//
+// Fields:
+//   - Subject: The "sub" claim; holds the user ID when UserId is not set.
+//   - UserId: The ID of the authenticated user.
+//   - Issuer: The issuer of the token.
+//   - ExpiresAt: Unix time after which the token is rejected.
+//   - NotBefore: Unix time before which the token is rejected.
+//   - IssuedAt: Unix time when the token was issued.
+type Claims struct {
+	Subject   string `json:"sub,omitempty"`
+	UserId    int    `json:"user_id,omitempty"`
+	Issuer    string `json:"iss,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// UserID resolves the authenticated user ID from the "user_id" or "sub" claim.
+func (c *Claims) UserID() (int, error) {
+	if c.UserId > 0 {
+		return c.UserId, nil
+	}
+	id, err := strconv.Atoi(c.Subject)
+	if err != nil || id <= 0 {
+		return 0, ErrInvalidClaims
+	}
+	return id, nil
+}
+
+// SignToken creates an HS256-signed JWT for the given claims.
+// It is used to issue tokens for local development and tests.
+//
+// Parameters:
+//   - claims: The claims to embed into the token.
+//   - secret: The HMAC key used to sign the token.
+//
+// Returns:
+//   - The encoded token.
+//   - An error if the claims cannot be encoded.
+func SignToken(claims Claims, secret []byte) (string, error) {
+	headerJSON, err := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encodeSegment(headerJSON) + "." + encodeSegment(claimsJSON)
+	return signingInput + "." + encodeSegment(sign(signingInput, secret)), nil
+}
+
+// VerifyToken checks the signature and time-based claims of an HS256 JWT.
+// Tokens must carry an "exp" claim.
+//
+// Parameters:
+//   - token: The encoded token.
+//   - config: The verification settings.
+//   - now: The current time.
+//
+// Returns:
+//   - A pointer to the verified Claims.
+//   - An error describing why the token was rejected.
+func VerifyToken(token string, config *Config, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformedToken
+	}
+
+	headerJSON, err := decodeSegment(parts[0])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var h header
+	if err := json.Unmarshal(headerJSON, &h); err != nil {
+		return nil, ErrMalformedToken
+	}
+	// Only HS256 is accepted; this also rejects "none".
+	if h.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrMalformedToken, h.Alg)
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	if !hmac.Equal(signature, sign(parts[0]+"."+parts[1], config.Secret)) {
+		return nil, ErrInvalidSignature
+	}
+
+	claimsJSON, err := decodeSegment(parts[1])
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	// A token without "exp" would stay valid forever once leaked
+	if claims.ExpiresAt == 0 {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidClaims)
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(config.Leeway)) {
+		return nil, ErrExpiredToken
+	}
+	if claims.NotBefore != 0 && now.Add(config.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrExpiredToken
+	}
+	if config.Issuer != "" && claims.Issuer != config.Issuer {
+		return nil, ErrInvalidClaims
+	}
+
+	return &claims, nil
+}
+
+// sign computes the HMAC-SHA256 of the signing input.
+func sign(signingInput string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// encodeSegment encodes a token segment using unpadded base64url.
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeSegment decodes an unpadded base64url token segment.
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
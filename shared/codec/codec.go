@@ -0,0 +1,100 @@
+package codec
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// Subprotocol names negotiated through the Sec-WebSocket-Protocol header.
+const (
+	JSONSubprotocol    = "json.v1"
+	MsgpackSubprotocol = "msgpack.v1"
+)
+
+// Codec encodes and decodes the frames exchanged over a WebSocket connection.
+type Codec interface {
+	// Subprotocol returns the Sec-WebSocket-Protocol name the codec is negotiated under.
+	Subprotocol() string
+	// MessageType returns the WebSocket frame type (text or binary) the codec writes.
+	MessageType() int
+	// Marshal encodes v into a single frame.
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes a single frame into v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// registry lists the supported codecs.
+var registry = []Codec{JSON, Msgpack}
+
+// Negotiate selects the first subprotocol offered by the client that has a registered codec,
+// honouring the client's order of preference, and returns the response header announcing it.
+// Pass the result to websocket.Upgrader.Upgrade; clients offering no supported subprotocol
+// get no header and fall back to JSON.
+//
+// Parameters:
+//   - r: The handshake request.
+//
+// Returns:
+//   - The response header for the upgrade, or nil if nothing was negotiated.
+func Negotiate(r *http.Request) http.Header {
+	for _, offered := range websocket.Subprotocols(r) {
+		for _, c := range registry {
+			if c.Subprotocol() == offered {
+				return http.Header{"Sec-Websocket-Protocol": {offered}}
+			}
+		}
+	}
+	return nil
+}
+
+// ForSubprotocol returns the codec registered under the given subprotocol name.
+// Clients that did not negotiate a subprotocol (name == "") get the JSON codec,
+// which keeps existing clients working unchanged.
+//
+// Parameters:
+//   - name: The subprotocol selected during the handshake.
+//
+// Returns:
+//   - The matching Codec, or JSON if the name is empty or unknown.
+func ForSubprotocol(name string) Codec {
+	for _, c := range registry {
+		if c.Subprotocol() == name {
+			return c
+		}
+	}
+	return JSON
+}
+
+// ForConn returns the codec negotiated on an upgraded connection.
+//
+// Parameters:
+//   - conn: The upgraded WebSocket connection.
+//
+// Returns:
+//   - The Codec matching conn.Subprotocol().
+func ForConn(conn *websocket.Conn) Codec {
+	return ForSubprotocol(conn.Subprotocol())
+}
+
+// ToJSON re-encodes a frame decoded with c as JSON, so that handlers built around
+// JSON decoding and validation can serve every negotiated format.
+//
+// Parameters:
+//   - c: The codec the frame was encoded with.
+//   - data: The raw frame.
+//
+// Returns:
+//   - The frame as JSON.
+//   - An error if the frame cannot be decoded.
+func ToJSON(c Codec, data []byte) ([]byte, error) {
+	if c.Subprotocol() == JSONSubprotocol {
+		return data, nil
+	}
+	var v interface{}
+	if err := c.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Conn pairs an upgraded WebSocket connection with the codec negotiated on it.
+type Conn struct {
+	*websocket.Conn
+	Codec        Codec         // Wire format negotiated during the handshake.
+	WriteTimeout time.Duration // Deadline for a single write; zero disables it.
+}
+
+// Wrap returns the connection together with its negotiated codec.
+// Writes have no deadline until WriteTimeout is set.
+//
+// Parameters:
+//   - conn: The upgraded WebSocket connection.
+//
+// Returns:
+//   - A pointer to the wrapping Conn.
+func Wrap(conn *websocket.Conn) *Conn {
+	return &Conn{Conn: conn, Codec: ForConn(conn)}
+}
+
+// WriteJSON encodes v with the negotiated codec and writes it as a single frame.
+// It shadows websocket.Conn.WriteJSON, so writers that only know about JSON
+// (such as the error handler) transparently honour the negotiated format.
+//
+// Parameters:
+//   - v: The value to send.
+//
+// Returns:
+//   - An error if encoding or writing fails.
+func (c *Conn) WriteJSON(v interface{}) error {
+	data, err := c.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if c.WriteTimeout > 0 {
+		c.Conn.SetWriteDeadline(time.Now().Add(c.WriteTimeout))
+	}
+	return c.Conn.WriteMessage(c.Codec.MessageType(), data)
+}
@@ -0,0 +1,28 @@
+package codec
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+)
+
+// JSON is the default codec, writing JSON text frames.
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return JSONSubprotocol }
+
+func (jsonCodec) MessageType() int { return websocket.TextMessage }
+
+// Marshal encodes v as JSON. Pre-encoded json.RawMessage values are written as is.
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
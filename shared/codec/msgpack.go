@@ -0,0 +1,46 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Msgpack is the MessagePack codec, writing binary frames.
+// Struct fields are named after their `json` tags, so both formats carry the same keys.
+var Msgpack Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Subprotocol() string { return MsgpackSubprotocol }
+
+func (msgpackCodec) MessageType() int { return websocket.BinaryMessage }
+
+// Marshal encodes v as MessagePack. Pre-encoded json.RawMessage values (such as events
+// relayed through the backplane) are transcoded rather than written as opaque bytes.
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	if raw, ok := v.(json.RawMessage); ok {
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err != nil {
+			return nil, err
+		}
+		v = decoded
+	}
+
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
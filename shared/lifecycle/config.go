@@ -0,0 +1,72 @@
+package lifecycle
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the keepalive and deadline settings applied to every WebSocket connection.
+type Config struct {
+	PingInterval   time.Duration // How often the server pings the client.
+	PongTimeout    time.Duration // How long the server waits for any pong before reaping the connection.
+	WriteTimeout   time.Duration // Deadline for a single write, including pings.
+	MaxMessageSize int64         // Largest inbound frame accepted, in bytes.
+}
+
+// DefaultConfig returns the connection settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		PingInterval:   25 * time.Second,
+		PongTimeout:    60 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxMessageSize: 64 * 1024,
+	}
+}
+
+// LoadConfig reads the connection settings from environment variables, falling back to
+// DefaultConfig for unset or malformed values:
+//   - WS_PING_INTERVAL_MS: interval between server pings, in milliseconds.
+//   - WS_PONG_TIMEOUT_MS: how long a connection may stay silent before it is reaped, in milliseconds.
+//   - WS_WRITE_TIMEOUT_MS: deadline for a single write, in milliseconds.
+//   - WS_MAX_MESSAGE_SIZE: largest inbound frame accepted, in bytes.
+//
+// A ping interval that is not shorter than the pong timeout is lowered to 90% of the timeout,
+// since otherwise healthy connections would be reaped between two pings.
+func LoadConfig() Config {
+	config := DefaultConfig()
+
+	config.PingInterval = durationFromEnv("WS_PING_INTERVAL_MS", config.PingInterval)
+	config.PongTimeout = durationFromEnv("WS_PONG_TIMEOUT_MS", config.PongTimeout)
+	config.WriteTimeout = durationFromEnv("WS_WRITE_TIMEOUT_MS", config.WriteTimeout)
+
+	if raw := os.Getenv("WS_MAX_MESSAGE_SIZE"); raw != "" {
+		if size, err := strconv.ParseInt(raw, 10, 64); err == nil && size > 0 {
+			config.MaxMessageSize = size
+		} else {
+			log.Printf("Ignoring invalid WS_MAX_MESSAGE_SIZE %q", raw)
+		}
+	}
+
+	if config.PingInterval >= config.PongTimeout {
+		log.Printf("WS_PING_INTERVAL_MS must be shorter than WS_PONG_TIMEOUT_MS; pinging every %v", config.PongTimeout*9/10)
+		config.PingInterval = config.PongTimeout * 9 / 10
+	}
+
+	return config
+}
+
+// durationFromEnv reads a positive number of milliseconds from the named variable.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	ms, err := strconv.Atoi(raw)
+	if err != nil || ms <= 0 {
+		log.Printf("Ignoring invalid %s %q", name, raw)
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
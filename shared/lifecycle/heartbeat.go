@@ -0,0 +1,107 @@
+package lifecycle
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Heartbeat keeps a WebSocket connection's deadlines up to date.
+// It limits the size of inbound frames, pings the client at a fixed interval and
+// extends the read deadline whenever a pong arrives. A connection that stops answering
+// (for example a half-open TCP connection) hits its read deadline, which makes the
+// handler's blocked ReadMessage call return an error so the connection can be reaped.
+type Heartbeat struct {
+	conn     *websocket.Conn
+	config   Config
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Start applies the settings to the connection and starts pinging it.
+// It must be called before the handler's first ReadMessage. Zero values in config
+// disable the corresponding setting.
+//
+// Parameters:
+//   - conn: The upgraded WebSocket connection.
+//   - config: The keepalive and deadline settings.
+//
+// Returns:
+//   - The running Heartbeat; call Stop once the connection is done.
+func Start(conn *websocket.Conn, config Config) *Heartbeat {
+	h := &Heartbeat{
+		conn:   conn,
+		config: config,
+		done:   make(chan struct{}),
+	}
+
+	if config.MaxMessageSize > 0 {
+		conn.SetReadLimit(config.MaxMessageSize)
+	}
+	h.extendReadDeadline()
+	conn.SetPongHandler(func(string) error {
+		h.extendReadDeadline()
+		return nil
+	})
+
+	if config.PingInterval > 0 {
+		go h.pingLoop()
+	}
+	return h
+}
+
+// Stop stops pinging the connection. It is safe to call repeatedly.
+func (h *Heartbeat) Stop() {
+	h.stopOnce.Do(func() { close(h.done) })
+}
+
+// Close sends a close frame with the given status code and reason, bounded by the write timeout.
+// The caller still closes the connection itself once it stops reading.
+//
+// Parameters:
+//   - code: The WebSocket close code, e.g. websocket.ClosePolicyViolation.
+//   - text: The close reason sent to the client.
+func (h *Heartbeat) Close(code int, text string) {
+	if err := h.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), h.writeDeadline()); err != nil {
+		log.Printf("Error sending close frame: %v", err)
+	}
+}
+
+// writeDeadline returns the deadline for a write started now; the zero time means none.
+func (h *Heartbeat) writeDeadline() time.Time {
+	if h.config.WriteTimeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(h.config.WriteTimeout)
+}
+
+// extendReadDeadline gives the client another pong timeout to answer.
+// It is only called from the reading goroutine (directly or through the pong handler).
+func (h *Heartbeat) extendReadDeadline() {
+	if h.config.PongTimeout > 0 {
+		h.conn.SetReadDeadline(time.Now().Add(h.config.PongTimeout))
+	}
+}
+
+// pingLoop pings the client until the heartbeat is stopped. Pings are written with
+// WriteControl, which is safe to call concurrently with the connection's writer.
+// If a ping cannot be written the connection is closed, which unblocks the reader.
+func (h *Heartbeat) pingLoop() {
+	ticker := time.NewTicker(h.config.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			if err := h.conn.WriteControl(websocket.PingMessage, nil, h.writeDeadline()); err != nil {
+				log.Printf("Closing unresponsive connection: ping failed: %v", err)
+				h.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule is a token-bucket limit: Rate tokens are added per second, up to Burst.
+// A zero Rate disables the limit.
+type Rule struct {
+	Rate  float64 // Sustained requests per second.
+	Burst int     // Requests that may be made at once; defaults to 1.
+}
+
+// burst returns the bucket capacity, which is at least one token.
+func (r Rule) burst() int {
+	if r.Burst < 1 {
+		return 1
+	}
+	return r.Burst
+}
+
+// Config holds the rate limits of a service.
+type Config struct {
+	Rules           map[string]Rule // Limits per frame type.
+	Default         Rule            // Limit for frame types without a rule.
+	MaxViolations   int             // Rejections within ViolationWindow after which a caller is disconnected; zero never disconnects.
+	ViolationWindow time.Duration   // Window in which violations are counted.
+}
+
+// Rule returns the limit applying to the given frame type.
+func (c Config) Rule(frameType string) Rule {
+	if rule, ok := c.Rules[frameType]; ok {
+		return rule
+	}
+	return c.Default
+}
+
+// LoadConfig reads overrides of the given defaults from environment variables,
+// ignoring malformed values:
+//   - RATE_LIMITS: comma-separated "type=rate:burst" rules, e.g. "message=5:10,history=2:5".
+//     The type "*" sets the default rule.
+//   - RATE_LIMIT_MAX_VIOLATIONS: rejections after which a caller is disconnected (0 disables).
+//   - RATE_LIMIT_VIOLATION_WINDOW_MS: window in which violations are counted, in milliseconds.
+//
+// Parameters:
+//   - defaults: The service's built-in limits.
+//
+// Returns:
+//   - The effective Config.
+func LoadConfig(defaults Config) Config {
+	config := defaults
+	config.Rules = make(map[string]Rule, len(defaults.Rules))
+	for frameType, rule := range defaults.Rules {
+		config.Rules[frameType] = rule
+	}
+
+	if raw := os.Getenv("RATE_LIMITS"); raw != "" {
+		for _, entry := range strings.Split(raw, ",") {
+			frameType, rule, err := parseRule(strings.TrimSpace(entry))
+			if err != nil {
+				log.Printf("Ignoring invalid RATE_LIMITS entry %q", entry)
+				continue
+			}
+			if frameType == "*" {
+				config.Default = rule
+			} else {
+				config.Rules[frameType] = rule
+			}
+		}
+	}
+
+	if raw := os.Getenv("RATE_LIMIT_MAX_VIOLATIONS"); raw != "" {
+		if count, err := strconv.Atoi(raw); err == nil && count >= 0 {
+			config.MaxViolations = count
+		} else {
+			log.Printf("Ignoring invalid RATE_LIMIT_MAX_VIOLATIONS %q", raw)
+		}
+	}
+
+	if raw := os.Getenv("RATE_LIMIT_VIOLATION_WINDOW_MS"); raw != "" {
+		if ms, err := strconv.Atoi(raw); err == nil && ms > 0 {
+			config.ViolationWindow = time.Duration(ms) * time.Millisecond
+		} else {
+			log.Printf("Ignoring invalid RATE_LIMIT_VIOLATION_WINDOW_MS %q", raw)
+		}
+	}
+
+	return config
+}
+
+// parseRule parses a single "type=rate:burst" entry.
+func parseRule(entry string) (string, Rule, error) {
+	frameType, limit, found := strings.Cut(entry, "=")
+	if !found || frameType == "" {
+		return "", Rule{}, strconv.ErrSyntax
+	}
+	rawRate, rawBurst, _ := strings.Cut(limit, ":")
+	rate, err := strconv.ParseFloat(rawRate, 64)
+	if err != nil || rate < 0 {
+		return "", Rule{}, strconv.ErrSyntax
+	}
+	rule := Rule{Rate: rate, Burst: 1}
+	if rawBurst != "" {
+		if rule.Burst, err = strconv.Atoi(rawBurst); err != nil || rule.Burst < 1 {
+			return "", Rule{}, strconv.ErrSyntax
+		}
+	}
+	return frameType, rule, nil
+}
@@ -0,0 +1,176 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Decision is the outcome of a rate limit check.
+type Decision struct {
+	Allowed    bool          // Whether the request may proceed.
+	RetryAfter time.Duration // How long to wait before the next request can succeed; zero if allowed.
+	Disconnect bool          // Whether the caller has been limited often enough to be disconnected.
+}
+
+// bucket is a token bucket refilled continuously at its rule's rate.
+type bucket struct {
+	rule    Rule
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens earned since the last update, up to the burst.
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(b.rule.burst()), b.tokens+now.Sub(b.updated).Seconds()*b.rule.Rate)
+	b.updated = now
+}
+
+// offender tracks the recent violations of one key.
+type offender struct {
+	count int
+	since time.Time
+}
+
+// Limiter applies token-bucket limits keyed by caller and frame type.
+// It is safe for concurrent use, so a single Limiter can be shared by all connections
+// of a handler to limit a user across every socket they open.
+type Limiter struct {
+	config    Config
+	now       func() time.Time
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	offenders map[string]*offender
+	lastSweep time.Time
+}
+
+// sweepInterval is how often idle buckets and expired violations are dropped.
+const sweepInterval = time.Minute
+
+// NewLimiter creates a Limiter enforcing the given configuration.
+//
+// Parameters:
+//   - config: The per-frame-type rules and the disconnection policy.
+//
+// Returns:
+//   - A pointer to the new Limiter.
+func NewLimiter(config Config) *Limiter {
+	return NewLimiterWithClock(config, time.Now)
+}
+
+// NewLimiterWithClock creates a Limiter that reads the time from now, which lets tests
+// advance time deterministically.
+//
+// Parameters:
+//   - config: The per-frame-type rules and the disconnection policy.
+//   - now: The clock used to refill buckets.
+//
+// Returns:
+//   - A pointer to the new Limiter.
+func NewLimiterWithClock(config Config, now func() time.Time) *Limiter {
+	return &Limiter{
+		config:    config,
+		now:       now,
+		buckets:   make(map[string]*bucket),
+		offenders: make(map[string]*offender),
+		lastSweep: now(),
+	}
+}
+
+// Allow takes one token from the bucket of the caller for the given frame type.
+// Frame types without a rule fall back to the default rule; a rule with a zero rate
+// leaves the frame type unlimited. Every rejected request counts as a violation, and
+// reaching MaxViolations within ViolationWindow sets Decision.Disconnect.
+//
+// Parameters:
+//   - key: The caller, as returned by Key.
+//   - frameType: The kind of request, e.g. "message" or "query".
+//
+// Returns:
+//   - The Decision for this request.
+func (l *Limiter) Allow(key string, frameType string) Decision {
+	rule := l.config.Rule(frameType)
+	if rule.Rate <= 0 {
+		return Decision{Allowed: true}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	id := key + "|" + frameType
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{rule: rule, tokens: float64(rule.burst()), updated: now}
+		l.buckets[id] = b
+	}
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Decision{Allowed: true}
+	}
+
+	retryAfter := time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second))
+	return Decision{RetryAfter: retryAfter, Disconnect: l.recordViolation(key, now)}
+}
+
+// recordViolation counts a violation for key and reports whether it should be disconnected.
+// The caller must hold l.mu.
+func (l *Limiter) recordViolation(key string, now time.Time) bool {
+	if l.config.MaxViolations <= 0 {
+		return false
+	}
+	o, ok := l.offenders[key]
+	if !ok || now.Sub(o.since) > l.config.ViolationWindow {
+		o = &offender{since: now}
+		l.offenders[key] = o
+	}
+	o.count++
+	return o.count >= l.config.MaxViolations
+}
+
+// sweep drops buckets that have refilled completely and expired violations,
+// so the maps do not grow with every caller ever seen. The caller must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for id, b := range l.buckets {
+		// A full bucket is indistinguishable from a new one.
+		if b.refill(now); b.tokens >= float64(b.rule.burst()) {
+			delete(l.buckets, id)
+		}
+	}
+	for key, o := range l.offenders {
+		if now.Sub(o.since) > l.config.ViolationWindow {
+			delete(l.offenders, key)
+		}
+	}
+}
+
+// Key identifies the caller of a request: the authenticated user when there is one,
+// otherwise the remote IP address of the connection.
+//
+// Parameters:
+//   - userID: The authenticated user ID, or 0 for anonymous connections.
+//   - r: The handshake request.
+//
+// Returns:
+//   - The key to pass to Allow.
+func Key(userID int, r *http.Request) string {
+	if userID != 0 {
+		return "user:" + strconv.Itoa(userID)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
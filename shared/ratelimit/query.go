@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"log"
+	"time"
+
+	"shared/codec"
+	"shared/lifecycle"
+
+	"github.com/gorilla/websocket"
+)
+
+// QueryFrameType is the rate limit type of a search query.
+const QueryFrameType = "query"
+
+// ErrorFrame is sent to the client when a search query is rejected.
+type ErrorFrame struct {
+	Type  string    `json:"type"`  // Always "error".
+	Error ErrorBody `json:"error"` // The description of the failure.
+}
+
+// ErrorBody describes why a search query was rejected.
+type ErrorBody struct {
+	Code         string `json:"code"`                     // Machine-readable error code, e.g. "rate_limited".
+	Message      string `json:"message"`                  // Human-readable description.
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"` // Milliseconds to wait before retrying.
+}
+
+// DefaultQueryLimits returns the built-in query limits of the search sockets.
+//
+// Returns:
+//   - The default Config, to be overridden with LoadConfig.
+func DefaultQueryLimits() Config {
+	return Config{
+		Rules:           map[string]Rule{QueryFrameType: {Rate: 5, Burst: 10}},
+		MaxViolations:   20,
+		ViolationWindow: time.Minute,
+	}
+}
+
+// LimitQuery checks a search query against the caller's rate limit. Queries over the limit are
+// answered with a rate_limited error frame; repeat offenders are also sent a policy violation
+// close frame.
+//
+// Parameters:
+//   - limiter: The search socket's limiter; nil disables limiting.
+//   - conn: The connection the error frame is written to.
+//   - heartbeat: The connection's heartbeat, used to send the close frame.
+//   - key: The caller, as returned by Key.
+//
+// Returns:
+//   - The rate limit decision; always allowed when limiter is nil.
+func LimitQuery(limiter *Limiter, conn *codec.Conn, heartbeat *lifecycle.Heartbeat, key string) Decision {
+	if limiter == nil {
+		return Decision{Allowed: true}
+	}
+	decision := limiter.Allow(key, QueryFrameType)
+	if decision.Allowed {
+		return decision
+	}
+
+	log.Printf("Rate limited query from %s", key)
+	if err := conn.WriteJSON(ErrorFrame{
+		Type: "error",
+		Error: ErrorBody{
+			Code:         "rate_limited",
+			Message:      "rate limit exceeded",
+			RetryAfterMs: decision.RetryAfter.Milliseconds(),
+		},
+	}); err != nil {
+		log.Printf("Error sending rate limit error: %v", err)
+	}
+	if decision.Disconnect {
+		log.Printf("Disconnecting %s for repeatedly exceeding its rate limit", key)
+		heartbeat.Close(websocket.ClosePolicyViolation, "rate limit exceeded")
+	}
+	return decision
+}
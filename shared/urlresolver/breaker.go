@@ -0,0 +1,66 @@
+package urlresolver
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker guarding the media service. After FailureThreshold consecutive
+// failures it opens and rejects requests for Cooldown. Then a single probe request is let
+// through: its success closes the breaker, its failure opens it for another Cooldown.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+	failures  int       // Consecutive failures since the last success.
+	openUntil time.Time // End of the current cooldown; zero while the breaker is closed.
+	probing   bool      // Whether the probe request of a half-open breaker is in flight.
+}
+
+// allow reports whether a request may be sent to the media service.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.probing || b.now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record reports the outcome of a request that allow let through.
+func (b *breaker) record(success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if success {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold || !b.openUntil.IsZero() {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// release ends a request that allow let through without judging the media service,
+// e.g. because the caller gave up on it.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// open reports whether the breaker currently rejects requests.
+func (b *breaker) open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !b.openUntil.IsZero() && b.now().Before(b.openUntil)
+}
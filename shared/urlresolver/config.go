@@ -0,0 +1,77 @@
+package urlresolver
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the deadlines, cache and circuit breaker settings of a Resolver.
+type Config struct {
+	Timeout          time.Duration // Deadline of a single request to the media service.
+	Concurrency      int           // Largest number of requests in flight for one result set.
+	DefaultTTL       time.Duration // How long URLs without a recognizable expiry stay cached.
+	ExpiryMargin     time.Duration // URLs leave the cache this long before they expire.
+	MaxEntries       int           // Largest number of cached URLs.
+	FailureThreshold int           // Consecutive failed requests that open the circuit breaker.
+	Cooldown         time.Duration // How long an open breaker skips the media service before probing it again.
+	ServiceToken     string        // Token sent with every request to the media service.
+}
+
+// DefaultConfig returns the resolver settings used when nothing is configured.
+func DefaultConfig() Config {
+	return Config{
+		Timeout:          2 * time.Second,
+		Concurrency:      8,
+		DefaultTTL:       5 * time.Minute,
+		ExpiryMargin:     30 * time.Second,
+		MaxEntries:       10000,
+		FailureThreshold: 5,
+		Cooldown:         30 * time.Second,
+	}
+}
+
+// LoadConfig reads the resolver settings from environment variables, falling back to
+// DefaultConfig for unset or malformed values:
+//   - MEDIA_TIMEOUT_MS: deadline of a single request to the media service, in milliseconds.
+//   - MEDIA_CONCURRENCY: largest number of requests in flight for one result set.
+//   - MEDIA_CACHE_TTL_MS: lifetime of cached URLs without a recognizable expiry, in milliseconds.
+//   - MEDIA_BREAKER_THRESHOLD: consecutive failed requests that open the circuit breaker.
+//   - MEDIA_BREAKER_COOLDOWN_MS: how long an open breaker skips the media service, in milliseconds.
+//   - MEDIA_SERVICE_TOKEN: the token the media service expects with every request.
+func LoadConfig() Config {
+	config := DefaultConfig()
+
+	config.Timeout = durationFromEnv("MEDIA_TIMEOUT_MS", config.Timeout)
+	config.Concurrency = intFromEnv("MEDIA_CONCURRENCY", config.Concurrency)
+	config.DefaultTTL = durationFromEnv("MEDIA_CACHE_TTL_MS", config.DefaultTTL)
+	config.FailureThreshold = intFromEnv("MEDIA_BREAKER_THRESHOLD", config.FailureThreshold)
+	config.Cooldown = durationFromEnv("MEDIA_BREAKER_COOLDOWN_MS", config.Cooldown)
+	config.ServiceToken = os.Getenv("MEDIA_SERVICE_TOKEN")
+
+	return config
+}
+
+// durationFromEnv reads a positive number of milliseconds from the named variable.
+func durationFromEnv(name string, fallback time.Duration) time.Duration {
+	ms := intFromEnv(name, 0)
+	if ms == 0 {
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// intFromEnv reads a positive integer from the named variable.
+func intFromEnv(name string, fallback int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		log.Printf("Ignoring invalid %s %q", name, raw)
+		return fallback
+	}
+	return value
+}
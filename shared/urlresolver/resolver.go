@@ -0,0 +1,285 @@
+package urlresolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// errUnavailable marks failures that count against the media service: transport errors,
+// timeouts and server errors.
+var errUnavailable = errors.New("media service unavailable")
+
+// Resolver fetches presigned URLs from the media service for whole result sets at once.
+// Requests run concurrently, each with its own deadline, and their results are cached until
+// shortly before the URLs expire. While the media service keeps failing, a circuit breaker
+// skips it. URLs that cannot be resolved are left out of the result instead of blocking it.
+type Resolver struct {
+	Client  *http.Client // HTTP client used for the requests; deadlines are set per request.
+	config  Config
+	now     func() time.Time
+	mu      sync.Mutex       // Guards cache.
+	cache   map[string]entry // Resolved URLs, keyed by the request URL.
+	breaker *breaker
+}
+
+// entry is a cached result of the media service.
+type entry struct {
+	urls      []string
+	expiresAt time.Time
+}
+
+// response is the media service's reply. PRESIGNED_URL holds a single URL for avatars
+// and a list of URLs for the media of a place.
+type response struct {
+	Status       string          `json:"STATUS"`
+	PresignedURL json.RawMessage `json:"PRESIGNED_URL"`
+}
+
+// New creates a Resolver with the given settings.
+//
+// Parameters:
+//   - config: The deadlines, cache and circuit breaker settings.
+//
+// Returns:
+//   - A pointer to a newly created Resolver.
+func New(config Config) *Resolver {
+	defaults := DefaultConfig()
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaults.FailureThreshold
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaults.MaxEntries
+	}
+	return &Resolver{
+		Client:  &http.Client{},
+		config:  config,
+		now:     time.Now,
+		cache:   make(map[string]entry),
+		breaker: &breaker{threshold: config.FailureThreshold, cooldown: config.Cooldown, now: time.Now},
+	}
+}
+
+// Resolve fetches the presigned URLs behind the given request URLs, e.g. one avatar URL per
+// user of a search result. Cached results are served without a request; the others are fetched
+// concurrently. The call returns once every request finished or hit its deadline, or ctx is done.
+//
+// Parameters:
+//   - ctx: Bounds the whole call; the requests are cancelled when it is done.
+//   - urls: The request URLs of the media service; duplicates are fetched once.
+//
+// Returns:
+//   - The presigned URLs keyed by request URL. Request URLs that could not be resolved are missing.
+func (r *Resolver) Resolve(ctx context.Context, urls []string) map[string][]string {
+	results := make(map[string][]string, len(urls))
+	seen := make(map[string]bool, len(urls))
+	var pending []string
+	for _, requestURL := range urls {
+		if seen[requestURL] {
+			continue
+		}
+		seen[requestURL] = true
+		if cached, ok := r.cached(requestURL); ok {
+			results[requestURL] = cached
+			continue
+		}
+		pending = append(pending, requestURL)
+	}
+	if len(pending) == 0 || r.breaker.open() {
+		return results
+	}
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		slots = make(chan struct{}, r.config.Concurrency)
+	)
+	for _, requestURL := range pending {
+		wg.Add(1)
+		go func(requestURL string) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-ctx.Done():
+				return
+			}
+
+			resolved, ok := r.fetch(ctx, requestURL)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			results[requestURL] = resolved
+			mu.Unlock()
+		}(requestURL)
+	}
+	wg.Wait()
+	return results
+}
+
+// cached returns the cached result of a request URL, unless it expired.
+func (r *Resolver) cached(requestURL string) ([]string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cached, ok := r.cache[requestURL]
+	if !ok {
+		return nil, false
+	}
+	if !r.now().Before(cached.expiresAt) {
+		delete(r.cache, requestURL)
+		return nil, false
+	}
+	return cached.urls, true
+}
+
+// store caches a result until shortly before the earliest of its URLs expires.
+func (r *Resolver) store(requestURL string, urls []string) {
+	now := r.now()
+	expiresAt := now.Add(r.config.DefaultTTL)
+	for _, presigned := range urls {
+		if expiry, ok := expiryOf(presigned); ok && expiry.Before(expiresAt) {
+			expiresAt = expiry
+		}
+	}
+	expiresAt = expiresAt.Add(-r.config.ExpiryMargin)
+	if !expiresAt.After(now) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.cache) >= r.config.MaxEntries {
+		r.evictLocked(now)
+	}
+	r.cache[requestURL] = entry{urls: urls, expiresAt: expiresAt}
+}
+
+// evictLocked drops the expired entries, or an arbitrary entry if none expired.
+// The caller must hold r.mu.
+func (r *Resolver) evictLocked(now time.Time) {
+	for requestURL, cached := range r.cache {
+		if !now.Before(cached.expiresAt) {
+			delete(r.cache, requestURL)
+		}
+	}
+	for requestURL := range r.cache {
+		if len(r.cache) < r.config.MaxEntries {
+			return
+		}
+		delete(r.cache, requestURL)
+	}
+}
+
+// fetch requests a single URL, unless the circuit breaker is open, and records the outcome.
+func (r *Resolver) fetch(ctx context.Context, requestURL string) ([]string, bool) {
+	if !r.breaker.allow() {
+		return nil, false
+	}
+
+	urls, err := r.request(ctx, requestURL)
+	if ctx.Err() != nil {
+		// The caller gave up; that says nothing about the media service
+		r.breaker.release()
+		return nil, false
+	}
+	r.breaker.record(!errors.Is(err, errUnavailable))
+	if err != nil {
+		log.Printf("Error resolving %s: %v", requestURL, err)
+		return nil, false
+	}
+
+	r.store(requestURL, urls)
+	return urls, true
+}
+
+// request sends a single request to the media service under its own deadline.
+func (r *Resolver) request(ctx context.Context, requestURL string) ([]string, error) {
+	if r.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.config.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if r.config.ServiceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+r.config.ServiceToken)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, fmt.Errorf("%w: %s", errUnavailable, resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var body response
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("error decoding JSON: %w", err)
+	}
+	return decodeURLs(body.PresignedURL)
+}
+
+// decodeURLs reads PRESIGNED_URL, which is either a single URL or a list of URLs.
+func decodeURLs(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return []string{}, nil
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		if single == "" {
+			return []string{}, nil
+		}
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err != nil {
+		return nil, fmt.Errorf("error decoding PRESIGNED_URL: %w", err)
+	}
+	return list, nil
+}
+
+// expiryOf reads the expiry of a presigned URL from its query: X-Amz-Date and X-Amz-Expires
+// of S3 URLs, or a Unix time in Expires or expires.
+func expiryOf(presigned string) (time.Time, bool) {
+	parsed, err := url.Parse(presigned)
+	if err != nil {
+		return time.Time{}, false
+	}
+	query := parsed.Query()
+
+	if date, lifetime := query.Get("X-Amz-Date"), query.Get("X-Amz-Expires"); date != "" && lifetime != "" {
+		signedAt, err := time.Parse("20060102T150405Z", date)
+		seconds, convErr := strconv.Atoi(lifetime)
+		if err == nil && convErr == nil {
+			return signedAt.Add(time.Duration(seconds) * time.Second), true
+		}
+	}
+	for _, name := range []string{"Expires", "expires"} {
+		if raw := query.Get(name); raw != "" {
+			if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+				return time.Unix(seconds, 0), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,80 @@
+package presencecontroller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	Presence "user_search/models/presence"
+)
+
+// DefaultPresenceURL is the messenger engine's presence endpoint used when PRESENCE_URL is not set.
+const DefaultPresenceURL = "http://127.0.0.1:8440/presence"
+
+// HttpPresenceFetcher looks up the presence of users at the messenger engine's /presence endpoint.
+type HttpPresenceFetcher struct {
+	BaseURL string       // URL of the presence endpoint.
+	Client  *http.Client // HTTP client used for the lookups.
+}
+
+// NewHttpPresenceFetcher creates a fetcher for the endpoint named by PRESENCE_URL,
+// or DefaultPresenceURL when it is not set.
+//
+// Returns:
+//   - A pointer to a newly created HttpPresenceFetcher with a short request timeout.
+func NewHttpPresenceFetcher() *HttpPresenceFetcher {
+	baseURL := os.Getenv("PRESENCE_URL")
+	if baseURL == "" {
+		baseURL = DefaultPresenceURL
+	}
+	return &HttpPresenceFetcher{BaseURL: baseURL, Client: &http.Client{Timeout: 2 * time.Second}}
+}
+
+// Fetch looks up the presence of the given users on behalf of the caller.
+//
+// Parameters:
+//   - token: The caller's access token, forwarded to the messenger engine; may be empty.
+//   - userIds: IDs of the users to look up.
+//
+// Returns:
+//   - The presence of the users, keyed by user ID.
+//   - An error if the request fails or the response cannot be decoded.
+func (f *HttpPresenceFetcher) Fetch(token string, userIds []int) (map[int]Presence.Presence, error) {
+	ids := make([]string, len(userIds))
+	for i, userId := range userIds {
+		ids[i] = strconv.Itoa(userId)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, f.BaseURL+"?user_ids="+url.QueryEscape(strings.Join(ids, ",")), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	var response Presence.PresenceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("error decoding JSON: %v", err)
+	}
+
+	presence := make(map[int]Presence.Presence, len(response.Users))
+	for _, user := range response.Users {
+		presence[user.UserId] = user
+	}
+	return presence, nil
+}
@@ -1,15 +1,25 @@
 package usercontroller
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"user_search/controllers/base_controller"
-	"user_search/controllers/url_controller"
 )
 
+// AvatarServiceURL is the media service endpoint returning presigned URLs of user avatars.
+const AvatarServiceURL = "http://127.0.0.1:8165"
+
 type UserController struct {
 	baseCtrl *basecontroller.BaseController
+	Avatars  UrlResolver // Resolves the presigned URLs of avatars; nil leaves them empty
+}
+
+// UrlResolver fetches the presigned URLs of a whole result set at once.
+// It is implemented by *urlresolver.Resolver.
+type UrlResolver interface {
+	Resolve(ctx context.Context, urls []string) map[string][]string
 }
 
 type UserControllerInterface interface {
@@ -17,6 +27,7 @@ type UserControllerInterface interface {
 	GetUsersByUsername(username string) ([]byte, error)
 }
 
+// NewUserController creates a UserController without an avatar resolver; set Avatars to resolve them.
 func NewUserController(baseCtrl *basecontroller.BaseController) *UserController {
 	return &UserController{baseCtrl: baseCtrl}
 }
@@ -36,6 +47,7 @@ func (uc *UserController) GetUsers(userId int) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	uc.addAvatars(results)
 
 	return json.Marshal(results)
 }
@@ -55,6 +67,7 @@ func (uc *UserController) GetUsersByUsername(username string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	uc.addAvatars(results)
 
 	return json.Marshal(results)
 }
@@ -84,31 +97,37 @@ func scanUsers(rows *sql.Rows) ([]map[string]interface{}, error) {
 			"fullName":         fullName,
 			"hasActiveStories": hasActiveStories,
 			"commonFriends":    commonFriends,
+			"userAvatar":       "",
 		}
-
-		userDict["userAvatar"], _ = fetchAvatarURL(userid)
 		results = append(results, userDict)
 	}
 	return results, nil
 }
 
-// Helper to fetch avatar URL concurrently
-func fetchAvatarURL(userID int) (string, error) {
-	url := fmt.Sprintf("http://127.0.0.1:8165?user_id=%d", userID)
-	responseCh := make(chan *urlcontroller.UrlResponse)
-	errorCh := make(chan string)
-
-	fetcher := &urlcontroller.HttpPresignedUrlFetcher{}
-	go fetcher.Fetch(url)
+// addAvatars sets "userAvatar" of every user to the presigned URL of their avatar.
+// The avatars of all users are resolved at once; those that cannot be resolved stay empty.
+func (uc *UserController) addAvatars(users []map[string]interface{}) {
+	if uc.Avatars == nil || len(users) == 0 {
+		return
+	}
 
-	select {
-	case response := <-responseCh:
-		return response.PresignedURL, nil
-	case err := <-errorCh:
-		return "", fmt.Errorf("error fetching avatar: %s", err)
+	urls := make([]string, 0, len(users))
+	for _, user := range users {
+		urls = append(urls, avatarURL(user["userid"].(int)))
+	}
+	avatars := uc.Avatars.Resolve(context.Background(), urls)
+	for _, user := range users {
+		if resolved := avatars[avatarURL(user["userid"].(int))]; len(resolved) > 0 {
+			user["userAvatar"] = resolved[0]
+		}
 	}
 }
 
+// avatarURL returns the media service URL answering with the presigned URL of a user's avatar.
+func avatarURL(userID int) string {
+	return fmt.Sprintf("%s?user_id=%d", AvatarServiceURL, userID)
+}
+
 // Predefined SQL query strings
 func getMutualFriendsQuery() string {
 	return mutualFriendsQuery
@@ -0,0 +1,76 @@
+package websockethandler
+
+import (
+	"encoding/json"
+	"log"
+
+	Presence "user_search/models/presence"
+)
+
+// MaxPresenceUsers caps the number of users looked up with a single presence request.
+const MaxPresenceUsers = 200
+
+// PresenceFetcher looks up whether users are online and when they were last seen.
+// It is implemented by *presencecontroller.HttpPresenceFetcher.
+type PresenceFetcher interface {
+	Fetch(token string, userIds []int) (map[int]Presence.Presence, error)
+}
+
+// withPresence adds "online" and "lastSeen" to every user of a search result.
+// Results that are not a list of users, and results whose presence cannot be
+// fetched, are returned unchanged.
+//
+// Parameters:
+//   - jsonData: The search result as returned by the user controller.
+//   - token: The caller's access token, forwarded to the presence endpoint.
+//
+// Returns:
+//   - The search result, with presence where it was available.
+func (wsh *WebSocketHandler) withPresence(jsonData []byte, token string) []byte {
+	if wsh.Presence == nil {
+		return jsonData
+	}
+
+	var users []map[string]interface{}
+	if err := json.Unmarshal(jsonData, &users); err != nil || len(users) == 0 {
+		return jsonData
+	}
+
+	var userIds []int
+	for _, user := range users {
+		if id, ok := user["userid"].(float64); ok && len(userIds) < MaxPresenceUsers {
+			userIds = append(userIds, int(id))
+		}
+	}
+	if len(userIds) == 0 {
+		return jsonData
+	}
+
+	presence, err := wsh.Presence.Fetch(token, userIds)
+	if err != nil {
+		log.Printf("Error fetching presence: %v", err)
+		return jsonData
+	}
+
+	for _, user := range users {
+		id, ok := user["userid"].(float64)
+		if !ok {
+			continue
+		}
+		state, ok := presence[int(id)]
+		if !ok {
+			continue
+		}
+		user["online"] = state.Online
+		if state.LastSeenAt != nil {
+			user["lastSeen"] = state.LastSeenAt
+		}
+	}
+
+	annotated, err := json.Marshal(users)
+	if err != nil {
+		log.Printf("Error encoding search result: %v", err)
+		return jsonData
+	}
+	return annotated
+}
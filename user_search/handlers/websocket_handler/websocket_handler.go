@@ -7,6 +7,10 @@ import (
 	"strconv"
 	"strings"
 
+	"shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
+	"shared/ratelimit"
 	usercontroller "user_search/controllers/user_controller"
 
 	"github.com/gorilla/websocket"
@@ -19,8 +23,12 @@ type Message struct {
 
 // WebSocketHandler handles WebSocket connections.
 type WebSocketHandler struct {
-	upgrader websocket.Upgrader
-	userCtrl usercontroller.UserControllerInterface
+	upgrader      websocket.Upgrader
+	userCtrl      usercontroller.UserControllerInterface
+	Authenticator *auth.Authenticator // Verifies the handshake token; nil accepts unauthenticated clients.
+	Lifecycle     lifecycle.Config    // Heartbeat, deadline and frame size settings applied to every connection.
+	RateLimiter   *ratelimit.Limiter  // Limits queries per user (or remote IP); nil disables limiting.
+	Presence      PresenceFetcher     // Adds who is online to search results; nil leaves presence out.
 }
 
 // NewWebSocketHandler creates a new instance of WebSocketHandler.
@@ -30,31 +38,68 @@ func NewWebSocketHandler(userCtrl usercontroller.UserControllerInterface) *WebSo
 			// Allow all origins for simplicity. Adjust as needed for production.
 			CheckOrigin: func(r *http.Request) bool { return true },
 		},
-		userCtrl: userCtrl,
+		userCtrl:    userCtrl,
+		Lifecycle:   lifecycle.DefaultConfig(),
+		RateLimiter: ratelimit.NewLimiter(ratelimit.DefaultQueryLimits()),
 	}
 }
 
 // ServeHTTP handles HTTP requests and upgrades the connection to a WebSocket.
+// When an Authenticator is configured, handshakes without a valid token are rejected.
+// When a Presence fetcher is configured, every user in a result tells whether they are online.
 func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// Verify the access token before upgrading the connection.
+	var callerID int
+	if wsh.Authenticator != nil {
+		var err error
+		if callerID, err = wsh.Authenticator.Authenticate(r); err != nil {
+			log.Printf("Rejected unauthenticated connection: %v", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
 	// Upgrade the HTTP connection to a WebSocket connection.
-	conn, err := wsh.upgrader.Upgrade(w, r, nil)
+	ws, err := wsh.upgrader.Upgrade(w, r, codec.Negotiate(r))
 	if err != nil {
 		log.Printf("Error upgrading connection to WebSocket: %v", err)
 		return
 	}
-	defer conn.Close()
+	defer ws.Close()
+
+	// Ping the client and stop reading once it no longer answers.
+	heartbeat := lifecycle.Start(ws, wsh.Lifecycle)
+	defer heartbeat.Stop()
+
+	// Replies are encoded in the format negotiated through Sec-WebSocket-Protocol (JSON by default).
+	conn := codec.Wrap(ws)
+	conn.WriteTimeout = wsh.Lifecycle.WriteTimeout
+
+	// Queries are rate limited per authenticated user, or per remote IP for anonymous connections.
+	key := ratelimit.Key(callerID, r)
+
+	// The caller's token is forwarded to the presence lookups.
+	token := auth.TokenFromRequest(r)
 
 	for {
 		// Read message from WebSocket connection.
-		messageType, message, err := conn.ReadMessage()
+		_, message, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Error reading message: %v", err)
 			break
 		}
 
-		// Parse the JSON message.
+		// Reject queries over the rate limit, and disconnect callers that keep exceeding it.
+		if decision := ratelimit.LimitQuery(wsh.RateLimiter, conn, heartbeat, key); !decision.Allowed {
+			if decision.Disconnect {
+				break
+			}
+			continue
+		}
+
+		// Decode the message with the negotiated codec.
 		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
+		if err := conn.Codec.Unmarshal(message, &msg); err != nil {
 			log.Printf("Error parsing JSON: %v", err)
 			continue
 		}
@@ -66,7 +111,7 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				log.Printf("Error fetching users by ID: %v", err)
 				continue
 			}
-			if err := conn.WriteMessage(messageType, jsonData); err != nil {
+			if err := conn.WriteJSON(json.RawMessage(wsh.withPresence(jsonData, token))); err != nil {
 				log.Printf("Error sending message: %v", err)
 				break
 			}
@@ -83,7 +128,7 @@ func (wsh *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				log.Printf("Error fetching users by username: %v", err)
 				continue
 			}
-			if err := conn.WriteMessage(messageType, jsonData); err != nil {
+			if err := conn.WriteJSON(json.RawMessage(wsh.withPresence(jsonData, token))); err != nil {
 				log.Printf("Error sending message: %v", err)
 				break
 			}
@@ -0,0 +1,26 @@
+package presence
+
+import (
+	"time"
+)
+
+// Presence tells whether a user has at least one live connection to the messenger engine,
+// and when they were last seen.
+//
+// Fields:
+//   - UserId: ID of the user.
+//   - Online: Whether the user is connected right now.
+//   - LastSeenAt: When the user's last connection closed; nil if they were never seen.
+type Presence struct {
+	UserId     int        `json:"user_id"`
+	Online     bool       `json:"online"`
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// PresenceResponse is the body returned by the messenger engine's /presence endpoint.
+//
+// Fields:
+//   - Users: The presence of every requested user.
+type PresenceResponse struct {
+	Users []Presence `json:"users"`
+}
@@ -8,10 +8,15 @@ import (
 	"os/signal"
 	"syscall"
 
+	"shared/auth"
+	"shared/lifecycle"
+	"shared/ratelimit"
+	"shared/urlresolver"
 	"user_search/handlers/websocket_handler"
 	"user_search/modules/database/database_pool"
 
 	basecontroller "user_search/controllers/base_controller"
+	presencecontroller "user_search/controllers/presence_controller"
 	"user_search/controllers/user_controller"
 )
 
@@ -25,9 +30,20 @@ func main() {
 	// Initialize controllers
 	baseCtrl := basecontroller.NewBaseController(dbPool.GetDb())
 	userCtrl := usercontroller.NewUserController(baseCtrl)
+	userCtrl.Avatars = urlresolver.New(urlresolver.LoadConfig())
+
+	// Load the token verification settings for the WebSocket handshake
+	authConfig, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Error loading auth config: %v", err)
+	}
 
 	// Setup the WebSocket handler
 	wsHandler := websockethandler.NewWebSocketHandler(userCtrl)
+	wsHandler.Authenticator = auth.NewAuthenticator(authConfig)
+	wsHandler.Lifecycle = lifecycle.LoadConfig()
+	wsHandler.RateLimiter = ratelimit.NewLimiter(ratelimit.LoadConfig(ratelimit.DefaultQueryLimits()))
+	wsHandler.Presence = presencecontroller.NewHttpPresenceFetcher()
 
 	// Register the WebSocket handler at the root URL
 	http.Handle("/", wsHandler)
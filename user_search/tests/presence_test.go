@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	presencecontroller "user_search/controllers/presence_controller"
+	websockethandler "user_search/handlers/websocket_handler"
+	"user_search/models/presence"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// stubPresenceFetcher reports the users listed in it as online.
+type stubPresenceFetcher map[int]bool
+
+func (s stubPresenceFetcher) Fetch(token string, userIds []int) (map[int]presence.Presence, error) {
+	result := make(map[int]presence.Presence, len(userIds))
+	for _, userId := range userIds {
+		result[userId] = presence.Presence{UserId: userId, Online: s[userId]}
+	}
+	return result, nil
+}
+
+// TestHttpPresenceFetcher_Fetch verifies that lookups forward the caller's token and decode the presence.
+func TestHttpPresenceFetcher_Fetch(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret-token", r.Header.Get("Authorization"))
+		require.Equal(t, "1,2", r.URL.Query().Get("user_ids"))
+		fmt.Fprintln(w, `{"users": [{"user_id": 1, "online": true}, {"user_id": 2, "online": false, "last_seen_at": "2024-01-02T03:04:05Z"}]}`)
+	}))
+	defer ts.Close()
+
+	fetcher := &presencecontroller.HttpPresenceFetcher{BaseURL: ts.URL, Client: ts.Client()}
+	result, err := fetcher.Fetch("secret-token", []int{1, 2})
+	require.NoError(t, err)
+	require.True(t, result[1].Online)
+	require.False(t, result[2].Online)
+	require.NotNil(t, result[2].LastSeenAt)
+}
+
+// TestHttpPresenceFetcher_ErrorStatus verifies that rejected lookups are reported as errors.
+func TestHttpPresenceFetcher_ErrorStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer ts.Close()
+
+	fetcher := &presencecontroller.HttpPresenceFetcher{BaseURL: ts.URL, Client: ts.Client()}
+	_, err := fetcher.Fetch("", []int{1})
+	require.Error(t, err)
+}
+
+// TestWebSocketHandler_Presence verifies that search results tell which users are online.
+func TestWebSocketHandler_Presence(t *testing.T) {
+	mockCtrl := new(MockUserController)
+	mockCtrl.Mock.On("GetUsersByUsername", "jo").Return([]byte(`[{"userid": 1, "username": "john"}, {"userid": 2, "username": "joe"}]`), nil)
+
+	handler := websockethandler.NewWebSocketHandler(mockCtrl)
+	handler.Presence = stubPresenceFetcher{1: true}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	require.NoError(t, conn.WriteJSON(websockethandler.Message{Query: "jo"}))
+
+	_, response, err := conn.ReadMessage()
+	require.NoError(t, err)
+
+	var users []map[string]interface{}
+	require.NoError(t, json.Unmarshal(response, &users))
+	require.Len(t, users, 2)
+	require.Equal(t, true, users[0]["online"])
+	require.Equal(t, false, users[1]["online"])
+
+	mockCtrl.Mock.AssertExpectations(t)
+}
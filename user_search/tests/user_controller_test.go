@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -95,3 +96,45 @@ func TestGetUsersByUsername_DBError(t *testing.T) {
 	require.Error(t, err)
 	require.Nil(t, res)
 }
+
+// stubAvatarResolver resolves every avatar URL except the listed ones.
+type stubAvatarResolver struct {
+	calls   int
+	missing map[string]bool
+}
+
+func (s *stubAvatarResolver) Resolve(ctx context.Context, urls []string) map[string][]string {
+	s.calls++
+	resolved := make(map[string][]string, len(urls))
+	for _, url := range urls {
+		if !s.missing[url] {
+			resolved[url] = []string{"https://cdn.example.com/avatar.jpg"}
+		}
+	}
+	return resolved
+}
+
+// TestGetUsersByUsername_Avatars verifies that the avatars of a whole result are resolved at
+// once and that avatars which cannot be resolved are left empty.
+func TestGetUsersByUsername_Avatars(t *testing.T) {
+	db, mock, userCtrl := setupMockDB(t)
+	defer db.Close()
+
+	resolver := &stubAvatarResolver{missing: map[string]bool{usercontroller.AvatarServiceURL + "?user_id=2": true}}
+	userCtrl.Avatars = resolver
+
+	rows := sqlmock.NewRows([]string{"userid", "username", "verifiedAccount", "fullName", "hasActiveStories", "userAvatar", "commonFriends"}).
+		AddRow(1, "john_doe", true, "John Doe", true, "", "[]").
+		AddRow(2, "jane_doe", false, "Jane Doe", false, "", "[]")
+	mock.ExpectQuery("SELECT").WithArgs("jo").WillReturnRows(rows)
+
+	res, err := userCtrl.GetUsersByUsername("jo")
+	require.NoError(t, err)
+
+	var users []map[string]interface{}
+	require.NoError(t, json.Unmarshal(res, &users))
+	require.Len(t, users, 2)
+	require.Equal(t, "https://cdn.example.com/avatar.jpg", users[0]["userAvatar"])
+	require.Equal(t, "", users[1]["userAvatar"])
+	require.Equal(t, 1, resolver.calls)
+}
@@ -2,11 +2,15 @@ package tests
 
 import (
 	"encoding/json"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"shared/auth"
+	"shared/codec"
+	"shared/lifecycle"
 	websockethandler "user_search/handlers/websocket_handler"
 
 	"github.com/gorilla/websocket"
@@ -154,4 +158,77 @@ func TestWebSocketHandler_EmptyUsername(t *testing.T) {
 	require.Error(t, err)
 
 	mockCtrl.Mock.AssertExpectations(t)
-}
\ No newline at end of file
+}
+
+// TestWebSocketHandler_Msgpack tests that a client negotiating msgpack.v1 can query in MessagePack
+// and receives the user data transcoded into a binary MessagePack frame.
+func TestWebSocketHandler_Msgpack(t *testing.T) {
+	mockCtrl := new(MockUserController)
+	mockCtrl.Mock.On("GetUsersByUsername", "JaneDoe").Return([]byte(`{"id": 2, "name": "Jane Doe"}`), nil)
+
+	wsURL, closeServer := setupTestServer(t, mockCtrl)
+	defer closeServer()
+
+	dialer := websocket.Dialer{Subprotocols: []string{codec.MsgpackSubprotocol, codec.JSONSubprotocol}}
+	conn, _, err := dialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, codec.MsgpackSubprotocol, conn.Subprotocol())
+
+	reqBytes, err := codec.Msgpack.Marshal(websockethandler.Message{Query: "JaneDoe"})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, reqBytes))
+
+	messageType, response, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, messageType)
+
+	var user map[string]interface{}
+	require.NoError(t, codec.Msgpack.Unmarshal(response, &user))
+	require.Equal(t, "Jane Doe", user["name"])
+
+	mockCtrl.Mock.AssertExpectations(t)
+}
+
+// TestWebSocketHandler_RequiresToken tests that, with an Authenticator configured, the handshake
+// is rejected without a token and accepted when a correctly signed bearer token is sent.
+func TestWebSocketHandler_RequiresToken(t *testing.T) {
+	config := &auth.Config{Secret: []byte("test-secret")}
+	handler := websockethandler.NewWebSocketHandler(new(MockUserController))
+	handler.Authenticator = auth.NewAuthenticator(config)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	wsURL := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	token, err := auth.SignToken(auth.Claims{UserId: 1, ExpiresAt: time.Now().Add(time.Hour).Unix()}, config.Secret)
+	require.NoError(t, err)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"Authorization": {"Bearer " + token}})
+	require.NoError(t, err)
+	conn.Close()
+}
+
+// TestWebSocketHandler_ReapsSilentConnection tests that the server closes a connection whose client
+// stops answering pings, instead of blocking on it forever.
+func TestWebSocketHandler_ReapsSilentConnection(t *testing.T) {
+	handler := websockethandler.NewWebSocketHandler(new(MockUserController))
+	handler.Lifecycle = lifecycle.Config{PingInterval: 20 * time.Millisecond, PongTimeout: 100 * time.Millisecond, WriteTimeout: 100 * time.Millisecond}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Not reading means the client never answers the server's pings.
+	time.Sleep(300 * time.Millisecond)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	require.Error(t, err)
+	netErr, isNetErr := err.(interface{ Timeout() bool })
+	require.False(t, isNetErr && netErr.Timeout(), "expected the server to close the connection, got %v", err)
+}